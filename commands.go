@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a subcommand: its name as the first argument, and what it
+// does with the arguments after that. Each parses its own flags along with
+// the statusline's (see config.ParseArgs).
+type command struct {
+	name    string
+	usage   string // arguments, for the command list
+	summary string
+	run     func(args []string)
+}
+
+// commands lists the subcommands, the default first. Aliases are left out
+// of the list.
+func commands() []command {
+	return []command{
+		{"status", "[flags]", "Render the statusline from Claude Code's session input on stdin (default)", runStatus},
+		{"report", "[weekly] [--days N] [--format F]", "Cost history per day, or a summary of the last seven days", handleReport},
+		{"export", "[--from DATE] [--to DATE] [--format F]", "Costs per day, project and model from the logs", handleExport},
+		{"cost", "report [--unknown-models]", "Daily, weekly and monthly cost totals and forecast", handleCost},
+		{"doctor", "[flags]", "Check the installation, configuration and cache", handleDoctor},
+		{"init", "[--binary PATH] [--dry-run]", "Configure Claude Code to run this statusline", handleInit},
+		{"preview", "[--scenario S] [--modes M] [--themes T]", "Render sample sessions in every display mode and theme", handlePreview},
+		{"update", "[--to VERSION | --rollback]", "Update to the latest release, a given version, or back to the previous one", handleUpdate},
+		{"cache", "dir | purge --before DATE", "Show the cache directory or remove old data from it", handleCache},
+		{"config", "check | print", "Report invalid options, or print every option and its source", handleConfig},
+		{"note", "[--session ID] [TEXT]", "Add a note to the session, or list its notes", handleNote},
+		{"transcript", "stats [--session ID]", "Session cost per todo", handleTranscript},
+		{"pricing", "verify [--url URL]", "Compare the model pricing with the published pricing", handlePricing},
+		{"telemetry", "preview", "Show what an opt-in telemetry report contains", handleTelemetry},
+		{"help", "", "List the commands", func([]string) { printCommands(os.Stdout) }},
+	}
+}
+
+// aliases are other names of commands
+var aliases = map[string]string{
+	"purge": "cache purge",
+}
+
+// findCommand returns the command args name and the arguments for it. The
+// statusline itself runs when the first argument is a flag or missing.
+func findCommand(args []string) (command, []string, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commands()[0], args, true
+	}
+	name, rest := args[0], args[1:]
+	if alias, ok := aliases[name]; ok {
+		fields := strings.Fields(alias)
+		name, rest = fields[0], append(fields[1:], rest...)
+	}
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd, rest, true
+		}
+	}
+	return command{}, nil, false
+}
+
+// printCommands writes the command list
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Usage: claude-code-statusline [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands() {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.usage, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command takes the statusline flags (see: claude-code-statusline --help).")
+}
+
+// statusUsage prints the command list and the statusline flags, for
+// --help
+func statusUsage(fs *flag.FlagSet) func() {
+	return func() {
+		printCommands(fs.Output())
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+}
+
+// main runs the command named by the first argument, the statusline if
+// there is none
+func main() {
+	cmd, args, ok := findCommand(os.Args[1:])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", os.Args[1])
+		printCommands(os.Stderr)
+		os.Exit(2)
+	}
+	cmd.run(args)
+}
@@ -0,0 +1,414 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/output"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// Version is the bundle format version
+const Version = 1
+
+// anonymousHome replaces the user's home directory in recorded paths
+const anonymousHome = "/home/user"
+
+// redacted replaces the values of privateOptions in bundles
+const redacted = "REDACTED"
+
+// privateOptions hold secrets or account details: bundles record that they
+// were set, but not their values
+var privateOptions = map[string]bool{
+	"webhook":           true,
+	"otlp-endpoint":     true,
+	"otlp-headers":      true,
+	"api-base":          true,
+	"update-public-key": true,
+}
+
+// commandOptions hold shell commands, which may carry tokens: bundles keep
+// the segment names the render needs, but not the commands.
+// custom-segments is how CLAUDE_STATUS_CUSTOM_SEGMENTS maps to an option.
+var commandOptions = map[string]bool{
+	"custom-segment":  true,
+	"custom-segments": true,
+}
+
+// localOptions don't shape the render, only what happens on the recording
+// machine, and are left out of bundles. The value is whether the option
+// takes a value (as opposed to a boolean flag). config, profiles and
+// no-telemetry are only set in the environment.
+var localOptions = map[string]bool{
+	"record":         true,
+	"replay":         true,
+	"cache-dir":      true,
+	"data-dir":       true,
+	"profile":        true,
+	"debug":          false,
+	"log-level":      true,
+	"auto-update":    false,
+	"update-ttl":     true,
+	"update-channel": true,
+	"update-pin":     true,
+	"telemetry":      false,
+	"refresh-token":  false,
+	"config":         true,
+	"profiles":       true,
+	"no-telemetry":   true,
+}
+
+// Bundle is everything needed to reproduce a render: the flags and
+// environment it ran with, the collected data and the time it rendered at
+type Bundle struct {
+	Version    int               `json:"version"`
+	RecordedAt time.Time         `json:"recorded_at"`
+	Args       []string          `json:"args"`
+	Env        map[string]string `json:"env,omitempty"`
+	Options    map[string]any    `json:"options,omitempty"` // from the options file
+	Home       string            `json:"home"`
+	Data       *types.StatusData `json:"data"`
+
+	// UsageCache keeps these out of its JSON, so they are stored separately
+	UsageStale       bool `json:"usage_stale,omitempty"`
+	UsageUnavailable bool `json:"usage_unavailable,omitempty"`
+
+	// Output is the expected render of the (anonymized) data
+	Output string `json:"output"`
+}
+
+// New captures a render of data at the given time. The data is anonymized:
+// paths, branch names, commit subjects, tool targets, agent descriptions and
+// todo subjects keep their length and punctuation but their letters and
+// digits are masked.
+// Output is the render of the anonymized data, which replays must reproduce.
+func New(args []string, data *types.StatusData, at time.Time) *Bundle {
+	b := &Bundle{
+		Version:    Version,
+		RecordedAt: at,
+		Args:       args,
+		Env:        statusEnv(),
+		Options:    fileOptions(),
+		Home:       anonymousHome,
+		Data:       anonymize(data),
+	}
+	if data.Usage != nil {
+		b.UsageStale, b.UsageUnavailable = data.Usage.Stale, data.Usage.Unavailable
+	}
+	b.Output = b.Replay()
+	return b
+}
+
+// Save writes the bundle as indented JSON
+func (b *Bundle) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), config.PrivateFileMode)
+}
+
+// Load reads a bundle written by Save
+func Load(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if b.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	if b.Data == nil {
+		b.Data = &types.StatusData{}
+	}
+	if b.Data.Usage != nil {
+		b.Data.Usage.Stale, b.Data.Usage.Unavailable = b.UsageStale, b.UsageUnavailable
+	}
+	return &b, nil
+}
+
+// Replay renders the bundle with its recorded flags, environment and clock.
+// It replaces the process environment and global configuration.
+func (b *Bundle) Replay() string {
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); strings.HasPrefix(key, "CLAUDE_STATUS_") {
+			os.Unsetenv(key)
+		}
+	}
+	for key, value := range b.Env {
+		os.Setenv(key, value)
+	}
+	os.Setenv("HOME", b.Home)
+
+	// Only the recorded options apply, never the replaying machine's file
+	os.Unsetenv("XDG_CONFIG_HOME")
+	options := b.Options
+	if options == nil {
+		options = map[string]any{}
+	}
+	if file, err := os.CreateTemp("", "statusline-options-*.json"); err == nil {
+		data, _ := json.Marshal(options)
+		file.Write(data)
+		file.Close()
+		defer os.Remove(file.Name())
+		os.Setenv("CLAUDE_STATUS_CONFIG", file.Name())
+	}
+
+	// Recorded flags were accepted when recorded, so errors aren't expected
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(new(strings.Builder))
+	config.ParseArgs(fs, b.Args)
+
+	output.SetClock(func() time.Time { return b.RecordedAt })
+	defer output.SetClock(time.Now)
+
+	if config.Get().Output == "json" {
+		return output.FormatJSON(b.Data)
+	}
+	return output.Format(b.Data)
+}
+
+// RecordingArgs returns the flags in args that shape the render, for a
+// bundle: without localOptions (like --record and --replay) and with the
+// values of privateOptions redacted
+func RecordingArgs(args []string) []string {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") || args[i] == "--" {
+			kept = append(kept, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if takesValue, ok := localOptions[name]; ok {
+			if takesValue && !hasValue {
+				i++ // skip the value
+			}
+			continue
+		}
+		if privateOptions[name] {
+			kept = append(kept, "--"+name+"="+redacted)
+			if !hasValue {
+				i++
+			}
+			continue
+		}
+		if commandOptions[name] {
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			kept = append(kept, "--"+name+"="+redactCommands(value))
+			continue
+		}
+		kept = append(kept, args[i])
+	}
+	return kept
+}
+
+// statusEnv returns the CLAUDE_STATUS_* environment variables that shape
+// the render, with the values of privateOptions redacted
+func statusEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, "CLAUDE_STATUS_") {
+			continue
+		}
+		option := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(key, "CLAUDE_STATUS_"), "_", "-"))
+		switch {
+		case privateOptions[option]:
+			env[key] = redacted
+		case commandOptions[option]:
+			env[key] = redactCommands(value)
+		case !isLocal(option):
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// fileOptions returns the settings of the options file that shape the
+// render, filtered like statusEnv
+func fileOptions() map[string]any {
+	data, err := os.ReadFile(config.ConfigFile())
+	if err != nil {
+		return nil
+	}
+	var options map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if dec.Decode(&options) != nil {
+		return nil
+	}
+	for name, v := range options {
+		switch {
+		case isLocal(name):
+			delete(options, name)
+		case privateOptions[name]:
+			options[name] = redacted
+		case commandOptions[name]:
+			options[name] = redactCommandValue(v)
+		}
+	}
+	return options
+}
+
+// redactCommandValue redacts the custom segments of an options file entry:
+// a name=command string, a list of them, or an object of commands by name
+func redactCommandValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		return redactCommands(v)
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = redactCommandValue(item)
+		}
+		return items
+	case map[string]any:
+		commands := make(map[string]any, len(v))
+		for name := range v {
+			commands[name] = redacted
+		}
+		return commands
+	}
+	return redacted
+}
+
+// redactCommands replaces the commands of name=command custom segments,
+// one per line, keeping their names
+func redactCommands(value string) string {
+	lines := strings.Split(value, "\n")
+	for i, line := range lines {
+		if name, _, ok := strings.Cut(line, "="); ok {
+			lines[i] = name + "=" + redacted
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isLocal reports whether an option is one of localOptions
+func isLocal(option string) bool {
+	_, ok := localOptions[option]
+	return ok
+}
+
+// anonymize returns a copy of data with identifying text masked
+func anonymize(data *types.StatusData) *types.StatusData {
+	anon := *data
+	anon.Sources = nil
+
+	cwd := data.Cwd
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	anon.Cwd = anonymizePath(cwd, config.HomeDir())
+	anon.Project = mask(data.Project)
+	anon.Profile = mask(data.Profile)
+
+	if data.Session != nil {
+		sess := *data.Session
+		sess.SessionID = mask(sess.SessionID)
+		sess.Cwd = anonymizePath(sess.Cwd, config.HomeDir())
+		if sess.Workspace != nil {
+			sess.Workspace = &types.Workspace{
+				CurrentDir: anonymizePath(sess.Workspace.CurrentDir, config.HomeDir()),
+				ProjectDir: anonymizePath(sess.Workspace.ProjectDir, config.HomeDir()),
+			}
+		}
+		if sess.TranscriptPath != "" {
+			sess.TranscriptPath = "transcript.jsonl"
+		}
+		anon.Session = &sess
+	}
+
+	// Session costs are keyed by session ID: keep only this session's,
+	// under its masked ID, so the session segment still renders
+	if data.Stats != nil {
+		stats := *data.Stats
+		stats.SessionCosts = nil
+		if data.Session != nil {
+			if c, ok := data.Stats.SessionCosts[data.Session.SessionID]; ok {
+				stats.SessionCosts = map[string]float64{mask(data.Session.SessionID): c}
+			}
+		}
+		anon.Stats = &stats
+	}
+
+	anon.Git.Branch = mask(data.Git.Branch)
+	anon.Git.LastSubject = mask(data.Git.LastSubject)
+	anon.Git.Scope = mask(data.Git.Scope)
+
+	if data.Transcript != nil {
+		t := *data.Transcript
+		t.Tools = make([]types.ToolEntry, len(data.Transcript.Tools))
+		for i, tool := range data.Transcript.Tools {
+			tool.ID = ""
+			tool.Target = mask(tool.Target)
+			t.Tools[i] = tool
+		}
+		t.Agents = make([]types.AgentEntry, len(data.Transcript.Agents))
+		for i, agent := range data.Transcript.Agents {
+			agent.ID = ""
+			agent.Description = mask(agent.Description)
+			t.Agents[i] = agent
+		}
+		t.Todos = make([]types.TodoItem, len(data.Transcript.Todos))
+		for i, todo := range data.Transcript.Todos {
+			todo.Subject = mask(todo.Subject)
+			t.Todos[i] = todo
+		}
+		anon.Transcript = &t
+	}
+
+	if data.Note != nil {
+		note := *data.Note
+		note.Text = mask(note.Text)
+		anon.Note = &note
+	}
+
+	if data.Custom != nil {
+		anon.Custom = make(map[string]string, len(data.Custom))
+		for name, output := range data.Custom {
+			anon.Custom[name] = mask(output)
+		}
+	}
+
+	return &anon
+}
+
+// anonymizePath moves path under the anonymous home and masks its elements
+func anonymizePath(path, home string) string {
+	if path == "" {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(path, home); home != "" && ok && (rest == "" || rest[0] == '/' || rest[0] == filepath.Separator) {
+		return anonymousHome + filepath.ToSlash(mask(rest))
+	}
+	return filepath.ToSlash(mask(path))
+}
+
+// mask replaces letters and digits, keeping length and punctuation so
+// layout and parsing bugs still reproduce
+func mask(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r):
+			return 'x'
+		case unicode.IsDigit(r):
+			return '0'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,261 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// TestRegressionCorpus replays every recorded bundle in testdata and checks
+// it still renders exactly what was recorded. To add a user report, drop the
+// bundle from --record into testdata.
+func TestRegressionCorpus(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no bundles in testdata")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			b, err := Load(file)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := b.Replay(); got != b.Output {
+				t.Errorf("replay differs from recording\ngot:  %q\nwant: %q", got, b.Output)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLAUDE_STATUS_INFO_MODE", "text")
+
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+	data := &types.StatusData{
+		Cwd:     filepath.Join(home, "work", "acme"),
+		Session: &types.SessionInput{Model: &types.SessionModel{DisplayName: "Sonnet 4.5"}, SessionID: "abc123"},
+		Git:     types.GitInfo{IsRepo: true, Branch: "fix/login-42", Staged: 1},
+		Usage:   &types.UsageCache{UsagePercent: 80, ResetTime: at.Add(time.Hour)},
+		Stats:   &types.TokenStats{DailyCost: 1.5},
+		Sources: map[string]string{"git": "collected in 3ms"},
+	}
+
+	b := New([]string{"--no-color"}, data, at)
+	if b.Env["CLAUDE_STATUS_INFO_MODE"] != "text" {
+		t.Errorf("Env = %v, want CLAUDE_STATUS_INFO_MODE recorded", b.Env)
+	}
+	if strings.Contains(b.Output, "acme") || strings.Contains(b.Output, "login") {
+		t.Errorf("Output not anonymized: %q", b.Output)
+	}
+	if !strings.Contains(b.Output, "80%") {
+		t.Errorf("Output = %q, want usage 80%%", b.Output)
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	if err := b.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	t.Setenv("CLAUDE_STATUS_INFO_MODE", "emoji")
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := loaded.Replay(); got != b.Output {
+		t.Errorf("Replay() = %q, want %q", got, b.Output)
+	}
+}
+
+func TestRoundTripOptionsFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configDir := filepath.Join(t.TempDir(), "xdg")
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("CLAUDE_STATUS_CONFIG", "")
+	configFile := filepath.Join(configDir, "claude-code-statusline", "config.json")
+	os.MkdirAll(filepath.Dir(configFile), 0700)
+	os.WriteFile(configFile, []byte(`{"info-mode": "text", "webhook": "https://hooks.example/T0/secret",
+		"cache-dir": "/home/jane/.cache", "custom-segment": {"k8s": "kubectl --token=s3cret config current-context"}}`), 0600)
+
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+	data := &types.StatusData{Cwd: "/srv/repo", Usage: &types.UsageCache{UsagePercent: 80, ResetTime: at.Add(time.Hour)}}
+	b := New([]string{"--no-color"}, data, at)
+	want := map[string]any{"info-mode": "text", "webhook": redacted, "custom-segment": map[string]any{"k8s": redacted}}
+	if !reflect.DeepEqual(b.Options, want) {
+		t.Errorf("Options = %v, want %v", b.Options, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := os.ReadFile(path); strings.Contains(string(saved), "s3cret") || strings.Contains(string(saved), "jane") {
+		t.Errorf("bundle holds private options: %s", saved)
+	}
+
+	// The replaying machine's own options file is ignored
+	os.WriteFile(configFile, []byte(`{"info-mode": "emoji"}`), 0600)
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Replay(); got != b.Output {
+		t.Errorf("Replay() = %q, want %q", got, b.Output)
+	}
+	loaded.Options = nil
+	if got := loaded.Replay(); got == b.Output {
+		t.Errorf("Replay() without the recorded options = %q, want it to differ", got)
+	}
+}
+
+func TestAnonymizeLastCommit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+	committed := at.Add(-2 * time.Hour)
+	data := &types.StatusData{
+		Cwd: "/srv/repo",
+		Git: types.GitInfo{IsRepo: true, Branch: "main", LastCommit: &committed, LastSubject: "Fix login redirect"},
+	}
+
+	b := New([]string{"--no-color", "--git-last-commit"}, data, at)
+	if got := b.Data.Git.LastSubject; got != "xxx xxxxx xxxxxxxx" {
+		t.Errorf("LastSubject = %q, want it masked", got)
+	}
+	if strings.Contains(b.Output, "login") || !strings.Contains(b.Output, "xxx xxxxx") {
+		t.Errorf("Output = %q, want the masked subject", b.Output)
+	}
+}
+
+func TestAnonymizeSessionCosts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+	data := &types.StatusData{
+		Cwd:     "/srv/repo",
+		Session: &types.SessionInput{SessionID: "abc-123"},
+		Stats:   &types.TokenStats{SessionCosts: map[string]float64{"abc-123": 1.84, "other-999": 3}},
+	}
+
+	b := New([]string{"--no-color", "--show-session", "--segments=session"}, data, at)
+	if want := map[string]float64{"xxx-000": 1.84}; !reflect.DeepEqual(b.Data.Stats.SessionCosts, want) {
+		t.Errorf("SessionCosts = %v, want %v", b.Data.Stats.SessionCosts, want)
+	}
+	if !strings.Contains(b.Output, "$1.84/s") {
+		t.Errorf("Output = %q, want the session cost", b.Output)
+	}
+	if data.Stats.SessionCosts["other-999"] != 3 {
+		t.Error("anonymize changed the recorded data")
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := os.ReadFile(path)
+	if strings.Contains(string(saved), "abc-123") || strings.Contains(string(saved), "other-999") {
+		t.Errorf("bundle holds real session IDs: %s", saved)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Replay(); got != b.Output {
+		t.Errorf("Replay() = %q, want %q", got, b.Output)
+	}
+}
+
+func TestPrivateOptionsRedacted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	secrets := map[string]string{
+		"CLAUDE_STATUS_WEBHOOK":           "https://hooks.example/T0/secret",
+		"CLAUDE_STATUS_OTLP_HEADERS":      "Authorization=Bearer xyz",
+		"CLAUDE_STATUS_API_BASE":          "https://gw.corp.example",
+		"CLAUDE_STATUS_UPDATE_PUBLIC_KEY": "RWQBAgMEBQYHCA",
+	}
+	for key, value := range secrets {
+		t.Setenv(key, value)
+	}
+	t.Setenv("CLAUDE_STATUS_CACHE_DIR", "/home/jane/.cache/statusline")
+	t.Setenv("CLAUDE_STATUS_INFO_MODE", "text")
+	t.Setenv("CLAUDE_STATUS_CUSTOM_SEGMENTS", "k8s=kubectl --token=s3cret config current-context\nvpn=vpnctl status")
+
+	args := RecordingArgs([]string{"--webhook", secrets["CLAUDE_STATUS_WEBHOOK"], "--update-public-key=" + secrets["CLAUDE_STATUS_UPDATE_PUBLIC_KEY"], "--no-color"})
+	b := New(args, &types.StatusData{Cwd: "/srv/repo"}, time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC))
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := os.ReadFile(path)
+	for key, value := range secrets {
+		if strings.Contains(string(saved), value) {
+			t.Errorf("bundle holds the value of %s", key)
+		}
+		if b.Env[key] != redacted {
+			t.Errorf("Env[%s] = %q, want it redacted", key, b.Env[key])
+		}
+	}
+	if strings.Contains(string(saved), "s3cret") || b.Env["CLAUDE_STATUS_CUSTOM_SEGMENTS"] != "k8s=REDACTED\nvpn=REDACTED" {
+		t.Errorf("Env[CLAUDE_STATUS_CUSTOM_SEGMENTS] = %q, want the commands redacted", b.Env["CLAUDE_STATUS_CUSTOM_SEGMENTS"])
+	}
+	if strings.Contains(string(saved), "jane") || b.Env["CLAUDE_STATUS_CACHE_DIR"] != "" {
+		t.Errorf("bundle holds the cache directory: %v", b.Env)
+	}
+	if b.Env["CLAUDE_STATUS_INFO_MODE"] != "text" {
+		t.Errorf("Env = %v, want CLAUDE_STATUS_INFO_MODE recorded", b.Env)
+	}
+}
+
+func TestAnonymizePath(t *testing.T) {
+	tests := []struct {
+		path string
+		home string
+		want string
+	}{
+		{"", "/home/jane", ""},
+		{"/home/jane", "/home/jane", "/home/user"},
+		{"/home/jane/src/app-2", "/home/jane", "/home/user/xxx/xxx-0"},
+		{"/home/janet/src", "/home/jane", "/xxxx/xxxxx/xxx"},
+		{"/srv/repo", "", "/xxx/xxxx"},
+	}
+
+	for _, tt := range tests {
+		if got := anonymizePath(tt.path, tt.home); got != tt.want {
+			t.Errorf("anonymizePath(%q, %q) = %q, want %q", tt.path, tt.home, got, tt.want)
+		}
+	}
+}
+
+func TestRecordingArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--record", "b.json", "--no-color"}, []string{"--no-color"}},
+		{[]string{"--info-mode=text", "-record=b.json"}, []string{"--info-mode=text"}},
+		{[]string{"--replay", "b.json"}, nil},
+		{[]string{"--segments", "git,usage"}, []string{"--segments", "git,usage"}},
+		{[]string{"--webhook", "https://hooks.example/T0/secret", "--no-color"}, []string{"--webhook=REDACTED", "--no-color"}},
+		{[]string{"-otlp-headers=Authorization=Bearer xyz", "--api-base=https://gw.corp"}, []string{"--otlp-headers=REDACTED", "--api-base=REDACTED"}},
+		{[]string{"--cache-dir", "/home/jane/.cache", "--debug", "--auto-update=false", "--lines", "2"}, []string{"--lines", "2"}},
+		{[]string{"--custom-segment", `k8s=curl -H "Authorization: Bearer xyz"`, "--custom-segment=aws=aws sts get-caller-identity"},
+			[]string{"--custom-segment=k8s=REDACTED", "--custom-segment=aws=REDACTED"}},
+	}
+
+	for _, tt := range tests {
+		if got := RecordingArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RecordingArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
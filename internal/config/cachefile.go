@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheHeader starts the first line of files written by WriteCache; the
+// SHA-256 of the rest of the file follows in hex
+const cacheHeader = "#claude-code-statusline-cache v1 sha256="
+
+// ErrCorrupt is returned by ReadCache for a cache file that was damaged
+var ErrCorrupt = errors.New("corrupt cache file")
+
+// WriteCache saves v as JSON to a cache file that ReadCache can verify: a
+// header line with its checksum, then the data. The file is replaced
+// atomically and synced to disk, so a crash leaves the old or the new
+// version, never half of one. Nothing is written in read-only mode.
+func WriteCache(path string, v any) error {
+	if cfg != nil && cfg.ReadOnly {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	file := append([]byte(cacheHeader+hex.EncodeToString(sum[:])+"\n"), data...)
+	return replaceFile(path, file, true)
+}
+
+// ReadCache loads a cache file written by WriteCache, or a plain JSON file
+// from versions before the header, into v. A file that fails its checksum
+// or isn't valid JSON is moved aside to path.corrupt, so it's rebuilt
+// instead of read again, and its error (wrapping ErrCorrupt) returned.
+func ReadCache(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if rest, ok := bytes.CutPrefix(data, []byte(cacheHeader)); ok {
+		sum, body, _ := bytes.Cut(rest, []byte("\n"))
+		want := sha256.Sum256(body)
+		if string(sum) != hex.EncodeToString(want[:]) {
+			return quarantine(path, fmt.Errorf("%w: checksum mismatch", ErrCorrupt))
+		}
+		data = body
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return quarantine(path, fmt.Errorf("%w: %v", ErrCorrupt, err))
+	}
+	return nil
+}
+
+// quarantine moves a corrupt cache file to path.corrupt, replacing an
+// earlier one, and returns err
+func quarantine(path string, err error) error {
+	if cfg != nil && cfg.ReadOnly {
+		WarnLog("%s: %v", path, err)
+		return err
+	}
+	if mvErr := os.Rename(path, path+".corrupt"); mvErr != nil {
+		os.Remove(path)
+	}
+	ErrorLog("%s: %v; moved to %s.corrupt and rebuilding", path, err, filepath.Base(path))
+	return err
+}
+
+// replaceFile writes data to a private temporary file next to path and
+// renames it over path, syncing it first if sync is set. path is left
+// alone when the data can't be written. Should only the rename fail, as it
+// can on Windows while another process has path open, path is written in
+// place.
+func replaceFile(path string, data []byte, sync bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil && sync {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		DebugLog("Replacing %s: %v, writing in place", path, err)
+		os.Remove(tmp.Name())
+		return os.WriteFile(path, data, PrivateFileMode)
+	}
+	return nil
+}
+
+// Migrations upgrade the JSON object of a cache, keyed by the version each
+// upgrades to. Versions that changed nothing an older cache needs upgrading
+// for have none.
+type Migrations map[int]func(obj map[string]any) error
+
+// ReadVersionedCache reads a cache file like ReadCache, whose "version"
+// field says which format it was written in. A cache from an older version
+// is upgraded one version at a time by migrations to version before it's
+// decoded into v, so schema changes keep the data. A cache written by a
+// newer release isn't decoded, so it's rebuilt rather than misread.
+func ReadVersionedCache(path string, v any, version int, migrations Migrations) error {
+	var raw json.RawMessage
+	if err := ReadCache(path, &raw); err != nil {
+		return err
+	}
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return quarantine(path, fmt.Errorf("%w: %v", ErrCorrupt, err))
+	}
+	switch {
+	case header.Version > version:
+		return fmt.Errorf("%s: version %d is newer than %d", path, header.Version, version)
+	case header.Version == version:
+		return json.Unmarshal(raw, v)
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+		return quarantine(path, fmt.Errorf("%w: not an object", ErrCorrupt))
+	}
+	for to := header.Version + 1; to <= version; to++ {
+		if migrate := migrations[to]; migrate != nil {
+			DebugLog("Migrating %s to version %d", filepath.Base(path), to)
+			if err := migrate(obj); err != nil {
+				return fmt.Errorf("%s: migrating to version %d: %v", path, to, err)
+			}
+		}
+	}
+	obj["version"] = version
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Choices are the values of the options that take one of a fixed set, the
+// default first. Other values are reported and replaced by the default.
+var Choices = map[string][]string{
+	"display-mode":    {"colors", "minimal", "background", "accessible"},
+	"info-mode":       {"none", "emoji", "text", "icons"},
+	"aggregation":     {"fixed", "sliding"},
+	"background":      {"auto", "dark", "light"},
+	"theme":           {"default", "dracula", "gruvbox-light", "nord", "solarized"},
+	"color-depth":     {"auto", "truecolor", "24bit", "256", "16"},
+	"emoji-style":     {"auto", "emoji", "text", "none"},
+	"duration-format": {"compact", "verbose", "clock"},
+	"log-level":       {"debug", "info", "warn", "error"},
+	"usage-bar":       {"off", "blocks", "braille"},
+	"cost-unit":       {"dollars", "tokens", "both"},
+	"git-style":       {"counts", "flags"},
+	"git-untracked":   {"normal", "no"},
+	"tools-style":     {"full", "model"},
+	"dir-source":      {"cwd", "project"},
+	"webhook-format":  {"json", "slack"},
+	"output":          {"text", "json"},
+	"overflow":        {"line", "drop"},
+	"ci":              {"auto", "true", "false", "1", "0", "yes", "no", "on", "off"},
+	"update-channel":  {"stable", "prerelease", "none"},
+}
+
+// otherEnv are environment variables read outside of ParseArgs
+var otherEnv = []string{"CLAUDE_STATUS_CONFIG", "CLAUDE_STATUS_PROFILES", "CLAUDE_STATUS_NO_TELEMETRY"}
+
+// envKeys are the environment variables the getEnv functions have read
+var envKeys = make(map[string]bool)
+
+// Problem is an option that couldn't be used as given: an invalid value
+// that was replaced, an unknown option or a misspelled environment variable
+type Problem struct {
+	Option  string // "--flag", or the environment variable or config file key
+	Source  string // where it was set, see Source
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s (%s): %s", p.Option, p.Source, p.Message)
+}
+
+// problem logs and records a Problem
+func (c *Config) problem(option, source, format string, args ...any) {
+	p := Problem{Option: option, Source: source, Message: fmt.Sprintf(format, args...)}
+	WarnLog("%s", p)
+	c.Problems = append(c.Problems, p)
+}
+
+// Source returns where the value of the named flag came from: "command
+// line", "config file", "env NAME" or "default"
+func (c *Config) Source(name string) string {
+	if source, ok := c.sources[name]; ok {
+		return source
+	}
+	return "default"
+}
+
+// envName returns the environment variable a flag's default is read from,
+// by convention: CLAUDE_STATUS_ and the name without show- in capitals
+func envName(name string) string {
+	switch name {
+	case "no-color":
+		return "NO_COLOR"
+	case "show-if":
+		return "CLAUDE_STATUS_SHOW_IF"
+	case "custom-segment", "expr-segment":
+		name += "s"
+	}
+	name = strings.TrimPrefix(name, "show-")
+	return "CLAUDE_STATUS_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// recordSources notes which flags were set by an environment variable (the
+// common ones a subcommand doesn't have its own of), in the config file
+// (fromFile) or on the command line (args parsed by fs)
+func (c *Config) recordSources(common *flag.FlagSet, own, fromFile map[string]bool, fs *flag.FlagSet, args []string) {
+	c.sources = make(map[string]string)
+	common.VisitAll(func(f *flag.Flag) {
+		if env := envName(f.Name); !own[f.Name] && envKeys[env] && os.Getenv(env) != "" {
+			c.sources[f.Name] = "env " + env
+		}
+	})
+	for name := range fromFile {
+		c.sources[name] = "config file"
+	}
+
+	// The same walk over the arguments as fs.Parse
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+		if len(arg) < 2 || arg[0] != '-' || arg == "--" {
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		f := fs.Lookup(name)
+		if f == nil {
+			break
+		}
+		c.sources[name] = "command line"
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !hasValue && (!ok || !b.IsBoolFlag()) && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+}
+
+// validateOptions replaces values outside the Choices of their option, and
+// an unknown --lines layout, with the default, and reports segments
+// --segments doesn't know. common holds the flags ParseArgs registered, so
+// subcommand flags of the same name are left alone.
+func (c *Config) validateOptions(common *flag.FlagSet) {
+	names := make([]string, 0, len(Choices))
+	for name := range Choices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := common.Lookup(name)
+		value, choices := f.Value.String(), Choices[name]
+		valid := false
+		for _, choice := range choices {
+			if strings.EqualFold(value, choice) {
+				// Accept any case, as the choice
+				f.Value.Set(choice)
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			c.problem("--"+name, c.Source(name), "unknown value %q, want %s%s; using %s",
+				value, strings.Join(choices, "|"), didYouMean(value, choices), choices[0])
+			f.Value.Set(choices[0])
+		}
+	}
+
+	if _, ok := LineFormats[c.Lines]; !ok && c.Lines != 0 {
+		c.problem("--lines", c.Source("lines"), "no built-in layout has %d lines, want 1, 2 or 3; using the default", c.Lines)
+		c.Lines = 0
+	}
+
+	known := append(append([]string{}, SegmentNames...), c.CustomSegmentNames()...)
+	for _, s := range strings.Split(c.Segments, ",") {
+		if s = strings.TrimSpace(s); s != "" && !slices.Contains(known, s) {
+			c.problem("--segments", c.Source("segments"), "unknown segment %q%s", s, didYouMean(s, known))
+		}
+	}
+}
+
+// checkEnv reports CLAUDE_STATUS_ environment variables that nothing reads,
+// which are usually misspelled
+func (c *Config) checkEnv() {
+	known := append([]string{}, otherEnv...)
+	for key := range envKeys {
+		known = append(known, key)
+	}
+	sort.Strings(known)
+	var unknown []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, "CLAUDE_STATUS_") && !slices.Contains(known, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		c.problem(key, "environment", "unknown environment variable%s", didYouMean(key, known))
+	}
+}
+
+// didYouMean suggests the candidate closest to a misspelled word, as
+// " (did you mean x?)", if any is close enough
+func didYouMean(word string, candidates []string) string {
+	best, bestDist := "", 3 // at most 2 edits
+	for _, candidate := range candidates {
+		if d := editDistance(strings.ToLower(word), strings.ToLower(candidate)); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %s?)", best)
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
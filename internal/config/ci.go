@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// applyCI switches to CI mode when --ci is true, or in auto mode when
+// running under CI or without a writable cache directory: no network, no
+// cache writes, no updates, and nothing that depends on the terminal or on
+// timing, so the output only depends on the input and the logs
+func (c *Config) applyCI() {
+	reason := ""
+	switch strings.ToLower(c.CI) {
+	case "true", "1", "yes", "on":
+		reason = "--ci"
+	case "false", "0", "no", "off":
+		return
+	default:
+		if ci := os.Getenv("CI"); ci != "" && ci != "false" && ci != "0" {
+			reason = "CI environment variable"
+		} else if !writable(CacheDir()) {
+			reason = "read-only cache directory"
+		}
+	}
+	if reason == "" {
+		return
+	}
+
+	InfoLog("CI mode (%s): offline, read-only, no updates", reason)
+	c.ReadOnly = true
+	c.Offline = true
+	c.AutoUpdate = false
+	c.Telemetry = false
+	c.UseDaemon = false
+	c.Deadline = 0
+	c.CostAsync = false
+	c.RenderCacheTTL = 0
+	c.NoGitCache = true
+	c.LimitNotify = false
+	c.UsageNotify = ""
+	c.ResetNotify = false
+	c.BudgetNotify = false
+	c.WebhookURL = ""
+	c.OTLPEndpoint = ""
+	if c.Background == "auto" {
+		c.Background = "dark"
+	}
+}
+
+// writable reports whether files can be created in dir
+func writable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
+// WriteFile writes a cache or state file private to the user, or nothing
+// in read-only mode. The file is replaced by renaming, so concurrent
+// readers never see it half-written; see WriteCache for files that must
+// also survive a crash.
+func WriteFile(path string, data []byte) error {
+	if cfg != nil && cfg.ReadOnly {
+		return nil
+	}
+	return replaceFile(path, data, false)
+}
+
+// MkdirAll creates a cache directory private to the user, or nothing in
+// read-only mode
+func MkdirAll(dir string) {
+	if cfg != nil && cfg.ReadOnly {
+		return
+	}
+	os.MkdirAll(dir, PrivateDirMode)
+}
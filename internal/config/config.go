@@ -6,20 +6,121 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds all application configuration
 type Config struct {
-	CacheTTL        int
+	// How long each data source is cached (see validateTTLs for the limits)
+	CacheTTL        int           // seconds; usage API
+	PricingTTL      time.Duration // model pricing (0 = DefaultPricingTTL)
+	GitTTL          time.Duration // git status per repository (0 = always fresh)
+	NoGitCache      bool          // always run git, whatever GitTTL says
+	GitTimeout      time.Duration // how long git status may run before the dirty state is shown as unknown (0 = wait)
+	UpdateTTL       time.Duration // between update checks (0 = DefaultUpdateTTL)
+	RenderCacheTTL  int           // milliseconds; concurrent invocations share output within this window
+	OTLPInterval    time.Duration // minimum time between pushes to OTLPEndpoint
+	CustomTTL       time.Duration // output of each custom segment's command (0 = always rerun)
+	CustomTimeout   time.Duration // how long a custom segment's command may run
 	NoColor         bool
 	DisplayMode     string
+	Background      string // "auto", "dark" or "light": which color variants to use
+	Theme           string // Built-in palette: "default", "solarized", "dracula", "nord" or "gruvbox-light"
+	Colors          string // Per-segment colors, e.g. "dir=#268bd2/#073642,git=magenta"
+	ColorDepth      string // "auto" (detect), "truecolor", "256" or "16"
 	InfoMode        string
-	Debug           bool
+	EmojiStyle      string // "auto", "emoji" (U+FE0F), "text" (U+FE0E) or "none" for the emoji info mode
+	DurationFormat  string // "compact" (2h29m), "verbose" (2 hr 29 min) or "clock" (2:29)
+	GlyphWidths     string // Cell widths of glyphs as the terminal renders them, e.g. "📁=1,⚙=2"
+	Debug           bool   // Log with --debug
+	LogTarget       string // "file" (debug.log in the cache directory) or "stderr"
+	LogLevel        string // Lowest level logged: debug, info, warn or error
 	AggregationMode string // "sliding" or "fixed"
 	AutoUpdate      bool
-	RequirePlugin   string // Plugin name that must be installed (empty = no requirement)
+	UpdatePublicKey string  // Minisign key the release checksums must be signed with (empty = checksums only)
+	UpdateChannel   string  // Releases updates come from: "stable", "prerelease" or "none" (no automatic updates)
+	UpdatePin       string  // Version to update to and stay at (empty = the latest of UpdateChannel)
+	RequirePlugin   string  // Plugin name that must be installed (empty = no requirement)
+	Segments        string  // Comma-separated segment names to show (empty = all)
+	Format          string  // Segment layout template (empty = DefaultFormat)
+	Lines           int     // Built-in layout with this many lines, see LineFormats (0 = DefaultFormat)
+	MaxWidth        int     // Cells per line; wider lines drop their lowest-priority segments (0 = no limit)
+	AutoWidth       bool    // Without MaxWidth, fit lines into the terminal width from the session input or $COLUMNS
+	Overflow        string  // What happens to segments dropped for MaxWidth: "line" (moved to a last line) or "drop"
+	DataDir         string  // Claude Code's data directory (empty = see ClaudeDir)
+	CacheDir        string  // The statusline's cache directory (empty = see CacheDir)
+	Profile         string  // Claude account profile to use (empty = by project path, see ApplyProfile)
+	ActiveProfile   string  // Profile in use after ApplyProfile
+	KeyringService  string  // Keyring service of the active profile's credentials (empty = the claude CLI's)
+	FreshWindow     int     // Minutes to mark a newly started 5h window as "fresh" (0 = off)
+	BurnRate        bool    // Show how fast 5h usage grew recently: 45% +8%/h
+	LimitETA        bool    // Show when the 5h limit is reached at that rate, if before the reset: →100% in 1h10m
+	LimitHint       string  // Hint appended when the 5h window is full (e.g. "switch to haiku?")
+	ModelHint       string  // Hint shown while the 5h window fills up on large models (e.g. "try haiku")
+	ModelHintUsage  int     // 5h usage percentage from which ModelHint is considered
+	ModelHintShare  int     // Share of today's cost on opus and sonnet from which ModelHint is shown
+	LimitNotify     bool    // Desktop notification once per window when the 5h limit is hit
+	UsageNotify     string  // 5h usage percentages to notify at once per window, e.g. "75,90,100" (empty = off)
+	ResetNotify     bool    // Desktop notification when a new 5h window starts
+	Output          string  // "text" (statusline) or "json"
+	Daemon          bool    // Run as a background daemon keeping usage and cost data warm
+	UseDaemon       bool    // Query a running daemon instead of collecting usage and cost
+	Record          string  // Write an anonymized bundle of this render to the given file
+	Replay          string  // Render a recorded bundle instead of collecting data
+	Explain         bool    // Print where each segment's data came from after the statusline
+	Deadline        int     // milliseconds; components slower than this fall back to cached data (0 = wait)
+	TranscriptTail  int     // KB read from the end of a long transcript instead of all of it (0 = read it whole)
+	APIBase         string  // Root URL of the usage API, e.g. a gateway (empty = Anthropic's)
+	ClaudeDiscovery bool    // Fall back to the claude CLI's files and auth status for credentials
+	RefreshToken    bool    // Refresh an expired OAuth token instead of waiting for Claude Code to
+	UsageFormat     string  // Template for the 5h usage segment (empty = default)
+	UsageBar        string  // Usage gauge before the percentage: "off", "blocks" (▰▰▰▱▱) or "braille" (⣿⣿⡇⣀⣀)
+	UsageBarWidth   int     // Cells of the usage gauge
+	SevenDayFormat  string  // Template for the 7d usage segment (empty = default)
+	SevenDayMin     int     // Hide the 7d usage segment below this percentage
+	CostBreakdown   bool    // Split each cost period by model family: $12.30 (op $9.10, so $3.20)/d
+	CostProjection  bool    // Show the month-end forecast after the monthly cost: $350.75 → ~$610/m
+	CostUnit        string  // "dollars", "tokens" (1.2M tok/d) or "both"
+	CostAsync       bool    // Render costs as last saved and scan the logs after the output is written
+	GitStyle        string  // "counts" (!3 +2 ?5) or "flags" (?+!)
+	ToolsStyle      string  // "full" (tools segment) or "model" (latest running tool and its time after the model)
+	SummaryTools    string  // Tools counted by the summary segment as tool[+tool][=label], e.g. "Read,Edit+MultiEdit=E"
+	SummaryMin      int     // Tracked tool calls before the summary segment appears
+	Spinner         bool    // Animate the marker of running tools and agents, one frame per render
+	ErrorStreak     int     // Tool errors in a row from which the errors segment warns
+	CompactWarn     int     // Context usage percentage from which the compact segment warns of auto-compaction
+	ProjectName     bool    // Show the nearest package manifest's name instead of the directory
+	DirSource       string  // Directory the dir segment shows: "cwd" (the current one) or "project" (where Claude Code was started)
+	GitScope        string  // Monorepo subproject patterns like "packages/*", or "nested" for nested repos only (empty = off)
+	GitUpstreams    string  // Remotes to compare besides the branch's upstream: "auto" (a remote named upstream), "none" or a list
+	GitUntracked    string  // "normal" counts untracked files, "no" skips looking for them (git status -uno)
+	GitLastCommit   bool    // Show the latest commit's age and subject after the branch: main · 2h ago fix parser
+	Telemetry       bool    // Opted in to anonymous daily feature-usage reports
+	RetentionDays   int     // Days of cost and usage history to keep
+	BudgetMonthly   float64 // Monthly budget in dollars; warns when the forecast runs out before month end (0 = off)
+	BudgetWeekly    float64 // Weekly budget in dollars (0 = off)
+	BudgetDaily     float64 // Daily budget in dollars (0 = off)
+	BudgetPercent   bool    // Append the share of each budget to its cost: $80.10/w (82%)
+	BudgetNotify    bool    // Desktop notification once per period when a budget is exceeded
+	WebhookURL      string  // URL posted to once per window or period when the 5h limit is hit or a budget is exceeded (empty = off)
+	WebhookFormat   string  // "json" (generic event) or "slack" (incoming webhook message)
+	OTLPEndpoint    string  // OpenTelemetry collector to push cost and usage gauges to over OTLP/HTTP (empty = off)
+	OTLPHeaders     string  // Extra request headers for the collector, e.g. "Authorization=Bearer xyz"
+	CI              string  // "auto" (detect CI and read-only caches), "true" or "false"
+	ReadOnly        bool    // Write no caches or state (CI mode)
+	Offline         bool    // Make no network requests, use cached data only (--offline, or CI mode)
+
+	// Segments shown by default are hidden with --show-<segment>=false, so
+	// they stay on in a zero Config
+	HideDir          bool
+	HideGit          bool
+	HideModel        bool
+	HideSubscription bool
+	HideCost         bool
+	HideUsage        bool // all usage windows
 
 	// Feature flags for new components
 	ShowContext  bool
@@ -27,8 +128,100 @@ type Config struct {
 	ShowAgents   bool
 	ShowTodos    bool
 	ShowDuration bool
+	ShowNote     bool
+	ShowHistory  bool
+	ShowCommits  bool
+	ShowBase     bool
+	ShowSession  bool
+	ShowChanges  bool
+	ShowSummary  bool
+	ShowErrors   bool
+	ShowStyle    bool
+	ShowVersion  bool
+	ShowCompact  bool
+
+	// User-defined segments from --custom-segment and --expr-segment
+	CustomSegments []CustomSegment
+	// Conditions for showing segments from --show-if and --hide-if
+	Rules []Rule
+
+	// Options ParseArgs had to fix or ignore, and where each flag's value
+	// came from (see Source)
+	Problems []Problem
+	sources  map[string]string
+}
+
+// SegmentNames lists the segments accepted by --segments and --format
+var SegmentNames = []string{
+	"dir", "git", "model", "context", "subscription", "cost", "usage", "usage7d",
+	"opus", "tools", "agents", "todos", "duration", "note",
+	"history", "commits", "session", "changes", "summary", "errors",
+	"style", "version", "compact", "base",
+}
+
+// DefaultFormat is the segment layout used when no --format is given:
+// the status line followed by an activity line
+const DefaultFormat = "{dir} {git} {base} {model} {style} {context} {compact} {subscription} {cost} {session} {history} {commits} {usage} {usage7d} {opus} {version}\n{errors} {tools} {summary} {agents} {todos} {changes} {duration} {note}"
+
+// LineFormats are the layouts of --lines: everything on one line, the
+// session on the first line and usage, costs and activity on the second,
+// or session, usage and costs, and activity on a line each
+var LineFormats = map[int]string{
+	1: "{dir} {git} {base} {model} {style} {context} {compact} {subscription} {cost} {session} {history} {commits} {usage} {usage7d} {opus} {version} {errors} {tools} {summary} {agents} {todos} {changes} {duration} {note}",
+	2: "{dir} {git} {base} {model} {style} {context} {compact} {version}\n{usage} {usage7d} {opus} {cost} {session} {history} {subscription} {commits} {errors} {tools} {summary} {agents} {todos} {changes} {duration} {note}",
+	3: "{dir} {git} {base} {model} {style} {context} {compact} {version}\n{usage} {usage7d} {opus} {cost} {session} {history} {subscription} {commits}\n{errors} {tools} {summary} {agents} {todos} {changes} {duration} {note}",
+}
+
+// LayoutFormat returns the layout template: --format, else the --lines
+// layout, else DefaultFormat. The built-in layouts end their first line
+// with the custom segments; --format places them itself.
+func (c *Config) LayoutFormat() string {
+	if c.Format != "" {
+		return c.Format
+	}
+	format, ok := LineFormats[c.Lines]
+	if !ok {
+		format = DefaultFormat
+	}
+	if len(c.CustomSegments) == 0 {
+		return format
+	}
+	first, rest, lines := strings.Cut(format, "\n")
+	for _, name := range c.CustomSegmentNames() {
+		first += " {" + name + "}"
+	}
+	if !lines {
+		return first
+	}
+	return first + "\n" + rest
 }
 
+// Default cache lifetimes
+const (
+	DefaultCacheTTL       = 300 // seconds
+	DefaultRenderCacheTTL = 500 // milliseconds
+	DefaultPricingTTL     = 24 * time.Hour
+	DefaultUpdateTTL      = 24 * time.Hour
+	DefaultGitTTL         = 2 * time.Second
+	DefaultOTLPInterval   = time.Minute
+	DefaultCustomTTL      = 10 * time.Second
+	DefaultCustomTimeout  = time.Second
+)
+
+// DefaultTranscriptTail is how many KB of a long transcript are read from
+// its end, enough for the latest tool calls of most sessions
+const DefaultTranscriptTail = 256
+
+// DefaultSummaryTools are the tools the summary segment counts: reads,
+// edits of any kind and shell commands
+const DefaultSummaryTools = "Read,Edit+MultiEdit+Write+NotebookEdit=E,Bash"
+
+// DefaultRetentionDays covers a full month of costs for the monthly totals
+const DefaultRetentionDays = 31
+
+// TranscriptSegments are the segments that need the transcript parsed
+var TranscriptSegments = []string{"errors", "tools", "summary", "agents", "todos", "changes", "duration"}
+
 // Global configuration instance
 var cfg *Config
 
@@ -40,62 +233,518 @@ func Get() *Config {
 	return cfg
 }
 
-// Parse parses command line flags and environment variables
-func Parse() *Config {
+// ParseArgs registers the common flags on fs, parses args and makes the
+// result the global configuration. Subcommands pass their own FlagSet with
+// any extra flags already registered; those take precedence over common
+// flags with the same name.
+func ParseArgs(fs *flag.FlagSet, args []string) *Config {
 	cfg = &Config{}
-	flag.IntVar(&cfg.CacheTTL, "cache-ttl", getEnvInt("CLAUDE_STATUS_CACHE_TTL", 300), "Cache TTL in seconds")
-	flag.BoolVar(&cfg.NoColor, "no-color", false, "Disable ANSI colors")
-	flag.StringVar(&cfg.DisplayMode, "display-mode", getEnv("CLAUDE_STATUS_DISPLAY_MODE", "colors"), "Display mode: colors|minimal|background")
-	flag.StringVar(&cfg.InfoMode, "info-mode", getEnv("CLAUDE_STATUS_INFO_MODE", "none"), "Info mode: none|emoji|text")
-	flag.StringVar(&cfg.AggregationMode, "aggregation", getEnv("CLAUDE_STATUS_AGGREGATION", "fixed"), "Cost aggregation: sliding|fixed")
-	flag.BoolVar(&cfg.Debug, "debug", getEnvBool("CLAUDE_STATUS_DEBUG", false), "Enable debug output")
-	flag.BoolVar(&cfg.AutoUpdate, "auto-update", getEnvBool("CLAUDE_STATUS_AUTO_UPDATE", true), "Enable automatic updates (default: true)")
-	flag.StringVar(&cfg.RequirePlugin, "require-plugin", "", "Require plugin to be installed (exits silently if not)")
-
-	// Feature flags for new components (all default to true)
-	flag.BoolVar(&cfg.ShowContext, "show-context", getEnvBool("CLAUDE_STATUS_CONTEXT", true), "Show context window usage")
-	flag.BoolVar(&cfg.ShowTools, "show-tools", getEnvBool("CLAUDE_STATUS_TOOLS", true), "Show tool activity")
-	flag.BoolVar(&cfg.ShowAgents, "show-agents", getEnvBool("CLAUDE_STATUS_AGENTS", true), "Show agent activity")
-	flag.BoolVar(&cfg.ShowTodos, "show-todos", getEnvBool("CLAUDE_STATUS_TODOS", true), "Show todo progress")
-	flag.BoolVar(&cfg.ShowDuration, "show-duration", getEnvBool("CLAUDE_STATUS_DURATION", true), "Show session duration")
-	flag.Parse()
+	common := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	common.IntVar(&cfg.CacheTTL, "cache-ttl", getEnvInt("CLAUDE_STATUS_CACHE_TTL", DefaultCacheTTL), "Cache TTL in seconds for API usage")
+	common.DurationVar(&cfg.PricingTTL, "pricing-ttl", getEnvDuration("CLAUDE_STATUS_PRICING_TTL", DefaultPricingTTL), "How long fetched model pricing is used before refetching (at least 1h)")
+	common.DurationVar(&cfg.GitTTL, "git-ttl", getEnvDuration("CLAUDE_STATUS_GIT_TTL", DefaultGitTTL), "Reuse git status per repository for this long (0 = always fresh, at most 1m)")
+	common.BoolVar(&cfg.NoGitCache, "no-git-cache", getEnvBool("CLAUDE_STATUS_NO_GIT_CACHE", false), "Always run git instead of reusing its status for --git-ttl")
+	common.DurationVar(&cfg.GitTimeout, "git-status-timeout", getEnvDuration("CLAUDE_STATUS_GIT_STATUS_TIMEOUT", 0), "Show the branch with … instead of waiting longer than this for git status, e.g. 200ms (0 waits)")
+	common.DurationVar(&cfg.UpdateTTL, "update-ttl", getEnvDuration("CLAUDE_STATUS_UPDATE_TTL", DefaultUpdateTTL), "Time between update checks (at least 1h)")
+	common.IntVar(&cfg.RenderCacheTTL, "render-cache-ttl", getEnvInt("CLAUDE_STATUS_RENDER_CACHE_TTL", DefaultRenderCacheTTL), "Share rendered output between invocations for this many milliseconds (0 disables)")
+	common.BoolVar(&cfg.NoColor, "no-color", readEnv("NO_COLOR") != "", "Disable ANSI colors (default: true if NO_COLOR is set)")
+	common.StringVar(&cfg.DisplayMode, "display-mode", getEnv("CLAUDE_STATUS_DISPLAY_MODE", "colors"), "Display mode: colors|minimal|background|accessible")
+	common.StringVar(&cfg.Background, "background", getEnv("CLAUDE_STATUS_BACKGROUND", "auto"), "Terminal background: auto|dark|light (auto asks the terminal)")
+	common.StringVar(&cfg.Theme, "theme", getEnv("CLAUDE_STATUS_THEME", "default"), "Color theme: default|solarized|dracula|nord|gruvbox-light")
+	common.StringVar(&cfg.ColorDepth, "color-depth", getEnv("CLAUDE_STATUS_COLOR_DEPTH", "auto"), "Colors the terminal shows: auto|truecolor|256|16 (auto checks COLORTERM and TERM)")
+	common.StringVar(&cfg.Colors, "colors", getEnv("CLAUDE_STATUS_COLORS", ""), "Per-segment colors as segment=fg[/bg] with names, 0-255 or #rrggbb, e.g. \"dir=#268bd2,git=magenta/236\"")
+	common.StringVar(&cfg.InfoMode, "info-mode", getEnv("CLAUDE_STATUS_INFO_MODE", "none"), "Info mode: none|emoji|text|icons")
+	common.StringVar(&cfg.EmojiStyle, "emoji-style", getEnv("CLAUDE_STATUS_EMOJI_STYLE", "auto"), "Emoji presentation in the emoji info mode: auto|emoji|text|none")
+	common.StringVar(&cfg.DurationFormat, "duration-format", getEnv("CLAUDE_STATUS_DURATION_FORMAT", "compact"), "Durations as compact (2h29m), verbose (2 hr 29 min) or clock (2:29)")
+	common.StringVar(&cfg.GlyphWidths, "glyph-widths", getEnv("CLAUDE_STATUS_GLYPH_WIDTHS", ""), "Cell widths of glyphs as your terminal renders them, e.g. \"📁=1,⚙=2\"")
+	common.StringVar(&cfg.AggregationMode, "aggregation", getEnv("CLAUDE_STATUS_AGGREGATION", "fixed"), "Cost aggregation: sliding|fixed")
+	common.BoolVar(&cfg.BurnRate, "burn-rate", getEnvBool("CLAUDE_STATUS_BURN_RATE", false), "Show how fast 5h usage grew over the last hour, e.g. +8%/h")
+	common.BoolVar(&cfg.LimitETA, "limit-eta", getEnvBool("CLAUDE_STATUS_LIMIT_ETA", false), "Show when the 5h limit will be reached at the recent burn rate, if before the reset")
+	common.IntVar(&cfg.FreshWindow, "fresh-window", getEnvInt("CLAUDE_STATUS_FRESH_WINDOW", 0), "Mark a new 5h usage window as fresh for this many minutes (0 disables)")
+	common.StringVar(&cfg.LimitHint, "limit-hint", getEnv("CLAUDE_STATUS_LIMIT_HINT", ""), "Hint shown when the 5h usage limit is reached")
+	common.StringVar(&cfg.ModelHint, "model-hint", getEnv("CLAUDE_STATUS_MODEL_HINT", ""), "Hint shown when 5h usage is high and mostly spent on opus/sonnet, e.g. \"try haiku\"")
+	common.IntVar(&cfg.ModelHintUsage, "model-hint-usage", getEnvInt("CLAUDE_STATUS_MODEL_HINT_USAGE", 75), "5h usage percentage from which --model-hint is shown")
+	common.IntVar(&cfg.ModelHintShare, "model-hint-share", getEnvInt("CLAUDE_STATUS_MODEL_HINT_SHARE", 80), "Percentage of today's cost on opus and sonnet from which --model-hint is shown")
+	common.BoolVar(&cfg.LimitNotify, "limit-notify", getEnvBool("CLAUDE_STATUS_LIMIT_NOTIFY", false), "Desktop notification when the 5h usage limit is reached")
+	common.StringVar(&cfg.UsageNotify, "usage-notify", getEnv("CLAUDE_STATUS_USAGE_NOTIFY", ""), "Desktop notification when 5h usage crosses these percentages, e.g. 75,90,100")
+	common.BoolVar(&cfg.ResetNotify, "reset-notify", getEnvBool("CLAUDE_STATUS_RESET_NOTIFY", false), "Desktop notification when a new 5h usage window starts")
+	debugFlag{cfg}.Set(getEnv("CLAUDE_STATUS_DEBUG", "false"))
+	common.Var(debugFlag{cfg}, "debug", "Log to debug.log in the cache directory, or to stderr with --debug=stderr")
+	common.StringVar(&cfg.LogLevel, "log-level", getEnv("CLAUDE_STATUS_LOG_LEVEL", "debug"), "Lowest level logged with --debug: debug|info|warn|error")
+	common.BoolVar(&cfg.AutoUpdate, "auto-update", getEnvBool("CLAUDE_STATUS_AUTO_UPDATE", true), "Enable automatic updates (default: true)")
+	common.StringVar(&cfg.UpdateChannel, "update-channel", getEnv("CLAUDE_STATUS_UPDATE_CHANNEL", "stable"), "Releases to update to: stable|prerelease|none (none turns automatic updates off)")
+	common.StringVar(&cfg.UpdatePin, "update-pin", getEnv("CLAUDE_STATUS_UPDATE_PIN", ""), "Version to update to and stay at, e.g. v1.4.2 (default: the latest of --update-channel)")
+	common.StringVar(&cfg.UpdatePublicKey, "update-public-key", getEnv("CLAUDE_STATUS_UPDATE_PUBLIC_KEY", ""), "Minisign public key, or .pub file, that release checksums must be signed with to update")
+	common.StringVar(&cfg.APIBase, "api-base", getEnv("CLAUDE_STATUS_API_BASE", ""), "Root URL of the usage API, e.g. a self-hosted gateway (default: https://api.anthropic.com)")
+	common.StringVar(&cfg.Profile, "profile", getEnv("CLAUDE_STATUS_PROFILE", ""), "Claude account profile from profiles.json (default: matched by project path)")
+	common.StringVar(&cfg.DataDir, "data-dir", getEnv("CLAUDE_STATUS_DATA_DIR", ""), "Claude Code's data directory with projects/ and credentials.json (default: ~/.claude)")
+	common.StringVar(&cfg.CacheDir, "cache-dir", getEnv("CLAUDE_STATUS_CACHE_DIR", ""), "Cache directory (default: $XDG_CACHE_HOME/claude-code-statusline)")
+	common.StringVar(&cfg.RequirePlugin, "require-plugin", "", "Require plugin to be installed (exits silently if not)")
+	common.StringVar(&cfg.UsageBar, "usage-bar", getEnv("CLAUDE_STATUS_USAGE_BAR", "off"), "Show 5h and 7d usage as a gauge before the percentage: off|blocks|braille")
+	common.IntVar(&cfg.UsageBarWidth, "usage-bar-width", getEnvInt("CLAUDE_STATUS_USAGE_BAR_WIDTH", 5), "Width of the usage gauge in cells")
+	common.StringVar(&cfg.UsageFormat, "usage-format", getEnv("CLAUDE_STATUS_USAGE_FORMAT", ""), "Template for the 5h usage segment, e.g. \"{percent} {reset}\"")
+	common.StringVar(&cfg.SevenDayFormat, "usage7d-format", getEnv("CLAUDE_STATUS_USAGE7D_FORMAT", ""), "Template for the 7d usage segment, e.g. \"{percent}\"")
+	common.IntVar(&cfg.SevenDayMin, "usage7d-min", getEnvInt("CLAUDE_STATUS_USAGE7D_MIN", 0), "Only show the 7d usage segment at or above this percentage")
+	common.BoolVar(&cfg.CostProjection, "cost-projection", getEnvBool("CLAUDE_STATUS_COST_PROJECTION", true), "Show the month-end cost forecast, e.g. $350.75 → ~$610/m (fixed aggregation only)")
+	common.StringVar(&cfg.CostUnit, "cost-unit", getEnv("CLAUDE_STATUS_COST_UNIT", "dollars"), "Show costs in dollars, tokens (1.2M tok/d) or both")
+	common.BoolVar(&cfg.CostAsync, "cost-async", getEnvBool("CLAUDE_STATUS_COST_ASYNC", true), "Show costs as last scanned and scan the logs in the background (default: true)")
+	common.BoolVar(&cfg.CostBreakdown, "cost-breakdown", getEnvBool("CLAUDE_STATUS_COST_BREAKDOWN", false), "Split each cost period by model family, e.g. $12.30 (op $9.10, so $3.20)/d")
+	common.StringVar(&cfg.GitScope, "git-scope", getEnv("CLAUDE_STATUS_GIT_SCOPE", ""), "Show repo:subdir in nested repos and in monorepo subprojects matching these patterns (e.g. \"packages/*,apps/*\"), with status limited to the subproject")
+	common.StringVar(&cfg.GitUpstreams, "git-upstreams", getEnv("CLAUDE_STATUS_GIT_UPSTREAMS", "auto"), "Remotes to show ahead/behind for besides the branch's upstream: auto|none|comma-separated remotes")
+	common.StringVar(&cfg.GitUntracked, "git-untracked", getEnv("CLAUDE_STATUS_GIT_UNTRACKED", "normal"), "Untracked files: normal (counted) or no (not looked for, faster in huge repos)")
+	common.BoolVar(&cfg.GitLastCommit, "git-last-commit", getEnvBool("CLAUDE_STATUS_GIT_LAST_COMMIT", false), "Show the latest commit's age and subject after the branch, e.g. main · 2h ago fix parser")
+	common.StringVar(&cfg.DirSource, "dir-source", getEnv("CLAUDE_STATUS_DIR_SOURCE", "cwd"), "Directory shown: cwd (the current one) or project (where Claude Code was started)")
+	common.BoolVar(&cfg.ProjectName, "project-name", getEnvBool("CLAUDE_STATUS_PROJECT_NAME", false), "Show the name from the nearest go.mod, package.json, Cargo.toml or pyproject.toml instead of the directory")
+	common.StringVar(&cfg.GitStyle, "git-style", getEnv("CLAUDE_STATUS_GIT_STYLE", "counts"), "Git status indicators: counts (!3 +2 ?5) or flags (?+!)")
+	common.BoolVar(&cfg.Telemetry, "telemetry", getEnvBool("CLAUDE_STATUS_TELEMETRY", false), "Send an anonymous daily report of version, OS and enabled features (see: telemetry preview)")
+	common.IntVar(&cfg.RetentionDays, "retention-days", getEnvInt("CLAUDE_STATUS_RETENTION_DAYS", DefaultRetentionDays), "Days of cost and usage history to keep")
+	common.Float64Var(&cfg.BudgetMonthly, "budget-monthly", getEnvFloat("CLAUDE_STATUS_BUDGET_MONTHLY", 0), "Monthly budget in dollars; warn when the forecast exhausts it before month end (0 disables)")
+	common.Float64Var(&cfg.BudgetWeekly, "budget-weekly", getEnvFloat("CLAUDE_STATUS_BUDGET_WEEKLY", 0), "Weekly budget in dollars (0 disables)")
+	common.Float64Var(&cfg.BudgetDaily, "budget-daily", getEnvFloat("CLAUDE_STATUS_BUDGET_DAILY", 0), "Daily budget in dollars (0 disables)")
+	common.BoolVar(&cfg.BudgetPercent, "budget-percent", getEnvBool("CLAUDE_STATUS_BUDGET_PERCENT", false), "Show the share of each budget used, e.g. $80.10/w (82%)")
+	common.BoolVar(&cfg.BudgetNotify, "budget-notify", getEnvBool("CLAUDE_STATUS_BUDGET_NOTIFY", false), "Desktop notification when a daily, weekly or monthly budget is exceeded")
+	common.StringVar(&cfg.WebhookURL, "webhook", getEnv("CLAUDE_STATUS_WEBHOOK", ""), "Post an alert to this URL when the 5h limit is reached or a budget is exceeded, once per window or period")
+	common.StringVar(&cfg.WebhookFormat, "webhook-format", getEnv("CLAUDE_STATUS_WEBHOOK_FORMAT", "json"), "Webhook payload: json (generic event) or slack (incoming webhook message)")
+	common.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", getEnv("CLAUDE_STATUS_OTLP_ENDPOINT", ""), "Push cost and usage gauges to this OpenTelemetry collector over OTLP/HTTP, e.g. http://localhost:4318")
+	common.StringVar(&cfg.OTLPHeaders, "otlp-headers", getEnv("CLAUDE_STATUS_OTLP_HEADERS", ""), "Comma-separated key=value headers sent to the collector, e.g. Authorization=Bearer xyz")
+	common.DurationVar(&cfg.OTLPInterval, "otlp-interval", getEnvDuration("CLAUDE_STATUS_OTLP_INTERVAL", DefaultOTLPInterval), "Minimum time between pushes to the collector")
+	common.BoolVar(&cfg.Daemon, "daemon", false, "Run as a daemon that caches usage and cost data for other invocations (git state and output are still collected by each invocation)")
+	common.BoolVar(&cfg.UseDaemon, "use-daemon", getEnvBool("CLAUDE_STATUS_USE_DAEMON", true), "Use a running daemon's data when available")
+	common.StringVar(&cfg.Record, "record", "", "Write an anonymized bundle of this render to `file` for bug reports")
+	common.StringVar(&cfg.Replay, "replay", "", "Reproduce the render recorded in a bundle `file`")
+	common.BoolVar(&cfg.Explain, "explain", false, "Explain each segment: data source, why it's missing, related options")
+	common.BoolVar(&cfg.Offline, "offline", getEnvBool("CLAUDE_STATUS_OFFLINE", false), "Make no network requests: usage from the cache, built-in pricing, no update checks")
+	common.StringVar(&cfg.CI, "ci", getEnv("CLAUDE_STATUS_CI", "auto"), "CI mode without network, cache writes or updates: auto|true|false (auto detects CI and read-only caches)")
+	common.IntVar(&cfg.Deadline, "deadline", getEnvInt("CLAUDE_STATUS_DEADLINE", 300), "Render with cached data for components slower than this many milliseconds (0 waits for all)")
+	common.BoolVar(&cfg.ClaudeDiscovery, "claude-discovery", getEnvBool("CLAUDE_STATUS_CLAUDE_DISCOVERY", false), "Fall back to the claude CLI to find credentials and subscription type")
+	common.BoolVar(&cfg.RefreshToken, "refresh-token", getEnvBool("CLAUDE_STATUS_REFRESH_TOKEN", false), "Refresh an expired OAuth token instead of waiting for Claude Code to (rotates Claude Code's refresh token)")
+	common.StringVar(&cfg.Output, "output", getEnv("CLAUDE_STATUS_OUTPUT", "text"), "Output format: text|json")
+	common.StringVar(&cfg.Segments, "segments", getEnv("CLAUDE_STATUS_SEGMENTS", ""), "Comma-separated segments to show (default: all)")
+	common.IntVar(&cfg.Lines, "lines", getEnvInt("CLAUDE_STATUS_LINES", 0), "Built-in layout: 1 (one line), 2 (session, then usage, costs and activity) or 3 lines (default: status and activity lines)")
+	common.StringVar(&cfg.Format, "format", getEnv("CLAUDE_STATUS_FORMAT", ""), "Segment layout template, e.g. \"{usage} {dir} {git}\"")
+	common.IntVar(&cfg.MaxWidth, "max-width", getEnvInt("CLAUDE_STATUS_MAX_WIDTH", 0), "Maximum line width in cells; segments that don't fit are demoted by priority (0 = no limit)")
+	common.BoolVar(&cfg.AutoWidth, "auto-width", getEnvBool("CLAUDE_STATUS_AUTO_WIDTH", true), "Without --max-width, fit lines into the terminal width from the session input or $COLUMNS")
+	common.StringVar(&cfg.Overflow, "overflow", getEnv("CLAUDE_STATUS_OVERFLOW", "line"), "Segments that don't fit --max-width: line (moved to an extra line) or drop")
+
+	// Core segments, on unless turned off
+	for _, seg := range []struct {
+		hide *bool
+		name string
+		env  string
+	}{
+		{&cfg.HideDir, "dir", "CLAUDE_STATUS_DIR"},
+		{&cfg.HideGit, "git", "CLAUDE_STATUS_GIT"},
+		{&cfg.HideModel, "model", "CLAUDE_STATUS_MODEL"},
+		{&cfg.HideSubscription, "subscription", "CLAUDE_STATUS_SUBSCRIPTION"},
+		{&cfg.HideCost, "cost", "CLAUDE_STATUS_COST"},
+		{&cfg.HideUsage, "usage", "CLAUDE_STATUS_USAGE"},
+	} {
+		*seg.hide = !getEnvBool(seg.env, true)
+		common.Var(hideFlag{seg.hide}, "show-"+seg.name, "Show the "+seg.name+" segment (default: true)")
+	}
+
+	// Feature flags for new components (all but the note default to true)
+	common.BoolVar(&cfg.ShowContext, "show-context", getEnvBool("CLAUDE_STATUS_CONTEXT", true), "Show context window usage")
+	common.BoolVar(&cfg.ShowCompact, "show-compact", getEnvBool("CLAUDE_STATUS_COMPACT", false), "Warn with a flashing COMPACT SOON before Claude Code compacts the context")
+	common.IntVar(&cfg.CompactWarn, "compact-warn", getEnvInt("CLAUDE_STATUS_COMPACT_WARN", 80), "Context usage percentage from which --show-compact warns")
+	common.BoolVar(&cfg.ShowTools, "show-tools", getEnvBool("CLAUDE_STATUS_TOOLS", true), "Show tool activity")
+	common.StringVar(&cfg.ToolsStyle, "tools-style", getEnv("CLAUDE_STATUS_TOOLS_STYLE", "full"), "Tool activity as the full tools segment (full) or the running tool after the model (model)")
+	common.BoolVar(&cfg.ShowErrors, "show-errors", getEnvBool("CLAUDE_STATUS_ERRORS", false), "Warn when the latest tool calls all failed, e.g. ⚠ 3 errors")
+	common.IntVar(&cfg.ErrorStreak, "error-streak", getEnvInt("CLAUDE_STATUS_ERROR_STREAK", 3), "Tool errors in a row from which --show-errors warns")
+	common.BoolVar(&cfg.ShowSummary, "show-summary", getEnvBool("CLAUDE_STATUS_SUMMARY", false), "Show how often the session called the tracked tools, e.g. R12 E5 B8")
+	common.StringVar(&cfg.SummaryTools, "summary-tools", getEnv("CLAUDE_STATUS_SUMMARY_TOOLS", DefaultSummaryTools), "Tools counted by --show-summary as tool[+tool][=label], labelled with their first letter by default")
+	common.IntVar(&cfg.SummaryMin, "summary-min", getEnvInt("CLAUDE_STATUS_SUMMARY_MIN", 10), "Tracked tool calls before the summary appears")
+	common.IntVar(&cfg.TranscriptTail, "transcript-tail", getEnvInt("CLAUDE_STATUS_TRANSCRIPT_TAIL", DefaultTranscriptTail), "Read only the last this many KB of a long transcript, further back only for the todo list (0 reads it whole)")
+	common.BoolVar(&cfg.ShowAgents, "show-agents", getEnvBool("CLAUDE_STATUS_AGENTS", true), "Show agent activity")
+	common.BoolVar(&cfg.Spinner, "spinner", getEnvBool("CLAUDE_STATUS_SPINNER", false), "Animate the marker of running tools and agents across renders")
+	common.BoolVar(&cfg.ShowTodos, "show-todos", getEnvBool("CLAUDE_STATUS_TODOS", true), "Show todo progress")
+	common.BoolVar(&cfg.ShowDuration, "show-duration", getEnvBool("CLAUDE_STATUS_DURATION", true), "Show session duration")
+	common.BoolVar(&cfg.ShowChanges, "show-changes", getEnvBool("CLAUDE_STATUS_CHANGES", false), "Show the lines added and removed by the session's edits")
+	common.BoolVar(&cfg.ShowHistory, "show-history", getEnvBool("CLAUDE_STATUS_HISTORY", false), "Show the last 7 days of cost as a sparkline")
+	common.BoolVar(&cfg.ShowCommits, "show-commits", getEnvBool("CLAUDE_STATUS_COMMITS", false), "Show how many commits were made today in the repo")
+	common.BoolVar(&cfg.ShowBase, "show-base", getEnvBool("CLAUDE_STATUS_BASE", false), "Show how far the branch has diverged from the default branch, e.g. main↓12")
+	common.BoolVar(&cfg.ShowSession, "show-session", getEnvBool("CLAUDE_STATUS_SESSION", false), "Show what the current session has cost so far")
+	common.BoolVar(&cfg.ShowStyle, "show-style", getEnvBool("CLAUDE_STATUS_STYLE", false), "Show the output style Claude Code answers in, unless it's the default")
+	common.BoolVar(&cfg.ShowVersion, "show-version", getEnvBool("CLAUDE_STATUS_VERSION", false), "Show Claude Code's version")
+	common.BoolVar(&cfg.ShowNote, "show-note", getEnvBool("CLAUDE_STATUS_NOTE", false), "Show the session's latest note (see: note)")
+
+	// Custom segments, e.g. --custom-segment k8s="kubectl config current-context"
+	parseCustomSegments(customSegmentsFlag{segments: &cfg.CustomSegments}, "CLAUDE_STATUS_CUSTOM_SEGMENTS")
+	parseCustomSegments(customSegmentsFlag{segments: &cfg.CustomSegments, expr: true}, "CLAUDE_STATUS_EXPR_SEGMENTS")
+	common.Var(customSegmentsFlag{segments: &cfg.CustomSegments}, "custom-segment", "Add a segment `name=command` showing the first line the command prints (repeatable)")
+	common.Var(customSegmentsFlag{segments: &cfg.CustomSegments, expr: true}, "expr-segment", "Add a segment `name=expression` showing what the expression gives for the collected data (repeatable)")
+	common.DurationVar(&cfg.CustomTimeout, "custom-timeout", getEnvDuration("CLAUDE_STATUS_CUSTOM_TIMEOUT", DefaultCustomTimeout), "How long a custom segment's command may run before it's shown from cache")
+	common.DurationVar(&cfg.CustomTTL, "custom-ttl", getEnvDuration("CLAUDE_STATUS_CUSTOM_TTL", DefaultCustomTTL), "Reuse a custom segment's output for this long before running its command again (0 = every render)")
+
+	// Display rules, e.g. --show-if "cost=cost.daily > 1"
+	parseRules(rulesFlag{rules: &cfg.Rules, show: true}, "CLAUDE_STATUS_SHOW_IF")
+	parseRules(rulesFlag{rules: &cfg.Rules}, "CLAUDE_STATUS_HIDE_IF")
+	common.Var(rulesFlag{rules: &cfg.Rules, show: true}, "show-if", "Show a segment only while a condition holds, as `segment=condition` (repeatable)")
+	common.Var(rulesFlag{rules: &cfg.Rules}, "hide-if", "Hide a segment while a condition holds, as `segment=condition` (repeatable)")
+
+	// A subcommand's own flag wins over a common flag of the same name
+	own := make(map[string]bool)
+	common.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+		} else {
+			own[f.Name] = true
+		}
+	})
+	fromFile := applyConfigFile(fs)
+	fs.Parse(args)
+	cfg.recordSources(common, own, fromFile, fs, args)
+	cfg.validateTTLs()
+	cfg.validateOptions(common)
+	cfg.checkEnv()
+	cfg.applyCI()
 	return cfg
 }
 
+// hideFlag is a --show-<segment> flag stored as whether it's hidden
+type hideFlag struct{ hide *bool }
+
+func (f hideFlag) IsBoolFlag() bool { return true }
+
+func (f hideFlag) String() string {
+	return strconv.FormatBool(f.hide == nil || !*f.hide)
+}
+
+func (f hideFlag) Set(value string) error {
+	show, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*f.hide = !show
+	return nil
+}
+
+// TTL limits: usage and update checks are rate limited by the APIs behind
+// them, pricing rarely changes, git status older than a minute would be
+// misleading, and collectors needn't hear from every render
+const (
+	minCacheTTL     = 30 // seconds
+	minPricingTTL   = time.Hour
+	minUpdateTTL    = time.Hour
+	maxGitTTL       = time.Minute
+	minOTLPInterval = 10 * time.Second
+	maxCustomTime   = 10 * time.Second
+)
+
+// validateTTLs replaces negative TTLs with their defaults and clamps the
+// rest to their limits
+func (c *Config) validateTTLs() {
+	fix := func(name string, from, to any) {
+		c.problem("--"+name, c.Source(name), "%v is out of range, using %v", from, to)
+	}
+	switch {
+	case c.CacheTTL < 0:
+		fix("cache-ttl", c.CacheTTL, DefaultCacheTTL)
+		c.CacheTTL = DefaultCacheTTL
+	case c.CacheTTL < minCacheTTL:
+		fix("cache-ttl", c.CacheTTL, minCacheTTL)
+		c.CacheTTL = minCacheTTL
+	}
+	if c.RenderCacheTTL < 0 {
+		fix("render-cache-ttl", c.RenderCacheTTL, DefaultRenderCacheTTL)
+		c.RenderCacheTTL = DefaultRenderCacheTTL
+	}
+	switch {
+	case c.PricingTTL < 0:
+		fix("pricing-ttl", c.PricingTTL, DefaultPricingTTL)
+		c.PricingTTL = DefaultPricingTTL
+	case c.PricingTTL < minPricingTTL:
+		fix("pricing-ttl", c.PricingTTL, minPricingTTL)
+		c.PricingTTL = minPricingTTL
+	}
+	switch {
+	case c.UpdateTTL < 0:
+		fix("update-ttl", c.UpdateTTL, DefaultUpdateTTL)
+		c.UpdateTTL = DefaultUpdateTTL
+	case c.UpdateTTL < minUpdateTTL:
+		fix("update-ttl", c.UpdateTTL, minUpdateTTL)
+		c.UpdateTTL = minUpdateTTL
+	}
+	switch {
+	case c.GitTTL < 0:
+		fix("git-ttl", c.GitTTL, DefaultGitTTL)
+		c.GitTTL = DefaultGitTTL
+	case c.GitTTL > maxGitTTL:
+		fix("git-ttl", c.GitTTL, maxGitTTL)
+		c.GitTTL = maxGitTTL
+	}
+	if c.GitTimeout < 0 {
+		fix("git-status-timeout", c.GitTimeout, time.Duration(0))
+		c.GitTimeout = 0
+	}
+	if c.OTLPEndpoint != "" && c.OTLPInterval < minOTLPInterval {
+		fix("otlp-interval", c.OTLPInterval, minOTLPInterval)
+		c.OTLPInterval = minOTLPInterval
+	}
+	if c.CustomTTL < 0 {
+		fix("custom-ttl", c.CustomTTL, time.Duration(0))
+		c.CustomTTL = 0
+	}
+	switch {
+	case c.CustomTimeout <= 0:
+		fix("custom-timeout", c.CustomTimeout, DefaultCustomTimeout)
+		c.CustomTimeout = DefaultCustomTimeout
+	case c.CustomTimeout > maxCustomTime:
+		fix("custom-timeout", c.CustomTimeout, maxCustomTime)
+		c.CustomTimeout = maxCustomTime
+	}
+}
+
+// PricingMaxAge returns how long fetched pricing is used
+func (c *Config) PricingMaxAge() time.Duration {
+	if c.PricingTTL <= 0 {
+		return DefaultPricingTTL
+	}
+	return c.PricingTTL
+}
+
+// UpdateInterval returns the time between update checks
+func (c *Config) UpdateInterval() time.Duration {
+	if c.UpdateTTL <= 0 {
+		return DefaultUpdateTTL
+	}
+	return c.UpdateTTL
+}
+
+// RetentionCutoff returns the time before which collected history is dropped
+func (c *Config) RetentionCutoff(now time.Time) time.Time {
+	days := c.RetentionDays
+	if days <= 0 {
+		days = DefaultRetentionDays
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+// SegmentEnabled reports whether the named segment should be collected and shown
+func (c *Config) SegmentEnabled(name string) bool {
+	if c.Format != "" && !strings.Contains(c.Format, "{"+name+"}") {
+		return false
+	}
+
+	if c.Segments != "" {
+		listed := false
+		for _, s := range strings.Split(c.Segments, ",") {
+			s = strings.TrimSpace(s)
+			// "usage" covers all usage windows
+			if s == name || (s == "usage" && (name == "usage7d" || name == "opus")) {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			return false
+		}
+	}
+
+	switch name {
+	case "dir":
+		return !c.HideDir
+	case "git":
+		return !c.HideGit
+	case "model":
+		return !c.HideModel
+	case "subscription":
+		return !c.HideSubscription
+	case "cost":
+		return !c.HideCost
+	case "usage", "usage7d", "opus":
+		return !c.HideUsage
+	case "context":
+		return c.ShowContext
+	case "tools":
+		return c.ShowTools
+	case "agents":
+		return c.ShowAgents
+	case "todos":
+		return c.ShowTodos
+	case "duration":
+		return c.ShowDuration
+	case "note":
+		return c.ShowNote
+	case "history":
+		return c.ShowHistory
+	case "commits":
+		return c.ShowCommits
+	case "base":
+		return c.ShowBase
+	case "session":
+		return c.ShowSession
+	case "changes":
+		return c.ShowChanges
+	case "summary":
+		return c.ShowSummary
+	case "errors":
+		return c.ShowErrors
+	case "style":
+		return c.ShowStyle
+	case "version":
+		return c.ShowVersion
+	case "compact":
+		return c.ShowCompact
+	}
+	return true
+}
+
+// AnySegmentEnabled reports whether at least one of the named segments is enabled
+func (c *Config) AnySegmentEnabled(names ...string) bool {
+	for _, name := range names {
+		if c.SegmentEnabled(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// readEnv returns the environment variable key, noting that it's known
+func readEnv(key string) string {
+	envKeys[key] = true
+	return os.Getenv(key)
+}
+
+// envProblem reports an environment variable whose value can't be used
+func envProblem(key, val, want string, using any) {
+	Get().problem(key, "environment", "%q isn't %s, using %v", val, want, using)
+}
+
 func getEnv(key, defaultVal string) string {
-	if val := os.Getenv(key); val != "" {
+	if val := readEnv(key); val != "" {
 		return val
 	}
 	return defaultVal
 }
 
 func getEnvInt(key string, defaultVal int) int {
-	if val := os.Getenv(key); val != "" {
+	if val := readEnv(key); val != "" {
 		if i, err := strconv.Atoi(val); err == nil {
 			return i
 		}
+		envProblem(key, val, "a whole number", defaultVal)
+	}
+	return defaultVal
+}
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if val := readEnv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+		envProblem(key, val, "a number", defaultVal)
+	}
+	return defaultVal
+}
+
+// getEnvDuration parses durations like "90s" or "24h"; a bare number is
+// taken as seconds
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if val := readEnv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+		if i, err := strconv.Atoi(val); err == nil {
+			return time.Duration(i) * time.Second
+		}
+		envProblem(key, val, "a duration like 90s", defaultVal)
 	}
 	return defaultVal
 }
 
+// getEnvBool is true for "true", "1" or "yes" and false for anything else
 func getEnvBool(key string, defaultVal bool) bool {
-	if val := os.Getenv(key); val != "" {
-		return val == "true" || val == "1" || val == "yes"
+	if val := readEnv(key); val != "" {
+		on := val == "true" || val == "1" || val == "yes"
+		if !on && val != "false" && val != "0" && val != "no" {
+			envProblem(key, val, "true, 1, yes, false, 0 or no", false)
+		}
+		return on
 	}
 	return defaultVal
 }
 
-// DebugLog writes debug output to a log file if debug mode is enabled
-func DebugLog(format string, args ...interface{}) {
-	if cfg == nil || !cfg.Debug {
-		return
+// Permissions for everything the statusline writes: caches hold account
+// usage and spend, so they are kept private to the user
+const (
+	PrivateDirMode  os.FileMode = 0700
+	PrivateFileMode os.FileMode = 0600
+)
+
+// HomeDir returns the user's home directory: $HOME, or %USERPROFILE% on
+// Windows (empty if unknown)
+func HomeDir() string {
+	home, _ := os.UserHomeDir()
+	return home
+}
+
+// CacheDir returns the cache directory, creating it private to the user
+// unless read-only:
+// --cache-dir (CLAUDE_STATUS_CACHE_DIR), else claude-code-statusline under
+// XDG_CACHE_HOME, or ~/.cache (%LocalAppData% on Windows)
+func CacheDir() string {
+	dir := os.Getenv("CLAUDE_STATUS_CACHE_DIR")
+	if cfg != nil && cfg.CacheDir != "" {
+		dir = cfg.CacheDir
 	}
-	f, err := os.OpenFile("/tmp/claude-statusline.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return
+	if dir == "" {
+		base := os.Getenv("XDG_CACHE_HOME")
+		if !filepath.IsAbs(base) {
+			// The spec says relative paths are invalid and to be ignored
+			base = ""
+			if runtime.GOOS == "windows" {
+				base, _ = os.UserCacheDir()
+			}
+			if base == "" {
+				base = filepath.Join(HomeDir(), ".cache")
+			}
+		}
+		dir = filepath.Join(base, "claude-code-statusline")
+	}
+	if cfg != nil && cfg.ReadOnly {
+		return dir
+	}
+	os.MkdirAll(dir, PrivateDirMode)
+	// Tighten directories created by older versions
+	os.Chmod(dir, PrivateDirMode)
+	return dir
+}
+
+// ClaudeDir returns the directory Claude Code keeps its data in (projects,
+// credentials, settings): --data-dir (CLAUDE_STATUS_DATA_DIR), else the
+// claude CLI's own CLAUDE_CONFIG_DIR, else ~/.claude, or claude under
+// XDG_CONFIG_HOME (~/.config) when only that one exists. On Windows ~ is
+// %USERPROFILE%, where the claude CLI keeps .claude too.
+func ClaudeDir() string {
+	if cfg != nil && cfg.DataDir != "" {
+		return cfg.DataDir
+	}
+	for _, env := range []string{"CLAUDE_STATUS_DATA_DIR", "CLAUDE_CONFIG_DIR"} {
+		if dir := os.Getenv(env); dir != "" {
+			return dir
+		}
+	}
+
+	home := filepath.Join(HomeDir(), ".claude")
+	if _, err := os.Stat(home); err == nil {
+		return home
+	}
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(HomeDir(), ".config")
+	}
+	if xdg := filepath.Join(base, "claude"); xdg != home {
+		if _, err := os.Stat(xdg); err == nil {
+			return xdg
+		}
 	}
-	defer f.Close()
-	fmt.Fprintf(f, "[%s] %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+	return home
+}
+
+// ProjectsDir returns the directory of Claude Code's session logs
+func ProjectsDir() string {
+	return filepath.Join(ClaudeDir(), "projects")
 }
 
 // CheckRequiredPlugin checks if the required plugin is installed.
@@ -106,18 +755,15 @@ func CheckRequiredPlugin() bool {
 		return true
 	}
 
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return true // Can't check, assume OK
-	}
+	claudeDir := ClaudeDir()
 
 	// Check installed_plugins.json
-	pluginsFile := filepath.Join(homeDir, ".claude", "plugins", "installed_plugins.json")
+	pluginsFile := filepath.Join(claudeDir, "plugins", "installed_plugins.json")
 	data, err := os.ReadFile(pluginsFile)
 	if err != nil {
 		// File doesn't exist or can't read - plugin system not active, clean up
-		DebugLog("Cannot read installed_plugins.json: %v", err)
-		removeStatusLineConfig(homeDir)
+		WarnLog("Cannot read installed_plugins.json: %v", err)
+		removeStatusLineConfig(claudeDir)
 		return false
 	}
 
@@ -125,7 +771,7 @@ func CheckRequiredPlugin() bool {
 		Plugins map[string]interface{} `json:"plugins"`
 	}
 	if err := json.Unmarshal(data, &pluginsData); err != nil {
-		DebugLog("Cannot parse installed_plugins.json: %v", err)
+		WarnLog("Cannot parse installed_plugins.json: %v", err)
 		return true // Can't parse, assume OK
 	}
 
@@ -140,14 +786,14 @@ func CheckRequiredPlugin() bool {
 	}
 
 	if pluginKey == "" {
-		DebugLog("Plugin %s not found in installed plugins, cleaning up", cfg.RequirePlugin)
-		removeStatusLineConfig(homeDir)
+		InfoLog("Plugin %s not found in installed plugins, cleaning up", cfg.RequirePlugin)
+		removeStatusLineConfig(claudeDir)
 		fmt.Print("\033[2mstatusline plugin disabled\033[0m")
 		return false
 	}
 
 	// Also check if plugin is enabled in settings.json
-	settingsFile := filepath.Join(homeDir, ".claude", "settings.json")
+	settingsFile := filepath.Join(claudeDir, "settings.json")
 	settingsData, err := os.ReadFile(settingsFile)
 	if err == nil {
 		var settings struct {
@@ -155,8 +801,8 @@ func CheckRequiredPlugin() bool {
 		}
 		if json.Unmarshal(settingsData, &settings) == nil {
 			if enabled, exists := settings.EnabledPlugins[pluginKey]; exists && !enabled {
-				DebugLog("Plugin %s is disabled in enabledPlugins, cleaning up", pluginKey)
-				removeStatusLineConfig(homeDir)
+				InfoLog("Plugin %s is disabled in enabledPlugins, cleaning up", pluginKey)
+				removeStatusLineConfig(claudeDir)
 				fmt.Print("\033[2mstatusline plugin disabled\033[0m")
 				return false
 			}
@@ -167,8 +813,8 @@ func CheckRequiredPlugin() bool {
 }
 
 // removeStatusLineConfig removes the statusLine key from settings.json
-func removeStatusLineConfig(homeDir string) {
-	settingsFile := filepath.Join(homeDir, ".claude", "settings.json")
+func removeStatusLineConfig(claudeDir string) {
+	settingsFile := filepath.Join(claudeDir, "settings.json")
 	data, err := os.ReadFile(settingsFile)
 	if err != nil {
 		return
@@ -190,6 +836,14 @@ func removeStatusLineConfig(homeDir string) {
 		return
 	}
 
-	os.WriteFile(settingsFile, newData, 0644)
-	DebugLog("Removed statusLine from settings.json")
+	// Keep the user's own permissions on their settings file
+	mode := PrivateFileMode
+	if info, err := os.Stat(settingsFile); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if cfg.ReadOnly {
+		return
+	}
+	os.WriteFile(settingsFile, newData, mode)
+	InfoLog("Removed statusLine from settings.json")
 }
@@ -1,8 +1,16 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetEnvBool(t *testing.T) {
@@ -151,3 +159,730 @@ func TestConfigFeatureFlagOverrides(t *testing.T) {
 		t.Error("CLAUDE_STATUS_TOOLS should be false when set to '0'")
 	}
 }
+
+func TestParseArgsSubcommandFlagWins(t *testing.T) {
+	t.Setenv("CLAUDE_STATUS_FORMAT", "{git}")
+
+	fs := flag.NewFlagSet("report weekly", flag.ContinueOnError)
+	format := fs.String("format", "text", "Output format")
+	c := ParseArgs(fs, []string{"--format=markdown", "--aggregation", "sliding"})
+
+	if *format != "markdown" {
+		t.Errorf("subcommand --format = %q, want markdown", *format)
+	}
+	if c.Format != "{git}" {
+		t.Errorf("Format = %q, want the env default untouched", c.Format)
+	}
+	if c.AggregationMode != "sliding" {
+		t.Errorf("AggregationMode = %q, want common flags still parsed", c.AggregationMode)
+	}
+}
+
+func TestShowSegmentFlags(t *testing.T) {
+	defer func() { cfg = nil }()
+	t.Setenv("CLAUDE_STATUS_CONFIG", filepath.Join(t.TempDir(), "none.json"))
+	t.Setenv("CLAUDE_STATUS_COST", "false")
+
+	c := ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--show-git=false"})
+	for name, want := range map[string]bool{"dir": true, "git": false, "cost": false, "usage": true, "usage7d": true} {
+		if got := c.SegmentEnabled(name); got != want {
+			t.Errorf("SegmentEnabled(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	c = ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--show-usage=false", "--show-cost"})
+	if c.SegmentEnabled("opus") || !c.SegmentEnabled("cost") {
+		t.Errorf("expected --show-usage=false to hide opus and --show-cost to show cost")
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	defer func() { cfg = nil }()
+	file := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("CLAUDE_STATUS_CONFIG", file)
+	t.Setenv("CLAUDE_STATUS_COST", "true")
+	os.WriteFile(file, []byte(`{"show-cost": false, "segments": ["dir", "cost"], "cache-ttl": 60, "aggregation": "sliding", "colour": "none"}`), 0600)
+
+	c := ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--cache-ttl=90"})
+	if !c.HideCost {
+		t.Error("expected the file to override CLAUDE_STATUS_COST")
+	}
+	if c.Segments != "dir,cost" || c.AggregationMode != "sliding" {
+		t.Errorf("Segments = %q, AggregationMode = %q, want values from the file", c.Segments, c.AggregationMode)
+	}
+	if c.CacheTTL != 90 {
+		t.Errorf("CacheTTL = %d, want the command line to override the file", c.CacheTTL)
+	}
+}
+
+func TestCustomSegments(t *testing.T) {
+	defer func() { cfg = nil }()
+	file := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("CLAUDE_STATUS_CONFIG", file)
+	t.Setenv("CLAUDE_STATUS_CUSTOM_SEGMENTS", "k8s=kubectl config current-context\ngit=echo shadowed\n\naws=echo env")
+	t.Setenv("CLAUDE_STATUS_EXPR_SEGMENTS", "spend=cost.daily > 5 ? cost.daily : nil\nbad=1 +")
+	os.WriteFile(file, []byte(`{"custom-segment": {"aws": "aws configure get region", "node": "node -v | cut -c2-,3"}}`), 0600)
+
+	c := ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), []string{
+		"--custom-segment", "py=python3 --version", "--custom-segment=k8s=kubectx -c", "--expr-segment", "aws=upper(custom.aws)",
+	})
+	var got []string
+	for _, seg := range c.CustomSegments {
+		if seg.Expr != nil {
+			got = append(got, seg.Name+"=("+seg.Expr.String()+")")
+		} else {
+			got = append(got, seg.Name+"="+seg.Command)
+		}
+	}
+	want := []string{"k8s=kubectx -c", "aws=(upper(custom.aws))", "spend=(cost.daily > 5 ? cost.daily : nil)", "node=node -v | cut -c2-,3", "py=python3 --version"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CustomSegments = %q, want %q", got, want)
+	}
+	if !c.ExprReads("cost") || !c.ExprReads("custom.aws") || c.ExprReads("usage", "custom.k8s") {
+		t.Error("unexpected ExprReads result")
+	}
+	if seg, ok := c.CustomSegment("py"); !ok || seg.Command != "python3 --version" {
+		t.Errorf("CustomSegment(py) = %v, %v", seg, ok)
+	}
+
+	for _, value := range []string{"dir=pwd", "k 8s=kubectl", "=pwd", "empty="} {
+		var segments []CustomSegment
+		if err := (customSegmentsFlag{segments: &segments}).Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", value)
+		}
+	}
+	for _, value := range []string{"x=1 +", "x=", "x=(a"} {
+		var segments []CustomSegment
+		if err := (customSegmentsFlag{segments: &segments, expr: true}).Set(value); err == nil {
+			t.Errorf("expression Set(%q) succeeded, want an error", value)
+		}
+	}
+
+	tests := []struct {
+		format string
+		lines  int
+		want   string
+	}{
+		{"", 1, LineFormats[1] + " {k8s} {py}"},
+		{"", 3, strings.Replace(LineFormats[3], "\n", " {k8s} {py}\n", 1)},
+		{"{py} {dir}", 0, "{py} {dir}"},
+	}
+	for _, tt := range tests {
+		c := &Config{Format: tt.format, Lines: tt.lines, CustomSegments: []CustomSegment{{Name: "k8s", Command: "kubectl"}, {Name: "py", Command: "python3"}}}
+		if got := c.LayoutFormat(); got != tt.want {
+			t.Errorf("LayoutFormat() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	defer func() { cfg = nil }()
+	file := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("CLAUDE_STATUS_CONFIG", file)
+	t.Setenv("CLAUDE_STATUS_SHOW_IF", "usage=usage.percent > 50\ncost=(")
+	os.WriteFile(file, []byte(`{"hide-if": {"git": "git.branch == 'main' && git.clean"}}`), 0600)
+
+	c := ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--show-if", "cost=cost.daily > 1", "--show-if=usage=usage.percent > 75"})
+	var got []string
+	for _, rule := range c.Rules {
+		kind := "hide-if"
+		if rule.Show {
+			kind = "show-if"
+		}
+		got = append(got, kind+" "+rule.Segment+"="+rule.Cond.String())
+	}
+	want := []string{"show-if usage=usage.percent > 75", "hide-if git=git.branch == 'main' && git.clean", "show-if cost=cost.daily > 1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Rules = %q, want %q", got, want)
+	}
+	if len(c.SegmentRules("git")) != 1 || len(c.SegmentRules("dir")) != 0 {
+		t.Error("unexpected SegmentRules result")
+	}
+	if !c.ExprReads("git") || !c.ExprReads("cost") {
+		t.Error("expected ExprReads to include the rules of shown segments")
+	}
+	c.Segments = "dir"
+	if c.ExprReads("git", "cost", "usage") {
+		t.Error("expected ExprReads to skip the rules of hidden segments")
+	}
+
+	for _, value := range []string{"=cost.daily > 1", "cost=", "cost=1 +"} {
+		var rules []Rule
+		if err := (rulesFlag{rules: &rules, show: true}).Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestGetEnvDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"90s", 90 * time.Second},
+		{"24h", 24 * time.Hour},
+		{"120", 2 * time.Minute},
+		{"soon", time.Hour},
+		{"", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+		if got := getEnvDuration("TEST_DURATION", time.Hour); got != tt.want {
+			t.Errorf("getEnvDuration() with %q = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTTLs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want Config
+	}{
+		{"defaults", nil, Config{CacheTTL: 300, PricingTTL: 24 * time.Hour, GitTTL: 2 * time.Second, UpdateTTL: 24 * time.Hour, RenderCacheTTL: 500}},
+		{"valid", []string{"--cache-ttl=60", "--pricing-ttl=6h", "--git-ttl=0s", "--update-ttl=168h", "--render-cache-ttl=0"},
+			Config{CacheTTL: 60, PricingTTL: 6 * time.Hour, UpdateTTL: 168 * time.Hour}},
+		{"negative use defaults", []string{"--cache-ttl=-1", "--pricing-ttl=-1s", "--git-ttl=-1s", "--update-ttl=-1s", "--render-cache-ttl=-1"},
+			Config{CacheTTL: 300, PricingTTL: 24 * time.Hour, GitTTL: 2 * time.Second, UpdateTTL: 24 * time.Hour, RenderCacheTTL: 500}},
+		{"clamped", []string{"--cache-ttl=5", "--pricing-ttl=1m", "--git-ttl=10m", "--update-ttl=0s"},
+			Config{CacheTTL: 30, PricingTTL: time.Hour, GitTTL: time.Minute, UpdateTTL: time.Hour, RenderCacheTTL: 500}},
+	}
+	// CI mode would turn the render cache off
+	t.Setenv("CLAUDE_STATUS_CI", "false")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+			got := Config{CacheTTL: c.CacheTTL, PricingTTL: c.PricingTTL, GitTTL: c.GitTTL, UpdateTTL: c.UpdateTTL, RenderCacheTTL: c.RenderCacheTTL}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TTLs = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyCI(t *testing.T) {
+	writable := t.TempDir()
+	readOnly := filepath.Join(t.TempDir(), "cache")
+	if err := os.Mkdir(readOnly, 0500); err != nil {
+		t.Fatal(err)
+	}
+	canWrite := os.WriteFile(filepath.Join(readOnly, "probe"), nil, 0600) == nil
+	defer func() { cfg = nil }()
+
+	tests := []struct {
+		name     string
+		ci       string
+		env      string
+		cacheDir string
+		want     bool
+	}{
+		{"interactive", "auto", "", writable, false},
+		{"CI variable", "auto", "true", writable, true},
+		{"CI variable false", "auto", "false", writable, false},
+		{"forced on", "true", "", writable, true},
+		{"forced off", "false", "true", writable, false},
+		{"read-only cache", "auto", "", readOnly, !canWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CI", tt.env)
+			cfg = &Config{CI: tt.ci, CacheDir: tt.cacheDir, AutoUpdate: true, CostAsync: true,
+				UseDaemon: true, Deadline: 300, RenderCacheTTL: 500, Background: "auto"}
+			cfg.applyCI()
+			if cfg.ReadOnly != tt.want || cfg.Offline != tt.want {
+				t.Fatalf("ReadOnly = %v, Offline = %v, want %v", cfg.ReadOnly, cfg.Offline, tt.want)
+			}
+			if tt.want && (cfg.AutoUpdate || cfg.CostAsync || cfg.UseDaemon || cfg.Deadline != 0 || cfg.RenderCacheTTL != 0 || cfg.Background != "dark") {
+				t.Errorf("CI mode left nondeterministic settings on: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestWriteFileReadOnly(t *testing.T) {
+	defer func() { cfg = nil }()
+	file := filepath.Join(t.TempDir(), "state.json")
+
+	cfg = &Config{ReadOnly: true}
+	if err := WriteFile(file, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("WriteFile wrote %s in read-only mode", file)
+	}
+
+	cfg.ReadOnly = false
+	if err := WriteFile(file, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("WriteFile didn't write: %v", err)
+	}
+}
+
+func TestCacheFiles(t *testing.T) {
+	defer func() { cfg = nil }()
+	cfg = &Config{}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cache.json")
+	type cache struct{ Days map[string]float64 }
+
+	if err := WriteCache(file, cache{map[string]float64{"2025-12-01": 4}}); err != nil {
+		t.Fatal(err)
+	}
+	var got cache
+	if err := ReadCache(file, &got); err != nil || got.Days["2025-12-01"] != 4 {
+		t.Fatalf("ReadCache() = %+v, %v", got, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	// Files from before the checksum header still load
+	os.WriteFile(file, []byte(`{"Days": {"2025-12-02": 5}}`), 0600)
+	if err := ReadCache(file, &got); err != nil || got.Days["2025-12-02"] != 5 {
+		t.Errorf("ReadCache(plain JSON) = %+v, %v", got, err)
+	}
+
+	for name, damage := range map[string]func([]byte) []byte{
+		"changed":   func(b []byte) []byte { return bytes.Replace(b, []byte("4"), []byte("9"), 1) },
+		"truncated": func(b []byte) []byte { return b[:len(b)-5] },
+		"not JSON":  func([]byte) []byte { return []byte(`{"Days": {`) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			WriteCache(file, cache{map[string]float64{"2025-12-01": 4}})
+			data, _ := os.ReadFile(file)
+			os.WriteFile(file, damage(data), 0600)
+
+			if err := ReadCache(file, &cache{}); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("ReadCache() error = %v, want ErrCorrupt", err)
+			}
+			if _, err := os.Stat(file); !os.IsNotExist(err) {
+				t.Error("corrupt file wasn't moved aside")
+			}
+			if moved, _ := os.ReadFile(file + ".corrupt"); !bytes.Equal(moved, damage(data)) {
+				t.Errorf("%s.corrupt = %q", file, moved)
+			}
+		})
+	}
+
+	// Read-only mode neither writes nor moves anything
+	os.WriteFile(file, []byte("garbage"), 0600)
+	cfg.ReadOnly = true
+	if err := ReadCache(file, &got); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("ReadCache() error = %v, want ErrCorrupt", err)
+	}
+	WriteCache(file, cache{})
+	if data, _ := os.ReadFile(file); string(data) != "garbage" {
+		t.Errorf("read-only mode changed the file to %q", data)
+	}
+}
+
+func TestVersionedCache(t *testing.T) {
+	defer func() { cfg = nil }()
+	cfg = &Config{}
+	file := filepath.Join(t.TempDir(), "cache.json")
+	type cache struct {
+		Version int                `json:"version"`
+		Days    map[string]float64 `json:"days"`
+		Note    string             `json:"note"`
+	}
+	migrations := Migrations{
+		// Version 2 renamed "costs" to "days"
+		2: func(obj map[string]any) error {
+			obj["days"] = obj["costs"]
+			delete(obj, "costs")
+			return nil
+		},
+		3: func(obj map[string]any) error {
+			if obj["note"] == "broken" {
+				return errors.New("can't migrate")
+			}
+			obj["note"] = "migrated"
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		want    cache
+		wantErr bool
+	}{
+		{"unversioned", `{"costs":{"2025-12-01":4}}`, cache{3, map[string]float64{"2025-12-01": 4}, "migrated"}, false},
+		{"one behind", `{"version":2,"days":{"2025-12-01":4}}`, cache{3, map[string]float64{"2025-12-01": 4}, "migrated"}, false},
+		{"current", `{"version":3,"days":{"2025-12-01":4}}`, cache{3, map[string]float64{"2025-12-01": 4}, ""}, false},
+		{"newer", `{"version":4,"days":{"2025-12-01":4}}`, cache{}, true},
+		{"failed migration", `{"version":2,"note":"broken"}`, cache{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.WriteFile(file, []byte(tt.file), 0600)
+			var got cache
+			err := ReadVersionedCache(file, &got, 3, migrations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadVersionedCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got.Version != tt.want.Version || got.Note != tt.want.Note || len(got.Days) != 1 || got.Days["2025-12-01"] != 4) {
+				t.Errorf("ReadVersionedCache() = %+v, want %+v", got, tt.want)
+			}
+			if _, err := os.Stat(file); err != nil {
+				t.Errorf("a readable cache was moved aside: %v", err)
+			}
+		})
+	}
+}
+
+func TestDebugFlag(t *testing.T) {
+	defer func() { cfg = nil }()
+	tests := []struct {
+		env       string
+		args      []string
+		wantDebug bool
+		wantLog   string
+	}{
+		{"", nil, false, ""},
+		{"true", nil, true, "file"},
+		{"stderr", nil, true, "stderr"},
+		{"", []string{"--debug"}, true, "file"},
+		{"", []string{"--debug=stderr"}, true, "stderr"},
+		{"stderr", []string{"--debug=false"}, false, "stderr"},
+	}
+	for _, tt := range tests {
+		t.Setenv("CLAUDE_STATUS_DEBUG", tt.env)
+		c := ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+		if c.Debug != tt.wantDebug || (tt.wantDebug && c.LogTarget != tt.wantLog) {
+			t.Errorf("env %q args %v: Debug=%v LogTarget=%q, want %v %q", tt.env, tt.args, c.Debug, c.LogTarget, tt.wantDebug, tt.wantLog)
+		}
+	}
+}
+
+func TestLogLevelsAndRotation(t *testing.T) {
+	defer func() { cfg = nil }()
+	cfg = &Config{CacheDir: t.TempDir(), Debug: true, LogTarget: "file", LogLevel: "warn"}
+
+	DebugLog("hidden %d", 1)
+	InfoLog("hidden %d", 2)
+	WarnLog("shown %d", 3)
+	ErrorLog("shown %d", 4)
+
+	data, err := os.ReadFile(LogFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	if strings.Contains(log, "hidden") {
+		t.Errorf("messages below --log-level logged:\n%s", log)
+	}
+	if !strings.Contains(log, "WARN  config: shown 3\n") || !strings.Contains(log, "ERROR config: shown 4\n") {
+		t.Errorf("expected levels and component prefixes, got:\n%s", log)
+	}
+
+	os.WriteFile(LogFile(), make([]byte, maxLogSize+1), PrivateFileMode)
+	ErrorLog("after rotation")
+	if info, err := os.Stat(LogFile() + ".1"); err != nil || info.Size() != maxLogSize+1 {
+		t.Errorf("expected the full log rotated to debug.log.1: %v", err)
+	}
+	if data, _ := os.ReadFile(LogFile()); !strings.HasSuffix(string(data), "after rotation\n") || len(data) > 100 {
+		t.Errorf("expected a fresh debug.log, got %d bytes", len(data))
+	}
+}
+
+func TestRetentionCutoff(t *testing.T) {
+	now := time.Date(2025, 12, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		days int
+		want time.Time
+	}{
+		{0, time.Date(2025, 11, 30, 12, 0, 0, 0, time.UTC)},
+		{90, time.Date(2025, 10, 2, 12, 0, 0, 0, time.UTC)},
+		{7, time.Date(2025, 12, 24, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		c := &Config{RetentionDays: tt.days}
+		if got := c.RetentionCutoff(now); !got.Equal(tt.want) {
+			t.Errorf("RetentionCutoff with %d days = %v, want %v", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestSegmentEnabled(t *testing.T) {
+	c := &Config{ShowContext: true, ShowTools: false}
+
+	if !c.SegmentEnabled("cost") || !c.SegmentEnabled("context") {
+		t.Error("expected all segments enabled with an empty segment list")
+	}
+	if c.SegmentEnabled("tools") {
+		t.Error("expected tools disabled by ShowTools=false")
+	}
+
+	c.Segments = "git, context,tools"
+	if c.SegmentEnabled("cost") {
+		t.Error("expected cost disabled when not listed")
+	}
+	if !c.SegmentEnabled("git") || !c.SegmentEnabled("context") {
+		t.Error("expected listed segments enabled")
+	}
+	if c.SegmentEnabled("tools") {
+		t.Error("expected listed segment to still respect its feature flag")
+	}
+	if !c.AnySegmentEnabled("cost", "git") || c.AnySegmentEnabled("cost", "usage") {
+		t.Error("unexpected AnySegmentEnabled result")
+	}
+
+	c.Segments = "usage"
+	if !c.SegmentEnabled("usage7d") || !c.SegmentEnabled("opus") {
+		t.Error("expected usage to enable all usage windows")
+	}
+}
+
+func TestSegmentEnabledWithFormat(t *testing.T) {
+	c := &Config{Format: "{usage} {dir} {git}"}
+
+	if !c.SegmentEnabled("usage") || !c.SegmentEnabled("dir") {
+		t.Error("expected segments in the format to be enabled")
+	}
+	if c.SegmentEnabled("cost") || c.SegmentEnabled("usage7d") {
+		t.Error("expected segments missing from the format to be disabled")
+	}
+}
+
+func TestCacheDirIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions")
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// A directory left world-readable by an older version gets tightened
+	legacy := filepath.Join(home, ".cache", "claude-code-statusline")
+	if err := os.MkdirAll(legacy, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := CacheDir()
+	if dir != legacy {
+		t.Fatalf("CacheDir() = %q, want %q", dir, legacy)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != PrivateDirMode {
+		t.Errorf("cache dir has mode %o, want %o", perm, PrivateDirMode)
+	}
+}
+
+func TestCacheDirLocations(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLAUDE_STATUS_CACHE_DIR", "")
+	defer func() { cfg = nil }()
+	cfg = &Config{}
+
+	t.Setenv("XDG_CACHE_HOME", "")
+	if got, want := CacheDir(), filepath.Join(home, ".cache", "claude-code-statusline"); got != want {
+		t.Errorf("CacheDir() = %q, want %q", got, want)
+	}
+
+	xdg := filepath.Join(home, "xdg-cache")
+	t.Setenv("XDG_CACHE_HOME", xdg)
+	if got, want := CacheDir(), filepath.Join(xdg, "claude-code-statusline"); got != want {
+		t.Errorf("CacheDir() with XDG_CACHE_HOME = %q, want %q", got, want)
+	}
+	t.Setenv("XDG_CACHE_HOME", "relative")
+	if got, want := CacheDir(), filepath.Join(home, ".cache", "claude-code-statusline"); got != want {
+		t.Errorf("CacheDir() with a relative XDG_CACHE_HOME = %q, want %q", got, want)
+	}
+
+	custom := filepath.Join(home, "custom")
+	t.Setenv("CLAUDE_STATUS_CACHE_DIR", custom)
+	if got := CacheDir(); got != custom {
+		t.Errorf("CacheDir() with CLAUDE_STATUS_CACHE_DIR = %q, want %q", got, custom)
+	}
+	flagged := filepath.Join(home, "flagged")
+	cfg.CacheDir = flagged
+	if got := CacheDir(); got != flagged {
+		t.Errorf("CacheDir() with --cache-dir = %q, want %q", got, flagged)
+	}
+}
+
+func TestClaudeDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CLAUDE_STATUS_DATA_DIR", "")
+	t.Setenv("CLAUDE_CONFIG_DIR", "")
+	defer func() { cfg = nil }()
+	cfg = &Config{}
+
+	dotClaude := filepath.Join(home, ".claude")
+	if got := ClaudeDir(); got != dotClaude {
+		t.Errorf("ClaudeDir() = %q, want %q when nothing exists", got, dotClaude)
+	}
+
+	// Only the XDG location exists
+	xdg := filepath.Join(home, ".config", "claude")
+	os.MkdirAll(xdg, 0755)
+	if got := ClaudeDir(); got != xdg {
+		t.Errorf("ClaudeDir() = %q, want %q", got, xdg)
+	}
+	if got, want := ProjectsDir(), filepath.Join(xdg, "projects"); got != want {
+		t.Errorf("ProjectsDir() = %q, want %q", got, want)
+	}
+
+	// ~/.claude wins when both exist
+	os.MkdirAll(dotClaude, 0755)
+	if got := ClaudeDir(); got != dotClaude {
+		t.Errorf("ClaudeDir() = %q, want %q", got, dotClaude)
+	}
+
+	t.Setenv("CLAUDE_CONFIG_DIR", "/opt/claude")
+	if got := ClaudeDir(); got != "/opt/claude" {
+		t.Errorf("ClaudeDir() with CLAUDE_CONFIG_DIR = %q", got)
+	}
+	t.Setenv("CLAUDE_STATUS_DATA_DIR", "/mnt/data/claude")
+	if got := ClaudeDir(); got != "/mnt/data/claude" {
+		t.Errorf("ClaudeDir() with CLAUDE_STATUS_DATA_DIR = %q", got)
+	}
+	cfg.DataDir = "/srv/claude"
+	if got := ClaudeDir(); got != "/srv/claude" {
+		t.Errorf("ClaudeDir() with --data-dir = %q", got)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("CLAUDE_STATUS_CACHE_DIR", "")
+	profiles := filepath.Join(home, "profiles.json")
+	t.Setenv("CLAUDE_STATUS_PROFILES", profiles)
+	os.WriteFile(profiles, []byte(`{
+		"profiles": {
+			"work": {"paths": ["~/work"], "data_dir": "~/.claude-work", "keyring_service": "Claude Code-credentials-work"},
+			"client": {"paths": ["~/work/client"], "data_dir": "~/.claude-client"},
+			"personal": {}
+		},
+		"default": "personal"
+	}`), 0644)
+	baseCache := filepath.Join(home, ".cache", "claude-code-statusline")
+
+	tests := []struct {
+		name     string
+		profile  string // --profile
+		dataDir  string // --data-dir
+		dir      string
+		want     string
+		wantData string
+	}{
+		{"matched by path", "", "", filepath.Join(home, "work", "api"), "work", filepath.Join(home, ".claude-work")},
+		{"longest path wins", "", "", filepath.Join(home, "work", "client", "site"), "client", filepath.Join(home, ".claude-client")},
+		{"prefix isn't a parent", "", "", filepath.Join(home, "workshop"), "personal", ""},
+		{"default", "", "", filepath.Join(home, "src"), "personal", ""},
+		{"flag wins", "client", "", filepath.Join(home, "work"), "client", filepath.Join(home, ".claude-client")},
+		{"--data-dir wins", "", "/data", filepath.Join(home, "work"), "work", "/data"},
+		{"unknown profile", "nope", "", filepath.Join(home, "work"), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg = &Config{Profile: tt.profile, DataDir: tt.dataDir}
+			defer func() { cfg = nil }()
+			ApplyProfile(tt.dir)
+			if cfg.ActiveProfile != tt.want || cfg.DataDir != tt.wantData {
+				t.Errorf("profile %q with data dir %q, want %q with %q", cfg.ActiveProfile, cfg.DataDir, tt.want, tt.wantData)
+			}
+			wantCache := baseCache
+			if tt.want != "" {
+				wantCache = filepath.Join(baseCache, "profiles", tt.want)
+			}
+			if got := CacheDir(); got != wantCache {
+				t.Errorf("CacheDir() = %q, want %q", got, wantCache)
+			}
+		})
+	}
+
+	// Without a profiles file nothing changes
+	t.Setenv("CLAUDE_STATUS_PROFILES", filepath.Join(home, "missing.json"))
+	cfg = &Config{}
+	defer func() { cfg = nil }()
+	ApplyProfile(filepath.Join(home, "work"))
+	if cfg.ActiveProfile != "" || cfg.CacheDir != "" {
+		t.Errorf("config = %+v, want it untouched", cfg)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	defer func() { cfg = nil }()
+	file := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(file, []byte(`{"theme": "nrod", "colour": "none", "cache-ttl": "abc", "aggregation": "sliding"}`), 0600)
+	t.Setenv("CLAUDE_STATUS_CONFIG", file)
+	t.Setenv("CLAUDE_STATUS_CI", "false")
+	t.Setenv("CLAUDE_STATUS_INFO_MODE", "emoji")
+	t.Setenv("CLAUDE_STATUS_CACHE_TTL", "120")
+	t.Setenv("CLAUDE_STATUS_DISPLAYMODE", "minimal")
+	t.Setenv("CLAUDE_STATUS_BUDGET_DAILY", "ten")
+	t.Setenv("CLAUDE_STATUS_CONTEXT", "ture")
+
+	c := ParseArgs(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--display-mode", "Minimal", "--lines=4", "--segments=dir,gti", "--show-git=false"})
+	if c.DisplayMode != "minimal" || c.Theme != "default" || c.Lines != 0 || c.CacheTTL != 120 {
+		t.Errorf("DisplayMode = %q, Theme = %q, Lines = %d, CacheTTL = %d, want minimal, default, 0, 120",
+			c.DisplayMode, c.Theme, c.Lines, c.CacheTTL)
+	}
+
+	var got []string
+	for _, p := range c.Problems {
+		got = append(got, p.String())
+	}
+	for _, want := range []string{
+		`CLAUDE_STATUS_BUDGET_DAILY (environment): "ten" isn't a number, using 0`,
+		`CLAUDE_STATUS_CONTEXT (environment): "ture" isn't true, 1, yes, false, 0 or no, using false`,
+		`cache-ttl (config file): invalid value "abc"`,
+		`colour (config file): unknown option (did you mean colors?)`,
+		`--theme (config file): unknown value "nrod", want default|dracula|gruvbox-light|nord|solarized (did you mean nord?); using default`,
+		`--lines (command line): no built-in layout has 4 lines`,
+		`--segments (command line): unknown segment "gti" (did you mean git?)`,
+		`CLAUDE_STATUS_DISPLAYMODE (environment): unknown environment variable (did you mean CLAUDE_STATUS_DISPLAY_MODE?)`,
+	} {
+		if !strings.Contains(strings.Join(got, "\n"), want) {
+			t.Errorf("Problems have no %q:\n%s", want, strings.Join(got, "\n"))
+		}
+	}
+	if len(got) != 8 {
+		t.Errorf("got %d problems, want 8:\n%s", len(got), strings.Join(got, "\n"))
+	}
+
+	for name, want := range map[string]string{
+		"display-mode": "command line",
+		"show-git":     "command line",
+		"aggregation":  "config file",
+		"info-mode":    "env CLAUDE_STATUS_INFO_MODE",
+		"cache-ttl":    "env CLAUDE_STATUS_CACHE_TTL",
+		"output":       "default",
+	} {
+		if got := c.Source(name); got != want {
+			t.Errorf("Source(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	// A subcommand's own flag doesn't come from the common flag's variable
+	t.Setenv("CLAUDE_STATUS_FORMAT", "{git}")
+	fs := flag.NewFlagSet("report weekly", flag.ContinueOnError)
+	fs.String("format", "text", "Output format")
+	if c := ParseArgs(fs, nil); c.Source("format") != "default" {
+		t.Errorf("Source(format) = %q, want default", c.Source("format"))
+	}
+}
+
+func TestEnvNames(t *testing.T) {
+	defer func() { cfg = nil }()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	ParseArgs(fs, nil)
+	noEnv := map[string]bool{"require-plugin": true, "daemon": true, "record": true, "replay": true, "explain": true}
+	fs.VisitAll(func(f *flag.Flag) {
+		if env := envName(f.Name); !envKeys[env] && !noEnv[f.Name] {
+			t.Errorf("--%s isn't read from %s", f.Name, env)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/erwint/claude-code-statusline/internal/expr"
+)
+
+// CustomSegment is a user-defined segment showing what a command prints,
+// e.g. {Name: "k8s", Command: "kubectl config current-context"}, or what
+// an expression over the collected data gives
+type CustomSegment struct {
+	Name    string
+	Command string
+	Expr    *expr.Expr
+}
+
+// customSegmentsFlag is --custom-segment name=command, or with expr set
+// --expr-segment name=expression. Each use adds a segment, or replaces
+// one with the same name.
+type customSegmentsFlag struct {
+	segments *[]CustomSegment
+	expr     bool
+}
+
+func (f customSegmentsFlag) String() string {
+	if f.segments == nil {
+		return ""
+	}
+	var items []string
+	for _, seg := range *f.segments {
+		if f.expr && seg.Expr != nil {
+			items = append(items, seg.Name+"="+seg.Expr.String())
+		} else if !f.expr && seg.Expr == nil {
+			items = append(items, seg.Name+"="+seg.Command)
+		}
+	}
+	return strings.Join(items, "\n")
+}
+
+func (f customSegmentsFlag) Set(value string) error {
+	name, source, _ := strings.Cut(value, "=")
+	name, source = strings.TrimSpace(name), strings.TrimSpace(source)
+	if err := validCustomName(name); err != nil {
+		return err
+	}
+	seg := CustomSegment{Name: name, Command: source}
+	if f.expr {
+		e, err := expr.Parse(source)
+		if err != nil {
+			return fmt.Errorf("segment %s: %v", name, err)
+		}
+		seg = CustomSegment{Name: name, Expr: e}
+	} else if source == "" {
+		return fmt.Errorf("no command for segment %q, want name=command", name)
+	}
+	for i := range *f.segments {
+		if (*f.segments)[i].Name == name {
+			(*f.segments)[i] = seg
+			return nil
+		}
+	}
+	*f.segments = append(*f.segments, seg)
+	return nil
+}
+
+// appendsItems marks the flag as taking one item per Set, see listFlag
+func (f customSegmentsFlag) appendsItems() {}
+
+// validCustomName checks that a custom segment name can be used in
+// --format and --segments and doesn't shadow a built-in segment
+func validCustomName(name string) error {
+	if name == "" {
+		return fmt.Errorf("custom segment without a name, want name=command")
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("invalid custom segment name %q: use letters, digits, - and _", name)
+		}
+	}
+	if slices.Contains(SegmentNames, name) {
+		return fmt.Errorf("custom segment %q has the name of a built-in segment", name)
+	}
+	return nil
+}
+
+// parseCustomSegments adds the segments in the environment variable key,
+// one name=command (or name=expression) per line. Invalid lines are logged
+// and skipped.
+func parseCustomSegments(f customSegmentsFlag, key string) {
+	for _, line := range strings.Split(getEnv(key, ""), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := f.Set(line); err != nil {
+			WarnLog("Ignoring %s entry: %v", key, err)
+		}
+	}
+}
+
+// CustomSegment returns the custom segment called name
+func (c *Config) CustomSegment(name string) (CustomSegment, bool) {
+	for _, seg := range c.CustomSegments {
+		if seg.Name == name {
+			return seg, true
+		}
+	}
+	return CustomSegment{}, false
+}
+
+// ExprReads reports whether a shown expression segment, or a rule of a
+// shown segment, reads one of the variables or one below it: "cost" covers
+// cost.daily. Data that only expressions read is collected as for its
+// segment.
+func (c *Config) ExprReads(vars ...string) bool {
+	var exprs []*expr.Expr
+	for _, seg := range c.CustomSegments {
+		if seg.Expr != nil && c.SegmentEnabled(seg.Name) {
+			exprs = append(exprs, seg.Expr)
+		}
+	}
+	for _, rule := range c.Rules {
+		if c.SegmentEnabled(rule.Segment) {
+			exprs = append(exprs, rule.Cond)
+		}
+	}
+	for _, e := range exprs {
+		for _, used := range e.Vars() {
+			for _, v := range vars {
+				if used == v || strings.HasPrefix(used, v+".") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// CustomSegmentNames returns the names of the custom segments, in the order
+// they were given
+func (c *Config) CustomSegmentNames() []string {
+	names := make([]string, len(c.CustomSegments))
+	for i, seg := range c.CustomSegments {
+		names[i] = seg.Name
+	}
+	return names
+}
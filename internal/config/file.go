@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConfigFile returns the options file: CLAUDE_STATUS_CONFIG, else
+// config.json in ConfigDir
+func ConfigFile() string {
+	if file := os.Getenv("CLAUDE_STATUS_CONFIG"); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir(), "config.json")
+}
+
+// listFlag is a repeatable flag whose values may contain commas, such as
+// --custom-segment. The options file sets it once per list item, or once
+// per key=value of an object, instead of joining them.
+type listFlag interface {
+	flag.Value
+	appendsItems()
+}
+
+// applyConfigFile sets the flags named in the options file, e.g.
+// {"show-cost": false, "segments": ["dir", "git"]}, and returns their
+// names. Values from the file override environment variables and are
+// overridden by the command line. Unknown options and invalid values are
+// reported and skipped.
+func applyConfigFile(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	file := ConfigFile()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return set
+	}
+	options := make(map[string]any)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&options); err != nil {
+		cfg.problem(file, "config file", "invalid JSON, ignoring the file: %v", err)
+		return set
+	}
+
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := options[name]
+		f := fs.Lookup(name)
+		if f == nil {
+			var known []string
+			fs.VisitAll(func(f *flag.Flag) { known = append(known, f.Name) })
+			cfg.problem(name, "config file", "unknown option%s", didYouMean(name, known))
+			continue
+		}
+		values := []any{v}
+		_, isList := f.Value.(listFlag)
+		if isList {
+			values = listItems(v)
+		}
+		for _, v := range values {
+			value, ok := optionValue(v)
+			if !ok {
+				cfg.problem(name, "config file", "invalid value %v", v)
+				continue
+			}
+			old := f.Value.String()
+			if err := fs.Set(name, value); err != nil {
+				// Number flags are zeroed by a failed Set
+				if !isList {
+					f.Value.Set(old)
+				}
+				cfg.problem(name, "config file", "invalid value %q: %v", value, err)
+				continue
+			}
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// listItems splits the value of a listFlag into the values to set: the
+// items of a list, the key=value pairs of an object, or the value itself
+func listItems(v any) []any {
+	switch v := v.(type) {
+	case []any:
+		return v
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]any, 0, len(v))
+		for _, key := range keys {
+			s, ok := optionValue(v[key])
+			if !ok {
+				return []any{v}
+			}
+			items = append(items, key+"="+s)
+		}
+		return items
+	}
+	return []any{v}
+}
+
+// optionValue converts a JSON value to flag syntax: lists are joined with
+// commas, and objects become comma-separated key=value pairs
+func optionValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool, json.Number:
+		return fmt.Sprint(v), true
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(v))
+		for _, key := range keys {
+			s, ok := optionValue(v[key])
+			if !ok {
+				return "", false
+			}
+			items = append(items, key+"="+s)
+		}
+		return strings.Join(items, ","), true
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := optionValue(item)
+			if !ok {
+				return "", false
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), true
+	}
+	return "", false
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses --log-level, defaulting to debug for unknown names
+func ParseLevel(name string) Level {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i)
+		}
+	}
+	return LevelDebug
+}
+
+// maxLogSize is the size at which debug.log is rotated to debug.log.1,
+// replacing the previous one
+const maxLogSize = 1 << 20
+
+// debugFlag is --debug: a bool flag that also takes "stderr"
+type debugFlag struct{ c *Config }
+
+func (f debugFlag) IsBoolFlag() bool { return true }
+
+func (f debugFlag) String() string {
+	if f.c == nil || !f.c.Debug {
+		return "false"
+	}
+	if f.c.LogTarget == "stderr" {
+		return "stderr"
+	}
+	return "true"
+}
+
+func (f debugFlag) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "stderr":
+		f.c.Debug, f.c.LogTarget = true, "stderr"
+	case "true", "1", "yes", "file":
+		f.c.Debug, f.c.LogTarget = true, "file"
+	case "false", "0", "no", "":
+		f.c.Debug = false
+	default:
+		return fmt.Errorf("want true, false or stderr")
+	}
+	return nil
+}
+
+// DebugLog logs details only useful when investigating a problem
+func DebugLog(format string, args ...interface{}) {
+	logf(LevelDebug, format, args...)
+}
+
+// InfoLog logs what the statusline did, e.g. a refresh or an update
+func InfoLog(format string, args ...interface{}) {
+	logf(LevelInfo, format, args...)
+}
+
+// WarnLog logs a failure the statusline recovered from, e.g. by showing
+// cached data
+func WarnLog(format string, args ...interface{}) {
+	logf(LevelWarn, format, args...)
+}
+
+// ErrorLog logs a failure that leaves something missing or broken
+func ErrorLog(format string, args ...interface{}) {
+	logf(LevelError, format, args...)
+}
+
+// logf writes a message with --debug at or above --log-level, prefixed
+// with the calling package
+func logf(level Level, format string, args ...interface{}) {
+	if cfg == nil || !cfg.Debug || level < ParseLevel(cfg.LogLevel) {
+		return
+	}
+	line := fmt.Sprintf("%s %-5s %s: %s\n", time.Now().Format("2006-01-02 15:04:05.000"),
+		strings.ToUpper(level.String()), caller(3), fmt.Sprintf(format, args...))
+
+	if cfg.LogTarget == "stderr" {
+		io.WriteString(os.Stderr, line)
+		return
+	}
+	if cfg.ReadOnly {
+		return
+	}
+	file := LogFile()
+	if info, err := os.Stat(file); err == nil && info.Size() > maxLogSize {
+		os.Rename(file, file+".1")
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, PrivateFileMode)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, line)
+}
+
+// LogFile is where --debug logs to
+func LogFile() string {
+	return filepath.Join(CacheDir(), "debug.log")
+}
+
+// caller returns the package name of the function skip frames up, e.g.
+// "usage" for .../internal/usage.fetchUsage
+func caller(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return "?"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "?"
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	pkg, _, _ := strings.Cut(name, ".")
+	return pkg
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Profile is one Claude account: where its credentials and logs are, and
+// which projects use it
+type Profile struct {
+	// Project directories using this account; subdirectories match too
+	Paths []string `json:"paths,omitempty"`
+	// Claude Code's data directory for the account (its CLAUDE_CONFIG_DIR)
+	DataDir string `json:"data_dir,omitempty"`
+	// Keyring service the account's credentials are stored under, if not
+	// the claude CLI's default
+	KeyringService string `json:"keyring_service,omitempty"`
+}
+
+// profileFile is the profiles configuration
+type profileFile struct {
+	Profiles map[string]Profile `json:"profiles"`
+	// Used when no profile's paths match (empty = no profile)
+	Default string `json:"default,omitempty"`
+}
+
+// ConfigDir returns the statusline's configuration directory:
+// claude-code-statusline under XDG_CONFIG_HOME, or ~/.config (%AppData% on
+// Windows)
+func ConfigDir() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(base) {
+		base = ""
+		if runtime.GOOS == "windows" {
+			base, _ = os.UserConfigDir()
+		}
+		if base == "" {
+			base = filepath.Join(HomeDir(), ".config")
+		}
+	}
+	return filepath.Join(base, "claude-code-statusline")
+}
+
+// profilesPath returns where profiles are configured:
+// CLAUDE_STATUS_PROFILES, else profiles.json in ConfigDir
+func profilesPath() string {
+	if file := os.Getenv("CLAUDE_STATUS_PROFILES"); file != "" {
+		return file
+	}
+	return filepath.Join(ConfigDir(), "profiles.json")
+}
+
+// ApplyProfile selects the account for a project directory (empty = the
+// working directory): --profile if given, else the profile with the
+// longest path containing dir, else the default profile. The profile's
+// data directory and keyring service are used unless --data-dir is set,
+// and it gets a cache directory of its own so accounts don't share usage
+// or costs. Without a profiles file nothing changes. It changes the global
+// configuration, so it must run before any background job starts.
+func ApplyProfile(dir string) {
+	c := Get()
+	data, err := os.ReadFile(profilesPath())
+	if err != nil {
+		if c.Profile != "" {
+			WarnLog("--profile %s given but no profiles file: %v", c.Profile, err)
+		}
+		return
+	}
+	var file profileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		WarnLog("Invalid profiles file %s: %v", profilesPath(), err)
+		return
+	}
+
+	name := c.Profile
+	if name == "" {
+		name = matchProfile(file.Profiles, dir)
+	}
+	if name == "" {
+		name = file.Default
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		if name != "" {
+			WarnLog("Unknown profile %q", name)
+		}
+		return
+	}
+
+	InfoLog("Using profile %s", name)
+	c.ActiveProfile = name
+	if c.DataDir == "" {
+		c.DataDir = expandHome(profile.DataDir)
+	}
+	c.KeyringService = profile.KeyringService
+	c.CacheDir = filepath.Join(CacheDir(), "profiles", name)
+}
+
+// matchProfile returns the profile with the longest path containing dir
+func matchProfile(profiles map[string]Profile, dir string) string {
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	dir = filepath.Clean(dir)
+
+	best, bestLen := "", -1
+	for name, p := range profiles {
+		for _, path := range p.Paths {
+			path = filepath.Clean(expandHome(path))
+			if (dir == path || strings.HasPrefix(dir, path+string(filepath.Separator))) && len(path) > bestLen {
+				best, bestLen = name, len(path)
+			}
+		}
+	}
+	return best
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path == "~" {
+		return HomeDir()
+	}
+	if strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		return filepath.Join(HomeDir(), path[2:])
+	}
+	return path
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erwint/claude-code-statusline/internal/expr"
+)
+
+// Rule shows or hides a segment depending on the collected data, e.g.
+// --show-if "cost=cost.daily > 1" or --hide-if "git=git.branch == 'main' && git.clean"
+type Rule struct {
+	Segment string
+	Show    bool // show the segment only when Cond holds, or else hide it when it does
+	Cond    *expr.Expr
+}
+
+// rulesFlag is --show-if or --hide-if segment=condition. Each use adds a
+// rule, or replaces the segment's rule of the same kind.
+type rulesFlag struct {
+	rules *[]Rule
+	show  bool
+}
+
+func (f rulesFlag) String() string {
+	if f.rules == nil {
+		return ""
+	}
+	var items []string
+	for _, rule := range *f.rules {
+		if rule.Show == f.show {
+			items = append(items, rule.Segment+"="+rule.Cond.String())
+		}
+	}
+	return strings.Join(items, "\n")
+}
+
+func (f rulesFlag) Set(value string) error {
+	segment, cond, _ := strings.Cut(value, "=")
+	segment, cond = strings.TrimSpace(segment), strings.TrimSpace(cond)
+	if segment == "" {
+		return fmt.Errorf("rule without a segment, want segment=condition")
+	}
+	e, err := expr.Parse(cond)
+	if err != nil {
+		return fmt.Errorf("rule for %s: %v", segment, err)
+	}
+	rule := Rule{Segment: segment, Show: f.show, Cond: e}
+	for i, r := range *f.rules {
+		if r.Segment == segment && r.Show == f.show {
+			(*f.rules)[i] = rule
+			return nil
+		}
+	}
+	*f.rules = append(*f.rules, rule)
+	return nil
+}
+
+// appendsItems marks the flag as taking one item per Set, see listFlag
+func (f rulesFlag) appendsItems() {}
+
+// parseRules adds the rules in the environment variable key, one
+// segment=condition per line. Invalid lines are logged and skipped.
+func parseRules(f rulesFlag, key string) {
+	for _, line := range strings.Split(getEnv(key, ""), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := f.Set(line); err != nil {
+			WarnLog("Ignoring %s entry: %v", key, err)
+		}
+	}
+}
+
+// SegmentRules returns the --show-if and --hide-if rules of a segment
+func (c *Config) SegmentRules(segment string) []Rule {
+	var rules []Rule
+	for _, rule := range c.Rules {
+		if rule.Segment == segment {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,148 @@
+package cost
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// Activity breaks down the logged usage in a period by day, hour, project,
+// model and session. Unlike the cost cache it's computed from the logs on
+// demand, for reports.
+type Activity struct {
+	Since    time.Time
+	Until    time.Time
+	Total    float64
+	Messages int
+	Days     map[string]float64 // YYYY-MM-DD (local) -> cost
+	Hours    [24]float64        // local hour of day -> cost
+	Projects map[string]float64 // project directory name -> cost
+	Models   map[string]float64 // model without date suffix -> cost
+	Sessions map[string]bool
+	Rows     map[ActivityKey]*ActivityRow
+}
+
+// ActivityKey identifies the messages of one day (YYYY-MM-DD, local), project
+// and model
+type ActivityKey struct {
+	Day, Project, Model string
+}
+
+// ActivityRow totals the cost, messages and tokens of one ActivityKey
+type ActivityRow struct {
+	Cost float64
+	DayStats
+}
+
+// ScanActivity reads the logs under ~/.claude/projects for messages
+// between since and until
+func ScanActivity(since, until time.Time) *Activity {
+	a := &Activity{
+		Since:    since,
+		Until:    until,
+		Days:     make(map[string]float64),
+		Projects: make(map[string]float64),
+		Models:   make(map[string]float64),
+		Sessions: make(map[string]bool),
+		Rows:     make(map[ActivityKey]*ActivityRow),
+	}
+	pricing := loadPricing()
+	seen := make(map[string]bool)
+
+	projectsDir := config.ProjectsDir()
+	filepath.Walk(projectsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".jsonl") || info.ModTime().Before(since) {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+
+		reader := bufio.NewReader(file)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				a.add(line, path, pricing, seen)
+			}
+			if err != nil {
+				break
+			}
+		}
+		return nil
+	})
+
+	return a
+}
+
+// add counts one log line, deduplicated like the cost cache
+func (a *Activity) add(line []byte, path string, pricing *types.PricingData, seen map[string]bool) {
+	var entry types.LogEntry
+	if err := json.Unmarshal(line, &entry); err != nil || entry.Type != "assistant" {
+		return
+	}
+	ts, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil || ts.Before(a.Since) || !ts.Before(a.Until) {
+		return
+	}
+
+	key := entry.Message.ID + ":" + entry.RequestID
+	if key == ":" || seen[key] {
+		return
+	}
+	seen[key] = true
+
+	u := entry.Message.Usage
+	if u.InputTokens == 0 && u.OutputTokens == 0 && u.CacheCreationInputTokens == 0 && u.CacheReadInputTokens == 0 {
+		return
+	}
+	cost := calculateCost(entry.Message.Model, u.InputTokens, u.OutputTokens, u.CacheCreationInputTokens, u.CacheReadInputTokens, pricing)
+
+	// Older logs lack cwd; their directory is the project path with
+	// separators replaced by dashes
+	project := filepath.Base(filepath.Dir(path))
+	if entry.Cwd != "" {
+		project = filepath.Base(entry.Cwd)
+	}
+
+	local := ts.Local()
+	day, model := local.Format("2006-01-02"), modelName(entry.Message.Model)
+	a.Total += cost
+	a.Messages++
+	a.Days[day] += cost
+	a.Hours[local.Hour()] += cost
+	a.Projects[project] += cost
+	a.Models[model] += cost
+
+	row := a.Rows[ActivityKey{day, project, model}]
+	if row == nil {
+		row = &ActivityRow{}
+		a.Rows[ActivityKey{day, project, model}] = row
+	}
+	row.Cost += cost
+	row.Messages++
+	row.InputTokens += int64(u.InputTokens)
+	row.OutputTokens += int64(u.OutputTokens)
+	row.CacheCreationTokens += int64(u.CacheCreationInputTokens)
+	row.CacheReadTokens += int64(u.CacheReadInputTokens)
+	if entry.SessionID != "" {
+		a.Sessions[entry.SessionID] = true
+	}
+}
+
+// modelName maps a model ID to its canonical name without the date suffix,
+// so provider IDs and snapshots of one model are grouped together
+func modelName(model string) string {
+	model = normalizeModelID(model)
+	if idx := strings.LastIndex(model, "-20"); idx > 0 {
+		model = model[:idx]
+	}
+	return model
+}
@@ -11,24 +11,139 @@ import (
 	"time"
 
 	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/jobs"
 	"github.com/erwint/claude-code-statusline/internal/types"
 )
 
-const (
-	pricingURL      = "https://raw.githubusercontent.com/erwint/claude-code-statusline/main/pricing.json"
-	pricingCacheTTL = 24 * time.Hour
-)
+const pricingURL = "https://raw.githubusercontent.com/erwint/claude-code-statusline/main/pricing.json"
 
 var embeddedPricing []byte
 
+// costCacheVersion is bumped when the cache format changes, with a
+// migration in costCacheMigrations if older caches need upgrading
+const costCacheVersion = 4
+
+// checkpointInterval is how often a scan saves its progress
+var checkpointInterval = 250 * time.Millisecond
+
+// costCacheMigrations upgrade older cost caches, see config.Migrations
+var costCacheMigrations = config.Migrations{
+	// Caches from before the per-model split or the token counts: rescan
+	// the logs once so they cover every day. Session costs only count
+	// messages scanned since they were added, which is fine for sessions
+	// started since.
+	3: func(obj map[string]any) error {
+		config.DebugLog("Cost cache is outdated, rescanning logs")
+		for key := range obj {
+			if key != "purged_before" {
+				delete(obj, key)
+			}
+		}
+		return nil
+	},
+	// Message keys from before the day buckets: their days aren't known, so
+	// keep them with today's, which outlives every day they could be from.
+	// Older lines are past the file offsets, so aren't read again anyway.
+	4: func(obj map[string]any) error {
+		legacy, _ := obj["processed_messages"].(map[string]any)
+		delete(obj, "processed_messages")
+		if len(legacy) == 0 {
+			return nil
+		}
+		buckets, _ := obj["processed_by_day"].(map[string]any)
+		if buckets == nil {
+			buckets = make(map[string]any)
+			obj["processed_by_day"] = buckets
+		}
+		today := time.Now().Format("2006-01-02")
+		keys, _ := buckets[today].(map[string]any)
+		if keys == nil {
+			keys = make(map[string]any)
+			buckets[today] = keys
+		}
+		for key := range legacy {
+			keys[key] = true
+		}
+		return nil
+	},
+}
+
 // CostCache stores per-day cost totals and file processing state
 type CostCache struct {
+	Version int `json:"version"`
 	// DayCosts maps date string (YYYY-MM-DD) to total cost for that day
 	DayCosts map[string]float64 `json:"day_costs"`
 	// FileState tracks last processed position for each log file
 	FileState map[string]FileProcessState `json:"file_state"`
 	// ProcessedMessages tracks message IDs we've already counted
-	ProcessedMessages map[string]bool `json:"processed_messages"`
+	ProcessedMessages MessageBuckets `json:"processed_by_day"`
+	// UnknownModels tracks models that had no pricing entry and were
+	// costed at the default rates
+	UnknownModels map[string]*UnknownModelStats `json:"unknown_models,omitempty"`
+	// DayModelCosts splits each day's cost by model family (opus, sonnet,
+	// haiku, other)
+	DayModelCosts map[string]map[string]float64 `json:"day_model_costs,omitempty"`
+	// DayStats counts each day's messages and tokens
+	DayStats map[string]*DayStats `json:"day_stats,omitempty"`
+	// PurgedBefore (YYYY-MM-DD) keeps purged days from being counted again
+	// when logs are rescanned
+	PurgedBefore string `json:"purged_before,omitempty"`
+	// SessionCosts totals the cost of each Claude Code session by its ID
+	SessionCosts map[string]*SessionCost `json:"session_costs,omitempty"`
+}
+
+// SessionCost is the cost of one session so far
+type SessionCost struct {
+	Cost float64 `json:"cost"`
+	// LastDay (YYYY-MM-DD) is the last day the session sent a message, so
+	// sessions are pruned along with their days
+	LastDay string `json:"last_day"`
+}
+
+// DayStats counts the messages and tokens of one day
+type DayStats struct {
+	Messages            int   `json:"messages"`
+	InputTokens         int64 `json:"input_tokens"`
+	OutputTokens        int64 `json:"output_tokens"`
+	CacheCreationTokens int64 `json:"cache_creation_tokens"`
+	CacheReadTokens     int64 `json:"cache_read_tokens"`
+}
+
+// MessageBuckets holds the keys of counted messages by day (YYYY-MM-DD), so
+// they're pruned along with their day instead of growing without bound
+type MessageBuckets map[string]map[string]bool
+
+// has reports whether a message was counted on day. Copies of a message
+// share its timestamp, so they land on the same day.
+func (b MessageBuckets) has(day, key string) bool {
+	return b[day][key]
+}
+
+func (b MessageBuckets) add(day, key string) {
+	if b[day] == nil {
+		b[day] = make(map[string]bool)
+	}
+	b[day][key] = true
+}
+
+// size returns the number of messages across all days
+func (b MessageBuckets) size() int {
+	n := 0
+	for _, keys := range b {
+		n += len(keys)
+	}
+	return n
+}
+
+// UnknownModelStats accumulates usage for a model priced at the default rates
+type UnknownModelStats struct {
+	Messages            int     `json:"messages"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	EstimatedCost       float64 `json:"estimated_cost"`
+	LastSeen            string  `json:"last_seen"` // YYYY-MM-DD
 }
 
 // FileProcessState tracks processing state for a single log file
@@ -45,17 +160,48 @@ func SetEmbeddedPricing(data []byte) {
 
 // GetTokenStats calculates cost statistics from log files with caching
 func GetTokenStats() *types.TokenStats {
-	cacheDir := filepath.Join(os.Getenv("HOME"), ".cache", "claude-code-statusline")
+	cache := LoadCache()
+
+	// Aggregate stats from daily buckets
+	stats := aggregateStats(cache, time.Now())
+
+	config.DebugLog("Cost stats: daily=$%.2f, weekly=$%.2f, monthly=$%.2f",
+		stats.DailyCost, stats.WeeklyCost, stats.MonthlyCost)
+
+	return stats
+}
+
+// CachedTokenStats aggregates the cost cache as last saved, without scanning
+// the logs. Used when a render can't wait for the scan.
+func CachedTokenStats() *types.TokenStats {
+	cache := loadCostCache(filepath.Join(config.CacheDir(), "cost_cache.json"))
+	return aggregateStats(cache, time.Now())
+}
+
+// SavedTokenStats aggregates the cost cache as last saved, like
+// CachedTokenStats, and reports whether the logs were ever scanned into it.
+// Renders serve these right away and Refresh the cache in the background.
+func SavedTokenStats() (*types.TokenStats, bool) {
+	cache := loadCostCache(filepath.Join(config.CacheDir(), "cost_cache.json"))
+	return aggregateStats(cache, time.Now()), len(cache.FileState) > 0
+}
+
+// Refresh brings the cost cache up to date with the log files unless
+// another process is already doing so
+func Refresh() {
+	jobs.Run("cost-scan", func() { LoadCache() })
+}
+
+// LoadCache brings the cost cache up to date with the log files and returns it
+func LoadCache() *CostCache {
+	cacheDir := config.CacheDir()
 	cacheFile := filepath.Join(cacheDir, "cost_cache.json")
 	lockFile := filepath.Join(cacheDir, "cost_cache.lock")
 
-	// Ensure cache directory exists
-	os.MkdirAll(cacheDir, 0755)
-
 	// Acquire file lock for concurrent access protection
 	lock, err := acquireLock(lockFile)
 	if err != nil {
-		config.DebugLog("Failed to acquire lock, proceeding without: %v", err)
+		config.WarnLog("Failed to acquire lock, proceeding without: %v", err)
 	} else {
 		defer releaseLock(lock)
 	}
@@ -63,56 +209,112 @@ func GetTokenStats() *types.TokenStats {
 	cache := loadCostCache(cacheFile)
 	pricing := loadPricing()
 
-	now := time.Now()
-	monthlyCutoff := now.AddDate(0, -1, 0)
+	cutoff := retentionCutoff(cache, time.Now())
 
-	projectsDir := filepath.Join(os.Getenv("HOME"), ".claude", "projects")
+	projectsDir := config.ProjectsDir()
 	config.DebugLog("Scanning logs from: %s", projectsDir)
 
-	// Clean up old days from cache (older than 31 days)
-	cleanupOldDays(cache, monthlyCutoff)
+	// Clean up days older than the retention period
+	cleanupOldDays(cache, cutoff)
+
+	scanLogs(projectsDir, cache, pricing, cutoff, func() { saveCostCache(cacheFile, cache) })
 
-	// Process log files
+	// Save updated cache
+	saveCostCache(cacheFile, cache)
+
+	return cache
+}
+
+// scanLogs processes the log files under projectsDir into cache, calling
+// checkpoint at most every checkpointInterval while there's new progress.
+// Saving it there lets a scan that's cut short (the statusline exits soon
+// after printing) pick up where it got to instead of starting over.
+func scanLogs(projectsDir string, cache *CostCache, pricing *types.PricingData, cutoff time.Time, checkpoint func()) {
+	saved, dirty := time.Now(), false
 	filepath.Walk(projectsDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".jsonl") {
 			return nil
 		}
 
-		// Skip files older than monthly cutoff
-		if info.ModTime().Before(monthlyCutoff) {
+		// Skip files older than the cutoff
+		if info.ModTime().Before(cutoff) {
 			return nil
 		}
 
-		processLogFile(path, info, cache, pricing, monthlyCutoff)
+		before := cache.FileState[path]
+		processLogFile(path, info, cache, pricing, cutoff)
+		if cache.FileState[path] != before {
+			dirty = true
+		}
+		if dirty && time.Since(saved) >= checkpointInterval {
+			checkpoint()
+			saved, dirty = time.Now(), false
+		}
 		return nil
 	})
+}
 
-	// Save updated cache
-	saveCostCache(cacheFile, cache)
+// retentionCutoff returns the time before which log entries are dropped:
+// the configured retention period, or the last purge if that's later
+func retentionCutoff(cache *CostCache, now time.Time) time.Time {
+	cutoff := config.Get().RetentionCutoff(now)
+	if purged, err := time.ParseInLocation("2006-01-02", cache.PurgedBefore, time.Local); err == nil && purged.After(cutoff) {
+		return purged
+	}
+	return cutoff
+}
 
-	// Aggregate stats from daily buckets
-	stats := aggregateStats(cache, now)
+// Purge removes the costs of days before the given date from the cache and
+// keeps them from being counted again. It returns the number of days removed.
+func Purge(before time.Time) int {
+	cacheDir := config.CacheDir()
+	cacheFile := filepath.Join(cacheDir, "cost_cache.json")
+	lock, err := acquireLock(filepath.Join(cacheDir, "cost_cache.lock"))
+	if err != nil {
+		config.WarnLog("Failed to acquire lock, proceeding without: %v", err)
+	} else {
+		defer releaseLock(lock)
+	}
 
-	config.DebugLog("Cost stats: daily=$%.2f, weekly=$%.2f, monthly=$%.2f",
-		stats.DailyCost, stats.WeeklyCost, stats.MonthlyCost)
+	cache := loadCostCache(cacheFile)
+	days := len(cache.DayCosts)
+	cleanupOldDays(cache, before)
+	removed := days - len(cache.DayCosts)
 
-	return stats
+	if date := before.Format("2006-01-02"); date > cache.PurgedBefore {
+		cache.PurgedBefore = date
+	}
+	saveCostCache(cacheFile, cache)
+	return removed
 }
 
-func loadCostCache(path string) *CostCache {
-	cache := &CostCache{
+// AggregateStats computes daily/weekly/monthly totals from the cache
+func AggregateStats(cache *CostCache, now time.Time) *types.TokenStats {
+	return aggregateStats(cache, now)
+}
+
+// newCostCache returns an empty cost cache, from which a scan of the logs
+// rebuilds the costs
+func newCostCache() *CostCache {
+	return &CostCache{
 		DayCosts:          make(map[string]float64),
+		DayModelCosts:     make(map[string]map[string]float64),
+		DayStats:          make(map[string]*DayStats),
 		FileState:         make(map[string]FileProcessState),
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
+		UnknownModels:     make(map[string]*UnknownModelStats),
+		SessionCosts:      make(map[string]*SessionCost),
 	}
+}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return cache
+func loadCostCache(path string) *CostCache {
+	cache := newCostCache()
+	if err := config.ReadVersionedCache(path, cache, costCacheVersion, costCacheMigrations); err != nil {
+		// Missing, corrupt and moved aside or from a newer release: rescan
+		// the logs
+		return newCostCache()
 	}
 
-	json.Unmarshal(data, cache)
-
 	// Ensure maps are initialized
 	if cache.DayCosts == nil {
 		cache.DayCosts = make(map[string]float64)
@@ -121,7 +323,19 @@ func loadCostCache(path string) *CostCache {
 		cache.FileState = make(map[string]FileProcessState)
 	}
 	if cache.ProcessedMessages == nil {
-		cache.ProcessedMessages = make(map[string]bool)
+		cache.ProcessedMessages = make(MessageBuckets)
+	}
+	if cache.UnknownModels == nil {
+		cache.UnknownModels = make(map[string]*UnknownModelStats)
+	}
+	if cache.DayModelCosts == nil {
+		cache.DayModelCosts = make(map[string]map[string]float64)
+	}
+	if cache.DayStats == nil {
+		cache.DayStats = make(map[string]*DayStats)
+	}
+	if cache.SessionCosts == nil {
+		cache.SessionCosts = make(map[string]*SessionCost)
 	}
 
 	return cache
@@ -129,16 +343,11 @@ func loadCostCache(path string) *CostCache {
 
 func saveCostCache(path string, cache *CostCache) {
 	dir := filepath.Dir(path)
-	os.MkdirAll(dir, 0755)
-
-	data, err := json.Marshal(cache)
-	if err != nil {
-		config.DebugLog("Failed to marshal cost cache: %v", err)
-		return
-	}
+	config.MkdirAll(dir)
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		config.DebugLog("Failed to save cost cache: %v", err)
+	cache.Version = costCacheVersion
+	if err := config.WriteCache(path, cache); err != nil {
+		config.ErrorLog("Failed to save cost cache: %v", err)
 	}
 }
 
@@ -149,17 +358,34 @@ func cleanupOldDays(cache *CostCache, cutoff time.Time) {
 			delete(cache.DayCosts, day)
 		}
 	}
-
-	// Also clean up old message IDs (keep last 100k to prevent unbounded growth)
-	if len(cache.ProcessedMessages) > 100000 {
-		// Just clear it - we'll reprocess but that's fine
-		cache.ProcessedMessages = make(map[string]bool)
-		cache.FileState = make(map[string]FileProcessState)
-		config.DebugLog("Cleared message cache (exceeded 100k entries)")
+	for day := range cache.DayModelCosts {
+		if day < cutoffStr {
+			delete(cache.DayModelCosts, day)
+		}
+	}
+	for day := range cache.DayStats {
+		if day < cutoffStr {
+			delete(cache.DayStats, day)
+		}
+	}
+	for day := range cache.ProcessedMessages {
+		if day < cutoffStr {
+			delete(cache.ProcessedMessages, day)
+		}
+	}
+	for model, stats := range cache.UnknownModels {
+		if stats.LastSeen < cutoffStr {
+			delete(cache.UnknownModels, model)
+		}
+	}
+	for id, session := range cache.SessionCosts {
+		if session.LastDay < cutoffStr {
+			delete(cache.SessionCosts, id)
+		}
 	}
 }
 
-func processLogFile(path string, info os.FileInfo, cache *CostCache, pricing *types.PricingData, monthlyCutoff time.Time) {
+func processLogFile(path string, info os.FileInfo, cache *CostCache, pricing *types.PricingData, cutoff time.Time) {
 	state, exists := cache.FileState[path]
 
 	// Check if file has changed since last processing
@@ -202,16 +428,16 @@ func processLogFile(path string, info os.FileInfo, cache *CostCache, pricing *ty
 				// Process last line if it doesn't end with newline
 				if len(line) > 0 {
 					bytesRead += int64(len(line))
-					processLogEntry(line, cache, pricing, monthlyCutoff)
+					processLogEntry(line, cache, pricing, cutoff)
 				}
 				break
 			}
-			config.DebugLog("Read error for %s at offset %d: %v", filepath.Base(path), bytesRead, err)
+			config.WarnLog("Read error for %s at offset %d: %v", filepath.Base(path), bytesRead, err)
 			return
 		}
 
 		bytesRead += int64(len(line))
-		processLogEntry(line, cache, pricing, monthlyCutoff)
+		processLogEntry(line, cache, pricing, cutoff)
 	}
 
 	// Update file state only if we successfully completed
@@ -222,7 +448,7 @@ func processLogFile(path string, info os.FileInfo, cache *CostCache, pricing *ty
 	}
 }
 
-func processLogEntry(line []byte, cache *CostCache, pricing *types.PricingData, monthlyCutoff time.Time) {
+func processLogEntry(line []byte, cache *CostCache, pricing *types.PricingData, cutoff time.Time) {
 	// Note: For very large lines, json.Unmarshal will allocate memory temporarily,
 	// but this is better than trying to parse across line boundaries with streaming.
 	// bufio.Reader.ReadBytes automatically grows its buffer, so we can handle any line size.
@@ -233,7 +459,7 @@ func processLogEntry(line []byte, cache *CostCache, pricing *types.PricingData,
 
 	// Parse timestamp
 	ts, err := time.Parse(time.RFC3339, entry.Timestamp)
-	if err != nil || ts.Before(monthlyCutoff) {
+	if err != nil || ts.Before(cutoff) {
 		return
 	}
 
@@ -243,11 +469,15 @@ func processLogEntry(line []byte, cache *CostCache, pricing *types.PricingData,
 	}
 
 	// Deduplicate by message ID + request ID
+	day := ts.Local().Format("2006-01-02")
 	key := entry.Message.ID + ":" + entry.RequestID
-	if key == ":" || cache.ProcessedMessages[key] {
+	if key == ":" || cache.ProcessedMessages.has(day, key) {
 		return
 	}
-	cache.ProcessedMessages[key] = true
+	if cache.ProcessedMessages == nil {
+		cache.ProcessedMessages = make(MessageBuckets)
+	}
+	cache.ProcessedMessages.add(day, key)
 
 	// Get token counts
 	inputTokens := entry.Message.Usage.InputTokens
@@ -260,11 +490,74 @@ func processLogEntry(line []byte, cache *CostCache, pricing *types.PricingData,
 	}
 
 	// Calculate cost
-	cost := calculateCost(entry.Message.Model, inputTokens, outputTokens, cacheCreation, cacheRead, pricing)
+	p, known := lookupPricing(entry.Message.Model, pricing)
+	cost := priceTokens(p, inputTokens, outputTokens, cacheCreation, cacheRead)
 
 	// Add to day bucket (use local time for user's perspective)
-	day := ts.Local().Format("2006-01-02")
 	cache.DayCosts[day] += cost
+	if cache.DayModelCosts == nil {
+		cache.DayModelCosts = make(map[string]map[string]float64)
+	}
+	if cache.DayModelCosts[day] == nil {
+		cache.DayModelCosts[day] = make(map[string]float64)
+	}
+	cache.DayModelCosts[day][ModelFamily(entry.Message.Model)] += cost
+	if cache.DayStats == nil {
+		cache.DayStats = make(map[string]*DayStats)
+	}
+	if cache.DayStats[day] == nil {
+		cache.DayStats[day] = &DayStats{}
+	}
+	ds := cache.DayStats[day]
+	ds.Messages++
+	ds.InputTokens += int64(inputTokens)
+	ds.OutputTokens += int64(outputTokens)
+	ds.CacheCreationTokens += int64(cacheCreation)
+	ds.CacheReadTokens += int64(cacheRead)
+
+	if entry.SessionID != "" {
+		if cache.SessionCosts == nil {
+			cache.SessionCosts = make(map[string]*SessionCost)
+		}
+		session := cache.SessionCosts[entry.SessionID]
+		if session == nil {
+			session = &SessionCost{}
+			cache.SessionCosts[entry.SessionID] = session
+		}
+		session.Cost += cost
+		if day > session.LastDay {
+			session.LastDay = day
+		}
+	}
+
+	if !known {
+		recordUnknownModel(cache, entry.Message.Model, day, inputTokens, outputTokens, cacheCreation, cacheRead, cost)
+	}
+}
+
+// recordUnknownModel tracks usage that was costed at the default rates
+func recordUnknownModel(cache *CostCache, model, day string, inputTokens, outputTokens, cacheCreation, cacheRead int, cost float64) {
+	if model == "" {
+		model = "(none)"
+	}
+	if cache.UnknownModels == nil {
+		cache.UnknownModels = make(map[string]*UnknownModelStats)
+	}
+	stats, ok := cache.UnknownModels[model]
+	if !ok {
+		stats = &UnknownModelStats{}
+		cache.UnknownModels[model] = stats
+		config.WarnLog("No pricing for model %q, using default rates", model)
+	}
+	stats.Messages++
+	stats.InputTokens += int64(inputTokens)
+	stats.OutputTokens += int64(outputTokens)
+	stats.CacheCreationTokens += int64(cacheCreation)
+	stats.CacheReadTokens += int64(cacheRead)
+	stats.EstimatedCost += cost
+	if day > stats.LastSeen {
+		stats.LastSeen = day
+	}
 }
 
 func aggregateStats(cache *CostCache, now time.Time) *types.TokenStats {
@@ -279,9 +572,52 @@ func aggregateStats(cache *CostCache, now time.Time) *types.TokenStats {
 		aggregateFixed(cache, now, stats)
 	}
 
+	stats.DayHistory = dayHistory(cache, now, historyDays)
+	stats.SessionCosts = recentSessions(cache, now)
+
+	f := ForecastMonth(cache, now, cfg.BudgetMonthly)
+	if !f.BudgetOut.IsZero() {
+		stats.BudgetOut = &f.BudgetOut
+	}
+	// The forecast runs to the end of the calendar month, which only
+	// continues the monthly cost in fixed mode
+	if cfg.AggregationMode != "sliding" {
+		stats.MonthProjected = f.Projected
+	}
+
 	return stats
 }
 
+// recentSessions returns the cost of each session that sent a message
+// today or yesterday, which covers every session still open
+func recentSessions(cache *CostCache, now time.Time) map[string]float64 {
+	since := now.AddDate(0, 0, -1).Format("2006-01-02")
+	var costs map[string]float64
+	for id, session := range cache.SessionCosts {
+		if session.LastDay < since {
+			continue
+		}
+		if costs == nil {
+			costs = make(map[string]float64)
+		}
+		costs[id] = session.Cost
+	}
+	return costs
+}
+
+// historyDays is how many days the cost history segment covers
+const historyDays = 7
+
+// dayHistory returns the cost of each of the last n calendar days, oldest
+// first and ending today
+func dayHistory(cache *CostCache, now time.Time, n int) []float64 {
+	history := make([]float64, n)
+	for i := range history {
+		history[i] = cache.DayCosts[now.AddDate(0, 0, i-n+1).Format("2006-01-02")]
+	}
+	return history
+}
+
 // aggregateSliding uses rolling windows: last 24h, 7d, 30d
 func aggregateSliding(cache *CostCache, now time.Time, stats *types.TokenStats) {
 	dailyCutoff := now.AddDate(0, 0, -1).Format("2006-01-02")
@@ -289,12 +625,19 @@ func aggregateSliding(cache *CostCache, now time.Time, stats *types.TokenStats)
 	// Monthly cutoff already handled by cleanup
 
 	for day, cost := range cache.DayCosts {
+		tokens := dayTokens(cache, day)
 		stats.MonthlyCost += cost
+		stats.MonthlyTokens += tokens
+		addModelCosts(&stats.MonthlyByModel, cache.DayModelCosts[day])
 		if day >= weeklyCutoff {
 			stats.WeeklyCost += cost
+			stats.WeeklyTokens += tokens
+			addModelCosts(&stats.WeeklyByModel, cache.DayModelCosts[day])
 		}
 		if day >= dailyCutoff {
 			stats.DailyCost += cost
+			stats.DailyTokens += tokens
+			addModelCosts(&stats.DailyByModel, cache.DayModelCosts[day])
 		}
 	}
 }
@@ -314,64 +657,124 @@ func aggregateFixed(cache *CostCache, now time.Time, stats *types.TokenStats) {
 	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format("2006-01-02")
 
 	for day, cost := range cache.DayCosts {
+		tokens := dayTokens(cache, day)
 		if day >= monthStart {
 			stats.MonthlyCost += cost
+			stats.MonthlyTokens += tokens
+			addModelCosts(&stats.MonthlyByModel, cache.DayModelCosts[day])
 		}
 		if day >= weekStart {
 			stats.WeeklyCost += cost
+			stats.WeeklyTokens += tokens
+			addModelCosts(&stats.WeeklyByModel, cache.DayModelCosts[day])
 		}
 		if day == today {
 			stats.DailyCost += cost
+			stats.DailyTokens += tokens
+			addModelCosts(&stats.DailyByModel, cache.DayModelCosts[day])
 		}
 	}
 }
 
+// dayTokens returns a day's input, output and cache write tokens. Cache
+// reads are left out: they re-read the same context on every message and
+// would dwarf the rest.
+func dayTokens(cache *CostCache, day string) int64 {
+	s := cache.DayStats[day]
+	if s == nil {
+		return 0
+	}
+	return s.InputTokens + s.OutputTokens + s.CacheCreationTokens
+}
+
+// addModelCosts adds a day's per-model costs to a period's totals
+func addModelCosts(total *map[string]float64, day map[string]float64) {
+	if len(day) == 0 {
+		return
+	}
+	if *total == nil {
+		*total = make(map[string]float64)
+	}
+	for family, cost := range day {
+		(*total)[family] += cost
+	}
+}
+
+// MessagePricer returns a function that prices a message's tokens with the
+// current pricing table, loaded once
+func MessagePricer() func(model string, inputTokens, outputTokens, cacheCreation, cacheRead int) float64 {
+	pricing := loadPricing()
+	return func(model string, inputTokens, outputTokens, cacheCreation, cacheRead int) float64 {
+		return calculateCost(model, inputTokens, outputTokens, cacheCreation, cacheRead, pricing)
+	}
+}
+
 func calculateCost(model string, inputTokens, outputTokens, cacheCreation, cacheRead int, pricing *types.PricingData) float64 {
-	p := getPricing(model, pricing)
+	return priceTokens(getPricing(model, pricing), inputTokens, outputTokens, cacheCreation, cacheRead)
+}
 
+func priceTokens(p types.ModelPricing, inputTokens, outputTokens, cacheCreation, cacheRead int) float64 {
 	// Cache read tokens are discounted (10% of input price)
 	// Cache creation tokens are charged at 1.25x input price
+	// Prices are per million tokens; dividing once at the end rounds once
 	var cost float64
-	cost += float64(inputTokens) / 1000000 * p.Input
-	cost += float64(cacheCreation) / 1000000 * p.Input * 1.25
-	cost += float64(cacheRead) / 1000000 * p.Input * 0.1
-	cost += float64(outputTokens) / 1000000 * p.Output
-	return cost
+	cost += float64(inputTokens) * p.Input
+	cost += float64(cacheCreation) * p.Input * 1.25
+	cost += float64(cacheRead) * p.Input * 0.1
+	cost += float64(outputTokens) * p.Output
+	return cost / 1000000
 }
 
 // getPricing finds pricing for a model with fallback:
+// 0. Normalize Bedrock/Vertex IDs (e.g., "anthropic.claude-sonnet-4-5-20250514-v1:0")
 // 1. Exact match (e.g., "claude-sonnet-4-5-20250514")
 // 2. Versioned model (e.g., "claude-sonnet-4-5")
 // 3. Base model (e.g., "claude-sonnet")
 // 4. Default sonnet pricing
 func getPricing(model string, pricing *types.PricingData) types.ModelPricing {
+	p, _ := lookupPricing(model, pricing)
+	return p
+}
+
+// defaultPricing is used for models without a pricing entry (sonnet rates)
+var defaultPricing = types.ModelPricing{Input: 3.0, Output: 15.0}
+
+// lookupPricing is getPricing that also reports whether the model was found
+// (false means the default pricing was returned)
+func lookupPricing(model string, pricing *types.PricingData) (types.ModelPricing, bool) {
 	// Try exact match
 	if p, ok := pricing.Models[model]; ok {
-		return p
+		return p, true
+	}
+
+	// Map provider-specific IDs to canonical names and retry
+	model = normalizeModelID(model)
+	if p, ok := pricing.Models[model]; ok {
+		return p, true
 	}
 
 	// Try without date suffix (e.g., "claude-sonnet-4-5-20250514" -> "claude-sonnet-4-5")
 	if idx := strings.LastIndex(model, "-20"); idx > 0 {
 		versionedModel := model[:idx]
 		if p, ok := pricing.Models[versionedModel]; ok {
-			return p
+			return p, true
 		}
 
 		// Try base model (e.g., "claude-sonnet-4-5" -> "claude-sonnet")
 		baseModel := stripVersion(versionedModel)
 		if p, ok := pricing.Models[baseModel]; ok {
-			return p
+			return p, true
 		}
 	}
 
 	// Try stripping version from original model
 	baseModel := stripVersion(model)
 	if p, ok := pricing.Models[baseModel]; ok {
-		return p
+		return p, true
 	}
 
 	// Default to sonnet pricing
-	return types.ModelPricing{Input: 3.0, Output: 15.0}
+	return defaultPricing, false
 }
 
 // stripVersion removes version numbers from model name
@@ -388,26 +791,33 @@ func stripVersion(model string) string {
 }
 
 func loadPricing() *types.PricingData {
-	cacheDir := filepath.Join(os.Getenv("HOME"), ".cache", "claude-code-statusline")
+	cacheDir := config.CacheDir()
 	cacheFile := filepath.Join(cacheDir, "pricing.json")
 
-	// Check if cache exists and is fresh (< 24h old)
+	// Offline and CI mode price with the pricing built into this version,
+	// so reports don't depend on what happened to be cached
+	if config.Get().Offline {
+		var pricing types.PricingData
+		json.Unmarshal(embeddedPricing, &pricing)
+		return &pricing
+	}
+
+	// Check if cache exists and is fresh (< --pricing-ttl old)
 	if info, err := os.Stat(cacheFile); err == nil {
-		if time.Since(info.ModTime()) < pricingCacheTTL {
-			if data, err := os.ReadFile(cacheFile); err == nil {
-				var pricing types.PricingData
-				if json.Unmarshal(data, &pricing) == nil {
-					config.DebugLog("Using cached pricing (age: %v)", time.Since(info.ModTime()))
-					return &pricing
-				}
+		if time.Since(info.ModTime()) < config.Get().PricingMaxAge() {
+			var pricing types.PricingData
+			if err := config.ReadCache(cacheFile, &pricing); err == nil {
+				config.DebugLog("Using cached pricing (age: %v)", time.Since(info.ModTime()))
+				return &pricing
 			}
+			go jobs.Run("pricing", func() { fetchAndCachePricing(cacheDir, cacheFile) })
 		} else {
 			config.DebugLog("Pricing cache expired, fetching update...")
-			go fetchAndCachePricing(cacheDir, cacheFile)
+			go jobs.Run("pricing", func() { fetchAndCachePricing(cacheDir, cacheFile) })
 		}
 	} else {
 		config.DebugLog("No pricing cache, fetching...")
-		go fetchAndCachePricing(cacheDir, cacheFile)
+		go jobs.Run("pricing", func() { fetchAndCachePricing(cacheDir, cacheFile) })
 	}
 
 	// Fall back to embedded pricing
@@ -420,35 +830,35 @@ func fetchAndCachePricing(cacheDir, cacheFile string) {
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Get(pricingURL)
 	if err != nil {
-		config.DebugLog("Failed to fetch pricing: %v", err)
+		config.WarnLog("Failed to fetch pricing: %v", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		config.DebugLog("Pricing fetch returned status %d", resp.StatusCode)
+		config.WarnLog("Pricing fetch returned status %d", resp.StatusCode)
 		return
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		config.DebugLog("Failed to read pricing response: %v", err)
+		config.WarnLog("Failed to read pricing response: %v", err)
 		return
 	}
 
 	// Validate JSON before caching
 	var pricing types.PricingData
 	if err := json.Unmarshal(data, &pricing); err != nil {
-		config.DebugLog("Invalid pricing JSON: %v", err)
+		config.WarnLog("Invalid pricing JSON: %v", err)
 		return
 	}
 
 	// Save to cache
-	os.MkdirAll(cacheDir, 0755)
-	if err := os.WriteFile(cacheFile, data, 0644); err != nil {
-		config.DebugLog("Failed to cache pricing: %v", err)
+	config.MkdirAll(cacheDir)
+	if err := config.WriteCache(cacheFile, &pricing); err != nil {
+		config.WarnLog("Failed to cache pricing: %v", err)
 		return
 	}
 
-	config.DebugLog("Pricing updated and cached")
+	config.InfoLog("Pricing updated and cached")
 }
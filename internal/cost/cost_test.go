@@ -2,8 +2,11 @@ package cost
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -131,6 +134,60 @@ func TestStripVersion(t *testing.T) {
 	}
 }
 
+func TestNormalizeModelID(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"claude-sonnet-4-5-20250929", "claude-sonnet-4-5-20250929"},
+		{"anthropic.claude-sonnet-4-5-20250929-v1:0", "claude-sonnet-4-5-20250929"},
+		{"us.anthropic.claude-opus-4-1-20250805-v1:0", "claude-opus-4-1-20250805"},
+		{"global.anthropic.claude-haiku-4-5-20251001-v1:0", "claude-haiku-4-5-20251001"},
+		{"anthropic.claude-3-5-haiku-20241022-v1:0", "claude-haiku-3-5-20241022"},
+		{"arn:aws:bedrock:us-east-1:123456789012:inference-profile/us.anthropic.claude-sonnet-4-20250514-v1:0", "claude-sonnet-4-20250514"},
+		{"claude-sonnet-4-5@20250929", "claude-sonnet-4-5-20250929"},
+		{"claude-3-5-sonnet-v2@20241022", "claude-sonnet-3-5-20241022"},
+		{"publishers/anthropic/models/claude-opus-4-1@20250805", "claude-opus-4-1-20250805"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := normalizeModelID(tt.input)
+			if result != tt.expected {
+				t.Errorf("normalizeModelID(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetPricingProviderIDs(t *testing.T) {
+	pricing := &types.PricingData{
+		Models: map[string]types.ModelPricing{
+			"claude-opus-4-1":  {Input: 15.0, Output: 75.0},
+			"claude-haiku-3-5": {Input: 0.8, Output: 4.0},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		model         string
+		expectedInput float64
+	}{
+		{"bedrock opus", "us.anthropic.claude-opus-4-1-20250805-v1:0", 15.0},
+		{"bedrock legacy haiku", "anthropic.claude-3-5-haiku-20241022-v1:0", 0.8},
+		{"vertex opus", "claude-opus-4-1@20250805", 15.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := getPricing(tt.model, pricing)
+			if p.Input != tt.expectedInput {
+				t.Errorf("expected input price %.2f, got %.2f", tt.expectedInput, p.Input)
+			}
+		})
+	}
+}
+
 func TestCostCacheLoadSave(t *testing.T) {
 	tmpDir := t.TempDir()
 	cacheFile := filepath.Join(tmpDir, "cost_cache.json")
@@ -148,9 +205,9 @@ func TestCostCacheLoadSave(t *testing.T) {
 				Offset:  500,
 			},
 		},
-		ProcessedMessages: map[string]bool{
-			"msg1:req1": true,
-			"msg2:req2": true,
+		ProcessedMessages: MessageBuckets{
+			"2025-11-28": {"msg1:req1": true},
+			"2025-11-29": {"msg2:req2": true},
 		},
 	}
 
@@ -165,8 +222,8 @@ func TestCostCacheLoadSave(t *testing.T) {
 	if loaded.DayCosts["2025-11-28"] != 10.50 {
 		t.Errorf("expected 10.50, got %.2f", loaded.DayCosts["2025-11-28"])
 	}
-	if len(loaded.ProcessedMessages) != 2 {
-		t.Errorf("expected 2 processed messages, got %d", len(loaded.ProcessedMessages))
+	if loaded.ProcessedMessages.size() != 2 {
+		t.Errorf("expected 2 processed messages, got %d", loaded.ProcessedMessages.size())
 	}
 }
 
@@ -177,7 +234,7 @@ func TestCleanupOldDays(t *testing.T) {
 			"2025-11-15": 10.0, // within range
 			"2025-11-28": 20.0, // within range
 		},
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
 	}
 
 	cutoff := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
@@ -321,7 +378,7 @@ func TestProcessLogFile(t *testing.T) {
 	cache := &CostCache{
 		DayCosts:          make(map[string]float64),
 		FileState:         make(map[string]FileProcessState),
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
 	}
 
 	pricing := &types.PricingData{
@@ -335,8 +392,8 @@ func TestProcessLogFile(t *testing.T) {
 	processLogFile(logFile, info, cache, pricing, monthlyCutoff)
 
 	// Check results
-	if len(cache.ProcessedMessages) != 2 {
-		t.Errorf("expected 2 processed messages, got %d", len(cache.ProcessedMessages))
+	if cache.ProcessedMessages.size() != 2 {
+		t.Errorf("expected 2 processed messages, got %d", cache.ProcessedMessages.size())
 	}
 
 	dayCost := cache.DayCosts["2025-11-29"]
@@ -379,15 +436,15 @@ func TestProcessLogFileIncremental(t *testing.T) {
 	cache := &CostCache{
 		DayCosts:          make(map[string]float64),
 		FileState:         make(map[string]FileProcessState),
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
 	}
 
 	info, _ := os.Stat(logFile)
 	processLogFile(logFile, info, cache, pricing, monthlyCutoff)
 
 	initialCost := cache.DayCosts["2025-11-29"]
-	if len(cache.ProcessedMessages) != 1 {
-		t.Errorf("expected 1 processed message after first run, got %d", len(cache.ProcessedMessages))
+	if cache.ProcessedMessages.size() != 1 {
+		t.Errorf("expected 1 processed message after first run, got %d", cache.ProcessedMessages.size())
 	}
 
 	// Append new entry
@@ -411,8 +468,8 @@ func TestProcessLogFileIncremental(t *testing.T) {
 	info, _ = os.Stat(logFile)
 	processLogFile(logFile, info, cache, pricing, monthlyCutoff)
 
-	if len(cache.ProcessedMessages) != 2 {
-		t.Errorf("expected 2 processed messages after second run, got %d", len(cache.ProcessedMessages))
+	if cache.ProcessedMessages.size() != 2 {
+		t.Errorf("expected 2 processed messages after second run, got %d", cache.ProcessedMessages.size())
 	}
 
 	newCost := cache.DayCosts["2025-11-29"]
@@ -454,15 +511,15 @@ func TestProcessLogFileDeduplication(t *testing.T) {
 	cache := &CostCache{
 		DayCosts:          make(map[string]float64),
 		FileState:         make(map[string]FileProcessState),
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
 	}
 
 	info, _ := os.Stat(logFile)
 	processLogFile(logFile, info, cache, pricing, monthlyCutoff)
 
 	// Should only count once despite 3 entries
-	if len(cache.ProcessedMessages) != 1 {
-		t.Errorf("expected 1 processed message (deduplicated), got %d", len(cache.ProcessedMessages))
+	if cache.ProcessedMessages.size() != 1 {
+		t.Errorf("expected 1 processed message (deduplicated), got %d", cache.ProcessedMessages.size())
 	}
 
 	// Cost should be for single message only
@@ -472,6 +529,59 @@ func TestProcessLogFileDeduplication(t *testing.T) {
 	}
 }
 
+func TestUnknownModelAccounting(t *testing.T) {
+	pricing := &types.PricingData{
+		Models: map[string]types.ModelPricing{
+			"claude-sonnet-4-5": {Input: 3.0, Output: 15.0},
+		},
+	}
+	monthlyCutoff := time.Date(2025, 10, 29, 0, 0, 0, 0, time.UTC)
+
+	cache := &CostCache{
+		DayCosts:          make(map[string]float64),
+		FileState:         make(map[string]FileProcessState),
+		ProcessedMessages: make(MessageBuckets),
+	}
+
+	for i, model := range []string{"claude-sonnet-4-5", "mystery-model", "mystery-model"} {
+		entry := map[string]interface{}{
+			"timestamp": "2025-11-29T10:00:00Z",
+			"type":      "assistant",
+			"message": map[string]interface{}{
+				"id":    "msg" + string(rune('a'+i)),
+				"model": model,
+				"usage": map[string]int{"input_tokens": 1000000, "output_tokens": 0},
+			},
+			"requestId": "req",
+		}
+		line, _ := json.Marshal(entry)
+		processLogEntry(line, cache, pricing, monthlyCutoff)
+	}
+
+	if len(cache.UnknownModels) != 1 {
+		t.Fatalf("expected 1 unknown model, got %d", len(cache.UnknownModels))
+	}
+	stats := cache.UnknownModels["mystery-model"]
+	if stats == nil {
+		t.Fatal("expected mystery-model to be tracked")
+	}
+	if stats.Messages != 2 || stats.InputTokens != 2000000 {
+		t.Errorf("expected 2 messages / 2M input tokens, got %d / %d", stats.Messages, stats.InputTokens)
+	}
+	if !floatEquals(stats.EstimatedCost, 6.0) {
+		t.Errorf("expected estimated cost 6.00, got %.2f", stats.EstimatedCost)
+	}
+	if stats.LastSeen != "2025-11-29" {
+		t.Errorf("expected last seen 2025-11-29, got %s", stats.LastSeen)
+	}
+
+	// Pruned together with old day buckets
+	cleanupOldDays(cache, time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC))
+	if len(cache.UnknownModels) != 0 {
+		t.Errorf("expected unknown models to be pruned, got %d", len(cache.UnknownModels))
+	}
+}
+
 func TestDayOverflow(t *testing.T) {
 	tmpDir := t.TempDir()
 	logFile := filepath.Join(tmpDir, "test.jsonl")
@@ -506,7 +616,7 @@ func TestDayOverflow(t *testing.T) {
 	cache := &CostCache{
 		DayCosts:          make(map[string]float64),
 		FileState:         make(map[string]FileProcessState),
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
 	}
 
 	info, _ := os.Stat(logFile)
@@ -570,7 +680,7 @@ func TestUnchangedFileSkipped(t *testing.T) {
 	cache := &CostCache{
 		DayCosts:          make(map[string]float64),
 		FileState:         make(map[string]FileProcessState),
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
 	}
 
 	info, _ := os.Stat(logFile)
@@ -647,15 +757,15 @@ func TestLargeLogEntry(t *testing.T) {
 	cache := &CostCache{
 		DayCosts:          make(map[string]float64),
 		FileState:         make(map[string]FileProcessState),
-		ProcessedMessages: make(map[string]bool),
+		ProcessedMessages: make(MessageBuckets),
 	}
 
 	info, _ := os.Stat(logFile)
 	processLogFile(logFile, info, cache, pricing, monthlyCutoff)
 
 	// Should process both entries despite one being very large
-	if len(cache.ProcessedMessages) != 2 {
-		t.Errorf("expected 2 processed messages (including large one), got %d", len(cache.ProcessedMessages))
+	if cache.ProcessedMessages.size() != 2 {
+		t.Errorf("expected 2 processed messages (including large one), got %d", cache.ProcessedMessages.size())
 	}
 
 	// Cost should include both entries
@@ -677,3 +787,569 @@ func TestLargeLogEntry(t *testing.T) {
 		t.Error("file state not saved")
 	}
 }
+
+func TestParsePublishedPricing(t *testing.T) {
+	page := `
+<table>
+<tr><th>Model</th><th>Base Input Tokens</th><th>5m Cache Writes</th><th>1h Cache Writes</th><th>Cache Hits &amp; Refreshes</th><th>Output Tokens</th></tr>
+<tr><td>Claude Opus 4.1</td><td>$15 / MTok</td><td>$18.75 / MTok</td><td>$30 / MTok</td><td>$1.50 / MTok</td><td>$75 / MTok</td></tr>
+<tr><td>Claude Sonnet 4.5</td><td>$3 / MTok</td><td>$3.75 / MTok</td><td>$6 / MTok</td><td>$0.30 / MTok</td><td>$15 / MTok</td></tr>
+<tr><td>Claude Haiku 3.5</td><td>$0.80 / MTok</td><td>$1 / MTok</td><td>$1.6 / MTok</td><td>$0.08 / MTok</td><td>$4 / MTok</td></tr>
+</table>
+<p>Batch processing</p>
+<table>
+<tr><td>Claude Opus 4.1</td><td>$7.50 / MTok</td><td>$37.50 / MTok</td></tr>
+</table>`
+
+	published := ParsePublishedPricing(page)
+
+	expected := map[string]types.ModelPricing{
+		"claude-opus-4-1":   {Input: 15, Output: 75},
+		"claude-sonnet-4-5": {Input: 3, Output: 15},
+		"claude-haiku-3-5":  {Input: 0.8, Output: 4},
+	}
+	if len(published) != len(expected) {
+		t.Fatalf("expected %d models, got %d: %v", len(expected), len(published), published)
+	}
+	for model, want := range expected {
+		if got := published[model]; got != want {
+			t.Errorf("%s: expected %+v, got %+v", model, want, got)
+		}
+	}
+}
+
+func TestComparePricing(t *testing.T) {
+	ours := &types.PricingData{
+		Models: map[string]types.ModelPricing{
+			"claude-opus-4-5":   {Input: 15, Output: 75},
+			"claude-sonnet-4-5": {Input: 3, Output: 15},
+		},
+	}
+	published := map[string]types.ModelPricing{
+		"claude-opus-4-5":   {Input: 5, Output: 25},
+		"claude-sonnet-4-5": {Input: 3, Output: 15},
+		"claude-haiku-4-5":  {Input: 1, Output: 5},
+	}
+
+	drifts := ComparePricing(ours, published)
+	if len(drifts) != 3 {
+		t.Fatalf("expected 3 drifts, got %d: %+v", len(drifts), drifts)
+	}
+	if drifts[0].Model != "claude-haiku-4-5" || drifts[0].Field != "missing" {
+		t.Errorf("expected missing haiku first, got %+v", drifts[0])
+	}
+	if drifts[1].Field != "input" || drifts[1].Ours != 15 || drifts[1].Published != 5 {
+		t.Errorf("unexpected input drift %+v", drifts[1])
+	}
+	if drifts[2].Field != "output" || drifts[2].Published != 25 {
+		t.Errorf("unexpected output drift %+v", drifts[2])
+	}
+}
+
+func TestSaveCostCache_PrivatePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions")
+	}
+
+	cacheFile := filepath.Join(t.TempDir(), "nested", "cost_cache.json")
+	saveCostCache(cacheFile, &CostCache{ProcessedMessages: MessageBuckets{}})
+
+	assertMode(t, cacheFile, 0600)
+	assertMode(t, filepath.Dir(cacheFile), 0700)
+}
+
+func assertMode(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != want {
+		t.Errorf("%s has mode %o, want %o", path, got, want)
+	}
+}
+
+func TestCachedTokenStats(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	today := time.Now().Format("2006-01-02")
+	saveCostCache(filepath.Join(config.CacheDir(), "cost_cache.json"), &CostCache{
+		DayCosts: map[string]float64{today: 4.25},
+	})
+
+	stats := CachedTokenStats()
+	if !floatEquals(stats.DailyCost, 4.25) || !floatEquals(stats.MonthlyCost, 4.25) {
+		t.Errorf("expected cached costs without a log scan, got %+v", stats)
+	}
+}
+
+func TestForecastMonth(t *testing.T) {
+	// $10 every day, and half of today gone with $5 spent: the rate is a
+	// steady $10/day whatever the weighting
+	steady := &CostCache{DayCosts: map[string]float64{"2025-11-30": 50}}
+	for day := 1; day <= 9; day++ {
+		steady.DayCosts[time.Date(2025, 12, day, 0, 0, 0, 0, time.Local).Format("2006-01-02")] = 10
+	}
+	steady.DayCosts["2025-12-10"] = 5
+	now := time.Date(2025, 12, 10, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name      string
+		budget    float64
+		budgetOut time.Time
+	}{
+		{"no budget", 0, time.Time{}},
+		{"lasts the month", 400, time.Time{}},
+		{"runs out", 200, time.Date(2025, 12, 21, 0, 0, 0, 0, time.Local)},
+		{"already exceeded", 50, now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := ForecastMonth(steady, now, tt.budget)
+			if f.MonthToDate != 95 {
+				t.Errorf("MonthToDate = %.2f, want 95 (last month excluded)", f.MonthToDate)
+			}
+			if math.Abs(f.DailyRate-10) > 1e-9 {
+				t.Errorf("DailyRate = %.4f, want 10", f.DailyRate)
+			}
+			if math.Abs(f.Projected-310) > 1e-6 {
+				t.Errorf("Projected = %.4f, want 310", f.Projected)
+			}
+			if f.BudgetOut.Sub(tt.budgetOut).Abs() > time.Second {
+				t.Errorf("BudgetOut = %v, want %v", f.BudgetOut, tt.budgetOut)
+			}
+		})
+	}
+
+	t.Run("recent days weigh more", func(t *testing.T) {
+		cache := &CostCache{DayCosts: map[string]float64{}}
+		for day := 8; day <= 14; day++ {
+			cache.DayCosts[time.Date(2025, 12, day, 0, 0, 0, 0, time.Local).Format("2006-01-02")] = 20
+		}
+		f := ForecastMonth(cache, time.Date(2025, 12, 15, 0, 0, 0, 0, time.Local), 0)
+		if f.DailyRate <= 10 || f.DailyRate >= 20 {
+			t.Errorf("DailyRate = %.2f, want between the plain average $10 and the recent $20", f.DailyRate)
+		}
+	})
+}
+
+func TestAggregateStatsBudgetOut(t *testing.T) {
+	cfg := config.Get()
+	cfg.AggregationMode = "fixed"
+	defer func() { cfg.BudgetMonthly = 0 }()
+
+	cache := &CostCache{DayCosts: map[string]float64{"2025-12-01": 30, "2025-12-02": 30}}
+	now := time.Date(2025, 12, 3, 0, 0, 0, 0, time.Local)
+
+	cfg.BudgetMonthly = 100
+	stats := aggregateStats(cache, now)
+	if stats.BudgetOut == nil || stats.BudgetOut.Day() != 4 {
+		t.Errorf("BudgetOut = %v, want Dec 4", stats.BudgetOut)
+	}
+
+	cfg.BudgetMonthly = 5000
+	if stats := aggregateStats(cache, now); stats.BudgetOut != nil {
+		t.Errorf("BudgetOut = %v, want nil within budget", stats.BudgetOut)
+	}
+}
+
+func TestAggregateStatsMonthProjected(t *testing.T) {
+	cfg := config.Get()
+	defer func() { cfg.AggregationMode = "fixed" }()
+
+	cache := &CostCache{DayCosts: map[string]float64{"2025-12-01": 30, "2025-12-02": 30}}
+	now := time.Date(2025, 12, 3, 0, 0, 0, 0, time.Local)
+
+	// $30/day for the remaining 29 days on top of $60
+	cfg.AggregationMode = "fixed"
+	if stats := aggregateStats(cache, now); math.Abs(stats.MonthProjected-930) > 0.01 {
+		t.Errorf("MonthProjected = %.2f, want 930", stats.MonthProjected)
+	}
+
+	cfg.AggregationMode = "sliding"
+	if stats := aggregateStats(cache, now); stats.MonthProjected != 0 {
+		t.Errorf("MonthProjected = %.2f, want 0 in sliding mode", stats.MonthProjected)
+	}
+}
+
+func TestScanActivity(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	writeLog := func(project, name string, entries ...map[string]interface{}) {
+		dir := filepath.Join(home, ".claude", "projects", project)
+		os.MkdirAll(dir, 0755)
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, entry := range entries {
+			data, _ := json.Marshal(entry)
+			f.Write(append(data, '\n'))
+		}
+	}
+	msg := func(ts, id, model, session, cwd string) map[string]interface{} {
+		return map[string]interface{}{
+			"timestamp": ts,
+			"type":      "assistant",
+			"sessionId": session,
+			"cwd":       cwd,
+			"requestId": "req-" + id,
+			"message": map[string]interface{}{
+				"id":    id,
+				"model": model,
+				"usage": map[string]int{"input_tokens": 1000000},
+			},
+		}
+	}
+
+	// Default (sonnet) rates apply without embedded pricing: $3 per message
+	writeLog("-work-app", "s1.jsonl",
+		msg("2025-12-01T10:00:00Z", "m1", "us.anthropic.claude-opus-4-5-20251101-v1:0", "s1", "/work/app"),
+		msg("2025-12-01T10:30:00Z", "m1", "us.anthropic.claude-opus-4-5-20251101-v1:0", "s1", "/work/app"), // duplicate
+		msg("2025-12-02T10:00:00Z", "m2", "claude-opus-4-5-20251101", "s1", "/work/app"),
+		msg("2025-11-20T10:00:00Z", "m3", "claude-opus-4-5-20251101", "s1", "/work/app"), // before the period
+	)
+	writeLog("-work-lib", "s2.jsonl", msg("2025-12-02T11:00:00Z", "m4", "claude-sonnet-4-5-20250929", "s2", ""))
+
+	since := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+	a := ScanActivity(since, since.AddDate(0, 0, 7))
+
+	if a.Messages != 3 || math.Abs(a.Total-9) > 1e-9 {
+		t.Errorf("Messages = %d, Total = %.2f, want 3 messages costing $9", a.Messages, a.Total)
+	}
+	if len(a.Sessions) != 2 {
+		t.Errorf("Sessions = %v, want s1 and s2", a.Sessions)
+	}
+	if a.Projects["app"] != 6 || a.Projects["-work-lib"] != 3 {
+		t.Errorf("Projects = %v, want app $6 (from cwd) and -work-lib $3 (from directory)", a.Projects)
+	}
+	if a.Models["claude-opus-4-5"] != 6 || a.Models["claude-sonnet-4-5"] != 3 {
+		t.Errorf("Models = %v, want provider and dated IDs grouped", a.Models)
+	}
+	dec2 := time.Date(2025, 12, 2, 10, 0, 0, 0, time.UTC).Local().Format("2006-01-02")
+	if a.Days[dec2] == 0 {
+		t.Errorf("Days = %v, want costs on Dec 2", a.Days)
+	}
+	if len(a.Rows) != 3 {
+		t.Errorf("Rows = %d, want one per day, project and model", len(a.Rows))
+	}
+	if row := a.Rows[ActivityKey{dec2, "-work-lib", "claude-sonnet-4-5"}]; row == nil || row.Cost != 3 || row.Messages != 1 || row.InputTokens != 1000000 {
+		t.Errorf("Dec 2 -work-lib sonnet row = %+v", row)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	cacheFile := filepath.Join(config.CacheDir(), "cost_cache.json")
+	saveCostCache(cacheFile, &CostCache{
+		DayCosts:          map[string]float64{"2025-11-28": 1, "2025-11-29": 2, "2025-12-01": 3},
+		FileState:         map[string]FileProcessState{},
+		ProcessedMessages: MessageBuckets{},
+		UnknownModels: map[string]*UnknownModelStats{
+			"old-model": {LastSeen: "2025-11-28"},
+			"new-model": {LastSeen: "2025-12-01"},
+		},
+	})
+
+	before := time.Date(2025, 12, 1, 0, 0, 0, 0, time.Local)
+	if removed := Purge(before); removed != 2 {
+		t.Errorf("Purge removed %d days, want 2", removed)
+	}
+
+	cache := loadCostCache(cacheFile)
+	if len(cache.DayCosts) != 1 || cache.DayCosts["2025-12-01"] != 3 {
+		t.Errorf("DayCosts = %v, want only 2025-12-01", cache.DayCosts)
+	}
+	if _, ok := cache.UnknownModels["old-model"]; ok {
+		t.Error("expected unknown model last seen before the purge date removed")
+	}
+
+	// Rescanning logs must not bring purged days back
+	if cutoff := retentionCutoff(cache, before.AddDate(0, 0, 5)); !cutoff.Equal(before) {
+		t.Errorf("retentionCutoff = %v, want the purge date %v", cutoff, before)
+	}
+
+	// An earlier purge date doesn't move the marker back
+	Purge(before.AddDate(0, 0, -10))
+	if cache := loadCostCache(cacheFile); cache.PurgedBefore != "2025-12-01" {
+		t.Errorf("PurgedBefore = %q, want 2025-12-01", cache.PurgedBefore)
+	}
+}
+
+func TestModelFamily(t *testing.T) {
+	tests := map[string]string{
+		"claude-opus-4-5-20251101":                       "opus",
+		"us.anthropic.claude-sonnet-4-5-20250929-v1:0":   "sonnet",
+		"claude-3-5-haiku-20241022":                      "haiku",
+		"publishers/anthropic/models/claude-opus-4@2025": "opus",
+		"gpt-4o": "other",
+		"":       "other",
+	}
+	for model, want := range tests {
+		if got := ModelFamily(model); got != want {
+			t.Errorf("ModelFamily(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
+
+func TestAggregateStatsByModel(t *testing.T) {
+	config.Get().AggregationMode = "fixed"
+	now := time.Date(2025, 12, 3, 12, 0, 0, 0, time.Local)
+
+	cache := &CostCache{DayCosts: map[string]float64{}, ProcessedMessages: MessageBuckets{}}
+	pricing := &types.PricingData{Models: map[string]types.ModelPricing{
+		"claude-opus-4-5":   {Input: 5},
+		"claude-sonnet-4-5": {Input: 3},
+	}}
+	for i, e := range []struct{ ts, model string }{
+		{"2025-12-03T10:00:00", "claude-opus-4-5-20251101"},
+		{"2025-12-03T11:00:00", "claude-sonnet-4-5-20250929"},
+		{"2025-12-01T10:00:00", "claude-opus-4-5-20251101"},
+	} {
+		ts, _ := time.ParseInLocation("2006-01-02T15:04:05", e.ts, time.Local)
+		line, _ := json.Marshal(map[string]interface{}{
+			"timestamp": ts.Format(time.RFC3339),
+			"type":      "assistant",
+			"requestId": fmt.Sprint("req", i),
+			"message": map[string]interface{}{
+				"id":    fmt.Sprint("msg", i),
+				"model": e.model,
+				"usage": map[string]int{"input_tokens": 1000000},
+			},
+		})
+		processLogEntry(line, cache, pricing, now.AddDate(0, -1, 0))
+	}
+
+	stats := aggregateStats(cache, now)
+	if stats.DailyByModel["opus"] != 5 || stats.DailyByModel["sonnet"] != 3 {
+		t.Errorf("DailyByModel = %v, want opus $5, sonnet $3", stats.DailyByModel)
+	}
+	if stats.MonthlyByModel["opus"] != 10 || stats.MonthlyCost != 13 {
+		t.Errorf("MonthlyByModel = %v (total %.2f), want opus $10 of $13", stats.MonthlyByModel, stats.MonthlyCost)
+	}
+}
+
+func TestProcessLogEntryDayStats(t *testing.T) {
+	cache := &CostCache{DayCosts: map[string]float64{}, ProcessedMessages: MessageBuckets{}}
+	pricing := &types.PricingData{Models: map[string]types.ModelPricing{"claude-sonnet-4-5": {Input: 3}}}
+	ts := time.Date(2025, 12, 3, 10, 0, 0, 0, time.Local)
+
+	for _, id := range []string{"msg1", "msg2", "msg2"} {
+		line, _ := json.Marshal(map[string]interface{}{
+			"timestamp": ts.Format(time.RFC3339),
+			"type":      "assistant",
+			"requestId": "req-" + id,
+			"message": map[string]interface{}{
+				"id":    id,
+				"model": "claude-sonnet-4-5-20250929",
+				"usage": map[string]int{"input_tokens": 100, "output_tokens": 20, "cache_creation_input_tokens": 5, "cache_read_input_tokens": 1000},
+			},
+		})
+		processLogEntry(line, cache, pricing, ts.AddDate(0, -1, 0))
+	}
+
+	want := DayStats{Messages: 2, InputTokens: 200, OutputTokens: 40, CacheCreationTokens: 10, CacheReadTokens: 2000}
+	if got := cache.DayStats["2025-12-03"]; got == nil || *got != want {
+		t.Errorf("DayStats = %+v, want %+v", got, want)
+	}
+
+	// Cache reads aren't counted in the token totals
+	config.Get().AggregationMode = "fixed"
+	if stats := aggregateStats(cache, ts); stats.DailyTokens != 250 || stats.WeeklyTokens != 250 || stats.MonthlyTokens != 250 {
+		t.Errorf("tokens = %d/%d/%d, want 250 each", stats.DailyTokens, stats.WeeklyTokens, stats.MonthlyTokens)
+	}
+
+	cleanupOldDays(cache, ts.AddDate(0, 0, 1))
+	if len(cache.DayStats) != 0 {
+		t.Errorf("expected cleanup to drop old day stats, got %v", cache.DayStats)
+	}
+}
+
+func TestSessionCosts(t *testing.T) {
+	cache := &CostCache{DayCosts: map[string]float64{}, ProcessedMessages: MessageBuckets{}}
+	pricing := &types.PricingData{Models: map[string]types.ModelPricing{"claude-sonnet-4-5": {Input: 3}}}
+	now := time.Date(2025, 12, 3, 10, 0, 0, 0, time.Local)
+
+	for _, m := range []struct {
+		id, session string
+		at          time.Time
+	}{
+		{"msg1", "s1", now.AddDate(0, 0, -1)},
+		{"msg2", "s1", now},
+		{"msg2", "s1", now}, // streamed again
+		{"msg3", "s2", now.AddDate(0, 0, -3)},
+		{"msg4", "", now},
+	} {
+		id := m.id
+		line, _ := json.Marshal(map[string]interface{}{
+			"timestamp": m.at.Format(time.RFC3339),
+			"type":      "assistant",
+			"sessionId": m.session,
+			"requestId": "req-" + id,
+			"message": map[string]interface{}{
+				"id":    id,
+				"model": "claude-sonnet-4-5",
+				"usage": map[string]int{"input_tokens": 1000000},
+			},
+		})
+		processLogEntry(line, cache, pricing, now.AddDate(0, -1, 0))
+	}
+
+	if s := cache.SessionCosts["s1"]; s == nil || s.Cost != 6 || s.LastDay != "2025-12-03" {
+		t.Errorf("s1 = %+v, want $6 last on 2025-12-03", s)
+	}
+	if got := recentSessions(cache, now); len(got) != 1 || got["s1"] != 6 {
+		t.Errorf("recentSessions = %v, want only s1, active since yesterday", got)
+	}
+	cleanupOldDays(cache, now.AddDate(0, 0, -2))
+	if _, ok := cache.SessionCosts["s2"]; ok || len(cache.SessionCosts) != 1 {
+		t.Errorf("expected cleanup to drop s2, got %v", cache.SessionCosts)
+	}
+}
+
+func TestLoadCostCache_RescansOutdatedVersion(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "cost_cache.json")
+	old := `{"day_costs":{"2025-12-01":4},"file_state":{"a.jsonl":{"offset":10}},"processed_messages":{"m:r":true}}`
+	os.WriteFile(cacheFile, []byte(old), 0600)
+
+	cache := loadCostCache(cacheFile)
+	if len(cache.DayCosts) != 0 || len(cache.FileState) != 0 || cache.ProcessedMessages.size() != 0 {
+		t.Errorf("expected an outdated cache to be reset for a rescan, got %+v", cache)
+	}
+
+	cache.DayCosts["2025-12-01"] = 4
+	saveCostCache(cacheFile, cache)
+	if loaded := loadCostCache(cacheFile); loaded.DayCosts["2025-12-01"] != 4 {
+		t.Errorf("expected a current cache to load as saved, got %+v", loaded)
+	}
+}
+
+func TestLoadCostCache_Corrupt(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "cost_cache.json")
+	saveCostCache(cacheFile, &CostCache{DayCosts: map[string]float64{"2025-12-01": 4}})
+	data, _ := os.ReadFile(cacheFile)
+	os.WriteFile(cacheFile, data[:len(data)/2], 0600) // a write cut short
+
+	cache := loadCostCache(cacheFile)
+	if len(cache.DayCosts) != 0 || cache.FileState == nil || cache.SessionCosts == nil {
+		t.Errorf("expected an empty cache to rebuild from the logs, got %+v", cache)
+	}
+	if _, err := os.Stat(cacheFile + ".corrupt"); err != nil {
+		t.Errorf("expected the corrupt cache to be kept aside: %v", err)
+	}
+}
+
+func TestAggregateStatsDayHistory(t *testing.T) {
+	cache := &CostCache{DayCosts: map[string]float64{
+		"2025-11-26": 99, // 8 days ago, outside the history
+		"2025-11-27": 4,
+		"2025-11-30": 12.5,
+		"2025-12-03": 2,
+	}}
+	now := time.Date(2025, 12, 3, 9, 0, 0, 0, time.Local)
+
+	want := []float64{4, 0, 0, 12.5, 0, 0, 2}
+	got := aggregateStats(cache, now).DayHistory
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("DayHistory = %v, want %v", got, want)
+	}
+}
+
+func TestLoadCostCache_MigratesUnbucketedMessages(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "cost_cache.json")
+	v3 := `{"version":3,"day_costs":{"2025-12-01":4},"file_state":{"a.jsonl":{"offset":10}},"processed_messages":{"m:r":true}}`
+	os.WriteFile(cacheFile, []byte(v3), 0600)
+
+	cache := loadCostCache(cacheFile)
+	if cache.DayCosts["2025-12-01"] != 4 || cache.FileState["a.jsonl"].Offset != 10 {
+		t.Errorf("expected a version 3 cache to keep its costs without a rescan, got %+v", cache)
+	}
+	if !cache.ProcessedMessages.has(time.Now().Format("2006-01-02"), "m:r") {
+		t.Errorf("expected the message keys moved into day buckets, got %+v", cache.ProcessedMessages)
+	}
+}
+
+func TestCleanupOldDays_PrunesMessageBuckets(t *testing.T) {
+	cache := &CostCache{
+		DayCosts: map[string]float64{},
+		ProcessedMessages: MessageBuckets{
+			"2025-10-01": {"old:req": true},
+			"2025-11-15": {"new:req": true},
+		},
+		FileState: map[string]FileProcessState{"a.jsonl": {Offset: 10}},
+	}
+
+	cleanupOldDays(cache, time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC))
+	if cache.ProcessedMessages.has("2025-10-01", "old:req") || !cache.ProcessedMessages.has("2025-11-15", "new:req") {
+		t.Errorf("expected only the old day's messages pruned, got %v", cache.ProcessedMessages)
+	}
+	if len(cache.FileState) != 1 {
+		t.Errorf("expected file state kept, got %v", cache.FileState)
+	}
+}
+
+func TestScanLogsCheckpoints(t *testing.T) {
+	defer func(d time.Duration) { checkpointInterval = d }(checkpointInterval)
+	checkpointInterval = 0
+
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		entry := fmt.Sprintf(`{"timestamp":%q,"type":"assistant","requestId":"req-%s","message":{"id":"msg-%s","model":"claude-sonnet-4-5","usage":{"input_tokens":100}}}`+"\n",
+			time.Now().UTC().Format(time.RFC3339), name, name)
+		os.WriteFile(filepath.Join(dir, name+".jsonl"), []byte(entry), 0644)
+	}
+
+	cache := newCostCache()
+	var progress []int
+	scan := func() {
+		scanLogs(dir, cache, &types.PricingData{}, time.Time{}, func() { progress = append(progress, len(cache.FileState)) })
+	}
+	scan()
+	if len(progress) != 2 || progress[0] != 1 || progress[1] != 2 {
+		t.Errorf("checkpoints at %v files, want after each of the 2 files", progress)
+	}
+
+	// Nothing new, nothing to save
+	progress = nil
+	scan()
+	if len(progress) != 0 {
+		t.Errorf("checkpoints at %v files on an unchanged scan, want none", progress)
+	}
+}
+
+func TestSavedTokenStatsAndRefresh(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	// A fresh pricing cache keeps the scan from fetching pricing
+	os.WriteFile(filepath.Join(config.CacheDir(), "pricing.json"), []byte("{}"), 0600)
+
+	if _, scanned := SavedTokenStats(); scanned {
+		t.Fatal("expected no scanned cache before the first scan")
+	}
+
+	dir := filepath.Join(home, ".claude", "projects", "-home-user-app")
+	os.MkdirAll(dir, 0755)
+	entry, _ := json.Marshal(map[string]interface{}{
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"type":      "assistant",
+		"requestId": "req1",
+		"message": map[string]interface{}{
+			"id":    "msg1",
+			"model": "claude-sonnet-4-5",
+			"usage": map[string]interface{}{"input_tokens": 1000000},
+		},
+	})
+	os.WriteFile(filepath.Join(dir, "session.jsonl"), append(entry, '\n'), 0644)
+
+	Refresh()
+	stats, scanned := SavedTokenStats()
+	if !scanned || stats.DailyCost <= 0 {
+		t.Errorf("expected the refreshed costs to be served, got %+v (scanned %v)", stats, scanned)
+	}
+}
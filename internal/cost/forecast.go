@@ -0,0 +1,60 @@
+package cost
+
+import (
+	"math"
+	"time"
+)
+
+// forecastHalfLife is the age at which a day's spend counts half as much
+// toward the daily rate, so the forecast follows a change in habits within
+// about a week
+const forecastHalfLife = 7 * 24 * time.Hour
+
+// MonthForecast projects the current calendar month's spend
+type MonthForecast struct {
+	MonthToDate float64 // Spend from the 1st until now
+	DailyRate   float64 // Recency-weighted average spend per day
+	Projected   float64 // Expected total at the end of the month
+	// BudgetOut is when the budget is expected to run out; zero when it
+	// lasts until the end of the month or no budget was given
+	BudgetOut time.Time
+}
+
+// ForecastMonth projects month-end spend from the month-to-date daily costs.
+// Recent days weigh more, and today counts only for the part that has
+// passed, so an early-morning forecast isn't dragged down by an empty day.
+func ForecastMonth(cache *CostCache, now time.Time, budget float64) MonthForecast {
+	var f MonthForecast
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	var weightedCost, weightedDays float64
+	for day := monthStart; day.Before(now); day = day.AddDate(0, 0, 1) {
+		cost := cache.DayCosts[day.Format("2006-01-02")]
+		f.MonthToDate += cost
+
+		elapsed := 1.0
+		if next := day.AddDate(0, 0, 1); next.After(now) {
+			elapsed = now.Sub(day).Hours() / 24
+		}
+		weight := math.Pow(0.5, float64(now.Sub(day))/float64(forecastHalfLife))
+		weightedCost += weight * cost
+		weightedDays += weight * elapsed
+	}
+	if weightedDays > 0 {
+		f.DailyRate = weightedCost / weightedDays
+	}
+
+	remainingDays := monthEnd.Sub(now).Hours() / 24
+	f.Projected = f.MonthToDate + f.DailyRate*remainingDays
+
+	if budget > 0 && f.Projected > budget {
+		if f.MonthToDate >= budget {
+			f.BudgetOut = now
+		} else {
+			days := (budget - f.MonthToDate) / f.DailyRate
+			f.BudgetOut = now.Add(time.Duration(days * 24 * float64(time.Hour)))
+		}
+	}
+	return f
+}
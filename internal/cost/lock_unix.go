@@ -10,7 +10,7 @@ import (
 
 // acquireLock gets an exclusive lock on the lock file
 func acquireLock(lockFile string) (*os.File, error) {
-	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return nil, err
 	}
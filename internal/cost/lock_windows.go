@@ -12,7 +12,7 @@ import (
 func acquireLock(lockFile string) (*os.File, error) {
 	for i := 0; i < 10; i++ {
 		// Try to create lock file exclusively
-		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
 		if err == nil {
 			return f, nil
 		}
@@ -0,0 +1,67 @@
+package cost
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// bedrockVersionSuffix matches Bedrock revision suffixes like "-v1:0" or "-v2"
+	bedrockVersionSuffix = regexp.MustCompile(`-v\d+(:\d+)?$`)
+	// legacyModelName matches pre-4 naming like "claude-3-5-sonnet"
+	legacyModelName = regexp.MustCompile(`^claude-(\d+(?:-\d+)?)-(opus|sonnet|haiku)(.*)$`)
+)
+
+// normalizeModelID maps provider-specific model identifiers to canonical
+// Claude model names so they can be looked up in the pricing table:
+//
+//	anthropic.claude-sonnet-4-5-20250929-v1:0        -> claude-sonnet-4-5-20250929
+//	us.anthropic.claude-3-5-haiku-20241022-v1:0      -> claude-haiku-3-5-20241022
+//	arn:aws:bedrock:...:inference-profile/us.anthropic.claude-opus-4-1-20250805-v1:0
+//	                                                 -> claude-opus-4-1-20250805
+//	claude-sonnet-4-5@20250929 (Vertex)              -> claude-sonnet-4-5-20250929
+//	publishers/anthropic/models/claude-3-5-sonnet-v2@20241022
+//	                                                 -> claude-sonnet-3-5-20241022
+func normalizeModelID(model string) string {
+	model = strings.ToLower(strings.TrimSpace(model))
+
+	// Bedrock ARNs and Vertex resource paths: keep the last path element
+	if idx := strings.LastIndex(model, "/"); idx >= 0 {
+		model = model[idx+1:]
+	}
+
+	// Bedrock: optional cross-region prefix ("us.", "eu.", "global.") plus "anthropic."
+	if idx := strings.Index(model, "anthropic."); idx >= 0 {
+		model = model[idx+len("anthropic."):]
+	}
+
+	// Vertex: "claude-sonnet-4-5@20250929" -> "claude-sonnet-4-5-20250929"
+	if idx := strings.Index(model, "@"); idx > 0 {
+		base := bedrockVersionSuffix.ReplaceAllString(model[:idx], "")
+		model = base + "-" + model[idx+1:]
+	}
+
+	model = bedrockVersionSuffix.ReplaceAllString(model, "")
+
+	// Legacy naming puts the version before the family: "claude-3-5-sonnet" -> "claude-sonnet-3-5"
+	if m := legacyModelName.FindStringSubmatch(model); m != nil {
+		model = "claude-" + m[2] + "-" + m[1] + m[3]
+	}
+
+	return model
+}
+
+// ModelFamilies lists the families costs are split into, most expensive first
+var ModelFamilies = []string{"opus", "sonnet", "haiku", "other"}
+
+// ModelFamily returns the family of a model ID: "opus", "sonnet", "haiku" or
+// "other"
+func ModelFamily(model string) string {
+	model = normalizeModelID(model)
+	for _, family := range ModelFamilies[:3] {
+		if strings.Contains(model, family) {
+			return family
+		}
+	}
+	return "other"
+}
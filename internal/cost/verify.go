@@ -0,0 +1,136 @@
+package cost
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// PublishedPricingURL is the Anthropic pricing documentation page
+const PublishedPricingURL = "https://docs.anthropic.com/en/docs/about-claude/pricing"
+
+var (
+	htmlTag        = regexp.MustCompile(`<[^>]+>`)
+	publishedModel = regexp.MustCompile(`Claude (Opus|Sonnet|Haiku) (\d+(?:\.\d+)?)`)
+	perMTokPrice   = regexp.MustCompile(`\$(\d+(?:\.\d+)?)\s*/\s*MTok`)
+)
+
+// PricingDrift describes a difference between a pricing table and the published rates
+type PricingDrift struct {
+	Model     string
+	Field     string // "input", "output" or "missing"
+	Ours      float64
+	Published float64
+}
+
+// EmbeddedPricing returns the pricing table compiled into the binary
+func EmbeddedPricing() *types.PricingData {
+	var pricing types.PricingData
+	json.Unmarshal(embeddedPricing, &pricing)
+	return &pricing
+}
+
+// ActivePricing returns the pricing currently used for cost calculations
+// (the cached remote copy if fresh, otherwise the embedded table)
+func ActivePricing() *types.PricingData {
+	return loadPricing()
+}
+
+// FetchPublishedPricing downloads and parses the published pricing page
+func FetchPublishedPricing(url string) (map[string]types.ModelPricing, error) {
+	if config.Get().Offline {
+		return nil, fmt.Errorf("offline, not fetching the pricing page")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pricing page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pricing page returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing page: %w", err)
+	}
+
+	published := ParsePublishedPricing(string(body))
+	if len(published) == 0 {
+		return nil, fmt.Errorf("no model prices found on %s (page layout may have changed)", url)
+	}
+	return published, nil
+}
+
+// ParsePublishedPricing extracts per-model input/output prices from the
+// pricing page (HTML or markdown). It looks for the model pricing table,
+// whose rows list a model followed by five $/MTok columns: base input,
+// 5m cache writes, 1h cache writes, cache hits and output.
+func ParsePublishedPricing(page string) map[string]types.ModelPricing {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(page, " "))
+
+	result := make(map[string]types.ModelPricing)
+	matches := publishedModel.FindAllStringSubmatchIndex(text, -1)
+	for i, m := range matches {
+		end := len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+
+		prices := perMTokPrice.FindAllStringSubmatch(text[m[1]:end], -1)
+		if len(prices) != 5 {
+			continue
+		}
+
+		family := strings.ToLower(text[m[2]:m[3]])
+		version := strings.ReplaceAll(text[m[4]:m[5]], ".", "-")
+		model := "claude-" + family + "-" + version
+		if _, seen := result[model]; seen {
+			continue // first table wins
+		}
+
+		input, _ := strconv.ParseFloat(prices[0][1], 64)
+		output, _ := strconv.ParseFloat(prices[4][1], 64)
+		result[model] = types.ModelPricing{Input: input, Output: output}
+	}
+	return result
+}
+
+// ComparePricing reports every published model whose rates differ from ours
+// or that we have no entry for
+func ComparePricing(ours *types.PricingData, published map[string]types.ModelPricing) []PricingDrift {
+	var drifts []PricingDrift
+	for model, pub := range published {
+		p, ok := ours.Models[model]
+		if !ok {
+			drifts = append(drifts, PricingDrift{Model: model, Field: "missing", Published: pub.Input})
+			continue
+		}
+		if p.Input != pub.Input {
+			drifts = append(drifts, PricingDrift{Model: model, Field: "input", Ours: p.Input, Published: pub.Input})
+		}
+		if p.Output != pub.Output {
+			drifts = append(drifts, PricingDrift{Model: model, Field: "output", Ours: p.Output, Published: pub.Output})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Model != drifts[j].Model {
+			return drifts[i].Model < drifts[j].Model
+		}
+		return drifts[i].Field < drifts[j].Field
+	})
+	return drifts
+}
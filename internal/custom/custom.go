@@ -0,0 +1,195 @@
+package custom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// maxOutput is how many characters of a command's output a segment shows
+const maxOutput = 48
+
+// keepOutput is how long output is kept to show when a command times out
+// or a render can't wait for it
+const keepOutput = 24 * time.Hour
+
+// escapes matches the terminal escape sequences commands color output with
+var escapes = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// result is a command's output as last run in a directory
+type result struct {
+	RanAt  time.Time `json:"ran_at"`
+	Output string    `json:"output"`
+}
+
+// Run runs the commands of the enabled custom segments in dir and returns
+// what each printed, by segment name. Output less than --custom-ttl old is
+// reused. A command that times out shows its last output, one that fails
+// shows nothing.
+func Run(dir string) map[string]string {
+	cfg := config.Get()
+	segments := enabled()
+	if len(segments) == 0 {
+		return nil
+	}
+	now := time.Now()
+	results := loadCache()
+
+	outputs := make(map[string]string)
+	var stale []config.CustomSegment
+	for _, seg := range segments {
+		r, ok := results[cacheKey(dir, seg.Command)]
+		if ok && now.Sub(r.RanAt) < cfg.CustomTTL && !now.Before(r.RanAt) {
+			outputs[seg.Name] = r.Output
+		} else {
+			stale = append(stale, seg)
+		}
+	}
+	if len(stale) == 0 {
+		return outputs
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, seg := range stale {
+		wg.Add(1)
+		go func(seg config.CustomSegment) {
+			defer wg.Done()
+			output, err := run(dir, seg.Command, cfg.CustomTimeout)
+			key := cacheKey(dir, seg.Command)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == context.DeadlineExceeded:
+				config.WarnLog("Custom segment %s timed out after %v", seg.Name, cfg.CustomTimeout)
+				output = results[key].Output
+			case err != nil:
+				config.WarnLog("Custom segment %s failed: %v", seg.Name, err)
+				results[key] = result{RanAt: now}
+			default:
+				results[key] = result{RanAt: now, Output: output}
+			}
+			outputs[seg.Name] = output
+		}(seg)
+	}
+	wg.Wait()
+
+	saveCache(results, now)
+	return outputs
+}
+
+// Cached returns the last output of the enabled custom segments in dir,
+// however old, for renders that can't wait for the commands
+func Cached(dir string) map[string]string {
+	results := loadCache()
+	outputs := make(map[string]string)
+	for _, seg := range enabled() {
+		if r, ok := results[cacheKey(dir, seg.Command)]; ok {
+			outputs[seg.Name] = r.Output
+		}
+	}
+	return outputs
+}
+
+// enabled returns the command segments the layout shows or an expression
+// segment reads
+func enabled() []config.CustomSegment {
+	cfg := config.Get()
+	var segments []config.CustomSegment
+	for _, seg := range cfg.CustomSegments {
+		if seg.Command != "" && (cfg.SegmentEnabled(seg.Name) || cfg.ExprReads("custom."+seg.Name)) {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// run runs command with the platform's shell in dir and returns the first
+// line it printed. It returns context.DeadlineExceeded when the command
+// takes longer than timeout.
+func run(dir, command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		cmd.Dir = dir
+	}
+	// Don't wait for background processes the command left holding stdout
+	cmd.WaitDelay = 100 * time.Millisecond
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", err
+	}
+	return firstLine(out), nil
+}
+
+// firstLine returns the first non-blank line of out, without colors or
+// other control characters and shortened to maxOutput characters
+func firstLine(out []byte) string {
+	for _, line := range bytes.Split(escapes.ReplaceAll(out, nil), []byte("\n")) {
+		clean := strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, string(line))
+		clean = strings.TrimSpace(clean)
+		if clean == "" {
+			continue
+		}
+		if runes := []rune(clean); len(runes) > maxOutput {
+			clean = string(runes[:maxOutput-1]) + "…"
+		}
+		return clean
+	}
+	return ""
+}
+
+func cacheFile() string {
+	return filepath.Join(config.CacheDir(), "custom.json")
+}
+
+// cacheKey identifies a command run in a directory, so segments show the
+// output for the project they're rendered in
+func cacheKey(dir, command string) string {
+	return dir + "\x00" + command
+}
+
+func loadCache() map[string]result {
+	results := make(map[string]result)
+	if data, err := os.ReadFile(cacheFile()); err == nil {
+		json.Unmarshal(data, &results)
+	}
+	return results
+}
+
+// saveCache writes the results, dropping those older than keepOutput
+func saveCache(results map[string]result, now time.Time) {
+	for key, r := range results {
+		if now.Sub(r.RanAt) >= keepOutput {
+			delete(results, key)
+		}
+	}
+	if data, err := json.Marshal(results); err == nil {
+		config.WriteFile(cacheFile(), data)
+	}
+}
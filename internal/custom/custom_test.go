@@ -0,0 +1,86 @@
+package custom
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+func withConfig(t *testing.T, c *config.Config) {
+	t.Helper()
+	c.CacheDir = t.TempDir()
+	orig := *config.Get()
+	*config.Get() = *c
+	t.Cleanup(func() { *config.Get() = orig })
+}
+
+func TestFirstLine(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want string
+	}{
+		{"single line", "prod-cluster\n", "prod-cluster"},
+		{"first non-blank line", "\n  \n  v20.11.0  \nmore\n", "v20.11.0"},
+		{"colors stripped", "\x1b[1;32mmain\x1b[0m\r\n", "main"},
+		{"control characters stripped", "a\x07b\tc", "abc"},
+		{"shortened", strings.Repeat("é", 60), strings.Repeat("é", maxOutput-1) + "…"},
+		{"nothing printed", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstLine([]byte(tt.out)); got != tt.want {
+				t.Errorf("firstLine(%q) = %q, want %q", tt.out, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands use a POSIX shell")
+	}
+	dir := t.TempDir()
+	count := filepath.Join(dir, "count")
+	withConfig(t, &config.Config{
+		CustomTTL:     time.Hour,
+		CustomTimeout: 200 * time.Millisecond,
+		CustomSegments: []config.CustomSegment{
+			{Name: "here", Command: "echo runs >> count; basename $PWD"},
+			{Name: "fails", Command: "echo partial; exit 1"},
+			{Name: "slow", Command: "sleep 2; echo late"},
+			{Name: "hidden", Command: "echo hidden"},
+		},
+		Segments: "here,fails,slow",
+	})
+
+	want := map[string]string{"here": filepath.Base(dir), "fails": "", "slow": ""}
+	got := Run(dir)
+	for name, output := range want {
+		if got[name] != output {
+			t.Errorf("Run()[%q] = %q, want %q", name, got[name], output)
+		}
+	}
+	if _, ok := got["hidden"]; ok {
+		t.Error("ran the command of a segment that isn't shown")
+	}
+
+	// Within --custom-ttl the output is reused without running again
+	if got := Run(dir); got["here"] != filepath.Base(dir) {
+		t.Errorf("second Run()[here] = %q", got["here"])
+	}
+	if data, _ := os.ReadFile(count); strings.Count(string(data), "runs") != 1 {
+		t.Errorf("command ran %d times, want once within the TTL", strings.Count(string(data), "runs"))
+	}
+	if got := Cached(dir); got["here"] != filepath.Base(dir) {
+		t.Errorf("Cached()[here] = %q", got["here"])
+	}
+	if got := Cached(t.TempDir()); len(got) != 0 {
+		t.Errorf("Cached() in another directory = %v, want nothing", got)
+	}
+}
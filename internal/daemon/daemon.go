@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/cost"
+	"github.com/erwint/claude-code-statusline/internal/types"
+	"github.com/erwint/claude-code-statusline/internal/usage"
+)
+
+// RefreshInterval is how often the daemon refreshes its warm data. Usage
+// fetches still honor the cache TTL, so this mostly bounds cost staleness.
+const RefreshInterval = 15 * time.Second
+
+// Snapshot is the warm data served to statusline invocations. It only holds
+// usage and cost: git state and the rendered output depend on each
+// invocation's directory, session and flags, so invocations collect and
+// format those themselves.
+type Snapshot struct {
+	Usage        *types.UsageCache `json:"usage,omitempty"`
+	Subscription string            `json:"subscription,omitempty"`
+	Tier         string            `json:"tier,omitempty"`
+	IsApiBilling bool              `json:"is_api_billing"`
+	Stats        *types.TokenStats `json:"stats,omitempty"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+
+	// UsageCache keeps these out of its JSON, so they travel separately
+	UsageStale       bool   `json:"usage_stale,omitempty"`
+	UsageUnavailable bool   `json:"usage_unavailable,omitempty"`
+	UsageSource      string `json:"usage_source,omitempty"`
+}
+
+// SocketPath returns the daemon socket, inside the private cache directory
+func SocketPath() string {
+	return filepath.Join(config.CacheDir(), "daemon.sock")
+}
+
+// Collect gathers a fresh snapshot of usage and cost data
+func Collect() *Snapshot {
+	snap := &Snapshot{UpdatedAt: time.Now()}
+	snap.Usage, snap.Subscription, snap.Tier, snap.IsApiBilling = usage.GetUsageAndSubscription()
+	snap.Stats = cost.GetTokenStats()
+	return snap
+}
+
+// Run serves snapshots on socket until interrupted, refreshing them with
+// collect every interval
+func Run(socket string, interval time.Duration, collect func() *Snapshot) error {
+	ln, err := listen(socket)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		ln.Close()
+	}()
+
+	serve(ln, interval, collect)
+	os.Remove(socket)
+	return nil
+}
+
+// listen opens the socket, replacing one left behind by a dead daemon
+func listen(socket string) (net.Listener, error) {
+	if _, err := Query(socket, time.Second); err == nil {
+		return nil, errors.New("a daemon is already running on " + socket)
+	}
+	os.Remove(socket)
+
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(socket, config.PrivateFileMode)
+	return ln, nil
+}
+
+// serve answers every connection with the latest snapshot until ln is closed
+func serve(ln net.Listener, interval time.Duration, collect func() *Snapshot) {
+	var mu sync.RWMutex
+	var current []byte
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			snap := collect()
+			if data, err := json.Marshal(snap.encode()); err == nil {
+				mu.Lock()
+				current = data
+				mu.Unlock()
+			}
+			config.DebugLog("Daemon refreshed snapshot")
+
+			select {
+			case <-done:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		mu.RLock()
+		data := current
+		mu.RUnlock()
+		// Until the first refresh completes, clients get an empty reply and
+		// collect the data themselves
+		conn.Write(data)
+		conn.Close()
+	}
+}
+
+// Query fetches the current snapshot from a running daemon
+func Query(socket string, timeout time.Duration) (*Snapshot, error) {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var snap Snapshot
+	if err := json.NewDecoder(conn).Decode(&snap); err != nil {
+		return nil, err
+	}
+	return snap.decode(), nil
+}
+
+// encode copies the fields UsageCache doesn't serialize into the snapshot
+func (s *Snapshot) encode() *Snapshot {
+	if s.Usage != nil {
+		s.UsageStale, s.UsageUnavailable, s.UsageSource = s.Usage.Stale, s.Usage.Unavailable, s.Usage.Source
+	}
+	return s
+}
+
+// decode restores the fields encode moved out of UsageCache
+func (s *Snapshot) decode() *Snapshot {
+	if s.Usage != nil {
+		s.Usage.Stale, s.Usage.Unavailable, s.Usage.Source = s.UsageStale, s.UsageUnavailable, s.UsageSource
+	}
+	return s
+}
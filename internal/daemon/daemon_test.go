@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// shortSocket returns a socket path short enough for the platform limit
+func shortSocket(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "csd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "d.sock")
+}
+
+func TestServeAndQuery(t *testing.T) {
+	socket := shortSocket(t)
+	ln, err := listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collected := make(chan struct{}, 1)
+	collect := func() *Snapshot {
+		defer func() {
+			select {
+			case collected <- struct{}{}:
+			default:
+			}
+		}()
+		return &Snapshot{
+			Usage:        &types.UsageCache{UsagePercent: 42, Stale: true, Source: "cache"},
+			Subscription: "max",
+			Stats:        &types.TokenStats{DailyCost: 3.5},
+			UpdatedAt:    time.Now(),
+		}
+	}
+
+	go serve(ln, time.Hour, collect)
+	defer ln.Close()
+	<-collected
+
+	// The snapshot is published right after collect returns
+	var snap *Snapshot
+	for i := 0; i < 50; i++ {
+		if snap, err = Query(socket, time.Second); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if snap.Usage == nil || snap.Usage.UsagePercent != 42 || !snap.Usage.Stale || snap.Usage.Source != "cache" {
+		t.Errorf("usage not carried over the socket: %+v", snap.Usage)
+	}
+	if snap.Subscription != "max" || snap.Stats == nil || snap.Stats.DailyCost != 3.5 {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestListen_RejectsRunningDaemonAndReplacesStaleSocket(t *testing.T) {
+	socket := shortSocket(t)
+
+	// A leftover socket file without a daemon behind it is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ul, ok := stale.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	stale.Close()
+
+	ln, err := listen(socket)
+	if err != nil {
+		t.Fatalf("expected stale socket to be replaced, got %v", err)
+	}
+	defer ln.Close()
+
+	go serve(ln, time.Hour, func() *Snapshot { return &Snapshot{UpdatedAt: time.Now()} })
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := listen(socket); err == nil {
+		t.Error("expected an error when a daemon is already running")
+	}
+}
+
+func TestQuery_NoDaemon(t *testing.T) {
+	if _, err := Query(shortSocket(t), 50*time.Millisecond); err == nil {
+		t.Error("expected an error without a daemon")
+	}
+}
@@ -0,0 +1,699 @@
+// Package expr evaluates the small expression language of expression
+// segments, e.g.
+//
+//	cost.daily > 5 ? format("$%.2f", cost.daily) : ""
+//
+// Values are numbers, strings, booleans and nil, which is what a variable
+// holds when its data wasn't collected. Operators, from lowest precedence:
+//
+//	c ? a : b    conditional
+//	||  &&       logical, short-circuit
+//	== != < <= > >=
+//	+ -          addition, or string concatenation when either side is a string
+//	* / %
+//	! -          unary
+//
+// Arithmetic with nil gives nil and comparisons with it are false, so
+// missing data hides a segment instead of failing it.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Func is a function expressions can call
+type Func func(args []any) (any, error)
+
+// Env holds the variables and functions an expression can use besides the
+// built-in functions
+type Env struct {
+	Vars  map[string]any
+	Funcs map[string]Func
+}
+
+// Expr is a parsed expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses an expression
+func Parse(src string) (*Expr, error) {
+	p := &parser{lex: lexer{src: src}}
+	p.next()
+	root, err := p.ternary()
+	if err == nil {
+		err = p.err
+	}
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string { return e.src }
+
+// Eval evaluates the expression in env
+func (e *Expr) Eval(env Env) (any, error) {
+	return e.root.eval(env)
+}
+
+// Vars returns the names of the variables the expression reads
+func (e *Expr) Vars() []string {
+	var names []string
+	e.root.walk(func(n node) {
+		if v, ok := n.(variable); ok {
+			names = append(names, string(v))
+		}
+	})
+	return names
+}
+
+// Truthy reports whether v counts as true: nil, false, 0 and "" don't
+func Truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// String formats v as segment text: numbers without trailing zeros and
+// nil as nothing
+func String(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// Number converts the numeric values variables are collected as to the
+// float64 expressions compute with
+func Number(v any) any {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return v
+}
+
+// Syntax
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+// operators are matched longest first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "?", ":", "(", ")", ","}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{tokNumber, l.src[start:l.pos], start}, nil
+	case isIdentStart(c):
+		for l.pos < len(l.src) && (isIdentStart(l.src[l.pos]) || isDigit(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{tokIdent, l.src[start:l.pos], start}, nil
+	case c == '"' || c == '\'':
+		var b strings.Builder
+		for l.pos++; l.pos < len(l.src); l.pos++ {
+			switch ch := l.src[l.pos]; {
+			case ch == c:
+				l.pos++
+				return token{tokString, b.String(), start}, nil
+			case ch == '\\' && l.pos+1 < len(l.src):
+				l.pos++
+				switch esc := l.src[l.pos]; esc {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(esc)
+				}
+			default:
+				b.WriteByte(ch)
+			}
+		}
+		return token{}, fmt.Errorf("unterminated string at %d", start+1)
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{tokOp, op, start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("unexpected %q at %d", c, start+1)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+type parser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+	if p.err != nil {
+		p.tok = token{kind: tokEOF, pos: p.lex.pos}
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf(format+" at %d", append(args, p.tok.pos+1)...)
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %q, found %s", op, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) ternary() (node, error) {
+	cond, err := p.binary(0)
+	if err != nil || !p.isOp("?") {
+		return cond, err
+	}
+	p.next()
+	then, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return conditional{cond, then, els}, nil
+}
+
+// levels are the binary operators by increasing precedence
+var levels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(levels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(levels[level]...) {
+		op := p.tok.text
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.isOp("!", "-") {
+		op := p.tok.text
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op, operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", tok.text, tok.pos+1)
+		}
+		return literal{n}, nil
+	case tokString:
+		p.next()
+		return literal{tok.text}, nil
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "nil":
+			return literal{nil}, nil
+		}
+		if !p.isOp("(") {
+			return variable(tok.text), nil
+		}
+		p.next()
+		c := call{name: tok.text}
+		for !p.isOp(")") {
+			if len(c.args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+		}
+		p.next()
+		return c, nil
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			inner, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// Evaluation
+
+type node interface {
+	eval(env Env) (any, error)
+	walk(fn func(node))
+}
+
+type literal struct{ value any }
+
+func (n literal) eval(Env) (any, error) { return n.value, nil }
+func (n literal) walk(fn func(node))    { fn(n) }
+
+type variable string
+
+func (n variable) eval(env Env) (any, error) { return Number(env.Vars[string(n)]), nil }
+func (n variable) walk(fn func(node))        { fn(n) }
+
+type unary struct {
+	op      string
+	operand node
+}
+
+func (n unary) eval(env Env) (any, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !Truthy(v), nil
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		return -v, nil
+	}
+	return nil, fmt.Errorf("can't negate %s", describe(v))
+}
+
+func (n unary) walk(fn func(node)) {
+	fn(n)
+	n.operand.walk(fn)
+}
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (n binary) eval(env Env) (any, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&":
+		if !Truthy(l) {
+			return false, nil
+		}
+		r, err := n.right.eval(env)
+		return Truthy(r), err
+	case "||":
+		if Truthy(l) {
+			return true, nil
+		}
+		r, err := n.right.eval(env)
+		return Truthy(r), err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, l, r)
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	if n.op == "+" {
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok || rok {
+			if !lok {
+				ls = String(l)
+			}
+			if !rok {
+				rs = String(r)
+			}
+			return ls + rs, nil
+		}
+	}
+	a, aok := l.(float64)
+	b, bok := r.(float64)
+	if !aok || !bok {
+		return nil, fmt.Errorf("can't compute %s %s %s", describe(l), n.op, describe(r))
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, nil
+		}
+		return a / b, nil
+	default: // %
+		if b == 0 {
+			return nil, nil
+		}
+		return math.Mod(a, b), nil
+	}
+}
+
+func (n binary) walk(fn func(node)) {
+	fn(n)
+	n.left.walk(fn)
+	n.right.walk(fn)
+}
+
+// compare orders two numbers or two strings; nil is neither smaller nor
+// larger than anything
+func compare(op string, l, r any) (any, error) {
+	if l == nil || r == nil {
+		return false, nil
+	}
+	var c int
+	switch a := l.(type) {
+	case float64:
+		b, ok := r.(float64)
+		if !ok {
+			return nil, fmt.Errorf("can't compare %s with %s", describe(l), describe(r))
+		}
+		c = cmpFloat(a, b)
+	case string:
+		b, ok := r.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't compare %s with %s", describe(l), describe(r))
+		}
+		c = strings.Compare(a, b)
+	default:
+		return nil, fmt.Errorf("can't compare %s", describe(l))
+	}
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type conditional struct{ cond, then, els node }
+
+func (n conditional) eval(env Env) (any, error) {
+	c, err := n.cond.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if Truthy(c) {
+		return n.then.eval(env)
+	}
+	return n.els.eval(env)
+}
+
+func (n conditional) walk(fn func(node)) {
+	fn(n)
+	n.cond.walk(fn)
+	n.then.walk(fn)
+	n.els.walk(fn)
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+func (n call) eval(env Env) (any, error) {
+	fn, ok := env.Funcs[n.name]
+	if !ok {
+		if fn, ok = builtins[n.name]; !ok {
+			return nil, fmt.Errorf("unknown function %s", n.name)
+		}
+	}
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return Number(v), nil
+}
+
+func (n call) walk(fn func(node)) {
+	fn(n)
+	for _, arg := range n.args {
+		arg.walk(fn)
+	}
+}
+
+// describe names the type of a value for error messages
+func describe(v any) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Built-in functions
+
+var builtins = map[string]Func{
+	// format("$%.2f", x) formats like Go's fmt.Sprintf
+	"format": func(args []any) (any, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("want a format")
+		}
+		format, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("format must be a string, not %s", describe(args[0]))
+		}
+		return fmt.Sprintf(format, args[1:]...), nil
+	},
+	// round(x) or round(x, digits)
+	"round": func(args []any) (any, error) {
+		if len(args) == 0 || len(args) > 2 {
+			return nil, fmt.Errorf("want round(x) or round(x, digits)")
+		}
+		x, ok := args[0].(float64)
+		if !ok {
+			return nil, nil
+		}
+		scale := 1.0
+		if len(args) == 2 {
+			digits, _ := args[1].(float64)
+			scale = math.Pow(10, digits)
+		}
+		return math.Round(x*scale) / scale, nil
+	},
+	"upper": stringFunc(strings.ToUpper),
+	"lower": stringFunc(strings.ToLower),
+	"trim":  stringFunc(strings.TrimSpace),
+	"len": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("want 1 argument")
+		}
+		return len([]rune(String(args[0]))), nil
+	},
+	"contains": func(args []any) (any, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("want contains(s, substring)")
+		}
+		return strings.Contains(String(args[0]), String(args[1])), nil
+	},
+	// matches(s, pattern) matches a regular expression
+	"matches": func(args []any) (any, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("want matches(s, pattern)")
+		}
+		re, err := regexp.Compile(String(args[1]))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(String(args[0])), nil
+	},
+	"min": minMax(func(a, b float64) bool { return a < b }),
+	"max": minMax(func(a, b float64) bool { return a > b }),
+}
+
+func stringFunc(fn func(string) string) Func {
+	return func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("want 1 argument")
+		}
+		return fn(String(args[0])), nil
+	}
+}
+
+// minMax returns the number that wins against all others, ignoring nil
+func minMax(wins func(a, b float64) bool) Func {
+	return func(args []any) (any, error) {
+		var best any
+		for _, arg := range args {
+			x, ok := arg.(float64)
+			if !ok {
+				continue
+			}
+			if b, ok := best.(float64); !ok || wins(x, b) {
+				best = x
+			}
+		}
+		return best, nil
+	}
+}
@@ -0,0 +1,123 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	env := Env{
+		Vars: map[string]any{
+			"cost.daily": 7.5,
+			"git.branch": "main",
+			"git.clean":  true,
+			"git.ahead":  2,
+			"model":      "opus",
+		},
+		Funcs: map[string]Func{
+			"twice": func(args []any) (any, error) { return String(args[0]) + String(args[0]), nil },
+		},
+	}
+
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"-git.ahead + 1", -1.0},
+		{"7 % 4 / 2", 1.5},
+		{"1 / 0", nil},
+		{"cost.daily > 5", true},
+		{"cost.daily > 5 && git.branch != 'main'", false},
+		{"git.branch == \"main\" && git.clean", true},
+		{"!git.clean || git.ahead >= 2", true},
+		{"cost.daily > 5 ? format(\"$%.2f\", cost.daily) : \"\"", "$7.50"},
+		{"cost.daily > 10 ? 'high' : cost.daily > 5 ? 'mid' : 'low'", "mid"},
+		{"'↑' + git.ahead", "↑2"},
+		{"upper(model) + ' ' + round(cost.daily / 3, 1)", "OPUS 2.5"},
+		{"len(git.branch) + max(1, nil, 3) - min(4, 2)", 5.0},
+		{"contains(git.branch, 'ai') && matches(git.branch, '^ma')", true},
+		{"twice(model)", "opusopus"},
+		{"'a\\'b\\n'", "a'b\n"},
+		// Missing data
+		{"usage.percent", nil},
+		{"usage.percent * 2", nil},
+		{"usage.percent > 50", false},
+		{"usage.percent <= 50", false},
+		{"usage.percent == nil", true},
+		{"usage.percent + ' %'", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			got, err := e.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"":             "unexpected end of expression at 1",
+		"1 +":          "unexpected end of expression at 4",
+		"(1 + 2":       `expected ")", found end of expression at 7`,
+		"a ? b":        `expected ":"`,
+		"f(1 2)":       `expected ","`,
+		"'open":        "unterminated string at 1",
+		"cost.daily @": `unexpected '@' at 12`,
+		"1 2":          `unexpected "2" at 3`,
+	} {
+		_, err := Parse(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	env := Env{Vars: map[string]any{"s": "x", "n": 1.0}}
+	for src, want := range map[string]string{
+		"s * 2":     "can't compute string * number",
+		"s < n":     "can't compare string with number",
+		"-s":        "can't negate string",
+		"nope()":    "unknown function nope",
+		"format(1)": "format: format must be a string",
+	} {
+		e, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", src, err)
+		}
+		if _, err := e.Eval(env); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Eval(%q) error = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	e, err := Parse("cost.daily > 5 ? format('%.0f', cost.weekly) : usage.percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cost.daily", "cost.weekly", "usage.percent"}
+	if got := e.Vars(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Vars() = %v, want %v", got, want)
+	}
+}
+
+func TestString(t *testing.T) {
+	for v, want := range map[any]string{nil: "", 2.0: "2", 2.5: "2.5", "x": "x", true: "true"} {
+		if got := String(v); got != want {
+			t.Errorf("String(%#v) = %q, want %q", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package fakeapi is a stand-in for the Anthropic OAuth usage API, token
+// endpoint and Admin API cost report, for integration tests that run the
+// real fetch, caching, backoff and token refresh code against it through
+// --api-base.
+package fakeapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// Where the endpoints are served, as on the real API
+const (
+	UsagePath      = "/api/oauth/usage"
+	TokenPath      = "/v1/oauth/token"
+	CostReportPath = "/v1/organizations/cost_report"
+)
+
+// Response is one canned reply of the usage endpoint
+type Response struct {
+	Status     int    // 0 = 200
+	Body       string // sent as is
+	RetryAfter int    // seconds, sent as Retry-After when > 0
+}
+
+// Usage returns a successful response reporting the given utilization of
+// the 5-hour and 7-day windows
+func Usage(fiveHour, sevenDay float64, fiveHourReset, sevenDayReset time.Time) Response {
+	body, _ := json.Marshal(types.UsageResponse{
+		FiveHour: &types.UsageWindow{Utilization: fiveHour, ResetsAt: fiveHourReset.UTC().Format(time.RFC3339)},
+		SevenDay: &types.UsageWindow{Utilization: sevenDay, ResetsAt: sevenDayReset.UTC().Format(time.RFC3339)},
+	})
+	return Response{Body: string(body)}
+}
+
+// RateLimited returns a 429 response asking to retry after the given time
+func RateLimited(retryAfter time.Duration) Response {
+	return Response{Status: http.StatusTooManyRequests, Body: `{"error":"rate_limited"}`, RetryAfter: int(retryAfter.Seconds())}
+}
+
+// Token returns a successful token refresh response
+func Token(accessToken, refreshToken string, expiresIn time.Duration) Response {
+	body, _ := json.Marshal(map[string]any{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(expiresIn.Seconds()),
+		"token_type":    "Bearer",
+	})
+	return Response{Body: string(body)}
+}
+
+// CostReport returns a cost report page with one daily bucket per amount,
+// given in cents as the Admin API reports them
+func CostReport(cents ...string) Response {
+	type result struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	type bucket struct {
+		Results []result `json:"results"`
+	}
+	report := struct {
+		Data    []bucket `json:"data"`
+		HasMore bool     `json:"has_more"`
+	}{Data: []bucket{}}
+	for _, c := range cents {
+		report.Data = append(report.Data, bucket{Results: []result{{Amount: c, Currency: "USD"}}})
+	}
+	body, _ := json.Marshal(report)
+	return Response{Body: string(body)}
+}
+
+// Request is a request the server received
+type Request struct {
+	Path          string
+	Authorization string
+	Beta          string // anthropic-beta header
+	APIKey        string // x-api-key header
+	Body          string
+}
+
+// Server serves queued responses in order, whatever the path, repeating
+// the last one
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+}
+
+// NewServer starts a server replying with the given responses. Close it
+// when done.
+func NewServer(responses ...Response) *Server {
+	s := &Server{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Reply replaces the responses still queued
+func (s *Server) Reply(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = responses
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Path:          r.URL.Path,
+		Authorization: r.Header.Get("Authorization"),
+		Beta:          r.Header.Get("anthropic-beta"),
+		APIKey:        r.Header.Get("x-api-key"),
+		Body:          string(body),
+	})
+	resp := Response{Status: http.StatusServiceUnavailable, Body: `{"error":"no response queued"}`}
+	if len(s.responses) > 0 {
+		resp = s.responses[0]
+		if len(s.responses) > 1 {
+			s.responses = s.responses[1:]
+		}
+	}
+	s.mu.Unlock()
+
+	if r.URL.Path != UsagePath && r.URL.Path != TokenPath && r.URL.Path != CostReportPath {
+		http.NotFound(w, r)
+		return
+	}
+	if resp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfter))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != 0 {
+		w.WriteHeader(resp.Status)
+	}
+	w.Write([]byte(resp.Body))
+}
@@ -0,0 +1,96 @@
+package git
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// baseCount is a cached divergence of one repo's HEAD from its default
+// branch
+type baseCount struct {
+	Head    string    `json:"head"`
+	Base    string    `json:"base"` // commit the default branch was at
+	Ahead   int       `json:"ahead"`
+	Behind  int       `json:"behind"`
+	Checked time.Time `json:"checked"`
+}
+
+// baseCacheAge is how long the count of a repo that isn't looked at again
+// is kept
+const baseCacheAge = 7 * 24 * time.Hour
+
+// defaultBranch finds the ref of the repository's default branch:
+// origin/HEAD as set by git clone, else origin/main or origin/master, else
+// a local main or master
+func defaultBranch(dir string) (string, bool) {
+	if out, err := runCommand(dir, "symbolic-ref", "--quiet", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimSpace(out), true
+	}
+	candidates := []string{"refs/remotes/origin/main", "refs/remotes/origin/master", "refs/heads/main", "refs/heads/master"}
+	out, err := runCommand(dir, append([]string{"for-each-ref", "--format=%(refname)"}, candidates...)...)
+	if err != nil {
+		return "", false
+	}
+	refs := make(map[string]bool)
+	for _, ref := range strings.Fields(out) {
+		refs[ref] = true
+	}
+	for _, ref := range candidates {
+		if refs[ref] {
+			return ref, true
+		}
+	}
+	return "", false
+}
+
+// compareBase counts the commits HEAD is ahead of and behind the default
+// branch, whose short name (e.g. "main") it returns; empty when there is
+// no default branch or it is the current branch. Counts are cached per repo
+// and only recounted when HEAD or the default branch moves.
+func compareBase(dir, gitDir, branch string, now time.Time) (name string, ahead, behind int) {
+	ref, ok := defaultBranch(dir)
+	if !ok {
+		return "", 0, 0
+	}
+	name = strings.TrimPrefix(strings.TrimPrefix(ref, "refs/remotes/origin/"), "refs/heads/")
+	if name == branch {
+		return "", 0, 0
+	}
+	out, err := runCommand(dir, "rev-parse", "HEAD", ref)
+	commits := strings.Fields(out)
+	if err != nil || len(commits) != 2 {
+		return "", 0, 0
+	}
+	if abs, err := filepath.Abs(gitDir); err == nil {
+		gitDir = abs
+	}
+
+	cacheFile := filepath.Join(config.CacheDir(), "base_divergence.json")
+	counts := make(map[string]baseCount)
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		json.Unmarshal(data, &counts)
+	}
+	if c, ok := counts[gitDir]; ok && c.Head == commits[0] && c.Base == commits[1] {
+		return name, c.Ahead, c.Behind
+	}
+
+	ahead, behind, ok = divergence(dir, ref)
+	if !ok {
+		return "", 0, 0
+	}
+	for repo, c := range counts {
+		if now.Sub(c.Checked) > baseCacheAge {
+			delete(counts, repo)
+		}
+	}
+	counts[gitDir] = baseCount{Head: commits[0], Base: commits[1], Ahead: ahead, Behind: behind, Checked: now}
+	if data, err := json.Marshal(counts); err == nil {
+		config.WriteFile(cacheFile, data)
+	}
+	return name, ahead, behind
+}
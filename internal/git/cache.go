@@ -0,0 +1,54 @@
+package git
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// cachedStatus is one directory's git information as last read
+type cachedStatus struct {
+	ReadAt time.Time     `json:"read_at"`
+	Info   types.GitInfo `json:"info"`
+}
+
+func infoCacheFile() string {
+	return filepath.Join(config.CacheDir(), "git_info.json")
+}
+
+func loadInfoCache() map[string]cachedStatus {
+	statuses := make(map[string]cachedStatus)
+	if data, err := os.ReadFile(infoCacheFile()); err == nil {
+		json.Unmarshal(data, &statuses)
+	}
+	return statuses
+}
+
+// cachedInfo returns the information read for dir within the last ttl
+func cachedInfo(dir string, ttl time.Duration, now time.Time) (types.GitInfo, bool) {
+	s, ok := loadInfoCache()[dir]
+	if !ok || now.Sub(s.ReadAt) >= ttl || now.Before(s.ReadAt) {
+		return types.GitInfo{}, false
+	}
+	config.DebugLog("Using cached git info for %s (age: %v)", dir, now.Sub(s.ReadAt))
+	return s.Info, true
+}
+
+// saveInfo caches the information read for dir, dropping entries that
+// have expired
+func saveInfo(dir string, info types.GitInfo, ttl time.Duration, now time.Time) {
+	statuses := loadInfoCache()
+	for d, s := range statuses {
+		if now.Sub(s.ReadAt) >= ttl {
+			delete(statuses, d)
+		}
+	}
+	statuses[dir] = cachedStatus{ReadAt: now, Info: info}
+	if data, err := json.Marshal(statuses); err == nil {
+		config.WriteFile(infoCacheFile(), data)
+	}
+}
@@ -0,0 +1,62 @@
+package git
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// commitCount is a cached count of one repo's commits today
+type commitCount struct {
+	Head  string `json:"head"`
+	Day   string `json:"day"` // YYYY-MM-DD
+	Count int    `json:"count"`
+}
+
+// commitsToday counts the commits reachable from HEAD that were made since
+// midnight. Counts are cached per repo and only recounted when HEAD moves
+// or the day changes.
+func commitsToday(dir, gitDir string, now time.Time) int {
+	head, err := runCommand(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return 0
+	}
+	head = strings.TrimSpace(head)
+	day := now.Format("2006-01-02")
+	if abs, err := filepath.Abs(gitDir); err == nil {
+		gitDir = abs
+	}
+
+	cacheFile := filepath.Join(config.CacheDir(), "commits_today.json")
+	counts := make(map[string]commitCount)
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		json.Unmarshal(data, &counts)
+	}
+	if c, ok := counts[gitDir]; ok && c.Head == head && c.Day == day {
+		return c.Count
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	out, err := runCommand(dir, "rev-list", "--count", "--since="+midnight.Format(time.RFC3339), "HEAD")
+	if err != nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(strings.TrimSpace(out))
+
+	// Counts from other days are never used again
+	for repo, c := range counts {
+		if c.Day != day {
+			delete(counts, repo)
+		}
+	}
+	counts[gitDir] = commitCount{Head: head, Day: day, Count: count}
+	if data, err := json.Marshal(counts); err == nil {
+		config.WriteFile(cacheFile, data)
+	}
+	return count
+}
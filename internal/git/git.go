@@ -2,70 +2,224 @@ package git
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/erwint/claude-code-statusline/internal/config"
 	"github.com/erwint/claude-code-statusline/internal/types"
 )
 
-// GetInfo retrieves git repository information
+// GetInfo retrieves git repository information for the working directory
 func GetInfo() types.GitInfo {
+	return GetInfoAt("")
+}
+
+// GetInfoAt retrieves git repository information for dir (empty = the
+// working directory), reusing it for --git-ttl unless --no-git-cache
+func GetInfoAt(dir string) types.GitInfo {
+	cfg := config.Get()
+	ttl := cfg.GitTTL
+	if ttl <= 0 || cfg.NoGitCache {
+		return readInfo(dir)
+	}
+	key, err := filepath.Abs(dir)
+	if err != nil {
+		return readInfo(dir)
+	}
+	if info, ok := cachedInfo(key, ttl, time.Now()); ok {
+		return info
+	}
+	info := readInfo(dir)
+	saveInfo(key, info, ttl, time.Now())
+	return info
+}
+
+// readInfo runs git to collect the repository information for dir
+func readInfo(dir string) types.GitInfo {
 	info := types.GitInfo{}
 
 	// Check if we're in a git repo
-	gitDir, err := runCommand("rev-parse", "--git-dir")
+	gitDir, err := runCommand(dir, "rev-parse", "--git-dir")
 	if err != nil {
 		return info
 	}
 	info.IsRepo = true
 	gitDir = strings.TrimSpace(gitDir)
+	// Relative to dir, e.g. ".git"
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
 
 	// Get branch name
-	if branch, err := runCommand("rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+	onBranch := false
+	if branch, err := runCommand(dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil {
 		info.Branch = strings.TrimSpace(branch)
+		onBranch = info.Branch != "HEAD"
 
 		// If we're in detached HEAD, check for special states
 		if info.Branch == "HEAD" {
-			info.Branch = getSpecialState(gitDir)
+			info.Branch = getSpecialState(dir, gitDir)
 		}
 	}
 
-	// Get status
-	if status, err := runCommand("status", "--porcelain"); err == nil {
+	// Get status, of just the subproject when scoped to one
+	statusArgs := []string{"status", "--porcelain"}
+	if cfg := config.Get(); cfg.GitUntracked == "no" {
+		statusArgs = append(statusArgs, "--untracked-files=no")
+	}
+	var pathspec string
+	info.Scope, pathspec = scope(dir)
+	if pathspec != "" {
+		statusArgs = append(statusArgs, "--", pathspec)
+	}
+	status, err := runStatus(dir, config.Get().GitTimeout, statusArgs...)
+	if err == context.DeadlineExceeded {
+		config.DebugLog("git status in %s took longer than %v", dir, config.Get().GitTimeout)
+		info.StatusUnknown = true
+	} else if err == nil {
 		lines := strings.Split(status, "\n")
 		for _, line := range lines {
 			if len(line) < 2 {
 				continue
 			}
 			if strings.HasPrefix(line, "??") {
-				info.HasUntracked = true
+				info.Untracked++
 			}
 			if line[0] != ' ' && line[0] != '?' {
-				info.HasStaged = true
+				info.Staged++
 			}
 			if line[1] != ' ' && line[1] != '?' {
-				info.HasModified = true
+				info.Modified++
 			}
 		}
 	}
 
 	// Get ahead/behind
-	if counts, err := runCommand("rev-list", "--left-right", "--count", "@{upstream}...HEAD"); err == nil {
-		parts := strings.Fields(counts)
-		if len(parts) == 2 {
-			info.Behind, _ = strconv.Atoi(parts[0])
-			info.Ahead, _ = strconv.Atoi(parts[1])
-		}
+	tracked := false
+	if ahead, behind, ok := divergence(dir, "@{upstream}"); ok {
+		info.Ahead, info.Behind, tracked = ahead, behind, true
+	}
+
+	if onBranch {
+		info.Upstreams = compareRemotes(dir, info, tracked)
+	}
+
+	if cfg := config.Get(); cfg.SegmentEnabled("commits") || cfg.ExprReads("commits") {
+		info.CommitsToday = commitsToday(dir, gitDir, time.Now())
+	}
+	if cfg := config.Get(); cfg.GitLastCommit || cfg.ExprReads("git.commit") {
+		info.LastCommit, info.LastSubject = lastCommit(dir)
+	}
+	if cfg := config.Get(); cfg.SegmentEnabled("base") || cfg.ExprReads("base") {
+		info.Base, info.BaseAhead, info.BaseBehind = compareBase(dir, gitDir, info.Branch, time.Now())
 	}
 
 	return info
 }
 
-func runCommand(args ...string) (string, error) {
+// divergence counts the commits HEAD is ahead of and behind ref
+func divergence(dir, ref string) (ahead, behind int, ok bool) {
+	counts, err := runCommand(dir, "rev-list", "--left-right", "--count", ref+"...HEAD")
+	if err != nil {
+		return 0, 0, false
+	}
+	parts := strings.Fields(counts)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	behind, _ = strconv.Atoi(parts[0])
+	ahead, _ = strconv.Atoi(parts[1])
+	return ahead, behind, true
+}
+
+// lastCommit reads when HEAD was committed and its subject, or nothing in
+// a repository without commits
+func lastCommit(dir string) (*time.Time, string) {
+	out, err := runCommand(dir, "log", "-1", "--format=%ct%x09%s")
+	if err != nil {
+		return nil, ""
+	}
+	secs, subject, _ := strings.Cut(strings.TrimSpace(out), "\t")
+	unix, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return nil, ""
+	}
+	at := time.Unix(unix, 0)
+	return &at, subject
+}
+
+// compareRemotes computes the divergence from remotes other than the
+// branch's own upstream, for triangular workflows where a branch tracks a
+// fork but is rebased onto the main repository. The remotes come from the
+// repo's statusline.upstreams git config, else --git-upstreams; "auto"
+// compares against a remote named "upstream" if there is one. Each remote
+// is compared against its branch of the same name, or its default branch.
+// The result starts with the branch's own upstream when it has one.
+func compareRemotes(dir string, info types.GitInfo, tracked bool) []types.Upstream {
+	branch := info.Branch
+	setting := config.Get().GitUpstreams
+	if out, err := runCommand(dir, "config", "--get", "statusline.upstreams"); err == nil {
+		setting = strings.TrimSpace(out)
+	}
+	var remotes []string
+	switch setting {
+	case "", "none":
+		return nil
+	case "auto":
+		remotes = []string{"upstream"}
+	default:
+		remotes = strings.FieldsFunc(setting, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	// One call to find which of the candidate refs exist
+	args := []string{"for-each-ref", "--format=%(refname)"}
+	for _, remote := range remotes {
+		args = append(args, "refs/remotes/"+remote+"/"+branch, "refs/remotes/"+remote+"/HEAD")
+	}
+	out, err := runCommand(dir, args...)
+	if err != nil {
+		return nil
+	}
+	refs := make(map[string]bool)
+	for _, ref := range strings.Fields(out) {
+		refs[ref] = true
+	}
+
+	tracking := ""
+	if out, err := runCommand(dir, "config", "--get", "branch."+branch+".remote"); err == nil {
+		tracking = strings.TrimSpace(out)
+	}
+	var upstreams []types.Upstream
+	for _, remote := range remotes {
+		if remote == tracking {
+			continue
+		}
+		ref := "refs/remotes/" + remote + "/" + branch
+		if !refs[ref] {
+			ref = "refs/remotes/" + remote + "/HEAD"
+		}
+		if !refs[ref] {
+			continue
+		}
+		if ahead, behind, ok := divergence(dir, ref); ok {
+			upstreams = append(upstreams, types.Upstream{Remote: remote, Ahead: ahead, Behind: behind})
+		}
+	}
+	if len(upstreams) > 0 && tracked && tracking != "" {
+		upstreams = append([]types.Upstream{{Remote: tracking, Ahead: info.Ahead, Behind: info.Behind}}, upstreams...)
+	}
+	return upstreams
+}
+
+func runCommand(dir string, args ...string) (string, error) {
 	cmdArgs := append([]string{"--no-optional-locks"}, args...)
 	cmd := exec.Command("git", cmdArgs...)
+	cmd.Dir = dir
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = nil
@@ -73,8 +227,29 @@ func runCommand(args ...string) (string, error) {
 	return out.String(), err
 }
 
+// runStatus runs git status like runCommand, giving up with
+// context.DeadlineExceeded after timeout (0 = no limit)
+func runStatus(dir string, timeout time.Duration, args ...string) (string, error) {
+	if timeout <= 0 {
+		return runCommand(dir, args...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--no-optional-locks"}, args...)...)
+	cmd.Dir = dir
+	// Don't wait for children still holding the output open once git is killed
+	cmd.WaitDelay = 100 * time.Millisecond
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return "", context.DeadlineExceeded
+	}
+	return out.String(), err
+}
+
 // getSpecialState detects special Git states (rebase, merge, etc.)
-func getSpecialState(gitDir string) string {
+func getSpecialState(dir, gitDir string) string {
 	// Check for rebase
 	if fileExists(gitDir + "/rebase-merge/head-name") {
 		// Interactive rebase
@@ -126,7 +301,7 @@ func getSpecialState(gitDir string) string {
 	}
 
 	// Detached HEAD - show short commit hash
-	if hash, err := runCommand("rev-parse", "--short", "HEAD"); err == nil {
+	if hash, err := runCommand(dir, "rev-parse", "--short", "HEAD"); err == nil {
 		return "HEAD@" + strings.TrimSpace(hash)
 	}
 
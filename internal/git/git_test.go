@@ -2,8 +2,15 @@ package git
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
 )
 
 func TestGetSpecialState(t *testing.T) {
@@ -120,7 +127,7 @@ func TestGetSpecialState(t *testing.T) {
 			}
 
 			// Test the function
-			result := getSpecialState(tmpDir)
+			result := getSpecialState(tmpDir, tmpDir)
 			if result != tt.expected {
 				t.Errorf("getSpecialState() = %q, want %q", result, tt.expected)
 			}
@@ -179,3 +186,299 @@ func TestReadFile(t *testing.T) {
 		t.Error("readFile() should return error for non-existent file")
 	}
 }
+
+func TestGetInfoAt(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"symbolic-ref", "HEAD", "refs/heads/topic"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, "new.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test binary runs in this package's directory, inside another repo
+	info := GetInfoAt(repo)
+	if !info.IsRepo || info.Branch != "topic" || info.Untracked != 1 {
+		t.Errorf("GetInfoAt(repo) = %+v, want repo on topic with untracked files", info)
+	}
+
+	if info := GetInfoAt(t.TempDir()); info.IsRepo {
+		t.Errorf("GetInfoAt(non-repo) = %+v, want IsRepo false", info)
+	}
+
+	cfg := config.Get()
+	orig := *cfg
+	defer func() { *cfg = orig }()
+	cfg.GitLastCommit = true
+	if info := GetInfoAt(repo); info.LastCommit == nil || info.LastSubject != "init" {
+		t.Errorf("GetInfoAt(repo) with --git-last-commit = %+v, want the init commit", info)
+	}
+	cfg.GitUntracked = "no"
+	if info := GetInfoAt(repo); info.Untracked != 0 || info.StatusUnknown {
+		t.Errorf("GetInfoAt(repo) with --git-untracked no = %+v, want no untracked files", info)
+	}
+	cfg.GitTimeout = time.Nanosecond
+	if info := GetInfoAt(repo); !info.StatusUnknown || info.Branch != "topic" {
+		t.Errorf("GetInfoAt(repo) past --git-status-timeout = %+v, want the branch with an unknown status", info)
+	}
+}
+
+func TestGetInfoAtCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.Get()
+	orig := *cfg
+	defer func() { *cfg = orig }()
+
+	repo := t.TempDir()
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+
+	cfg.GitTTL = time.Minute
+	if info := GetInfoAt(repo); info.Untracked != 0 {
+		t.Fatalf("Untracked = %d, want 0", info.Untracked)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "new.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info := GetInfoAt(repo); info.Untracked != 0 {
+		t.Errorf("Untracked = %d within --git-ttl, want the cached 0", info.Untracked)
+	}
+	if _, ok := cachedInfo(repo, time.Minute, time.Now().Add(time.Minute)); ok {
+		t.Error("cachedInfo() hit after the TTL, want a miss")
+	}
+
+	cfg.NoGitCache = true
+	if info := GetInfoAt(repo); info.Untracked != 1 {
+		t.Errorf("Untracked = %d with --no-git-cache, want 1", info.Untracked)
+	}
+	cfg.NoGitCache = false
+	cfg.GitTTL = 0
+	if info := GetInfoAt(repo); info.Untracked != 1 {
+		t.Errorf("Untracked = %d without --git-ttl, want 1", info.Untracked)
+	}
+}
+
+func TestCompareRemotes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(msg string) string {
+		git("commit", "-q", "--allow-empty", "-m", msg)
+		return git("rev-parse", "HEAD")
+	}
+
+	// upstream/main has two commits the fork's topic branch lacks; topic is
+	// one commit ahead of origin/topic and two ahead of upstream/main
+	git("init", "-q")
+	git("symbolic-ref", "HEAD", "refs/heads/main")
+	commit("init")
+	git("checkout", "-q", "-b", "topic")
+	pushed := commit("fork work")
+	commit("local work")
+	git("checkout", "-q", "main")
+	commit("upstream 1")
+	upstreamMain := commit("upstream 2")
+	git("checkout", "-q", "topic")
+
+	git("remote", "add", "origin", "https://example.com/fork.git")
+	git("remote", "add", "upstream", "https://example.com/project.git")
+	git("update-ref", "refs/remotes/origin/topic", pushed)
+	git("update-ref", "refs/remotes/upstream/main", upstreamMain)
+	git("symbolic-ref", "refs/remotes/upstream/HEAD", "refs/remotes/upstream/main")
+	git("branch", "-q", "--set-upstream-to", "origin/topic")
+
+	cfg := config.Get()
+	defer func() { cfg.GitUpstreams = "" }()
+
+	cfg.GitUpstreams = "none"
+	if info := GetInfoAt(repo); info.Ahead != 1 || info.Behind != 0 || info.Upstreams != nil {
+		t.Errorf("with none: %+v, want only origin/topic divergence", info)
+	}
+
+	cfg.GitUpstreams = "auto"
+	want := []types.Upstream{{Remote: "origin", Ahead: 1}, {Remote: "upstream", Ahead: 2, Behind: 2}}
+	if info := GetInfoAt(repo); !reflect.DeepEqual(info.Upstreams, want) {
+		t.Errorf("with auto: Upstreams = %+v, want %+v", info.Upstreams, want)
+	}
+
+	// The repo's own setting wins over the flag
+	git("config", "statusline.upstreams", "none")
+	if info := GetInfoAt(repo); info.Upstreams != nil {
+		t.Errorf("with statusline.upstreams=none: Upstreams = %+v, want none", info.Upstreams)
+	}
+}
+
+func TestCompareBase(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	gitDir := filepath.Join(repo, ".git")
+
+	// main moves on by two commits after topic branches off with one
+	git("init", "-q")
+	git("symbolic-ref", "HEAD", "refs/heads/main")
+	git("commit", "-q", "--allow-empty", "-m", "init")
+	git("branch", "topic")
+	git("commit", "-q", "--allow-empty", "-m", "main 1")
+	git("commit", "-q", "--allow-empty", "-m", "main 2")
+	if name, _, _ := compareBase(repo, gitDir, "main", time.Now()); name != "" {
+		t.Errorf("compareBase() on main = %q, want nothing", name)
+	}
+	git("checkout", "-q", "topic")
+	git("commit", "-q", "--allow-empty", "-m", "topic 1")
+	if name, ahead, behind := compareBase(repo, gitDir, "topic", time.Now()); name != "main" || ahead != 1 || behind != 2 {
+		t.Errorf("compareBase() = %q ↑%d ↓%d, want main ↑1 ↓2", name, ahead, behind)
+	}
+
+	// Cached while neither branch moves
+	cacheFile := filepath.Join(config.CacheDir(), "base_divergence.json")
+	data, _ := os.ReadFile(cacheFile)
+	os.WriteFile(cacheFile, []byte(strings.Replace(string(data), `"behind":2`, `"behind":9`, 1)), 0600)
+	if _, _, behind := compareBase(repo, gitDir, "topic", time.Now()); behind != 9 {
+		t.Errorf("behind = %d, want the cached 9", behind)
+	}
+
+	// origin/HEAD names the default branch when there is one
+	git("update-ref", "refs/remotes/origin/trunk", "topic~1")
+	git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/trunk")
+	if name, ahead, behind := compareBase(repo, gitDir, "topic", time.Now()); name != "trunk" || ahead != 1 || behind != 0 {
+		t.Errorf("compareBase() = %q ↑%d ↓%d, want trunk ↑1", name, ahead, behind)
+	}
+}
+
+func TestCommitsToday(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+
+	repo := t.TempDir()
+	commit := func(date string) {
+		cmd := exec.Command("git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "work")
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git commit: %v\n%s", err, out)
+		}
+	}
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+
+	now := time.Now()
+	commit(now.AddDate(0, 0, -2).Format(time.RFC3339))
+	commit(now.Format(time.RFC3339))
+	commit(now.Format(time.RFC3339))
+
+	gitDir := filepath.Join(repo, ".git")
+	if n := commitsToday(repo, gitDir, now); n != 2 {
+		t.Errorf("commitsToday = %d, want 2", n)
+	}
+
+	// Cached for the same HEAD and day
+	cacheFile := filepath.Join(config.CacheDir(), "commits_today.json")
+	data, _ := os.ReadFile(cacheFile)
+	os.WriteFile(cacheFile, []byte(strings.Replace(string(data), `"count":2`, `"count":7`, 1)), 0600)
+	if n := commitsToday(repo, gitDir, now); n != 7 {
+		t.Errorf("commitsToday = %d, want the cached 7", n)
+	}
+
+	// A new commit moves HEAD and is counted again
+	commit(now.Format(time.RFC3339))
+	if n := commitsToday(repo, gitDir, now); n != 3 {
+		t.Errorf("commitsToday = %d after another commit, want 3", n)
+	}
+}
+
+func TestScope(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	run := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	mono := filepath.Join(root, "mono")
+	api := filepath.Join(mono, "packages", "api")
+	web := filepath.Join(mono, "packages", "web")
+	for _, dir := range []string{filepath.Join(api, "src"), web} {
+		os.MkdirAll(dir, 0755)
+	}
+	run(mono, "init", "-q")
+	os.WriteFile(filepath.Join(api, "a.go"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(web, "b.js"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(web, "c.js"), []byte("x"), 0644)
+
+	// A repository checked out inside the monorepo's working tree
+	vendored := filepath.Join(mono, "third_party", "lib")
+	os.MkdirAll(vendored, 0755)
+	run(vendored, "init", "-q")
+
+	cfg := config.Get()
+	defer func() { cfg.GitScope = "" }()
+
+	cfg.GitScope = ""
+	if info := GetInfoAt(filepath.Join(api, "src")); info.Scope != "" || info.Untracked != 2 {
+		t.Errorf("without --git-scope: %+v, want the whole repo's untracked dirs", info)
+	}
+
+	cfg.GitScope = "packages/*, apps/*"
+	if info := GetInfoAt(filepath.Join(api, "src")); info.Scope != "mono:packages/api" || info.Untracked != 1 {
+		t.Errorf("in packages/api: Scope %q, Untracked %d, want mono:packages/api with 1", info.Scope, info.Untracked)
+	}
+	if info := GetInfoAt(web); info.Scope != "mono:packages/web" || info.Untracked != 1 {
+		t.Errorf("in packages/web: Scope %q, Untracked %d, want mono:packages/web with 1", info.Scope, info.Untracked)
+	}
+	if info := GetInfoAt(mono); info.Scope != "" {
+		t.Errorf("at the root: Scope %q, want none", info.Scope)
+	}
+	if info := GetInfoAt(vendored); info.Scope != "mono:third_party/lib" {
+		t.Errorf("in a nested repo: Scope %q, want mono:third_party/lib", info.Scope)
+	}
+}
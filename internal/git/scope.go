@@ -0,0 +1,57 @@
+package git
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// scope works out which part of a repository dir belongs to, for
+// --git-scope. In a nested repository (a submodule or a repository inside
+// another's working tree) it returns "outer:path/to/inner" and no pathspec.
+// Inside a monorepo subproject matching one of the patterns (e.g.
+// "packages/*") it returns "repo:packages/api" and a pathspec limiting git
+// status to that subproject. Both are empty when neither applies.
+func scope(dir string) (label, pathspec string) {
+	setting := config.Get().GitScope
+	if setting == "" {
+		return "", ""
+	}
+	out, err := runCommand(dir, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		return "", ""
+	}
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	toplevel := lines[0]
+	prefix := ""
+	if len(lines) > 1 {
+		prefix = strings.TrimSuffix(lines[1], "/")
+	}
+
+	// Nested repository: label it with the enclosing one
+	if outer, err := runCommand(filepath.Dir(toplevel), "rev-parse", "--show-toplevel"); err == nil {
+		outer = strings.TrimSpace(outer)
+		if rel, err := filepath.Rel(outer, toplevel); err == nil {
+			return filepath.Base(outer) + ":" + filepath.ToSlash(rel), ""
+		}
+	}
+
+	for _, pattern := range strings.Split(setting, ",") {
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+		if pattern == "" || pattern == "nested" {
+			continue
+		}
+		parts := strings.Split(prefix, "/")
+		n := strings.Count(pattern, "/") + 1
+		if prefix == "" || len(parts) < n {
+			continue
+		}
+		subdir := strings.Join(parts[:n], "/")
+		if ok, _ := path.Match(pattern, subdir); ok {
+			return filepath.Base(toplevel) + ":" + subdir, ":(top)" + subdir
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,130 @@
+package install
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// versionTimeout bounds how long CheckBinary waits for --version
+const versionTimeout = 5 * time.Second
+
+// Result is what Install found and did
+type Result struct {
+	Path     string // the settings file
+	Previous string // command the statusLine ran before, if any
+	Changed  bool   // the statusLine didn't run the command yet
+	Backup   string // copy of the settings as they were, if written
+}
+
+// SettingsFile returns Claude Code's user settings file
+func SettingsFile() string {
+	return filepath.Join(config.ClaudeDir(), "settings.json")
+}
+
+// Install points the statusLine of the settings file at path to command,
+// keeping all other settings. Nothing is written when the statusLine
+// already runs command, or with dryRun. The settings as they were are
+// copied to settings.json.backup first.
+func Install(path, command string, dryRun bool) (Result, error) {
+	result := Result{Path: path}
+	settings := make(map[string]json.RawMessage)
+	mode := config.PrivateFileMode
+	data, err := os.ReadFile(path)
+	exists := err == nil
+	switch {
+	case exists:
+		if len(strings.TrimSpace(string(data))) > 0 {
+			if err := json.Unmarshal(data, &settings); err != nil {
+				return result, fmt.Errorf("can't parse %s, fix or remove it first: %v", path, err)
+			}
+		}
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	case !os.IsNotExist(err):
+		return result, err
+	}
+
+	// Keep other statusLine keys, like padding
+	statusLine := make(map[string]any)
+	if raw, ok := settings["statusLine"]; ok {
+		if err := json.Unmarshal(raw, &statusLine); err != nil {
+			return result, fmt.Errorf("can't parse the statusLine in %s: %v", path, err)
+		}
+		result.Previous, _ = statusLine["command"].(string)
+	}
+	if statusLine["type"] == "command" && result.Previous == command {
+		return result, nil
+	}
+	result.Changed = true
+	if dryRun {
+		return result, nil
+	}
+
+	statusLine["type"] = "command"
+	statusLine["command"] = command
+	raw, err := json.Marshal(statusLine)
+	if err != nil {
+		return result, err
+	}
+	settings["statusLine"] = raw
+	out, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return result, err
+	}
+
+	if exists {
+		result.Backup = path + ".backup"
+		if err := os.WriteFile(result.Backup, data, mode); err != nil {
+			return result, fmt.Errorf("can't back up %s: %v", path, err)
+		}
+	} else if err := os.MkdirAll(filepath.Dir(path), config.PrivateDirMode); err != nil {
+		return result, err
+	}
+	return result, os.WriteFile(path, append(out, '\n'), mode)
+}
+
+// Command returns the statusLine command that runs binary, quoted for the
+// shell when the path has spaces
+func Command(binary string) string {
+	if strings.ContainsAny(binary, " \t") {
+		return `"` + binary + `"`
+	}
+	return binary
+}
+
+// CheckBinary verifies that the statusLine can run binary: it's an
+// executable file that isn't a temporary go run build, and it answers
+// --version. It returns the version line.
+func CheckBinary(binary string) (string, error) {
+	info, err := os.Stat(binary)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s isn't a file", binary)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("%s isn't executable", binary)
+	}
+	if strings.Contains(filepath.ToSlash(binary), "/go-build") {
+		return "", fmt.Errorf("%s is a temporary build that go run deletes, install the binary and run init from there or pass --binary", binary)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, binary, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s --version failed: %v", binary, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,126 @@
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInstall(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string // "" = no settings file
+		changed  bool
+		previous string
+		want     string // statusLine after Install
+	}{
+		{"no settings file", "", true, "", `{"command":"/bin/sl","type":"command"}`},
+		{"other settings kept", `{"model": "opus", "statusLine": {"type": "command", "command": "/old/sl", "padding": 1}}`,
+			true, "/old/sl", `{"command":"/bin/sl","padding":1,"type":"command"}`},
+		{"already installed", `{"statusLine": {"type": "command", "command": "/bin/sl"}}`,
+			false, "/bin/sl", `{"type":"command","command":"/bin/sl"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "claude", "settings.json")
+			if tt.settings != "" {
+				os.MkdirAll(filepath.Dir(path), 0700)
+				if err := os.WriteFile(path, []byte(tt.settings), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// A dry run reports the same without writing
+			if result, err := Install(path, "/bin/sl", true); err != nil || result.Changed != tt.changed {
+				t.Fatalf("Install(dry run) = %+v, %v, want Changed %v", result, err, tt.changed)
+			}
+			if data, _ := os.ReadFile(path); string(data) != tt.settings {
+				t.Fatalf("dry run wrote %q", data)
+			}
+
+			result, err := Install(path, "/bin/sl", false)
+			if err != nil {
+				t.Fatalf("Install() error: %v", err)
+			}
+			if result.Changed != tt.changed || result.Previous != tt.previous {
+				t.Errorf("Install() = %+v, want Changed %v, Previous %q", result, tt.changed, tt.previous)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var settings map[string]json.RawMessage
+			if err := json.Unmarshal(data, &settings); err != nil {
+				t.Fatalf("settings aren't JSON: %v\n%s", err, data)
+			}
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, settings["statusLine"]); err != nil {
+				t.Fatal(err)
+			}
+			if compact.String() != tt.want {
+				t.Errorf("statusLine = %s, want %s", compact.String(), tt.want)
+			}
+			if strings.Contains(tt.settings, "model") && string(settings["model"]) != `"opus"` {
+				t.Errorf("model = %s, want the setting kept", settings["model"])
+			}
+
+			// A backup only when the settings were rewritten
+			backup, err := os.ReadFile(path + ".backup")
+			if tt.changed && tt.settings != "" && string(backup) != tt.settings {
+				t.Errorf("backup = %q, %v, want the previous settings", backup, err)
+			}
+			if !tt.changed && err == nil {
+				t.Error("backed up settings that weren't changed")
+			}
+		})
+	}
+}
+
+func TestInstallInvalidSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	os.WriteFile(path, []byte(`{"model": "opus",}`), 0644)
+	if _, err := Install(path, "/bin/sl", false); err == nil {
+		t.Fatal("Install() with invalid settings succeeded")
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"model": "opus",}` {
+		t.Errorf("invalid settings were overwritten: %q", data)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	for binary, want := range map[string]string{
+		"/home/me/.claude/bin/claude-code-statusline": "/home/me/.claude/bin/claude-code-statusline",
+		`C:\Users\Jo Doe\.claude\bin\sl.exe`:          `"C:\Users\Jo Doe\.claude\bin\sl.exe"`,
+	} {
+		if got := Command(binary); got != want {
+			t.Errorf("Command(%q) = %q, want %q", binary, got, want)
+		}
+	}
+}
+
+func TestCheckBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binary is a shell script")
+	}
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "sl")
+	os.WriteFile(binary, []byte("#!/bin/sh\necho claude-code-statusline v1.2.3\n"), 0755)
+	if ver, err := CheckBinary(binary); err != nil || ver != "claude-code-statusline v1.2.3" {
+		t.Errorf("CheckBinary() = %q, %v", ver, err)
+	}
+
+	notExec := filepath.Join(dir, "data")
+	os.WriteFile(notExec, []byte("x"), 0644)
+	goRun := filepath.Join(dir, "go-build123", "exe", "sl")
+	os.MkdirAll(filepath.Dir(goRun), 0755)
+	os.WriteFile(goRun, []byte("#!/bin/sh\necho v\n"), 0755)
+	for _, path := range []string{filepath.Join(dir, "missing"), dir, notExec, goRun} {
+		if _, err := CheckBinary(path); err == nil {
+			t.Errorf("CheckBinary(%q) succeeded", path)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package jobs
+
+import "syscall"
+
+// processAlive reports whether a process with the given pid exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM: it exists but belongs to another user
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// maxAge bounds how long a job holds its slot: older pid files are stale
+// even if their pid is alive, since it may have been reused
+const maxAge = 10 * time.Minute
+
+// Run runs fn unless the named job is already running in this or another
+// process, and reports whether it ran. Each job holds a pid file in the
+// cache directory while running; pid files of dead processes are taken over.
+func Run(name string, fn func()) bool {
+	release, ok := acquire(name)
+	if !ok {
+		config.DebugLog("Job %s is already running, skipping", name)
+		return false
+	}
+	defer release()
+
+	fn()
+	return true
+}
+
+// acquire claims the job's pid file and returns a function releasing it
+func acquire(name string) (func(), bool) {
+	dir := filepath.Join(config.CacheDir(), "jobs")
+	os.MkdirAll(dir, config.PrivateDirMode)
+	file := filepath.Join(dir, name+".pid")
+	pid := strconv.Itoa(os.Getpid())
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, config.PrivateFileMode)
+		if err == nil {
+			fmt.Fprintln(f, pid)
+			f.Close()
+			return func() {
+				// Only remove it if it wasn't taken over after maxAge
+				if owner, _ := readPid(file); owner == pid {
+					os.Remove(file)
+				}
+			}, true
+		}
+
+		owner, ok := stale(file)
+		if !ok {
+			return nil, false
+		}
+		// Re-check right before removing, another process may have just
+		// taken the stale file over
+		if current, _ := readPid(file); current == owner {
+			config.DebugLog("Removing stale pid file for job %s (pid %s)", name, owner)
+			os.Remove(file)
+		}
+	}
+	return nil, false
+}
+
+// stale reports whether the pid file's process is gone or has held it for
+// longer than maxAge, along with the pid it contains
+func stale(file string) (string, bool) {
+	info, err := os.Stat(file)
+	if err != nil {
+		// Released in the meantime
+		return "", true
+	}
+	owner, err := readPid(file)
+	if time.Since(info.ModTime()) > maxAge {
+		return owner, true
+	}
+	if err != nil {
+		// Empty while its owner is still writing it
+		return owner, false
+	}
+	pid, err := strconv.Atoi(owner)
+	if err != nil {
+		return owner, true
+	}
+	return owner, !processAlive(pid)
+}
+
+func readPid(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	pid := strings.TrimSpace(string(data))
+	if pid == "" {
+		return "", fmt.Errorf("empty pid file")
+	}
+	return pid, nil
+}
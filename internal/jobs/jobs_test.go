@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+func pidFile(name string) string {
+	return filepath.Join(config.CacheDir(), "jobs", name+".pid")
+}
+
+func writePidFile(t *testing.T, name string, pid int, age time.Duration) {
+	t.Helper()
+	file := pidFile(name)
+	os.MkdirAll(filepath.Dir(file), 0700)
+	if err := os.WriteFile(file, []byte(strconv.Itoa(pid)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	os.Chtimes(file, mtime, mtime)
+}
+
+// deadPid returns the pid of a process that has exited
+func deadPid(t *testing.T) int {
+	t.Helper()
+	name, args := "true", []string{}
+	if runtime.GOOS == "windows" {
+		name, args = "cmd", []string{"/c", "exit"}
+	}
+	cmd := exec.Command(name, args...)
+	if err := cmd.Run(); err != nil {
+		t.Skipf("can't start a process: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestRun_AtMostOnce(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		done <- Run("refresh", func() {
+			close(started)
+			<-finish
+		})
+	}()
+	<-started
+
+	if Run("refresh", func() { t.Error("second run while the first is running") }) {
+		t.Error("Run() = true while the job is running")
+	}
+	if !Run("other", func() {}) {
+		t.Error("expected a different job to run")
+	}
+
+	close(finish)
+	if !<-done {
+		t.Error("first Run() = false")
+	}
+	if _, err := os.Stat(pidFile("refresh")); !os.IsNotExist(err) {
+		t.Errorf("expected pid file removed after the job, got %v", err)
+	}
+	if !Run("refresh", func() {}) {
+		t.Error("expected the job to run again once finished")
+	}
+}
+
+func TestRun_StalePidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		pid     func(t *testing.T) int
+		age     time.Duration
+		wantRun bool
+	}{
+		{"live owner", func(*testing.T) int { return os.Getpid() }, time.Minute, false},
+		{"dead owner", deadPid, time.Minute, true},
+		{"held too long", func(*testing.T) int { return os.Getpid() }, maxAge + time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			writePidFile(t, "pricing", tt.pid(t), tt.age)
+
+			ran := Run("pricing", func() {})
+			if ran != tt.wantRun {
+				t.Errorf("Run() = %v, want %v", ran, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestRun_KeepsTakenOverPidFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	Run("update", func() {
+		// Another process took the slot over while this job ran too long
+		writePidFile(t, "update", os.Getpid()+1, 0)
+	})
+	if _, err := os.Stat(pidFile("update")); err != nil {
+		t.Errorf("expected the new owner's pid file kept, got %v", err)
+	}
+}
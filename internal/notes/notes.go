@@ -0,0 +1,127 @@
+package notes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/transcript"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// Add appends a note to the session's notes file
+func Add(sessionID, text string, at time.Time) error {
+	file, err := notesFile(sessionID)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(file), config.PrivateDirMode)
+
+	data, err := json.Marshal(types.Note{Time: at, Text: text})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, config.PrivateFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// List returns the session's notes, oldest first
+func List(sessionID string) []types.Note {
+	file, err := notesFile(sessionID)
+	if err != nil {
+		return nil
+	}
+	return readNotes(file)
+}
+
+// Latest returns the session's most recent note, or nil if it has none
+func Latest(sessionID string) *types.Note {
+	notes := List(sessionID)
+	if len(notes) == 0 {
+		return nil
+	}
+	return &notes[len(notes)-1]
+}
+
+// LatestSession returns the ID of the session whose transcript under
+// ~/.claude/projects was written last, i.e. the active one
+func LatestSession() string {
+	path := transcript.Locate("")
+	if path == "" {
+		return ""
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".jsonl")
+}
+
+// Purge removes notes written before the given time and returns how many
+// were removed
+func Purge(before time.Time) int {
+	files, _ := filepath.Glob(filepath.Join(notesDir(), "*.jsonl"))
+	removed := 0
+	for _, file := range files {
+		notes := readNotes(file)
+		kept := notes[:0]
+		for _, note := range notes {
+			if note.Time.Before(before) {
+				removed++
+			} else {
+				kept = append(kept, note)
+			}
+		}
+		if len(kept) == len(notes) {
+			continue
+		}
+		if len(kept) == 0 {
+			os.Remove(file)
+			continue
+		}
+		var data []byte
+		for _, note := range kept {
+			line, _ := json.Marshal(note)
+			data = append(append(data, line...), '\n')
+		}
+		os.WriteFile(file, data, config.PrivateFileMode)
+	}
+	return removed
+}
+
+func readNotes(file string) []types.Note {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var notes []types.Note
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var note types.Note
+		if err := json.Unmarshal(scanner.Bytes(), &note); err == nil {
+			notes = append(notes, note)
+		}
+	}
+	return notes
+}
+
+func notesDir() string {
+	return filepath.Join(config.CacheDir(), "notes")
+}
+
+// notesFile returns the notes file of a session, rejecting IDs that would
+// point outside the notes directory
+func notesFile(sessionID string) (string, error) {
+	if sessionID == "" || sessionID == "." || sessionID == ".." || strings.ContainsAny(sessionID, `/\`) {
+		return "", fmt.Errorf("invalid session ID %q", sessionID)
+	}
+	return filepath.Join(notesDir(), sessionID+".jsonl"), nil
+}
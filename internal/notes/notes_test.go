@@ -0,0 +1,80 @@
+package notes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddAndList(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+
+	if Latest("abc") != nil {
+		t.Fatal("expected no note for a new session")
+	}
+	for i, text := range []string{"tried approach X", "X is too slow, trying Y"} {
+		if err := Add("abc", text, at.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	Add("other", "unrelated", at)
+
+	if notes := List("abc"); len(notes) != 2 || notes[0].Text != "tried approach X" {
+		t.Errorf("List = %+v, want both notes oldest first", notes)
+	}
+	if note := Latest("abc"); note == nil || note.Text != "X is too slow, trying Y" || !note.Time.Equal(at.Add(time.Hour)) {
+		t.Errorf("Latest = %+v, want the second note", note)
+	}
+}
+
+func TestInvalidSessionID(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, id := range []string{"", "..", "../escape", `a\b`} {
+		if err := Add(id, "note", time.Now()); err == nil {
+			t.Errorf("Add(%q) succeeded, want an error", id)
+		}
+	}
+}
+
+func TestLatestSession(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if id := LatestSession(); id != "" {
+		t.Errorf("LatestSession = %q, want none without transcripts", id)
+	}
+
+	dir := filepath.Join(home, ".claude", "projects", "-home-user-app")
+	os.MkdirAll(dir, 0755)
+	old := filepath.Join(dir, "old-session.jsonl")
+	recent := filepath.Join(dir, "recent-session.jsonl")
+	os.WriteFile(old, []byte("{}\n"), 0644)
+	os.WriteFile(recent, []byte("{}\n"), 0644)
+	os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+
+	if id := LatestSession(); id != "recent-session" {
+		t.Errorf("LatestSession = %q, want recent-session", id)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	now := time.Now()
+
+	Add("abc", "old", now.Add(-72*time.Hour))
+	Add("abc", "new", now)
+	Add("gone", "old", now.Add(-72*time.Hour))
+
+	if removed := Purge(now.Add(-24 * time.Hour)); removed != 2 {
+		t.Errorf("Purge removed %d, want 2", removed)
+	}
+	if notes := List("abc"); len(notes) != 1 || notes[0].Text != "new" {
+		t.Errorf("List = %+v, want only the recent note", notes)
+	}
+	if _, err := os.Stat(filepath.Join(notesDir(), "gone.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("expected the emptied notes file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// sentRetention is how long sent notification keys are remembered
+const sentRetention = 8 * 24 * time.Hour
+
+// send delivers a desktop notification (replaced in tests)
+var send = sendDesktop
+
+// Once sends a notification unless one with the same key was already sent.
+// Keys identify the event, e.g. "limit-5h:<reset time>", so each event
+// notifies at most once across all invocations.
+func Once(key, title, message string) {
+	if !claim(key) {
+		return
+	}
+	if err := send(title, message); err != nil {
+		config.WarnLog("Notification failed: %v", err)
+	}
+}
+
+// claim records key as sent and reports whether it wasn't already
+func claim(key string) bool {
+	file := getSentFile()
+	sent := loadSent(file)
+	if _, ok := sent[key]; ok {
+		return false
+	}
+
+	// Record first so concurrent invocations don't all notify
+	now := time.Now()
+	for k, at := range sent {
+		if now.Sub(at) > sentRetention {
+			delete(sent, k)
+		}
+	}
+	sent[key] = now
+	saveSent(file, sent)
+	return true
+}
+
+// pendingPrefix marks the keys of sends still in progress
+const pendingPrefix = "pending:"
+
+// claimAttempt claims key for a send that may fail, and reports whether it
+// was neither sent nor being sent already. The claim lasts ttl, so a send
+// cut off by the process exiting is retried later; finishAttempt records
+// how it went.
+func claimAttempt(key string, ttl time.Duration) bool {
+	file := getSentFile()
+	sent := loadSent(file)
+	if _, ok := sent[key]; ok {
+		return false
+	}
+	now := time.Now()
+	if at, ok := sent[pendingPrefix+key]; ok && now.Sub(at) < ttl {
+		return false
+	}
+	sent[pendingPrefix+key] = now
+	saveSent(file, sent)
+	return true
+}
+
+// finishAttempt ends a send claimed with claimAttempt: key is recorded as
+// sent if it succeeded, and otherwise left for a later attempt
+func finishAttempt(key string, ok bool) {
+	file := getSentFile()
+	sent := loadSent(file)
+	delete(sent, pendingPrefix+key)
+	if ok {
+		sent[key] = time.Now()
+	}
+	saveSent(file, sent)
+}
+
+// Purge forgets notifications sent before the given time and returns how
+// many were removed
+func Purge(before time.Time) int {
+	file := getSentFile()
+	sent := loadSent(file)
+	removed := 0
+	for k, at := range sent {
+		if at.Before(before) {
+			delete(sent, k)
+			removed++
+		}
+	}
+	if removed > 0 {
+		saveSent(file, sent)
+	}
+	return removed
+}
+
+// resetNotifyWindow is how long after a new 5-hour window was first seen
+// its start is still announced
+const resetNotifyWindow = time.Hour
+
+// CheckUsage sends one-shot notifications for the 5-hour window: when it
+// crosses the highest of the --usage-notify thresholds (100 with
+// --limit-notify) reached so far, and with --reset-notify when a new
+// window starts after the previous one was in use
+func CheckUsage(usage *types.UsageCache, now time.Time) {
+	if usage == nil || usage.Stale || usage.Unavailable || usage.ResetTime.IsZero() {
+		return
+	}
+	cfg := config.Get()
+	window := usage.ResetTime.UTC().Format(time.RFC3339)
+	resetAt := usage.ResetTime.Local().Format("15:04")
+
+	thresholds := parseThresholds(cfg.UsageNotify)
+	if cfg.LimitNotify {
+		thresholds = append(thresholds, 100)
+	}
+	crossed := 0
+	for _, t := range thresholds {
+		if usage.UsagePercent >= float64(t) && t > crossed {
+			crossed = t
+		}
+	}
+	limitMessage := fmt.Sprintf("5-hour limit reached, resets at %s", resetAt)
+	if hint := cfg.LimitHint; hint != "" {
+		limitMessage += " — " + hint
+	}
+	switch {
+	case crossed >= 100:
+		Once("limit-5h:"+window, "Claude usage limit reached", limitMessage)
+	case crossed > 0:
+		message := fmt.Sprintf("5-hour usage at %.0f%%, resets at %s", usage.UsagePercent, resetAt)
+		Once(fmt.Sprintf("usage-5h-%d:%s", crossed, window), fmt.Sprintf("Claude usage over %d%%", crossed), message)
+	}
+	if usage.UsagePercent >= 100 {
+		Alert("limit-5h:"+window, "Claude usage limit reached", limitMessage)
+	}
+
+	// The window start is only known when the previous window was seen
+	if cfg.ResetNotify && !usage.WindowStart.IsZero() && now.Sub(usage.WindowStart) < resetNotifyWindow {
+		message := fmt.Sprintf("A new 5-hour window started, %.0f%% used, resets at %s", usage.UsagePercent, resetAt)
+		Once("reset-5h:"+window, "Claude usage window reset", message)
+	}
+}
+
+// parseThresholds parses --usage-notify, e.g. "75,90,100"
+func parseThresholds(list string) []int {
+	var thresholds []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(field), "%"))
+		if field == "" {
+			continue
+		}
+		t, err := strconv.Atoi(field)
+		if err != nil || t <= 0 || t > 100 {
+			config.WarnLog("Ignoring usage notification threshold %q", field)
+			continue
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds
+}
+
+// CheckBudgets sends a one-shot notification (with --budget-notify) and
+// webhook alert per period when the daily, weekly or monthly cost exceeds
+// its budget
+func CheckBudgets(stats *types.TokenStats, now time.Time) {
+	if stats == nil {
+		return
+	}
+	cfg := config.Get()
+	year, week := now.ISOWeek()
+	for _, b := range []struct {
+		name   string
+		period string
+		cost   float64
+		budget float64
+	}{
+		{"daily", now.Format("2006-01-02"), stats.DailyCost, cfg.BudgetDaily},
+		{"weekly", fmt.Sprintf("%d-W%02d", year, week), stats.WeeklyCost, cfg.BudgetWeekly},
+		{"monthly", now.Format("2006-01"), stats.MonthlyCost, cfg.BudgetMonthly},
+	} {
+		if b.budget <= 0 || b.cost < b.budget {
+			continue
+		}
+		key := "budget-" + b.name + ":" + b.period
+		message := fmt.Sprintf("$%.2f spent, %s budget is $%.2f", b.cost, b.name, b.budget)
+		if cfg.BudgetNotify {
+			Once(key, "Claude budget exceeded", message)
+		}
+		Alert(key, "Claude budget exceeded", message)
+	}
+}
+
+// sendDesktop shows a notification using the platform's native mechanism
+func sendDesktop(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToastScript(title, message))
+	default:
+		cmd = exec.Command("notify-send", "--app-name=claude-code-statusline", title, message)
+	}
+
+	// Don't wait: the notifier outlives the statusline render
+	return cmd.Start()
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// powerShellString quotes s as a single-quoted PowerShell string literal
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func windowsToastScript(title, message string) string {
+	return strings.Join([]string{
+		"[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null",
+		"$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)",
+		"$t.GetElementsByTagName('text')[0].AppendChild($t.CreateTextNode(" + powerShellString(title) + ")) > $null",
+		"$t.GetElementsByTagName('text')[1].AppendChild($t.CreateTextNode(" + powerShellString(message) + ")) > $null",
+		"[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('claude-code-statusline').Show([Windows.UI.Notifications.ToastNotification]::new($t))",
+	}, "; ")
+}
+
+func getSentFile() string {
+	return filepath.Join(config.CacheDir(), "notifications.json")
+}
+
+func loadSent(file string) map[string]time.Time {
+	sent := make(map[string]time.Time)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return sent
+	}
+	json.Unmarshal(data, &sent)
+	if sent == nil {
+		sent = make(map[string]time.Time)
+	}
+	return sent
+}
+
+func saveSent(file string, sent map[string]time.Time) {
+	data, err := json.Marshal(sent)
+	if err != nil {
+		return
+	}
+	config.WriteFile(file, data)
+}
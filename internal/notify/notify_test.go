@@ -0,0 +1,264 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+type sentNotification struct {
+	title   string
+	message string
+}
+
+// stubSend captures notifications instead of showing them
+func stubSend(t *testing.T) *[]sentNotification {
+	t.Helper()
+	dir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+
+	var captured []sentNotification
+	origSend := send
+	send = func(title, message string) error {
+		captured = append(captured, sentNotification{title, message})
+		return nil
+	}
+	t.Cleanup(func() {
+		send = origSend
+		os.Setenv("HOME", origHome)
+	})
+	return &captured
+}
+
+func TestOnce_Deduplicates(t *testing.T) {
+	captured := stubSend(t)
+
+	Once("event-a", "Title", "first")
+	Once("event-a", "Title", "second")
+	Once("event-b", "Title", "third")
+
+	if len(*captured) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(*captured))
+	}
+	if (*captured)[0].message != "first" || (*captured)[1].message != "third" {
+		t.Errorf("unexpected notifications: %+v", *captured)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	stubSend(t)
+
+	now := time.Now()
+	file := getSentFile()
+	saveSent(file, map[string]time.Time{"old": now.Add(-72 * time.Hour), "new": now})
+
+	if removed := Purge(now.Add(-24 * time.Hour)); removed != 1 {
+		t.Errorf("Purge removed %d, want 1", removed)
+	}
+	sent := loadSent(file)
+	if _, ok := sent["old"]; ok || len(sent) != 1 {
+		t.Errorf("expected only the recent record kept, got %v", sent)
+	}
+}
+
+func TestCheckLimit(t *testing.T) {
+	captured := stubSend(t)
+	cfg := config.Get()
+	cfg.LimitNotify, cfg.LimitHint = true, "switch to haiku?"
+	defer func() { cfg.LimitNotify, cfg.LimitHint = false, "" }()
+
+	now := time.Now()
+	reset := now.Add(time.Hour)
+
+	CheckUsage(&types.UsageCache{UsagePercent: 80, ResetTime: reset}, now)
+	CheckUsage(&types.UsageCache{UsagePercent: 100, ResetTime: reset, Stale: true}, now)
+	if len(*captured) != 0 {
+		t.Fatalf("expected no notification below the limit or for stale data, got %d", len(*captured))
+	}
+
+	CheckUsage(&types.UsageCache{UsagePercent: 100, ResetTime: reset}, now)
+	CheckUsage(&types.UsageCache{UsagePercent: 100, ResetTime: reset}, now)
+	if len(*captured) != 1 {
+		t.Fatalf("expected exactly one notification per window, got %d", len(*captured))
+	}
+	msg := (*captured)[0].message
+	if !strings.Contains(msg, reset.Local().Format("15:04")) || !strings.Contains(msg, "switch to haiku?") {
+		t.Errorf("expected reset time and hint in message, got %q", msg)
+	}
+
+	// Next window notifies again
+	CheckUsage(&types.UsageCache{UsagePercent: 100, ResetTime: reset.Add(5 * time.Hour)}, now)
+	if len(*captured) != 2 {
+		t.Errorf("expected a notification for the next window, got %d", len(*captured))
+	}
+}
+
+func TestCheckUsageThresholds(t *testing.T) {
+	captured := stubSend(t)
+	cfg := config.Get()
+	cfg.UsageNotify = "75, 90%,oops,100"
+	defer func() { cfg.UsageNotify = "" }()
+
+	now := time.Now()
+	reset := now.Add(time.Hour)
+	for _, pct := range []float64{60, 76, 80, 95, 93, 100} {
+		CheckUsage(&types.UsageCache{UsagePercent: pct, ResetTime: reset}, now)
+	}
+
+	var titles []string
+	for _, n := range *captured {
+		titles = append(titles, n.title)
+	}
+	want := []string{"Claude usage over 75%", "Claude usage over 90%", "Claude usage limit reached"}
+	if strings.Join(titles, "; ") != strings.Join(want, "; ") {
+		t.Errorf("notifications = %q, want %q", titles, want)
+	}
+}
+
+func TestCheckUsageReset(t *testing.T) {
+	captured := stubSend(t)
+	cfg := config.Get()
+	cfg.ResetNotify = true
+	defer func() { cfg.ResetNotify = false }()
+
+	now := time.Now()
+	reset := now.Add(4 * time.Hour)
+
+	// First run: whether a window ended isn't known
+	CheckUsage(&types.UsageCache{UsagePercent: 2, ResetTime: reset}, now)
+	// An old window start isn't news
+	CheckUsage(&types.UsageCache{UsagePercent: 2, ResetTime: reset, WindowStart: now.Add(-2 * time.Hour)}, now)
+	if len(*captured) != 0 {
+		t.Fatalf("expected no reset notification, got %+v", *captured)
+	}
+
+	started := &types.UsageCache{UsagePercent: 2, ResetTime: reset, WindowStart: now.Add(-10 * time.Minute)}
+	CheckUsage(started, now)
+	CheckUsage(started, now)
+	if len(*captured) != 1 || (*captured)[0].title != "Claude usage window reset" {
+		t.Errorf("expected one reset notification, got %+v", *captured)
+	}
+}
+
+func TestCheckBudgets(t *testing.T) {
+	captured := stubSend(t)
+	cfg := config.Get()
+	cfg.BudgetNotify, cfg.BudgetDaily, cfg.BudgetWeekly = true, 10, 100
+	defer func() { cfg.BudgetNotify, cfg.BudgetDaily, cfg.BudgetWeekly = false, 0, 0 }()
+
+	now := time.Date(2025, 12, 3, 14, 0, 0, 0, time.Local)
+
+	CheckBudgets(&types.TokenStats{DailyCost: 9.99, WeeklyCost: 50, MonthlyCost: 500}, now)
+	if len(*captured) != 0 {
+		t.Fatalf("expected no notification within budget, got %d", len(*captured))
+	}
+
+	CheckBudgets(&types.TokenStats{DailyCost: 12, WeeklyCost: 50}, now)
+	CheckBudgets(&types.TokenStats{DailyCost: 15, WeeklyCost: 50}, now.Add(time.Hour))
+	if len(*captured) != 1 {
+		t.Fatalf("expected one notification per day, got %d", len(*captured))
+	}
+	if msg := (*captured)[0].message; !strings.Contains(msg, "daily budget is $10.00") {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	// Next day and the weekly budget notify separately
+	CheckBudgets(&types.TokenStats{DailyCost: 12, WeeklyCost: 120}, now.AddDate(0, 0, 1))
+	if len(*captured) != 3 {
+		t.Errorf("expected daily and weekly notifications for the next day, got %d", len(*captured))
+	}
+}
+
+func TestQuoting(t *testing.T) {
+	if got := appleScriptString(`say "hi" \o/`); got != `"say \"hi\" \\o/"` {
+		t.Errorf("unexpected AppleScript quoting: %s", got)
+	}
+	if got := powerShellString("it's"); got != "'it''s'" {
+		t.Errorf("unexpected PowerShell quoting: %s", got)
+	}
+}
+
+func TestAlert(t *testing.T) {
+	captured := stubSend(t)
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+
+	cfg := config.Get()
+	cfg.WebhookURL, cfg.BudgetDaily = srv.URL, 10
+	defer func() { cfg.WebhookURL, cfg.WebhookFormat, cfg.BudgetDaily = "", "", 0 }()
+
+	now := time.Now()
+	stats := &types.TokenStats{DailyCost: 12.5}
+	CheckBudgets(stats, now)
+	CheckBudgets(stats, now)
+	if len(bodies) != 1 {
+		t.Fatalf("expected one alert per period, got %d", len(bodies))
+	}
+	if len(*captured) != 0 {
+		t.Errorf("expected no desktop notification without --budget-notify, got %+v", *captured)
+	}
+	var event webhookEvent
+	if err := json.Unmarshal([]byte(bodies[0]), &event); err != nil {
+		t.Fatalf("invalid JSON payload %q: %v", bodies[0], err)
+	}
+	if event.Event != "budget-daily" || event.Key != "budget-daily:"+now.Format("2006-01-02") || !strings.Contains(event.Message, "$12.50 spent") {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	cfg.WebhookFormat = "slack"
+	reset := now.Add(time.Hour)
+	CheckUsage(&types.UsageCache{UsagePercent: 90, ResetTime: reset}, now)
+	CheckUsage(&types.UsageCache{UsagePercent: 100, ResetTime: reset}, now)
+	CheckUsage(&types.UsageCache{UsagePercent: 100, ResetTime: reset}, now)
+	if len(bodies) != 2 {
+		t.Fatalf("expected one alert for the 5h limit, got %d", len(bodies)-1)
+	}
+	var slack map[string]string
+	if err := json.Unmarshal([]byte(bodies[1]), &slack); err != nil || !strings.HasPrefix(slack["text"], "*Claude usage limit reached*\n5-hour limit reached") {
+		t.Errorf("unexpected Slack payload %q", bodies[1])
+	}
+}
+
+func TestAlertRetriesFailures(t *testing.T) {
+	stubSend(t)
+	status := http.StatusBadGateway
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cfg := config.Get()
+	cfg.WebhookURL = srv.URL
+	defer func() { cfg.WebhookURL = "" }()
+
+	Alert("budget-daily:2025-12-03", "Claude budget exceeded", "$12.50 spent")
+	status = http.StatusOK
+	Alert("budget-daily:2025-12-03", "Claude budget exceeded", "$12.50 spent")
+	Alert("budget-daily:2025-12-03", "Claude budget exceeded", "$12.50 spent")
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want a retry after the failure and none after the success", attempts)
+	}
+
+	// A send in progress elsewhere holds the key until it times out
+	if !claimAttempt("webhook:limit-5h:x", webhookTimeout) || claimAttempt("webhook:limit-5h:x", webhookTimeout) {
+		t.Error("expected a pending send to hold its key")
+	}
+	if !claimAttempt("webhook:limit-5h:x", 0) {
+		t.Error("expected an expired pending send to be retried")
+	}
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// webhookTimeout bounds how long an alert is sent for, and so how long
+// other invocations leave it to this one
+const webhookTimeout = 3 * time.Second
+
+// Alert posts an event to the --webhook URL unless one with the same key
+// was already posted. Keys are the same as for desktop notifications but
+// tracked separately, so an alert fires once per window or period whether
+// or not desktop notifications are on. An alert that fails isn't recorded,
+// so a later render sends it again.
+func Alert(key, title, message string) {
+	cfg := config.Get()
+	claimed := "webhook:" + key
+	if cfg.WebhookURL == "" || cfg.Offline || !claimAttempt(claimed, webhookTimeout) {
+		return
+	}
+	body, err := webhookPayload(cfg.WebhookFormat, key, title, message, time.Now())
+	if err == nil {
+		err = post(cfg.WebhookURL, body)
+	}
+	finishAttempt(claimed, err == nil)
+	if err != nil {
+		config.WarnLog("Webhook failed: %v", err)
+	}
+}
+
+// webhookEvent is the generic JSON alert
+type webhookEvent struct {
+	Event   string    `json:"event"` // e.g. "limit-5h" or "budget-daily"
+	Key     string    `json:"key"`   // event and window or period, unique per alert
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Host    string    `json:"host,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// webhookPayload builds the request body: a generic JSON event, or a
+// Slack incoming-webhook message with --webhook-format slack
+func webhookPayload(format, key, title, message string, now time.Time) ([]byte, error) {
+	host, _ := os.Hostname()
+	if format == "slack" {
+		text := fmt.Sprintf("*%s*\n%s", title, message)
+		if host != "" {
+			text += fmt.Sprintf(" (%s)", host)
+		}
+		return json.Marshal(map[string]string{"text": text})
+	}
+	event, _, _ := strings.Cut(key, ":")
+	return json.Marshal(webhookEvent{
+		Event:   event,
+		Key:     key,
+		Title:   title,
+		Message: message,
+		Host:    host,
+		Time:    now.UTC(),
+	})
+}
+
+// post sends a JSON body to the webhook (replaced in tests)
+var post = func(url string, body []byte) error {
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
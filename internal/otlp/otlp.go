@@ -0,0 +1,259 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// pushTimeout bounds how long a push may keep the process alive after the
+// statusline is printed
+const pushTimeout = 5 * time.Second
+
+// serviceName identifies the statusline to the collector
+const serviceName = "claude-code-statusline"
+
+// State remembers when metrics were last pushed
+type State struct {
+	LastPush time.Time `json:"last_push"`
+}
+
+// Push sends the cost and usage gauges in data to the --otlp-endpoint
+// collector, at most once per --otlp-interval across all invocations.
+// Costs are only sent when they were collected for this render.
+func Push(version string, data *types.StatusData, now time.Time) {
+	cfg := config.Get()
+	if cfg.OTLPEndpoint == "" || cfg.Offline {
+		return
+	}
+
+	file := getStateFile()
+	state := loadState(file)
+	if now.Sub(state.LastPush) < cfg.OTLPInterval {
+		return
+	}
+
+	metrics := gauges(data, now)
+	if len(metrics) == 0 {
+		return
+	}
+	// Claim the push first so concurrent invocations don't all push. The
+	// claim only lasts pushTimeout, so a push cut off by the process
+	// exiting is retried by a later render rather than a whole interval on.
+	state.LastPush = now.Add(pushTimeout - cfg.OTLPInterval)
+	saveState(file, state)
+
+	body, err := json.Marshal(request(version, metrics))
+	if err != nil {
+		config.ErrorLog("OTLP payload failed: %v", err)
+		return
+	}
+	err = send(metricsURL(cfg.OTLPEndpoint), parseHeaders(cfg.OTLPHeaders), body)
+	state.LastPush = now
+	saveState(file, state)
+	if err != nil {
+		config.WarnLog("OTLP push failed: %v", err)
+		return
+	}
+	config.DebugLog("Pushed %d metrics to %s", len(metrics), cfg.OTLPEndpoint)
+}
+
+// The OTLP/HTTP JSON encoding of an ExportMetricsServiceRequest, limited to
+// gauges
+type (
+	exportRequest struct {
+		ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+	}
+	resourceMetrics struct {
+		Resource     resource       `json:"resource"`
+		ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+	}
+	resource struct {
+		Attributes []attribute `json:"attributes"`
+	}
+	scopeMetrics struct {
+		Scope   scope    `json:"scope"`
+		Metrics []metric `json:"metrics"`
+	}
+	scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	metric struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Unit        string `json:"unit,omitempty"`
+		Gauge       gauge  `json:"gauge"`
+	}
+	gauge struct {
+		DataPoints []dataPoint `json:"dataPoints"`
+	}
+	dataPoint struct {
+		Attributes   []attribute `json:"attributes,omitempty"`
+		TimeUnixNano string      `json:"timeUnixNano"`
+		AsDouble     float64     `json:"asDouble"`
+	}
+	attribute struct {
+		Key   string         `json:"key"`
+		Value attributeValue `json:"value"`
+	}
+	attributeValue struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+func attr(key, value string) attribute {
+	return attribute{Key: key, Value: attributeValue{StringValue: value}}
+}
+
+// gauges builds the metrics for the data this render collected:
+//
+//	claude_statusline.cost    dollars spent, by period (day, week, month)
+//	claude_statusline.tokens  input, output and cache write tokens, by period
+//	claude_statusline.usage   plan usage in percent, by window (5h, 7d, 7d_opus)
+func gauges(data *types.StatusData, now time.Time) []metric {
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+	point := func(value float64, attrs ...attribute) dataPoint {
+		return dataPoint{Attributes: attrs, TimeUnixNano: ts, AsDouble: value}
+	}
+
+	var metrics []metric
+	if _, collected := data.Sources["cost"]; collected && data.Stats != nil {
+		s := data.Stats
+		metrics = append(metrics,
+			metric{Name: "claude_statusline.cost", Description: "Claude Code spend at API prices", Unit: "USD", Gauge: gauge{DataPoints: []dataPoint{
+				point(s.DailyCost, attr("period", "day")),
+				point(s.WeeklyCost, attr("period", "week")),
+				point(s.MonthlyCost, attr("period", "month")),
+			}}},
+			metric{Name: "claude_statusline.tokens", Description: "Input, output and cache write tokens", Unit: "{token}", Gauge: gauge{DataPoints: []dataPoint{
+				point(float64(s.DailyTokens), attr("period", "day")),
+				point(float64(s.WeeklyTokens), attr("period", "week")),
+				point(float64(s.MonthlyTokens), attr("period", "month")),
+			}}},
+		)
+	}
+	if u := data.Usage; u != nil && !u.Unavailable && !data.IsApiBilling {
+		points := []dataPoint{
+			point(u.UsagePercent, attr("window", "5h")),
+			point(u.SevenDayPercent, attr("window", "7d")),
+		}
+		if !u.OpusResetTime.IsZero() || u.OpusPercent > 0 {
+			points = append(points, point(u.OpusPercent, attr("window", "7d_opus")))
+		}
+		metrics = append(metrics, metric{Name: "claude_statusline.usage", Description: "Plan usage limit used", Unit: "%", Gauge: gauge{DataPoints: points}})
+	}
+	return metrics
+}
+
+// request wraps metrics with the resource attributes identifying this
+// machine: service name and version, host, user and Claude account
+// profile, plus any in OTEL_RESOURCE_ATTRIBUTES
+func request(version string, metrics []metric) exportRequest {
+	attrs := []attribute{attr("service.name", serviceName), attr("service.version", version)}
+	if host, err := os.Hostname(); err == nil {
+		attrs = append(attrs, attr("host.name", host))
+	}
+	if user := firstEnv("USER", "USERNAME"); user != "" {
+		attrs = append(attrs, attr("user.name", user))
+	}
+	if profile := config.Get().ActiveProfile; profile != "" {
+		attrs = append(attrs, attr("claude.profile", profile))
+	}
+	extra := parseHeaders(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attrs = append(attrs, attr(key, extra[key]))
+	}
+
+	return exportRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     resource{Attributes: attrs},
+		ScopeMetrics: []scopeMetrics{{Scope: scope{Name: serviceName, Version: version}, Metrics: metrics}},
+	}}}
+}
+
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// metricsURL appends the OTLP/HTTP metrics path to a collector's base URL,
+// e.g. http://collector:4318 becomes http://collector:4318/v1/metrics
+func metricsURL(endpoint string) string {
+	if strings.HasSuffix(endpoint, "/v1/metrics") {
+		return endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/v1/metrics"
+}
+
+// parseHeaders parses comma-separated key=value pairs, the format of
+// --otlp-headers and OTEL_RESOURCE_ATTRIBUTES
+func parseHeaders(list string) map[string]string {
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// send posts a JSON body to the collector (replaced in tests)
+var send = func(url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: pushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func getStateFile() string {
+	return filepath.Join(config.CacheDir(), "otlp.json")
+}
+
+func loadState(file string) *State {
+	state := &State{}
+	if data, err := os.ReadFile(file); err == nil {
+		json.Unmarshal(data, state)
+	}
+	return state
+}
+
+func saveState(file string, state *State) {
+	data, _ := json.Marshal(state)
+	config.WriteFile(file, data)
+}
@@ -0,0 +1,132 @@
+package otlp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+func withConfig(t *testing.T, c *config.Config) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	orig := *config.Get()
+	*config.Get() = *c
+	t.Cleanup(func() { *config.Get() = orig })
+}
+
+func TestGauges(t *testing.T) {
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+	stats := &types.TokenStats{DailyCost: 1.5, WeeklyCost: 8, MonthlyCost: 30, DailyTokens: 1200}
+	usage := &types.UsageCache{UsagePercent: 42, SevenDayPercent: 12}
+
+	tests := []struct {
+		name string
+		data *types.StatusData
+		want map[string]int // data points per metric
+	}{
+		{"everything", &types.StatusData{Stats: stats, Usage: usage, Sources: map[string]string{"cost": "collected"}},
+			map[string]int{"claude_statusline.cost": 3, "claude_statusline.tokens": 3, "claude_statusline.usage": 2}},
+		{"cost not collected", &types.StatusData{Stats: &types.TokenStats{}, Usage: usage, Sources: map[string]string{}},
+			map[string]int{"claude_statusline.usage": 2}},
+		{"opus window", &types.StatusData{Usage: &types.UsageCache{OpusPercent: 30}},
+			map[string]int{"claude_statusline.usage": 3}},
+		{"api billing", &types.StatusData{Usage: usage, IsApiBilling: true}, map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]int)
+			for _, m := range gauges(tt.data, at) {
+				got[m.Name] = len(m.Gauge.DataPoints)
+				for _, p := range m.Gauge.DataPoints {
+					if p.TimeUnixNano != "1764770400000000000" {
+						t.Errorf("%s timeUnixNano = %s", m.Name, p.TimeUnixNano)
+					}
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("metrics = %v, want %v", got, tt.want)
+			}
+			for name, n := range tt.want {
+				if got[name] != n {
+					t.Errorf("%s has %d data points, want %d", name, got[name], n)
+				}
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	var bodies []exportRequest
+	var auth, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req exportRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		bodies = append(bodies, req)
+		auth, path = r.Header.Get("Authorization"), r.URL.Path
+	}))
+	defer srv.Close()
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "team=platform")
+
+	withConfig(t, &config.Config{OTLPEndpoint: srv.URL, OTLPHeaders: "Authorization=Bearer xyz", OTLPInterval: time.Minute})
+	data := &types.StatusData{Usage: &types.UsageCache{UsagePercent: 42}}
+	at := time.Now()
+
+	Push("v1.2.3", data, at)
+	Push("v1.2.3", data, at.Add(30*time.Second)) // within the interval
+	if len(bodies) != 1 {
+		t.Fatalf("pushed %d times within the interval, want 1", len(bodies))
+	}
+	if path != "/v1/metrics" || auth != "Bearer xyz" {
+		t.Errorf("path = %q, Authorization = %q", path, auth)
+	}
+	attrs := make(map[string]string)
+	for _, a := range bodies[0].ResourceMetrics[0].Resource.Attributes {
+		attrs[a.Key] = a.Value.StringValue
+	}
+	if attrs["service.name"] != serviceName || attrs["service.version"] != "v1.2.3" || attrs["team"] != "platform" {
+		t.Errorf("resource attributes = %v", attrs)
+	}
+
+	Push("v1.2.3", data, at.Add(2*time.Minute))
+	if len(bodies) != 2 {
+		t.Errorf("pushed %d times, want 2 after the interval", len(bodies))
+	}
+
+	// A push cut off after its claim is retried once the claim runs out
+	saveState(getStateFile(), &State{LastPush: at.Add(time.Hour + pushTimeout - time.Minute)})
+	Push("v1.2.3", data, at.Add(time.Hour+time.Second))
+	if len(bodies) != 2 {
+		t.Errorf("pushed %d times while another push was claimed, want 2", len(bodies))
+	}
+	Push("v1.2.3", data, at.Add(time.Hour+pushTimeout+time.Second))
+	if len(bodies) != 3 {
+		t.Errorf("pushed %d times, want 3 after the claim ran out", len(bodies))
+	}
+
+	config.Get().Offline = true
+	Push("v1.2.3", data, at.Add(2*time.Hour))
+	if len(bodies) != 3 {
+		t.Errorf("pushed while offline")
+	}
+}
+
+func TestMetricsURL(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"http://localhost:4318":               "http://localhost:4318/v1/metrics",
+		"http://localhost:4318/":              "http://localhost:4318/v1/metrics",
+		"https://otel.example.com/v1/metrics": "https://otel.example.com/v1/metrics",
+	} {
+		if got := metricsURL(endpoint); got != want {
+			t.Errorf("metricsURL(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/session"
+	"github.com/erwint/claude-code-statusline/internal/transcript"
+	"github.com/erwint/claude-code-statusline/internal/types"
+	usagepkg "github.com/erwint/claude-code-statusline/internal/usage"
+)
+
+// accessibleSeparator joins segments in the accessible display mode, so
+// screen readers pause between them
+const accessibleSeparator = "; "
+
+// spokenUnits spells out the suffixes of abbreviated counts
+var spokenUnits = strings.NewReplacer("K", " thousand", "M", " million", "B", " billion")
+
+// renderAccessible renders each enabled segment as spelled-out text without
+// symbols or colors, e.g. "Git branch main, 3 commits ahead"
+func renderAccessible(data *types.StatusData) map[string]string {
+	cfg := config.Get()
+	segs := make(map[string]string)
+	sess, git, usage, stats := data.Session, data.Git, data.Usage, data.Stats
+
+	if cfg.SegmentEnabled("dir") {
+		segs["dir"] = "directory " + displayDir(ShownDir(data))
+		if data.Project != "" {
+			segs["dir"] = "project " + data.Project
+		}
+	}
+
+	if sess != nil {
+		if cfg.SegmentEnabled("style") && sess.OutputStyle != nil && !isDefaultStyle(sess.OutputStyle.Name) {
+			segs["style"] = sess.OutputStyle.Name + " output style"
+		}
+		if cfg.SegmentEnabled("compact") && compactSoon(sess, cfg) {
+			segs["compact"] = "warning: context nearly full, compaction soon"
+		}
+		if cfg.SegmentEnabled("version") && sess.Version != "" {
+			segs["version"] = "Claude Code version " + strings.TrimPrefix(sess.Version, "v")
+		}
+	}
+
+	if cfg.SegmentEnabled("git") && git.IsRepo {
+		parts := []string{"Git branch " + git.Branch}
+		if git.Scope != "" {
+			repo, subdir, _ := strings.Cut(git.Scope, ":")
+			parts[0] = "Git " + subdir + " in " + repo + ", branch " + git.Branch
+		}
+		if git.StatusUnknown {
+			parts = append(parts, "changes unknown")
+		}
+		for _, c := range []struct {
+			n    int
+			what string
+		}{
+			{git.Modified, "modified"},
+			{git.Staged, "staged"},
+			{git.Untracked, "untracked"},
+		} {
+			if c.n > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", c.n, c.what))
+			}
+		}
+		upstreams := git.Upstreams
+		if len(upstreams) == 0 {
+			upstreams = []types.Upstream{{Ahead: git.Ahead, Behind: git.Behind}}
+		}
+		for _, u := range upstreams {
+			of := ""
+			if u.Remote != "" {
+				of = " of " + u.Remote
+			}
+			if u.Ahead > 0 {
+				parts = append(parts, plural(u.Ahead, "commit")+" ahead"+of)
+			}
+			if u.Behind > 0 {
+				parts = append(parts, plural(u.Behind, "commit")+" behind"+of)
+			}
+		}
+		if git.LastCommit != nil {
+			last := "last commit just now"
+			if d := now().Sub(*git.LastCommit); d >= time.Minute {
+				last = "last commit " + spokenDuration(d.Truncate(time.Minute)) + " ago"
+			}
+			if git.LastSubject != "" {
+				last += ": " + git.LastSubject
+			}
+			parts = append(parts, last)
+		}
+		segs["git"] = strings.Join(parts, ", ")
+	}
+
+	if cfg.SegmentEnabled("base") && git.Base != "" && (git.BaseAhead > 0 || git.BaseBehind > 0) {
+		var parts []string
+		if git.BaseAhead > 0 {
+			parts = append(parts, plural(git.BaseAhead, "commit")+" ahead of "+git.Base)
+		}
+		if git.BaseBehind > 0 {
+			parts = append(parts, plural(git.BaseBehind, "commit")+" behind "+git.Base)
+		}
+		segs["base"] = strings.Join(parts, ", ")
+	}
+
+	if cfg.SegmentEnabled("commits") && git.CommitsToday > 0 {
+		segs["commits"] = plural(git.CommitsToday, "commit") + " today"
+	}
+
+	if cfg.SegmentEnabled("model") && sess != nil && sess.Model != nil {
+		modelName := sess.Model.DisplayName
+		if modelName == "" {
+			modelName = formatModelName(sess.Model.ID)
+		}
+		segs["model"] = "model " + modelName
+		if tool := inlineTool(data.Transcript, cfg); tool != nil {
+			segs["model"] += ", running " + tool.Name + " for " + spokenDuration(now().Sub(tool.StartTime).Truncate(time.Second))
+		}
+	}
+
+	if cfg.SegmentEnabled("context") && sess != nil && sess.ContextWindow != nil {
+		contextPct := session.GetContextPercent(sess)
+		if contextPct > 0 || sess.ContextWindow.Size > 0 {
+			segs["context"] = fmt.Sprintf("context %.0f percent full", contextPct)
+		}
+	}
+
+	if cfg.SegmentEnabled("subscription") && (data.Subscription != "" || data.Tier != "" || data.Profile != "") {
+		var parts []string
+		if plan := strings.TrimSpace(data.Subscription + " " + shortenTier(data.Tier)); plan != "" {
+			parts = append(parts, "plan "+plan)
+		}
+		if data.Profile != "" {
+			parts = append(parts, "profile "+data.Profile)
+		}
+		segs["subscription"] = strings.Join(parts, ", ")
+	}
+
+	if cfg.SegmentEnabled("cost") && stats != nil && (stats.DailyCost > 0 || stats.WeeklyCost > 0 || stats.MonthlyCost > 0) {
+		segs["cost"] = accessibleCost(stats, cfg)
+	}
+
+	if cfg.SegmentEnabled("session") && sess != nil && stats != nil {
+		if c, ok := stats.SessionCosts[sess.SessionID]; ok && c > 0 {
+			segs["session"] = fmt.Sprintf("%.2f dollars this session", c)
+		}
+	}
+
+	if cfg.SegmentEnabled("history") && stats != nil && sparkline(stats.DayHistory) != "" {
+		days := make([]string, len(stats.DayHistory))
+		for i, cost := range stats.DayHistory {
+			days[i] = fmt.Sprintf("%.0f", cost)
+		}
+		segs["history"] = "daily cost over the last 7 days, oldest first: " + strings.Join(days, ", ") + " dollars"
+	}
+
+	if cfg.SegmentEnabled("usage") && usage != nil {
+		switch {
+		case data.IsApiBilling && usage.ResetTime.IsZero() && !usage.Unavailable:
+			text := "API key billing"
+			if !usage.MonthStart.IsZero() {
+				text += fmt.Sprintf(", organization spend this month %.2f dollars", usage.MonthSpend)
+				if usage.Stale {
+					text += ", not up to date"
+				}
+			}
+			segs["usage"] = text
+		case usage.Unavailable:
+			segs["usage"] = "usage unavailable"
+		case usage.Stale:
+			segs["usage"] = fmt.Sprintf("usage about %.0f percent, not up to date", usage.UsagePercent)
+		default:
+			p := usage.Projection
+			if p == nil && !usage.ResetTime.IsZero() {
+				windowStart := usagepkg.WindowStart(usage.WindowStart, usage.ResetTime, 5*time.Hour)
+				p = usagepkg.Project(usage.UsagePercent, windowStart, usage.ResetTime, now())
+			}
+			text := accessibleWindow("usage", usage.UsagePercent, usage.ResetTime, p, "15:04")
+			if cfg.BurnRate && usage.UsagePercent < 100 && usage.BurnRate >= 0.5 {
+				text += fmt.Sprintf(", rising %.0f percent per hour", usage.BurnRate)
+			}
+			if at := usagepkg.LimitAt(usage); cfg.LimitETA && at.After(now()) {
+				text += ", limit reached in " + spokenDuration(at.Sub(now()).Truncate(time.Minute)) + " at this rate"
+			}
+			if usage.UsagePercent >= 100 && cfg.LimitHint != "" {
+				text += ", " + cfg.LimitHint
+			} else if hint := modelHint(cfg, usage, stats, sess); hint != "" {
+				text += ", " + hint
+			}
+			segs["usage"] = text
+		}
+	}
+
+	if cfg.SegmentEnabled("usage7d") && usage != nil && usage.SevenDayPercent > 0 && !usage.SevenDayResetTime.IsZero() &&
+		usage.SevenDayPercent >= float64(cfg.SevenDayMin) {
+		p := usage.SevenDayProjection
+		if p == nil {
+			windowStart := usagepkg.WindowStart(usage.SevenDayWindowStart, usage.SevenDayResetTime, 7*24*time.Hour)
+			p = usagepkg.Project(usage.SevenDayPercent, windowStart, usage.SevenDayResetTime, now())
+		}
+		segs["usage7d"] = accessibleWindow("weekly usage", usage.SevenDayPercent, usage.SevenDayResetTime, p, "January 2 15:04")
+	}
+
+	if cfg.SegmentEnabled("opus") && usage != nil && usage.OpusPercent > 0 && !usage.Unavailable {
+		segs["opus"] = accessibleWindow("Opus weekly usage", usage.OpusPercent, usage.OpusResetTime, nil, "January 2 15:04")
+	}
+
+	if td := data.Transcript; td != nil {
+		if cfg.SegmentEnabled("tools") && cfg.ToolsStyle != "model" {
+			segs["tools"] = accessibleTools(td)
+		}
+		if cfg.SegmentEnabled("errors") && td.ErrorStreak >= max(cfg.ErrorStreak, 1) {
+			segs["errors"] = fmt.Sprintf("warning: %s in a row", plural(td.ErrorStreak, "tool error"))
+		}
+		if cfg.SegmentEnabled("summary") {
+			var parts []string
+			for _, sc := range toolSummary(td, cfg) {
+				parts = append(parts, fmt.Sprintf("%s %d", sc.tool, sc.count))
+			}
+			if len(parts) > 0 {
+				segs["summary"] = "tool calls: " + strings.Join(parts, ", ")
+			}
+		}
+		if cfg.SegmentEnabled("agents") {
+			segs["agents"] = accessibleAgents(td)
+		}
+		if cfg.SegmentEnabled("todos") {
+			segs["todos"] = accessibleTodos(td)
+		}
+		if cfg.SegmentEnabled("changes") && (td.LinesAdded > 0 || td.LinesRemoved > 0) {
+			segs["changes"] = fmt.Sprintf("%s added, %d removed", plural(td.LinesAdded, "line"), td.LinesRemoved)
+		}
+		if cfg.SegmentEnabled("duration") && !td.SessionStart.IsZero() {
+			segs["duration"] = "session " + spokenDuration(now().Sub(td.SessionStart).Truncate(time.Minute))
+		}
+	}
+
+	if cfg.SegmentEnabled("note") && data.Note != nil {
+		segs["note"] = "note: " + data.Note.Text
+	}
+	for _, seg := range cfg.CustomSegments {
+		if !cfg.SegmentEnabled(seg.Name) {
+			continue
+		}
+		text := data.Custom[seg.Name]
+		if seg.Expr != nil {
+			text = exprText(seg, data, colorFunc("", "", cfg))
+		}
+		if text != "" {
+			segs[seg.Name] = seg.Name + ": " + text
+		}
+	}
+
+	return segs
+}
+
+// accessibleCost spells out the monthly, weekly and daily costs, with the
+// month-end forecast, the share of each budget and the month-end budget warning
+func accessibleCost(stats *types.TokenStats, cfg *config.Config) string {
+	labels := [3]string{"this month", "this week", "today"}
+	if cfg.AggregationMode == "sliding" {
+		labels = [3]string{"in 30 days", "in 7 days", "in 24 hours"}
+	}
+
+	var parts []string
+	for i, p := range []struct {
+		cost      float64
+		tokens    int64
+		budget    float64
+		projected float64
+	}{
+		{stats.MonthlyCost, stats.MonthlyTokens, cfg.BudgetMonthly, stats.MonthProjected},
+		{stats.WeeklyCost, stats.WeeklyTokens, cfg.BudgetWeekly, 0},
+		{stats.DailyCost, stats.DailyTokens, cfg.BudgetDaily, 0},
+	} {
+		var amounts []string
+		if cfg.CostUnit != "tokens" {
+			amounts = append(amounts, fmt.Sprintf("%.2f dollars", p.cost))
+		}
+		if cfg.CostUnit == "tokens" || cfg.CostUnit == "both" {
+			amounts = append(amounts, spokenUnits.Replace(formatTokens(p.tokens))+" tokens")
+		}
+		part := strings.Join(amounts, " and ") + " " + labels[i]
+		if cfg.CostUnit != "tokens" && cfg.CostProjection && p.projected >= p.cost+1 {
+			part += fmt.Sprintf(", on pace for about %.0f dollars by month end", p.projected)
+		}
+		if p.budget > 0 {
+			part += fmt.Sprintf(", %.0f percent of budget", p.cost/p.budget*100)
+		}
+		parts = append(parts, part)
+	}
+
+	text := "cost " + strings.Join(parts, ", ")
+	if stats.BudgetOut != nil {
+		if stats.BudgetOut.After(now()) {
+			text += ", monthly budget runs out around " + stats.BudgetOut.Local().Format("January 2")
+		} else {
+			text += ", over monthly budget"
+		}
+	}
+	return text
+}
+
+// accessibleWindow spells out a usage window: its percentage, how it
+// compares to an even pace and when it resets
+func accessibleWindow(label string, percent float64, reset time.Time, p *types.Projection, resetFormat string) string {
+	if percent >= 100 {
+		text := label + " limit reached"
+		if !reset.IsZero() {
+			text += ", resets at " + reset.Local().Format(resetFormat)
+		}
+		return text
+	}
+
+	text := fmt.Sprintf("%s %.0f percent", label, percent)
+	if p != nil {
+		switch p.Status {
+		case types.ProjectionWayOver:
+			text += ", far ahead of an even pace"
+		case types.ProjectionOver:
+			text += ", ahead of an even pace"
+		case types.ProjectionUnder:
+			text += ", behind an even pace"
+		case types.ProjectionWayUnder:
+			text += ", far behind an even pace"
+		}
+	}
+	if remaining := reset.Sub(now()); !reset.IsZero() && remaining > 0 {
+		text += ", resets in " + spokenDuration(remaining.Truncate(time.Minute))
+	}
+	return text
+}
+
+// accessibleTools spells out running tools and counts of completed ones
+func accessibleTools(data *types.TranscriptData) string {
+	var parts []string
+	for i, tool := range transcript.GetRunningTools(data) {
+		if i >= 2 {
+			break
+		}
+		part := "running " + tool.Name
+		if tool.Target != "" {
+			part += " on " + tool.Target
+		}
+		parts = append(parts, part)
+	}
+
+	var completed []string
+	for _, tc := range topCompletedTools(data, 4) {
+		if tc.count > 1 {
+			completed = append(completed, fmt.Sprintf("%s %d times", tc.name, tc.count))
+		} else {
+			completed = append(completed, tc.name)
+		}
+	}
+	if len(completed) > 0 {
+		parts = append(parts, "completed "+strings.Join(completed, ", "))
+	}
+
+	return strings.Join(parts, accessibleSeparator)
+}
+
+// accessibleAgents spells out running agents and how long they've run
+func accessibleAgents(data *types.TranscriptData) string {
+	var parts []string
+	for i, agent := range transcript.GetRunningAgents(data) {
+		if i >= 2 {
+			break
+		}
+		part := "agent " + agent.Type + " running"
+		if elapsed := now().Sub(agent.StartTime); elapsed > 0 {
+			part += " for " + spokenDuration(elapsed.Truncate(time.Second))
+		}
+		if agent.Description != "" {
+			part += ": " + agent.Description
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, accessibleSeparator)
+}
+
+// accessibleTodos spells out todo progress and the current todo
+func accessibleTodos(data *types.TranscriptData) string {
+	completed, total := transcript.GetTodoProgress(data)
+	if total == 0 {
+		return ""
+	}
+	if completed == total {
+		return fmt.Sprintf("all %s done", plural(total, "todo"))
+	}
+	text := fmt.Sprintf("%d of %s done", completed, plural(total, "todo"))
+	if current := transcript.GetCurrentTodo(data); current != nil {
+		text += ", current: " + current.Subject
+	}
+	return text
+}
+
+// spokenDuration spells out the two largest units of a duration, e.g.
+// "3 days 8 hours" or "1 minute 15 seconds"
+func spokenDuration(d time.Duration) string {
+	if d < time.Second {
+		return "less than a second"
+	}
+
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+	}
+	var parts []string
+	for _, u := range units {
+		if n := int(d / u.size); n > 0 {
+			parts = append(parts, plural(n, u.name))
+			d -= time.Duration(n) * u.size
+		} else if len(parts) > 0 {
+			// Only adjacent units: 1 day and 30 seconds is just "1 day"
+			break
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// plural formats a count with its noun, e.g. "1 commit" or "3 commits"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
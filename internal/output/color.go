@@ -0,0 +1,131 @@
+package output
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// colorDepth is how many colors the terminal shows: "truecolor", "256"
+// or "16". Colors beyond it are replaced by the nearest one it has; until
+// SetColorDepth is called they are used as they are.
+var colorDepth = "truecolor"
+
+// SetColorDepth sets the terminal's color depth and converts the current
+// palette to it. Call it after SetBackground and SetTheme.
+func SetColorDepth(depth string) {
+	colorDepth = depth
+	for _, c := range []*string{
+		&colorRed, &colorGreen, &colorYellow, &colorBlue, &colorMagenta, &colorCyan, &colorGray,
+		&bgRed, &bgGreen, &bgYellow, &bgBlue, &bgMagenta, &bgCyan,
+	} {
+		*c = downgrade(*c)
+	}
+}
+
+// ansi16 are the 16 basic colors as xterm draws them by default
+var ansi16 = [16][3]int{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0}, {0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0}, {92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// cubeLevels are the channel values of the 256-color palette's 6x6x6 cube
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// downgrade converts a 24-bit or 256-color escape sequence to colorDepth.
+// Other sequences are returned unchanged.
+func downgrade(seq string) string {
+	if colorDepth == "truecolor" || !strings.HasPrefix(seq, "\033[") || !strings.HasSuffix(seq, "m") {
+		return seq
+	}
+	params := strings.Split(seq[2:len(seq)-1], ";")
+	if len(params) < 3 || (params[0] != "38" && params[0] != "48") {
+		return seq
+	}
+	layer := params[0]
+	var rgb [3]int
+	switch {
+	case params[1] == "2" && len(params) == 5:
+		for i := range rgb {
+			rgb[i], _ = strconv.Atoi(params[2+i])
+		}
+		if colorDepth == "256" {
+			return fmt.Sprintf("\033[%s;5;%dm", layer, nearest256(rgb))
+		}
+	case params[1] == "5" && len(params) == 3:
+		if colorDepth == "256" {
+			return seq
+		}
+		n, _ := strconv.Atoi(params[2])
+		rgb = rgb256(n)
+	default:
+		return seq
+	}
+
+	// 16 colors: the nearest basic color, 30-37 or 90-97 (40-47 or 100-107
+	// for backgrounds)
+	best, bestDist := 0, -1
+	for i, c := range ansi16 {
+		if d := distance(rgb, c); bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	code := 30 + best
+	if best >= 8 {
+		code = 90 + best - 8
+	}
+	if layer == "48" {
+		code += 10
+	}
+	return fmt.Sprintf("\033[%dm", code)
+}
+
+// nearest256 returns the 256-color palette index closest to rgb, from the
+// color cube or the gray ramp
+func nearest256(rgb [3]int) int {
+	var idx [3]int
+	for i, v := range rgb {
+		for j, level := range cubeLevels {
+			if abs(v-level) < abs(v-cubeLevels[idx[i]]) {
+				idx[i] = j
+			}
+		}
+	}
+	cube := 16 + 36*idx[0] + 6*idx[1] + idx[2]
+
+	avg := (rgb[0] + rgb[1] + rgb[2]) / 3
+	gray := min(max((avg-3)/10, 0), 23)
+	if distance(rgb, rgb256(232+gray)) < distance(rgb, rgb256(cube)) {
+		return 232 + gray
+	}
+	return cube
+}
+
+// rgb256 returns the color of a 256-color palette index
+func rgb256(n int) [3]int {
+	switch {
+	case n < 16:
+		return ansi16[max(n, 0)]
+	case n < 232:
+		n -= 16
+		return [3]int{cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6]}
+	default:
+		v := 8 + 10*(min(n, 255)-232)
+		return [3]int{v, v, v}
+	}
+}
+
+func distance(a, b [3]int) int {
+	d := 0
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return d
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
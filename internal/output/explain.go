@@ -0,0 +1,303 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// segmentComponents maps each segment to the component its data comes from
+var segmentComponents = map[string]string{
+	"dir":          "cwd",
+	"git":          "git",
+	"model":        "stdin",
+	"context":      "stdin",
+	"subscription": "usage",
+	"cost":         "cost",
+	"usage":        "usage",
+	"usage7d":      "usage",
+	"opus":         "usage",
+	"tools":        "transcript",
+	"agents":       "transcript",
+	"todos":        "transcript",
+	"duration":     "transcript",
+	"note":         "notes",
+	"history":      "cost",
+	"commits":      "git",
+	"base":         "git",
+	"session":      "cost",
+	"changes":      "transcript",
+	"summary":      "transcript",
+	"errors":       "transcript",
+	"style":        "stdin",
+	"version":      "stdin",
+	"compact":      "stdin",
+}
+
+// componentDescriptions says where each component reads its data
+var componentDescriptions = map[string]string{
+	"cwd":        "working directory",
+	"stdin":      "session JSON from Claude Code on stdin",
+	"git":        "git rev-parse, status --porcelain and rev-list (per compared remote and the default branch) in the session cwd from stdin",
+	"usage":      "Anthropic OAuth usage API and credentials",
+	"cost":       "cost cache plus incremental scan of ~/.claude/projects logs",
+	"transcript": "session transcript (transcript_path)",
+	"notes":      "notes left with the note command for the session_id from stdin",
+	"custom":     "--custom-segment command run in the session cwd",
+	"expr":       "--expr-segment expression over the collected data",
+}
+
+// segmentOptions lists the options that change each segment, besides
+// --segments, --format and --deadline which affect all of them
+var segmentOptions = map[string][]string{
+	"dir":          {"--show-dir", "--dir-source", "--project-name", "--info-mode"},
+	"git":          {"--show-git", "--git-style", "--git-scope", "--git-upstreams", "--git-ttl", "--no-git-cache", "--git-status-timeout", "--git-untracked", "--git-last-commit", "--info-mode"},
+	"model":        {"--show-model", "--tools-style", "--info-mode"},
+	"context":      {"--show-context"},
+	"subscription": {"--show-subscription", "--claude-discovery", "--profile"},
+	"cost":         {"--show-cost", "--aggregation", "--budget-monthly", "--budget-weekly", "--budget-daily", "--budget-percent", "--budget-notify", "--webhook", "--cost-breakdown", "--cost-projection", "--cost-unit", "--cost-async", "--pricing-ttl", "--info-mode"},
+	"usage":        {"--show-usage", "--cache-ttl", "--api-base", "--refresh-token", "--usage-format", "--usage-bar", "--usage-bar-width", "--duration-format", "--burn-rate", "--limit-eta", "--fresh-window", "--limit-hint", "--model-hint", "--limit-notify", "--usage-notify", "--reset-notify", "--webhook"},
+	"usage7d":      {"--show-usage", "--cache-ttl", "--api-base", "--usage7d-format", "--usage7d-min", "--usage-bar", "--usage-bar-width", "--duration-format"},
+	"opus":         {"--show-usage", "--cache-ttl", "--api-base"},
+	"tools":        {"--show-tools", "--tools-style", "--spinner", "--transcript-tail", "--info-mode"},
+	"agents":       {"--show-agents", "--duration-format", "--spinner", "--transcript-tail", "--info-mode"},
+	"todos":        {"--show-todos", "--transcript-tail"},
+	"duration":     {"--show-duration", "--duration-format"},
+	"note":         {"--show-note", "--info-mode"},
+	"history":      {"--show-history", "--info-mode"},
+	"commits":      {"--show-commits"},
+	"base":         {"--show-base"},
+	"session":      {"--show-session", "--retention-days"},
+	"changes":      {"--show-changes"},
+	"summary":      {"--show-summary", "--summary-tools", "--summary-min"},
+	"errors":       {"--show-errors", "--error-streak"},
+	"style":        {"--show-style"},
+	"version":      {"--show-version"},
+	"compact":      {"--show-compact", "--compact-warn"},
+}
+
+// customOptions are the options that change a custom segment
+var customOptions = []string{"--custom-segment", "--expr-segment", "--custom-timeout", "--custom-ttl", "--colors"}
+
+// Explain writes, per segment, whether it was rendered, where its data
+// came from, why it is missing and which options affect it
+func Explain(w io.Writer, data *types.StatusData) {
+	cfg := config.Get()
+	segs := renderSegments(data)
+	width := lineWidth(cfg, data.Session)
+	_, overflow := layout(segs, shortSegments(data), width)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEGMENT\tSTATUS\tDETAILS")
+	for _, name := range append(slices.Clone(config.SegmentNames), cfg.CustomSegmentNames()...) {
+		options := segmentOptions[name]
+		if _, ok := cfg.CustomSegment(name); ok {
+			options = customOptions
+		}
+		switch {
+		case !cfg.SegmentEnabled(name):
+			fmt.Fprintf(tw, "%s\thidden\t%s\n", name, disabledReason(cfg, name))
+		case segs[name] == "":
+			fmt.Fprintf(tw, "%s\tmissing\t%s\n", name, missingReason(name, data))
+			fmt.Fprintf(tw, "\t\tsource: %s\n", sourceOf(name, data))
+		default:
+			fmt.Fprintf(tw, "%s\tshown\tsource: %s\n", name, sourceOf(name, data))
+			if slices.Contains(overflow, name) {
+				fmt.Fprintf(tw, "\t\t%s\n", overflowNote(cfg, width))
+			}
+		}
+		fmt.Fprintf(tw, "\t\toptions: %s\n", strings.Join(options, ", "))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "all\t\toptions: --segments, --format, --lines, --max-width, --auto-width, --overflow, --show-if, --hide-if, --theme, --colors, --deadline (%dms)\n", cfg.Deadline)
+	tw.Flush()
+}
+
+// overflowNote explains what happened to a segment that didn't fit
+func overflowNote(cfg *config.Config, width int) string {
+	limit := fmt.Sprintf("--max-width %d", width)
+	if cfg.MaxWidth <= 0 {
+		limit = fmt.Sprintf("the terminal width %d", width)
+	}
+	if cfg.Overflow == "drop" {
+		return "dropped: doesn't fit " + limit
+	}
+	return "moved to the last line: doesn't fit " + limit
+}
+
+// disabledReason explains why a segment is turned off
+func disabledReason(cfg *config.Config, name string) string {
+	if cfg.Format != "" && !strings.Contains(cfg.Format, "{"+name+"}") {
+		return "not in --format"
+	}
+	if cfg.Segments != "" {
+		enabled := *cfg
+		enabled.Segments = ""
+		if enabled.SegmentEnabled(name) {
+			return "not in --segments"
+		}
+	}
+	if name == "usage7d" || name == "opus" {
+		name = "usage"
+	}
+	return fmt.Sprintf("--show-%s=false", name)
+}
+
+// sourceOf describes where a segment's data came from
+func sourceOf(name string, data *types.StatusData) string {
+	component := segmentComponents[name]
+	if seg, ok := config.Get().CustomSegment(name); ok {
+		component = "custom"
+		if seg.Expr != nil {
+			component = "expr"
+		}
+	}
+	source := componentDescriptions[component]
+	if collected := data.Sources[component]; collected != "" {
+		source += ", " + collected
+	}
+	if component == "usage" && data.Usage != nil && data.Usage.Source != "" {
+		source += ", " + data.Usage.Source
+		if !data.Usage.FetchedAt.IsZero() {
+			source += fmt.Sprintf(" fetched %s ago", formatShortDuration(now().Sub(data.Usage.FetchedAt)))
+		}
+	}
+	return source
+}
+
+// missingReason explains why an enabled segment rendered nothing
+func missingReason(name string, data *types.StatusData) string {
+	sess := data.Session
+	if rule, hidden := hidingRule(name, exprVars(data), config.Get()); hidden {
+		if rule.Show {
+			return "--show-if condition doesn't hold: " + rule.Cond.String()
+		}
+		return "--hide-if condition holds: " + rule.Cond.String()
+	}
+	if seg, ok := config.Get().CustomSegment(name); ok {
+		if seg.Expr != nil {
+			return "the expression gave nil, false or \"\", or failed (see --debug)"
+		}
+		if strings.Contains(data.Sources["custom"], "deadline") {
+			return "the command didn't finish before the deadline and printed nothing before"
+		}
+		return "the command printed nothing, failed or timed out (see --debug)"
+	}
+	switch name {
+	case "git":
+		if strings.Contains(data.Sources["git"], "deadline") {
+			return "git didn't finish before the deadline"
+		}
+		return "not a git repository"
+	case "model":
+		if sess == nil {
+			return "no session input on stdin"
+		}
+		return "no model in the session input"
+	case "context":
+		if sess == nil {
+			return "no session input on stdin"
+		}
+		return "no context window usage in the session input yet"
+	case "style":
+		if sess == nil {
+			return "no session input on stdin"
+		}
+		if sess.OutputStyle != nil && sess.OutputStyle.Name != "" {
+			return "the default output style is in use"
+		}
+		return "no output_style in the session input"
+	case "compact":
+		if sess == nil {
+			return "no session input on stdin"
+		}
+		return fmt.Sprintf("context usage is below --compact-warn %d%%", max(config.Get().CompactWarn, 1))
+	case "version":
+		if sess == nil {
+			return "no session input on stdin"
+		}
+		return "no version in the session input"
+	case "subscription":
+		return "no subscription type or tier in the credentials"
+	case "cost":
+		return "no costs recorded in the current periods"
+	case "history":
+		return "no costs recorded in the last 7 days"
+	case "session":
+		if sess == nil || sess.SessionID == "" {
+			return "no session_id in the session input"
+		}
+		return "no costs recorded for this session yet"
+	case "commits":
+		if !data.Git.IsRepo {
+			return "not a git repository"
+		}
+		return "no commits today"
+	case "base":
+		if !data.Git.IsRepo {
+			return "not a git repository"
+		}
+		if data.Git.Base == "" {
+			return "no default branch (origin/HEAD, main or master), or it's the current branch"
+		}
+		return "even with " + data.Git.Base
+	case "note":
+		if sess == nil || sess.SessionID == "" {
+			return "no session_id in the session input"
+		}
+		return "no notes for this session"
+	case "usage", "usage7d", "opus":
+		if data.Usage == nil {
+			return "no usage data yet"
+		}
+		if data.Usage.Unavailable {
+			return "usage data unavailable (no cache and the API can't be reached)"
+		}
+		if data.IsApiBilling && data.Usage.ResetTime.IsZero() && name != "usage" {
+			return "API key billing has no plan usage windows"
+		}
+		switch name {
+		case "usage7d":
+			if data.Usage.SevenDayPercent > 0 {
+				return fmt.Sprintf("%.0f%% is below --usage7d-min", data.Usage.SevenDayPercent)
+			}
+			return "the API reported no 7-day window"
+		case "opus":
+			return "the API reported no Opus window (plan without an Opus cap)"
+		}
+		return "no usage data"
+	}
+
+	// Transcript segments
+	switch {
+	case sess == nil:
+		return "no session input on stdin"
+	case sess.TranscriptPath == "":
+		return "no transcript_path in the session input"
+	case data.Transcript == nil:
+		return "transcript not read"
+	}
+	switch name {
+	case "tools":
+		if config.Get().ToolsStyle == "model" {
+			return "--tools-style model shows the running tool after the model instead"
+		}
+		return "no tool calls yet"
+	case "agents":
+		return "no running subagents"
+	case "todos":
+		return "no todos in this session"
+	case "changes":
+		return "no successful file edits in this session"
+	case "errors":
+		return fmt.Sprintf("fewer than %d tool errors in a row", max(config.Get().ErrorStreak, 1))
+	case "summary":
+		return fmt.Sprintf("fewer than %d calls of the --summary-tools so far", config.Get().SummaryMin)
+	}
+	return "session start not found in the transcript"
+}
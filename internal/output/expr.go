@@ -0,0 +1,198 @@
+package output
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/expr"
+	"github.com/erwint/claude-code-statusline/internal/session"
+	"github.com/erwint/claude-code-statusline/internal/transcript"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// exprText evaluates an expression segment. A nil, false or empty result,
+// or an error, shows nothing; errors are logged. color is the expression's
+// color(spec, text) function.
+func exprText(seg config.CustomSegment, data *types.StatusData, color expr.Func) string {
+	v, err := seg.Expr.Eval(expr.Env{Vars: exprVars(data), Funcs: map[string]expr.Func{"color": color}})
+	if err != nil {
+		config.WarnLog("Expression segment %s: %v", seg.Name, err)
+		return ""
+	}
+	if v == false {
+		return ""
+	}
+	return expr.String(v)
+}
+
+// applyRules removes the segments that a --show-if or --hide-if rule hides
+func applyRules(segs map[string]string, data *types.StatusData, cfg *config.Config) map[string]string {
+	if len(cfg.Rules) == 0 {
+		return segs
+	}
+	vars := exprVars(data)
+	for name := range segs {
+		if _, hidden := hidingRule(name, vars, cfg); hidden {
+			delete(segs, name)
+		}
+	}
+	return segs
+}
+
+// hidingRule returns the rule that hides a segment: a --show-if whose
+// condition doesn't hold or a --hide-if whose condition does. A condition
+// that fails is logged and doesn't hide anything.
+func hidingRule(name string, vars map[string]any, cfg *config.Config) (config.Rule, bool) {
+	for _, rule := range cfg.SegmentRules(name) {
+		v, err := rule.Cond.Eval(expr.Env{Vars: vars})
+		if err != nil {
+			config.WarnLog("Rule for %s: %v", name, err)
+			continue
+		}
+		if expr.Truthy(v) != rule.Show {
+			return rule, true
+		}
+	}
+	return config.Rule{}, false
+}
+
+// colorFunc returns color(spec, text) for an expression segment drawn with
+// fg and bg: text in the color spec (as in --colors), then back to the
+// segment's own color
+func colorFunc(fg, bg string, cfg *config.Config) expr.Func {
+	return func(args []any) (any, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("want color(spec, text)")
+		}
+		spec, text := expr.String(args[0]), expr.String(args[1])
+		code, ok := colorCode(spec, false)
+		if !ok {
+			return nil, fmt.Errorf("unknown color %q", spec)
+		}
+		if cfg.NoColor || cfg.DisplayMode == "accessible" || text == "" {
+			return text, nil
+		}
+		restore := fg
+		switch cfg.DisplayMode {
+		case "minimal":
+			restore = colorGray
+		case "background":
+			restore = bg
+		}
+		return downgrade(code) + text + colorReset + restore, nil
+	}
+}
+
+// exprVars are the variables expressions can read. Each is only set when
+// its data was collected, so expressions see nil for the rest.
+func exprVars(data *types.StatusData) map[string]any {
+	vars := make(map[string]any)
+	dir := ShownDir(data)
+	vars["dir"] = dir
+	vars["project"] = filepath.Base(dir)
+	if data.Project != "" {
+		vars["project"] = data.Project
+	}
+
+	if sess := data.Session; sess != nil {
+		if sess.Model != nil {
+			vars["model"] = sess.Model.DisplayName
+			vars["model.id"] = sess.Model.ID
+		}
+		if sess.ContextWindow != nil {
+			vars["context.percent"] = session.GetContextPercent(sess)
+		}
+		if sess.OutputStyle != nil {
+			vars["style"] = sess.OutputStyle.Name
+		}
+		if sess.Version != "" {
+			vars["version"] = sess.Version
+		}
+	}
+
+	if git := data.Git; git.IsRepo {
+		vars["git.branch"] = git.Branch
+		if !git.StatusUnknown {
+			vars["git.modified"] = git.Modified
+			vars["git.staged"] = git.Staged
+			vars["git.untracked"] = git.Untracked
+			vars["git.clean"] = git.Modified+git.Staged+git.Untracked == 0
+		}
+		vars["git.ahead"] = git.Ahead
+		vars["git.behind"] = git.Behind
+		vars["commits"] = git.CommitsToday
+		if git.LastCommit != nil {
+			vars["git.commit.minutes"] = int(now().Sub(*git.LastCommit).Minutes())
+			vars["git.commit.subject"] = git.LastSubject
+		}
+		if git.Base != "" {
+			vars["base.branch"] = git.Base
+			vars["base.ahead"] = git.BaseAhead
+			vars["base.behind"] = git.BaseBehind
+		}
+	}
+
+	if u := data.Usage; u != nil && !u.Unavailable {
+		vars["usage.percent"] = u.UsagePercent
+		vars["usage.weekly"] = u.SevenDayPercent
+		vars["usage.opus"] = u.OpusPercent
+		if !u.ResetTime.IsZero() {
+			vars["usage.reset_minutes"] = int(u.ResetTime.Sub(now()).Minutes())
+		}
+	}
+	if data.Subscription != "" || data.Tier != "" {
+		vars["subscription.type"] = data.Subscription
+		vars["subscription.tier"] = data.Tier
+	}
+
+	if _, collected := data.Sources["cost"]; collected && data.Stats != nil {
+		s := data.Stats
+		vars["cost.daily"] = s.DailyCost
+		vars["cost.weekly"] = s.WeeklyCost
+		vars["cost.monthly"] = s.MonthlyCost
+		if s.MonthProjected > 0 {
+			vars["cost.projected"] = s.MonthProjected
+		}
+		if sess := data.Session; sess != nil {
+			if c, ok := s.SessionCosts[sess.SessionID]; ok {
+				vars["cost.session"] = c
+			}
+		}
+	}
+
+	if td := data.Transcript; td != nil {
+		running := 0
+		for _, tool := range td.Tools {
+			if tool.Status == "running" {
+				running++
+				vars["tools.current"] = tool.Name
+			}
+		}
+		vars["tools.running"] = running
+		agents := 0
+		for _, agent := range td.Agents {
+			if agent.Status == "running" {
+				agents++
+			}
+		}
+		vars["agents.running"] = agents
+		done, total := transcript.GetTodoProgress(td)
+		vars["todos.done"] = done
+		vars["todos.total"] = total
+		if current := transcript.GetCurrentTodo(td); current != nil {
+			vars["todos.current"] = current.Subject
+		}
+		vars["changes.added"] = td.LinesAdded
+		vars["changes.removed"] = td.LinesRemoved
+		vars["errors"] = td.ErrorStreak
+		if !td.SessionStart.IsZero() {
+			vars["duration.minutes"] = int(now().Sub(td.SessionStart).Minutes())
+		}
+	}
+
+	for name, output := range data.Custom {
+		vars["custom."+name] = output
+	}
+	return vars
+}
@@ -0,0 +1,167 @@
+package output
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/session"
+	"github.com/erwint/claude-code-statusline/internal/transcript"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// jsonDocument is the --output json representation of a render. Sections
+// whose data wasn't collected (disabled segment, no git repo, ...) are omitted.
+type jsonDocument struct {
+	Cwd          string            `json:"cwd"`
+	Session      *jsonSession      `json:"session,omitempty"`
+	Git          *types.GitInfo    `json:"git,omitempty"`
+	Usage        *jsonUsage        `json:"usage,omitempty"`
+	Subscription *jsonSubscription `json:"subscription,omitempty"`
+	Costs        *types.TokenStats `json:"costs,omitempty"`
+	Transcript   *jsonTranscript   `json:"transcript,omitempty"`
+	Note         *types.Note       `json:"note,omitempty"`
+	Custom       map[string]string `json:"custom,omitempty"`
+}
+
+type jsonSession struct {
+	ID             string              `json:"id,omitempty"`
+	Model          *types.SessionModel `json:"model,omitempty"`
+	ContextPercent *float64            `json:"context_percent,omitempty"`
+	TranscriptPath string              `json:"transcript_path,omitempty"`
+	Version        string              `json:"version,omitempty"`
+	OutputStyle    string              `json:"output_style,omitempty"`
+	ProjectDir     string              `json:"project_dir,omitempty"`
+}
+
+type jsonUsage struct {
+	*types.UsageCache
+	Stale       bool `json:"stale"`
+	Unavailable bool `json:"unavailable"`
+}
+
+type jsonSubscription struct {
+	Type       string `json:"type,omitempty"`
+	Tier       string `json:"tier,omitempty"`
+	APIBilling bool   `json:"api_billing"`
+}
+
+type jsonTranscript struct {
+	RunningTools    []jsonTool     `json:"running_tools"`
+	CompletedTools  map[string]int `json:"completed_tools"`
+	RunningAgents   []jsonAgent    `json:"running_agents"`
+	TodosCompleted  int            `json:"todos_completed"`
+	TodosTotal      int            `json:"todos_total"`
+	CurrentTodo     string         `json:"current_todo,omitempty"`
+	LinesAdded      int            `json:"lines_added"`
+	LinesRemoved    int            `json:"lines_removed"`
+	ErrorStreak     int            `json:"error_streak"`
+	SessionStart    *time.Time     `json:"session_start,omitempty"`
+	DurationSeconds int64          `json:"duration_seconds,omitempty"`
+}
+
+type jsonTool struct {
+	Name      string    `json:"name"`
+	Target    string    `json:"target,omitempty"`
+	StartTime time.Time `json:"start_time"`
+}
+
+type jsonAgent struct {
+	Type        string    `json:"type"`
+	Description string    `json:"description,omitempty"`
+	Model       string    `json:"model,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+}
+
+// FormatJSON renders the collected data as a JSON document for scripts
+func FormatJSON(data *types.StatusData) string {
+	doc := jsonDocument{}
+	doc.Cwd = data.Cwd
+	if doc.Cwd == "" {
+		doc.Cwd, _ = os.Getwd()
+	}
+
+	if sess := data.Session; sess != nil {
+		doc.Session = &jsonSession{
+			ID:             sess.SessionID,
+			Model:          sess.Model,
+			TranscriptPath: sess.TranscriptPath,
+			Version:        sess.Version,
+		}
+		if sess.OutputStyle != nil {
+			doc.Session.OutputStyle = sess.OutputStyle.Name
+		}
+		if sess.Workspace != nil {
+			doc.Session.ProjectDir = sess.Workspace.ProjectDir
+		}
+		if sess.ContextWindow != nil {
+			pct := session.GetContextPercent(sess)
+			doc.Session.ContextPercent = &pct
+		}
+	}
+
+	if data.Git.IsRepo {
+		doc.Git = &data.Git
+	}
+
+	if data.Usage != nil {
+		doc.Usage = &jsonUsage{UsageCache: data.Usage, Stale: data.Usage.Stale, Unavailable: data.Usage.Unavailable}
+	}
+
+	if data.Subscription != "" || data.Tier != "" || data.IsApiBilling {
+		doc.Subscription = &jsonSubscription{Type: data.Subscription, Tier: data.Tier, APIBilling: data.IsApiBilling}
+	}
+
+	if data.Stats != nil && (data.Stats.DailyCost > 0 || data.Stats.WeeklyCost > 0 || data.Stats.MonthlyCost > 0) {
+		doc.Costs = data.Stats
+	}
+
+	if data.Transcript != nil {
+		doc.Transcript = summarizeTranscript(data.Transcript)
+	}
+	doc.Note = data.Note
+	doc.Custom = data.Custom
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return "{}\n"
+	}
+	return string(out) + "\n"
+}
+
+// summarizeTranscript reduces transcript data to what the statusline shows
+func summarizeTranscript(data *types.TranscriptData) *jsonTranscript {
+	t := &jsonTranscript{
+		RunningTools:   []jsonTool{},
+		CompletedTools: transcript.GetCompletedToolCounts(data),
+		RunningAgents:  []jsonAgent{},
+		LinesAdded:     data.LinesAdded,
+		LinesRemoved:   data.LinesRemoved,
+		ErrorStreak:    data.ErrorStreak,
+	}
+
+	for _, tool := range transcript.GetRunningTools(data) {
+		t.RunningTools = append(t.RunningTools, jsonTool{Name: tool.Name, Target: tool.Target, StartTime: tool.StartTime})
+	}
+	for _, agent := range transcript.GetRunningAgents(data) {
+		t.RunningAgents = append(t.RunningAgents, jsonAgent{
+			Type:        agent.Type,
+			Description: agent.Description,
+			Model:       agent.Model,
+			StartTime:   agent.StartTime,
+		})
+	}
+
+	t.TodosCompleted, t.TodosTotal = transcript.GetTodoProgress(data)
+	if todo := transcript.GetCurrentTodo(data); todo != nil {
+		t.CurrentTodo = todo.Subject
+	}
+
+	if !data.SessionStart.IsZero() {
+		start := data.SessionStart
+		t.SessionStart = &start
+		t.DurationSeconds = int64(now().Sub(start).Seconds())
+	}
+
+	return t
+}
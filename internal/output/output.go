@@ -2,21 +2,25 @@ package output
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/cost"
 	"github.com/erwint/claude-code-statusline/internal/session"
 	"github.com/erwint/claude-code-statusline/internal/transcript"
 	"github.com/erwint/claude-code-statusline/internal/types"
+	usagepkg "github.com/erwint/claude-code-statusline/internal/usage"
 )
 
-// ANSI color codes
-const (
-	colorReset   = "\033[0m"
+// ANSI color codes. The colors suit dark backgrounds until SetBackground
+// or SetTheme switches them.
+var (
 	colorRed     = "\033[31m"
 	colorGreen   = "\033[32m"
 	colorYellow  = "\033[33m"
@@ -24,75 +28,166 @@ const (
 	colorMagenta = "\033[35m"
 	colorCyan    = "\033[36m"
 	colorGray    = "\033[38;5;248m"
-	bgRed        = "\033[41m"
-	bgGreen      = "\033[42m"
-	bgYellow     = "\033[43m"
-	bgBlue       = "\033[44m"
-	bgMagenta    = "\033[45m"
-	bgCyan       = "\033[46m"
+
+	bgRed     = "\033[41m"
+	bgGreen   = "\033[42m"
+	bgYellow  = "\033[43m"
+	bgBlue    = "\033[44m"
+	bgMagenta = "\033[45m"
+	bgCyan    = "\033[46m"
 )
 
+const colorReset = "\033[0m"
+
+// blink makes text flash until the next colorReset
+const blink = "\033[5m"
+
+// SetBackground selects the default colors for a "light" or "dark"
+// terminal background. Light backgrounds get darker yellow, cyan, green and
+// gray, which are otherwise hard to read on white.
+func SetBackground(background string) {
+	colorRed, colorBlue, colorMagenta = "\033[31m", "\033[34m", "\033[35m"
+	bgRed, bgGreen, bgYellow = "\033[41m", "\033[42m", "\033[43m"
+	bgBlue, bgMagenta, bgCyan = "\033[44m", "\033[45m", "\033[46m"
+	if background == "light" {
+		colorGreen = "\033[38;5;28m"
+		colorYellow = "\033[38;5;136m"
+		colorCyan = "\033[38;5;30m"
+		colorGray = "\033[38;5;242m"
+		return
+	}
+	colorGreen = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan = "\033[36m"
+	colorGray = "\033[38;5;248m"
+}
+
+// now is the clock used for all relative times; replays pin it
+var now = time.Now
+
+// SetClock replaces the clock used for rendering, e.g. to reproduce a
+// recorded render exactly
+func SetClock(clock func() time.Time) {
+	now = clock
+}
+
 // FormatStatusLine builds the complete status line output
 func FormatStatusLine(sess *types.SessionInput, git types.GitInfo, usage *types.UsageCache, stats *types.TokenStats, subscription, tier string, isApiBilling bool, transcriptData *types.TranscriptData) string {
+	return Format(&types.StatusData{
+		Session:      sess,
+		Git:          git,
+		Usage:        usage,
+		Stats:        stats,
+		Subscription: subscription,
+		Tier:         tier,
+		IsApiBilling: isApiBilling,
+		Transcript:   transcriptData,
+	})
+}
+
+// Format builds the status line from collected data
+func Format(data *types.StatusData) string {
+	out, _ := layout(renderSegments(data), shortSegments(data), lineWidth(config.Get(), data.Session))
+	return out
+}
+
+// layout lays rendered segments out by the layout template and fits each
+// line into width cells (0 = no limit), switching to the short forms
+// before dropping segments. It returns the output and the segments that
+// didn't fit, which --overflow line moves to a line of their own.
+func layout(segs, short map[string]string, width int) (string, []string) {
 	cfg := config.Get()
-	var parts []string
+	format := cfg.LayoutFormat()
+	sep := " | "
+	if cfg.DisplayMode == "accessible" {
+		sep = accessibleSeparator
+	}
+
+	lines := templateLines(format, segs, short)
+	var overflow []templateToken
+	if width > 0 {
+		lines, overflow = fitWidth(lines, width, sep, glyphWidths(cfg))
+	}
+	var dropped []string
+	for _, token := range overflow {
+		dropped = append(dropped, token.segment)
+	}
+	if len(overflow) > 0 && cfg.Overflow != "drop" {
+		lines = append(lines, overflow)
+	}
+	return joinLines(lines, sep, width, glyphWidths(cfg)), dropped
+}
+
+// renderSegments renders each enabled segment that has something to show
+func renderSegments(data *types.StatusData) map[string]string {
+	cfg := config.Get()
+	if cfg.DisplayMode == "accessible" {
+		return applyRules(renderAccessible(data), data, cfg)
+	}
+
+	segs := make(map[string]string)
+	sess, git, usage, stats := data.Session, data.Git, data.Usage, data.Stats
+	subscription, tier, isApiBilling, transcriptData := data.Subscription, data.Tier, data.IsApiBilling, data.Transcript
 
 	// Directory
-	cwd, _ := os.Getwd()
-	dir := filepath.Base(cwd)
-	if home := os.Getenv("HOME"); strings.HasPrefix(cwd, home) {
-		dir = "~" + cwd[len(home):]
-		if len(dir) > 20 {
-			dir = "~/" + filepath.Base(cwd)
+	if cfg.SegmentEnabled("dir") {
+		dir := data.Project
+		if dir == "" {
+			dir = displayDir(ShownDir(data))
 		}
+		fg, bg := segmentColor("dir", colorBlue, bgBlue)
+		segs["dir"] = colorize(dir, fg, bg, cfg)
 	}
-	parts = append(parts, colorize(dir, colorBlue, bgBlue, cfg))
 
 	// Git info
-	if git.IsRepo {
-		gitPart := git.Branch
-		indicators := ""
-		if git.HasUntracked {
-			indicators += "?"
-		}
-		if git.HasStaged {
-			indicators += "+"
-		}
-		if git.HasModified {
-			indicators += "!"
-		}
-		if indicators != "" {
-			gitPart += " " + indicators
-		}
-		if git.Ahead > 0 {
-			gitPart += fmt.Sprintf(" ↑%d", git.Ahead)
-		}
-		if git.Behind > 0 {
-			gitPart += fmt.Sprintf(" ↓%d", git.Behind)
-		}
-		parts = append(parts, colorize(gitPart, colorMagenta, bgMagenta, cfg))
+	if cfg.SegmentEnabled("git") && git.IsRepo {
+		segs["git"] = gitSegment(git, git.Branch, cfg)
+	}
+
+	// Output style, unless it's the default one
+	if cfg.SegmentEnabled("style") && sess != nil && sess.OutputStyle != nil && !isDefaultStyle(sess.OutputStyle.Name) {
+		fg, bg := segmentColor("style", colorMagenta, bgMagenta)
+		segs["style"] = colorize(sess.OutputStyle.Name, fg, bg, cfg)
+	}
+
+	// Claude Code version
+	if cfg.SegmentEnabled("version") && sess != nil && sess.Version != "" {
+		fg, bg := segmentColor("version", colorGray, bgBlue)
+		segs["version"] = colorize("v"+strings.TrimPrefix(sess.Version, "v"), fg, bg, cfg)
 	}
 
 	// Model info (from stdin session)
-	if sess != nil && sess.Model != nil {
+	if cfg.SegmentEnabled("model") && sess != nil && sess.Model != nil {
 		modelName := sess.Model.DisplayName
 		if modelName == "" {
 			modelName = formatModelName(sess.Model.ID)
 		}
-		parts = append(parts, colorize(modelName, colorCyan, bgCyan, cfg))
+		fg, bg := segmentColor("model", colorCyan, bgCyan)
+		segs["model"] = colorize(modelName, fg, bg, cfg)
+		if tool := inlineTool(transcriptData, cfg); tool != nil {
+			segs["model"] += " " + colorize("▶", colorYellow, bgYellow, cfg) + " " + colorize(tool.Name, colorCyan, bgCyan, cfg) +
+				" " + colorize(formatShortDuration(now().Sub(tool.StartTime)), colorGray, bgBlue, cfg)
+		}
 	}
 
 	// Context window usage bar
-	if cfg.ShowContext && sess != nil && sess.ContextWindow != nil {
+	if cfg.SegmentEnabled("context") && sess != nil && sess.ContextWindow != nil {
 		contextPct := session.GetContextPercent(sess)
 		if contextPct > 0 || sess.ContextWindow.Size > 0 {
-			contextPart := formatContextBar(contextPct, cfg)
-			parts = append(parts, contextPart)
+			segs["context"] = formatContextBar(contextPct, cfg)
+		}
+	}
+
+	// Warning before auto-compaction
+	if cfg.SegmentEnabled("compact") && compactSoon(sess, cfg) {
+		segs["compact"] = colorize("COMPACT SOON", colorRed, bgRed, cfg)
+		if !cfg.NoColor {
+			segs["compact"] = blink + segs["compact"]
 		}
 	}
 
 	// Subscription type with tier
-	if subscription != "" || tier != "" {
+	if cfg.SegmentEnabled("subscription") && (subscription != "" || tier != "" || data.Profile != "") {
 		subPart := subscription
 		if tier != "" {
 			shortTier := shortenTier(tier)
@@ -102,19 +197,56 @@ func FormatStatusLine(sess *types.SessionInput, git types.GitInfo, usage *types.
 				subPart = shortTier
 			}
 		}
-		parts = append(parts, colorize(subPart, colorGray, bgBlue, cfg))
+		// Which account's limits these are
+		if data.Profile != "" {
+			subPart = strings.TrimSpace(subPart + " @" + data.Profile)
+		}
+		fg, bg := segmentColor("subscription", colorGray, bgBlue)
+		segs["subscription"] = colorize(subPart, fg, bg, cfg)
 	}
 
 	// Cost breakdown: monthly / weekly / daily
-	if stats.DailyCost > 0 || stats.WeeklyCost > 0 || stats.MonthlyCost > 0 {
-		costPart := fmt.Sprintf("$%.2f/m $%.2f/w $%.2f/d",
-			stats.MonthlyCost, stats.WeeklyCost, stats.DailyCost)
-		parts = append(parts, colorize(costPart, colorCyan, bgCyan, cfg))
+	if cfg.SegmentEnabled("cost") && stats != nil && (stats.DailyCost > 0 || stats.WeeklyCost > 0 || stats.MonthlyCost > 0) {
+		segs["cost"] = costSegment(stats, cfg, false)
+	}
+
+	// What this session has cost so far
+	if cfg.SegmentEnabled("session") && sess != nil && stats != nil {
+		if c, ok := stats.SessionCosts[sess.SessionID]; ok && c > 0 {
+			fg, bg := segmentColor("session", colorCyan, bgCyan)
+			segs["session"] = colorize(fmt.Sprintf("$%.2f/s", c), fg, bg, cfg)
+		}
+	}
+
+	// Commits made today
+	if cfg.SegmentEnabled("commits") && git.CommitsToday > 0 {
+		fg, bg := segmentColor("commits", colorMagenta, bgMagenta)
+		segs["commits"] = colorize(fmt.Sprintf("%d ⎌", git.CommitsToday), fg, bg, cfg)
+	}
+
+	// How far the branch has drifted from the default branch
+	if cfg.SegmentEnabled("base") && git.Base != "" && (git.BaseAhead > 0 || git.BaseBehind > 0) {
+		text := git.Base
+		if git.BaseAhead > 0 {
+			text += fmt.Sprintf("↑%d", git.BaseAhead)
+		}
+		if git.BaseBehind > 0 {
+			text += fmt.Sprintf("↓%d", git.BaseBehind)
+		}
+		fg, bg := segmentColor("base", colorMagenta, bgMagenta)
+		segs["base"] = colorize(text, fg, bg, cfg)
+	}
+
+	// Last 7 days of cost, so an unusual day stands out
+	if cfg.SegmentEnabled("history") && stats != nil {
+		if line := sparkline(stats.DayHistory); line != "" {
+			fg, bg := segmentColor("history", colorCyan, bgCyan)
+			segs["history"] = colorize(line, fg, bg, cfg)
+		}
 	}
 
-	// API Usage info (at the end)
-	if usage != nil {
-		// 5-hour window
+	// API Usage info: 5-hour window
+	if cfg.SegmentEnabled("usage") && usage != nil {
 		usageColor := colorGreen
 		usageBg := bgGreen
 
@@ -131,7 +263,12 @@ func FormatStatusLine(sess *types.SessionInput, git types.GitInfo, usage *types.
 		}
 
 		var usagePart string
-		if usage.Unavailable {
+		if isApiBilling && usage.ResetTime.IsZero() && !usage.Unavailable {
+			// API key billing has no plan limits, only spend
+			usagePart = apiBillingPart(usage)
+			usageColor = colorGray
+			usageBg = bgBlue
+		} else if usage.Unavailable {
 			usagePart = "usage?"
 			usageColor = colorGray
 			usageBg = bgBlue
@@ -140,13 +277,27 @@ func FormatStatusLine(sess *types.SessionInput, git types.GitInfo, usage *types.
 			usageColor = colorGray
 			usageBg = bgBlue
 		} else {
-			usagePart = fmt.Sprintf("%.0f%%", usage.UsagePercent)
+			fields := map[string]string{"percent": fmt.Sprintf("%.0f%%", usage.UsagePercent), "bar": usageBar(usage.UsagePercent, cfg)}
 
 			// Add projection arrow if significantly off track
 			if !usage.ResetTime.IsZero() && usage.UsagePercent < 100 {
-				projection := calculateProjection(usage.UsagePercent, usage.ResetTime, 5*time.Hour, usageColor)
-				if projection != "" {
-					usagePart += projection
+				p := usage.Projection
+				if p == nil {
+					windowStart := usagepkg.WindowStart(usage.WindowStart, usage.ResetTime, 5*time.Hour)
+					p = usagepkg.Project(usage.UsagePercent, windowStart, usage.ResetTime, now())
+				}
+				fields["trend"] = projectionArrow(p, usageColor)
+			}
+
+			// Recent burn rate, once it rounds to at least a point an hour
+			if cfg.BurnRate && usage.UsagePercent < 100 && usage.BurnRate >= 0.5 {
+				fields["burn"] = fmt.Sprintf("+%.0f%%/h", usage.BurnRate)
+			}
+
+			// Limit reached before the window resets at that rate
+			if cfg.LimitETA {
+				if at := usagepkg.LimitAt(usage); at.After(now()) {
+					fields["eta"] = "→100% in " + formatDuration(at.Sub(now()))
 				}
 			}
 
@@ -155,131 +306,583 @@ func FormatStatusLine(sess *types.SessionInput, git types.GitInfo, usage *types.
 				if usage.UsagePercent >= 100 {
 					// At limit: show when it resets (local time)
 					resetLocal := usage.ResetTime.Local()
-					usagePart += fmt.Sprintf(" until %s", resetLocal.Format("15:04"))
+					fields["reset"] = fmt.Sprintf("until %s", resetLocal.Format("15:04"))
+					fields["hint"] = cfg.LimitHint
 				} else {
 					// Not at limit: show time remaining
-					remaining := time.Until(usage.ResetTime)
+					remaining := usage.ResetTime.Sub(now())
 					if remaining > 0 {
-						usagePart += " " + formatDuration(remaining)
+						fields["reset"] = formatDuration(remaining)
 					}
+					fields["hint"] = modelHint(cfg, usage, stats, sess)
 				}
 			}
+
+			// Newly started window
+			if cfg.FreshWindow > 0 && !usage.WindowStart.IsZero() &&
+				now().Sub(usage.WindowStart) < time.Duration(cfg.FreshWindow)*time.Minute {
+				fields["fresh"] = "fresh"
+			}
+
+			format := cfg.UsageFormat
+			if format == "" {
+				format = defaultUsageFormat
+			}
+			usagePart = formatWindow(format, fields)
 		}
 
-		parts = append(parts, colorize(usagePart, usageColor, usageBg, cfg))
+		segs["usage"] = colorize(usagePart, usageColor, usageBg, cfg)
+	}
 
-		// 7-day window
-		if usage.SevenDayPercent > 0 && !usage.SevenDayResetTime.IsZero() {
-			sevenDayColor := colorGreen
-			sevenDayBg := bgGreen
+	// API Usage info: 7-day window
+	if cfg.SegmentEnabled("usage7d") && usage != nil && usage.SevenDayPercent > 0 && !usage.SevenDayResetTime.IsZero() &&
+		usage.SevenDayPercent >= float64(cfg.SevenDayMin) {
+		sevenDayColor := colorGreen
+		sevenDayBg := bgGreen
 
-			// Grey out usage display when on API billing
-			if isApiBilling {
-				sevenDayColor = colorGray
-				sevenDayBg = bgBlue
-			} else if usage.SevenDayPercent >= 90 {
-				sevenDayColor = colorRed
-				sevenDayBg = bgRed
-			} else if usage.SevenDayPercent >= 75 {
-				sevenDayColor = colorYellow
-				sevenDayBg = bgYellow
-			}
+		// Grey out usage display when on API billing
+		if isApiBilling {
+			sevenDayColor = colorGray
+			sevenDayBg = bgBlue
+		} else if usage.SevenDayPercent >= 90 {
+			sevenDayColor = colorRed
+			sevenDayBg = bgRed
+		} else if usage.SevenDayPercent >= 75 {
+			sevenDayColor = colorYellow
+			sevenDayBg = bgYellow
+		}
 
-			sevenDayPart := fmt.Sprintf("%.0f%%", usage.SevenDayPercent)
+		fields := map[string]string{"percent": fmt.Sprintf("%.0f%%", usage.SevenDayPercent), "bar": usageBar(usage.SevenDayPercent, cfg)}
 
-			// Add projection arrow for 7-day window
-			if usage.SevenDayPercent < 100 {
-				projection := calculateProjection(usage.SevenDayPercent, usage.SevenDayResetTime, 7*24*time.Hour, sevenDayColor)
-				if projection != "" {
-					sevenDayPart += projection
-				}
+		// Add projection arrow for 7-day window
+		if usage.SevenDayPercent < 100 {
+			p := usage.SevenDayProjection
+			if p == nil {
+				windowStart := usagepkg.WindowStart(usage.SevenDayWindowStart, usage.SevenDayResetTime, 7*24*time.Hour)
+				p = usagepkg.Project(usage.SevenDayPercent, windowStart, usage.SevenDayResetTime, now())
 			}
+			fields["trend"] = projectionArrow(p, sevenDayColor)
+		}
 
-			// Reset time for 7-day window
-			if usage.SevenDayPercent >= 100 {
-				resetLocal := usage.SevenDayResetTime.Local()
-				sevenDayPart += fmt.Sprintf(" until %s", resetLocal.Format("Jan 2 15:04"))
-			} else {
-				// Not at limit: show time remaining in days/hours format
-				remaining := time.Until(usage.SevenDayResetTime)
-				if remaining > 0 {
-					sevenDayPart += " " + formatDurationDays(remaining)
-				}
+		// Reset time for 7-day window
+		if usage.SevenDayPercent >= 100 {
+			resetLocal := usage.SevenDayResetTime.Local()
+			fields["reset"] = fmt.Sprintf("until %s", resetLocal.Format("Jan 2 15:04"))
+		} else {
+			// Not at limit: show time remaining in days/hours format
+			remaining := usage.SevenDayResetTime.Sub(now())
+			if remaining > 0 {
+				fields["reset"] = formatDurationDays(remaining)
 			}
+		}
 
-			parts = append(parts, colorize(sevenDayPart, sevenDayColor, sevenDayBg, cfg))
+		format := cfg.SevenDayFormat
+		if format == "" {
+			format = defaultSevenDayFormat
 		}
+		sevenDayPart := formatWindow(format, fields)
+
+		segs["usage7d"] = colorize(sevenDayPart, sevenDayColor, sevenDayBg, cfg)
 	}
 
-	// Add info mode prefixes to main status line
-	if cfg.InfoMode == "emoji" {
-		for i, part := range parts {
-			switch i {
-			case 0:
-				parts[i] = "📁 " + part
-			case 1:
-				if git.IsRepo {
-					parts[i] = "🔀 " + part
-				}
+	// API Usage info: 7-day Opus window (only reported on plans with an Opus cap)
+	if cfg.SegmentEnabled("opus") && usage != nil && usage.OpusPercent > 0 && !usage.Unavailable {
+		opusColor, opusBg := colorGreen, bgGreen
+		if isApiBilling || usage.Stale {
+			opusColor, opusBg = colorGray, bgBlue
+		} else if usage.OpusPercent >= opusCritPercent {
+			opusColor, opusBg = colorRed, bgRed
+		} else if usage.OpusPercent >= opusWarnPercent {
+			opusColor, opusBg = colorYellow, bgYellow
+		}
+
+		opusPart := fmt.Sprintf("op %.0f%%", usage.OpusPercent)
+		if usage.OpusPercent >= 100 && !usage.OpusResetTime.IsZero() {
+			opusPart += fmt.Sprintf(" until %s", usage.OpusResetTime.Local().Format("Jan 2 15:04"))
+		}
+
+		segs["opus"] = colorize(opusPart, opusColor, opusBg, cfg)
+	}
+
+	// Tool activity
+	if cfg.SegmentEnabled("tools") && transcriptData != nil && cfg.ToolsStyle != "model" {
+		segs["tools"] = formatToolsActivity(transcriptData, cfg)
+	}
+
+	// Tool errors in a row
+	if cfg.SegmentEnabled("errors") && transcriptData != nil && transcriptData.ErrorStreak >= max(cfg.ErrorStreak, 1) {
+		segs["errors"] = colorize("⚠ "+plural(transcriptData.ErrorStreak, "error"), colorRed, bgRed, cfg)
+	}
+
+	// Counts of the tracked tools
+	if cfg.SegmentEnabled("summary") && transcriptData != nil {
+		var parts []string
+		for _, sc := range toolSummary(transcriptData, cfg) {
+			parts = append(parts, fmt.Sprintf("%s%d", sc.label, sc.count))
+		}
+		if len(parts) > 0 {
+			fg, bg := segmentColor("summary", colorCyan, bgCyan)
+			segs["summary"] = colorize(strings.Join(parts, " "), fg, bg, cfg)
+		}
+	}
+
+	// Agent activity
+	if cfg.SegmentEnabled("agents") && transcriptData != nil {
+		segs["agents"] = formatAgentsActivity(transcriptData, cfg)
+	}
+
+	// Todo progress
+	if cfg.SegmentEnabled("todos") && transcriptData != nil {
+		segs["todos"] = formatTodoProgress(transcriptData, cfg)
+	}
+
+	// Lines changed by the session's edits
+	if cfg.SegmentEnabled("changes") && transcriptData != nil && (transcriptData.LinesAdded > 0 || transcriptData.LinesRemoved > 0) {
+		fg, bg := segmentColor("changes", colorGreen, bgGreen)
+		segs["changes"] = colorize(fmt.Sprintf("+%d/-%d", transcriptData.LinesAdded, transcriptData.LinesRemoved), fg, bg, cfg)
+	}
+
+	// Session duration
+	if cfg.SegmentEnabled("duration") && transcriptData != nil {
+		if !transcriptData.SessionStart.IsZero() {
+			duration := formatSessionDuration(now().Sub(transcriptData.SessionStart))
+			fg, bg := segmentColor("duration", colorGray, bgBlue)
+			segs["duration"] = colorize(duration, fg, bg, cfg)
+		}
+	}
+
+	// Latest session note, dimmed
+	if cfg.SegmentEnabled("note") && data.Note != nil {
+		text := data.Note.Text
+		if len([]rune(text)) > maxNoteLength {
+			text = string([]rune(text)[:maxNoteLength-3]) + "..."
+		}
+		fg, bg := segmentColor("note", colorGray, bgBlue)
+		segs["note"] = colorize(text, fg, bg, cfg)
+	}
+
+	// Custom segments, colored with --colors like the built-in ones
+	for _, seg := range cfg.CustomSegments {
+		if !cfg.SegmentEnabled(seg.Name) {
+			continue
+		}
+		fg, bg := segmentColor(seg.Name, colorCyan, bgCyan)
+		text := data.Custom[seg.Name]
+		if seg.Expr != nil {
+			text = exprText(seg, data, colorFunc(fg, bg, cfg))
+		}
+		if text != "" {
+			segs[seg.Name] = colorize(text, fg, bg, cfg)
+		}
+	}
+
+	addInfoPrefixes(segs, cfg)
+	return applyRules(segs, data, cfg)
+}
+
+// shortSegments renders the abbreviated forms fitWidth falls back to before
+// dropping segments: the git segment with its branch name truncated and
+// without the latest commit's subject, the
+// cost segment with today's cost only and the subscription without tier
+// and profile. Only segments that have a shorter form are included.
+func shortSegments(data *types.StatusData) map[string]string {
+	cfg := config.Get()
+	if cfg.DisplayMode == "accessible" {
+		return nil
+	}
+
+	short := make(map[string]string)
+	if cfg.SegmentEnabled("git") && data.Git.IsRepo {
+		git := data.Git
+		git.LastSubject = ""
+		if branch := truncateBranch(git.Branch, maxBranchWidth); branch != git.Branch || data.Git.LastSubject != "" {
+			short["git"] = gitSegment(git, branch, cfg)
+		}
+	}
+	if stats := data.Stats; cfg.SegmentEnabled("cost") && stats != nil && (stats.DailyCost > 0 || stats.WeeklyCost > 0 || stats.MonthlyCost > 0) {
+		short["cost"] = costSegment(stats, cfg, true)
+	}
+	if cfg.SegmentEnabled("subscription") && data.Subscription != "" && (data.Tier != "" || data.Profile != "") {
+		fg, bg := segmentColor("subscription", colorGray, bgBlue)
+		short["subscription"] = colorize(data.Subscription, fg, bg, cfg)
+	}
+	addInfoPrefixes(short, cfg)
+	return short
+}
+
+// addInfoPrefixes puts the --info-mode labels in front of the segments
+func addInfoPrefixes(segs map[string]string, cfg *config.Config) {
+	for name, prefix := range infoPrefixes[cfg.InfoMode] {
+		if cfg.InfoMode == "emoji" {
+			prefix = emojiPrefix(prefix, cfg)
+		}
+		addPrefix(segs, name, prefix)
+	}
+}
+
+// gitSegment renders the git segment showing the given branch name
+func gitSegment(git types.GitInfo, branch string, cfg *config.Config) string {
+	gitPart := branch
+	if git.Scope != "" {
+		gitPart = git.Scope + " " + gitPart
+	}
+	if indicators := gitIndicators(git, cfg.GitStyle); indicators != "" {
+		gitPart += " " + indicators
+	}
+	if len(git.Upstreams) > 0 {
+		// Several remotes: name each one that has diverged
+		for _, u := range git.Upstreams {
+			if u.Ahead > 0 || u.Behind > 0 {
+				gitPart += " " + u.Remote + divergenceArrows(u.Ahead, u.Behind)
 			}
 		}
-	} else if cfg.InfoMode == "text" {
-		for i, part := range parts {
-			switch i {
-			case 0:
-				parts[i] = "Dir: " + part
-			case 1:
-				if git.IsRepo {
-					parts[i] = "Git: " + part
-				}
+	} else {
+		gitPart += divergenceArrows(git.Ahead, git.Behind)
+	}
+	if git.LastCommit != nil {
+		gitPart += " · " + commitAge(now().Sub(*git.LastCommit))
+		if subject := git.LastSubject; subject != "" {
+			if len([]rune(subject)) > maxSubjectLength {
+				subject = string([]rune(subject)[:maxSubjectLength-1]) + "…"
 			}
+			gitPart += " " + subject
 		}
 	}
+	fg, bg := segmentColor("git", colorMagenta, bgMagenta)
+	return colorize(gitPart, fg, bg, cfg)
+}
 
-	// Build the main status line
-	lines := []string{strings.Join(parts, " | ")}
+// maxSubjectLength is how much of the latest commit's subject the git
+// segment shows with --git-last-commit
+const maxSubjectLength = 30
+
+// commitAge says how long ago a commit was made in its largest unit, e.g.
+// "2h ago"
+func commitAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+}
 
-	// Build the activity line (tools, agents, todos, duration)
-	var activityParts []string
+// maxBranchWidth is how many characters of a branch name the abbreviated
+// git segment keeps
+const maxBranchWidth = 20
 
-	// Tool activity
-	if cfg.ShowTools && transcriptData != nil {
-		toolPart := formatToolsActivity(transcriptData, cfg)
-		if toolPart != "" {
-			activityParts = append(activityParts, toolPart)
+// truncateBranch shortens a branch name longer than limit characters: the
+// directories in front of it are cut to their first letter
+// ("feature/login" becomes "f/login"), then the end is replaced by "…"
+func truncateBranch(branch string, limit int) string {
+	if len([]rune(branch)) <= limit {
+		return branch
+	}
+	parts := strings.Split(branch, "/")
+	for i, part := range parts[:len(parts)-1] {
+		if r := []rune(part); len(r) > 1 {
+			parts[i] = string(r[:1])
 		}
 	}
+	branch = strings.Join(parts, "/")
+	if r := []rune(branch); len(r) > limit {
+		branch = string(r[:limit-1]) + "…"
+	}
+	return branch
+}
 
-	// Agent activity
-	if cfg.ShowAgents && transcriptData != nil {
-		agentPart := formatAgentsActivity(transcriptData, cfg)
-		if agentPart != "" {
-			activityParts = append(activityParts, agentPart)
+// costSegment renders the cost segment, colored by budget level. With
+// dailyOnly it shows just today's cost, for narrow terminals.
+func costSegment(stats *types.TokenStats, cfg *config.Config, dailyOnly bool) string {
+	parts, level := costPeriods(stats, cfg)
+	costPart := strings.Join(parts, " ")
+	if dailyOnly {
+		costPart = parts[len(parts)-1]
+	}
+	if stats.BudgetOut != nil {
+		// Forecast runs out of the monthly budget before month end
+		if stats.BudgetOut.After(now()) {
+			costPart += " budget out ~" + stats.BudgetOut.Local().Format("Jan 2")
+		} else {
+			costPart += " over budget"
 		}
+		level = max(level, budgetWarn)
+	}
+	costColor, costBg := colorCyan, bgCyan
+	switch level {
+	case budgetOK:
+		costColor, costBg = colorGreen, bgGreen
+	case budgetWarn:
+		costColor, costBg = colorYellow, bgYellow
+	case budgetOver:
+		costColor, costBg = colorRed, bgRed
 	}
+	return colorize(costPart, costColor, costBg, cfg)
+}
 
-	// Todo progress
-	if cfg.ShowTodos && transcriptData != nil {
-		todoPart := formatTodoProgress(transcriptData, cfg)
-		if todoPart != "" {
-			activityParts = append(activityParts, todoPart)
+// modelHint returns --model-hint while the 5h window is filling up and
+// today's spend is mostly on opus and sonnet, unless the session already
+// runs on haiku
+func modelHint(cfg *config.Config, usage *types.UsageCache, stats *types.TokenStats, sess *types.SessionInput) string {
+	if cfg.ModelHint == "" || usage.UsagePercent < float64(cfg.ModelHintUsage) || stats == nil {
+		return ""
+	}
+	if sess != nil && sess.Model != nil && strings.Contains(strings.ToLower(sess.Model.ID), "haiku") {
+		return ""
+	}
+	var total float64
+	for _, cost := range stats.DailyByModel {
+		total += cost
+	}
+	large := stats.DailyByModel["opus"] + stats.DailyByModel["sonnet"]
+	if total <= 0 || large*100 < total*float64(cfg.ModelHintShare) {
+		return ""
+	}
+	return cfg.ModelHint
+}
+
+// apiBillingPart labels usage under API key billing, with the
+// organization's spend this month when the Admin API provided it
+func apiBillingPart(usage *types.UsageCache) string {
+	switch {
+	case usage.MonthStart.IsZero():
+		return "API"
+	case usage.Stale:
+		return fmt.Sprintf("API ~$%.2f/m", usage.MonthSpend)
+	}
+	return fmt.Sprintf("API $%.2f/m", usage.MonthSpend)
+}
+
+// ShownDir returns the directory the dir segment shows: the session's
+// working directory, or with --dir-source project the directory Claude
+// Code was started in
+func ShownDir(data *types.StatusData) string {
+	if sess := data.Session; config.Get().DirSource == "project" && sess != nil && sess.Workspace != nil && sess.Workspace.ProjectDir != "" {
+		return sess.Workspace.ProjectDir
+	}
+	if data.Cwd != "" {
+		return data.Cwd
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+// compactSoon reports whether Claude Code is about to compact the
+// context: it holds more than 200k tokens or --compact-warn percent of the
+// window
+func compactSoon(sess *types.SessionInput, cfg *config.Config) bool {
+	if sess == nil {
+		return false
+	}
+	return sess.Exceeds200k || (sess.ContextWindow != nil && session.GetContextPercent(sess) >= float64(max(cfg.CompactWarn, 1)))
+}
+
+// isDefaultStyle reports whether an output style is Claude Code's default
+func isDefaultStyle(name string) bool {
+	return name == "" || strings.EqualFold(name, "default")
+}
+
+// displayDir shortens a directory for display: relative to home when
+// short enough, otherwise just its name
+func displayDir(cwd string) string {
+	dir := filepath.Base(cwd)
+	if home := config.HomeDir(); home != "" && strings.HasPrefix(cwd, home) {
+		dir = "~" + cwd[len(home):]
+		if len(dir) > 20 {
+			dir = "~/" + filepath.Base(cwd)
 		}
 	}
+	return dir
+}
 
-	// Session duration
-	if cfg.ShowDuration && transcriptData != nil {
-		duration := transcript.GetSessionDuration(transcriptData)
-		if duration != "" {
-			activityParts = append(activityParts, colorize(duration, colorGray, bgBlue, cfg))
+// infoPrefixes maps each info mode to the labels put in front of segments.
+// The icons mode uses Nerd Font glyphs, which need a patched font but keep a
+// fixed single-cell width where emoji often don't.
+var infoPrefixes = map[string]map[string]string{
+	"emoji": {
+		"dir":     "📁 ",
+		"git":     "🔀 ",
+		"tools":   "⚙ ",
+		"agents":  "🤖 ",
+		"note":    "📝 ",
+		"history": "📈 ",
+	},
+	"text": {
+		"dir":     "Dir: ",
+		"git":     "Git: ",
+		"tools":   "Tools: ",
+		"agents":  "Agents: ",
+		"note":    "Note: ",
+		"history": "7 days: ",
+	},
+	"icons": {
+		"dir":     "\uf07c ", // nf-fa-folder_open
+		"git":     "\ue0a0 ", // nf-pl-branch
+		"model":   "\uf4bc ", // nf-oct-cpu
+		"cost":    "\uf155 ", // nf-fa-dollar
+		"usage":   "\uf0e4 ", // nf-fa-tachometer
+		"usage7d": "\uf0e4 ",
+		"tools":   "\uf013 ",     // nf-fa-cog
+		"agents":  "\U000f06a9 ", // nf-md-robot
+		"note":    "\uf249 ",     // nf-fa-sticky_note
+		"history": "\uf201 ",     // nf-fa-line_chart
+	},
+}
+
+// maxNoteLength is how much of a note the note segment shows
+const maxNoteLength = 40
+
+// The Opus cap is much smaller than the overall weekly one, so warn earlier
+const (
+	opusWarnPercent = 50
+	opusCritPercent = 75
+)
+
+// defaultUsageBarWidth is the usage gauge's width without --usage-bar-width
+const defaultUsageBarWidth = 5
+
+// Default layouts of the usage window segments
+const (
+	defaultUsageFormat    = "{bar} {percent}{trend} {burn} {eta} {reset} {hint} {fresh}"
+	defaultSevenDayFormat = "{bar} {percent}{trend} {reset}"
+)
+
+// formatWindow fills a usage window template. Placeholders are {bar}
+// (gauge with --usage-bar), {percent}, {trend} (projection arrow), {burn}
+// (burn rate), {eta} (time to the limit), {reset} (time left, or reset
+// time at the limit), {hint} and {fresh}; spaces left by empty
+// placeholders are collapsed.
+func formatWindow(format string, fields map[string]string) string {
+	result := format
+	for _, name := range []string{"bar", "percent", "trend", "burn", "eta", "reset", "hint", "fresh"} {
+		result = strings.ReplaceAll(result, "{"+name+"}", fields[name])
+	}
+	return strings.Join(strings.Fields(result), " ")
+}
+
+// addPrefix prepends prefix to the named segment if it was rendered
+func addPrefix(segs map[string]string, name, prefix string) {
+	if segs[name] != "" {
+		segs[name] = prefix + segs[name]
+	}
+}
+
+// renderTemplate lays out rendered segments according to a format template.
+// Each line of the template is split on whitespace; a token like "{git}" is
+// replaced by that segment, and any text around the placeholder (e.g.
+// "cost:{cost}") is kept with it. Tokens whose segment is empty are dropped,
+// tokens without a placeholder are kept as literal text. The remaining
+// tokens are joined with sep and empty lines are omitted. A "{>}" token
+// right-aligns the rest of its line when the width is known (see
+// joinLines).
+func renderTemplate(format string, segs map[string]string, sep string) string {
+	return joinLines(templateLines(format, segs, nil), sep, 0, nil)
+}
+
+// alignMarker is the template token after which a line's segments are
+// right-aligned
+const alignMarker = "{>}"
+
+// templateToken is a rendered token of a template line and the segment it
+// shows (empty for literal text). short is the token with the segment's
+// abbreviated form, if it has one; align marks the alignMarker.
+type templateToken struct {
+	text    string
+	segment string
+	short   string
+	align   bool
+}
+
+// templateLines renders the tokens of each template line (see
+// renderTemplate), leaving out lines without any
+func templateLines(format string, segs, short map[string]string) [][]templateToken {
+	format = strings.ReplaceAll(format, `\n`, "\n")
+
+	var lines [][]templateToken
+	for _, line := range strings.Split(format, "\n") {
+		var tokens []templateToken
+		for _, token := range strings.Fields(line) {
+			if token == alignMarker {
+				tokens = append(tokens, templateToken{align: true})
+				continue
+			}
+			start := strings.Index(token, "{")
+			end := strings.Index(token, "}")
+			if start < 0 || end < start {
+				tokens = append(tokens, templateToken{text: token})
+				continue
+			}
+			name := token[start+1 : end]
+			seg := segs[name]
+			if seg == "" {
+				continue
+			}
+			t := templateToken{text: token[:start] + seg + token[end+1:], segment: name}
+			if s := short[name]; s != "" {
+				t.short = token[:start] + s + token[end+1:]
+			}
+			tokens = append(tokens, t)
+		}
+		if !blankLine(tokens) {
+			lines = append(lines, tokens)
 		}
 	}
+	return lines
+}
+
+// blankLine reports whether a line has nothing to show but alignment
+// markers
+func blankLine(tokens []templateToken) bool {
+	for _, token := range tokens {
+		if !token.align {
+			return false
+		}
+	}
+	return true
+}
+
+// joinLines joins each line's tokens with sep and the lines with newlines.
+// With a width, the tokens after an alignment marker are padded to end at
+// the line's last cell, measured by displayWidth; lines too wide for that,
+// and all lines without a width, are joined as if there was no marker.
+func joinLines(lines [][]templateToken, sep string, width int, overrides map[rune]int) string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = alignTokens(line, sep, width, overrides)
+	}
+	return strings.Join(out, "\n")
+}
 
-	// Add activity line if there's anything to show
-	if len(activityParts) > 0 {
-		lines = append(lines, strings.Join(activityParts, " | "))
+// alignTokens joins a line's tokens, right-aligning those after its first
+// alignment marker in width cells
+func alignTokens(tokens []templateToken, sep string, width int, overrides map[rune]int) string {
+	marker := slices.IndexFunc(tokens, func(t templateToken) bool { return t.align })
+	if width <= 0 || marker < 0 {
+		return joinTokens(tokens, sep)
 	}
+	left, right := joinTokens(tokens[:marker], sep), joinTokens(tokens[marker+1:], sep)
+	if right == "" {
+		return left
+	}
+	pad := width - displayWidth(left, overrides) - displayWidth(right, overrides)
+	if left != "" && pad < displayWidth(sep, overrides) {
+		return left + sep + right
+	}
+	return left + strings.Repeat(" ", max(pad, 0)) + right
+}
 
-	return strings.Join(lines, "\n")
+// joinTokens joins tokens with sep, leaving out alignment markers
+func joinTokens(tokens []templateToken, sep string) string {
+	texts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !token.align {
+			texts = append(texts, token.text)
+		}
+	}
+	return strings.Join(texts, sep)
 }
 
 func colorize(text, fgColor, bgColor string, cfg *config.Config) string {
@@ -311,81 +914,120 @@ func formatModelName(model string) string {
 	return model
 }
 
+// formatDuration formats d in hours and minutes: 2h29m
 func formatDuration(d time.Duration) string {
-	if d < 0 {
-		return "0m"
-	}
-	hours := int(d.Hours())
-	minutes := int(d.Minutes()) % 60
-	if hours > 0 {
-		return fmt.Sprintf("%dh%dm", hours, minutes)
-	}
-	return fmt.Sprintf("%dm", minutes)
+	return formatSpan(d, false, false)
 }
 
+// formatDurationDays formats d in days and hours, or hours and minutes
+// when shorter than a day: 3d22h
 func formatDurationDays(d time.Duration) string {
-	if d < 0 {
-		return "0m"
+	return formatSpan(d, true, false)
+}
+
+// formatSessionDuration formats how long a session has been running
+func formatSessionDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
 	}
+	return formatSpan(d, false, false)
+}
 
-	days := int(d.Hours()) / 24
-	hours := int(d.Hours()) % 24
+// Unit names of the compact and verbose --duration-format styles
+var (
+	compactUnits = [4][2]string{{"d", "d"}, {"h", "h"}, {"m", "m"}, {"s", "s"}}
+	verboseUnits = [4][2]string{{" day", " days"}, {" hr", " hr"}, {" min", " min"}, {" sec", " sec"}}
+)
 
-	if days > 0 {
-		return fmt.Sprintf("%dd%dh", days, hours)
+// formatSpan formats d in the --duration-format style: compact (2h29m),
+// verbose (2 hr 29 min) or clock (2:29). Compact and verbose show the two
+// largest units, down to minutes or to seconds; clock shows h:mm or m:ss.
+// withDays counts whole days separately.
+func formatSpan(d time.Duration, withDays, seconds bool) string {
+	if d < 0 {
+		d = 0
+	}
+	days := 0
+	if withDays {
+		days = int(d / (24 * time.Hour))
+		d %= 24 * time.Hour
+	}
+	h := int(d / time.Hour)
+	m := int(d % time.Hour / time.Minute)
+	s := int(d % time.Minute / time.Second)
+
+	style := config.Get().DurationFormat
+	if style == "clock" {
+		clock := fmt.Sprintf("%d:%02d", h, m)
+		switch {
+		case seconds && h > 0:
+			clock = fmt.Sprintf("%d:%02d:%02d", h, m, s)
+		case seconds:
+			clock = fmt.Sprintf("%d:%02d", m, s)
+		}
+		if days > 0 {
+			return fmt.Sprintf("%dd %s", days, clock)
+		}
+		return clock
 	}
 
-	// Less than a day, use regular format
-	minutes := int(d.Minutes()) % 60
-	if hours > 0 {
-		return fmt.Sprintf("%dh%dm", hours, minutes)
+	units, sep := compactUnits, ""
+	if style == "verbose" {
+		units, sep = verboseUnits, " "
 	}
-	return fmt.Sprintf("%dm", minutes)
+	values := []int{days, h, m, s}
+	if !seconds {
+		values = values[:3]
+	}
+	// The largest non-zero unit and the one below it
+	i := 0
+	for i < len(values)-1 && values[i] == 0 {
+		i++
+	}
+	unit := func(i int) string {
+		if values[i] == 1 {
+			return fmt.Sprintf("%d%s", values[i], units[i][0])
+		}
+		return fmt.Sprintf("%d%s", values[i], units[i][1])
+	}
+	if i == len(values)-1 {
+		return unit(i)
+	}
+	return unit(i) + sep + unit(i+1)
 }
 
+// calculateProjection assumes the window started exactly totalWindow before resetTime
 func calculateProjection(usagePercent float64, resetTime time.Time, totalWindow time.Duration, baseColor string) string {
-	// Don't show projection at 100% - we show reset time instead
-	if usagePercent >= 100 {
-		return ""
-	}
-
-	remaining := time.Until(resetTime)
-
-	if remaining <= 0 {
-		return ""
-	}
+	return calculateProjectionFrom(usagePercent, resetTime.Add(-totalWindow), resetTime, baseColor)
+}
 
-	// Time elapsed = totalWindow - remaining
-	elapsed := totalWindow - remaining
+// calculateProjectionFrom compares usage against a linear schedule running
+// from windowStart to resetTime and returns an arrow if it is off track
+func calculateProjectionFrom(usagePercent float64, windowStart, resetTime time.Time, baseColor string) string {
+	return projectionArrow(usagepkg.Project(usagePercent, windowStart, resetTime, now()), baseColor)
+}
 
-	if elapsed <= 0 || totalWindow <= 0 {
+// projectionArrow renders a projection as an arrow graded by severity
+func projectionArrow(p *types.Projection, baseColor string) string {
+	if p == nil {
 		return ""
 	}
 
-	// Expected usage at this point: elapsed / total * 100
-	expectedPercent := (float64(elapsed) / float64(totalWindow)) * 100
-
-	// Calculate deviation ranges
-	lowerBound5 := expectedPercent * 0.95
-	upperBound5 := expectedPercent * 1.05
-	lowerBound25 := expectedPercent * 0.75
-	upperBound25 := expectedPercent * 1.25
-
-	// Determine arrow based on deviation
 	var arrow string
-	if usagePercent > upperBound25 {
+	switch p.Status {
+	case types.ProjectionWayOver:
 		// >25% over: wide-headed arrow
 		arrow = " ⮝"
-	} else if usagePercent > upperBound5 {
+	case types.ProjectionOver:
 		// 5-25% over: outline triangle
 		arrow = " △"
-	} else if usagePercent < lowerBound25 {
+	case types.ProjectionWayUnder:
 		// >25% under: wide-headed arrow
 		arrow = " ⮟"
-	} else if usagePercent < lowerBound5 {
+	case types.ProjectionUnder:
 		// 5-25% under: outline triangle
 		arrow = " ▽"
-	} else {
+	default:
 		// Within ±5%: on track, no arrow
 		return ""
 	}
@@ -393,7 +1035,7 @@ func calculateProjection(usagePercent float64, resetTime time.Time, totalWindow
 	// Color the arrow
 	if baseColor == colorGray {
 		return arrow // Plain arrow, parent will colorize grey
-	} else if usagePercent > upperBound5 {
+	} else if p.Status == types.ProjectionOver || p.Status == types.ProjectionWayOver {
 		// Trending over: use red
 		return " " + colorRed + strings.TrimSpace(arrow) + baseColor
 	} else {
@@ -427,6 +1069,173 @@ func shortenTier(tier string) string {
 	return tier
 }
 
+// modelFamilyAbbrevs are the short names used in the cost breakdown
+var modelFamilyAbbrevs = map[string]string{"opus": "op", "sonnet": "so", "haiku": "ha", "other": "other"}
+
+// modelBreakdown renders a period's cost by model family, e.g.
+// " (op $9.10, so $3.20)", leaving out families without cost
+func modelBreakdown(byModel map[string]float64) string {
+	var parts []string
+	for _, family := range cost.ModelFamilies {
+		if c := byModel[family]; c >= 0.005 {
+			parts = append(parts, fmt.Sprintf("%s $%.2f", modelFamilyAbbrevs[family], c))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// Budget levels of the cost segment, from no budget set to over budget
+const (
+	budgetNone = iota
+	budgetOK
+	budgetWarn
+	budgetOver
+)
+
+// budgetWarnPercent is the share of a budget from which the cost segment
+// turns yellow
+const budgetWarnPercent = 75
+
+// costPeriods renders the monthly, weekly and daily costs in dollars, tokens
+// or both, the monthly one with its month-end forecast, each followed by the share of its budget with
+// --budget-percent, and returns the highest
+// budget level among them
+func costPeriods(stats *types.TokenStats, cfg *config.Config) ([]string, int) {
+	periods := []struct {
+		cost      float64
+		tokens    int64
+		byModel   map[string]float64
+		budget    float64
+		projected float64
+		unit      string
+	}{
+		{stats.MonthlyCost, stats.MonthlyTokens, stats.MonthlyByModel, cfg.BudgetMonthly, stats.MonthProjected, "/m"},
+		{stats.WeeklyCost, stats.WeeklyTokens, stats.WeeklyByModel, cfg.BudgetWeekly, 0, "/w"},
+		{stats.DailyCost, stats.DailyTokens, stats.DailyByModel, cfg.BudgetDaily, 0, "/d"},
+	}
+
+	level := budgetNone
+	parts := make([]string, 0, len(periods))
+	for _, p := range periods {
+		var part string
+		if cfg.CostUnit != "tokens" {
+			part = fmt.Sprintf("$%.2f", p.cost)
+			if cfg.CostBreakdown {
+				part += modelBreakdown(p.byModel)
+			}
+			if cfg.CostProjection && p.projected >= p.cost+1 {
+				part += fmt.Sprintf(" → ~$%.0f", p.projected)
+			}
+		}
+		if cfg.CostUnit == "tokens" || cfg.CostUnit == "both" {
+			part = strings.TrimSpace(part + " " + formatTokens(p.tokens) + " tok")
+		}
+		part += p.unit
+		if p.budget > 0 {
+			percent := p.cost / p.budget * 100
+			switch {
+			case percent >= 100:
+				level = max(level, budgetOver)
+			case percent >= budgetWarnPercent:
+				level = max(level, budgetWarn)
+			default:
+				level = max(level, budgetOK)
+			}
+			if cfg.BudgetPercent {
+				part += fmt.Sprintf(" (%.0f%%)", percent)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts, level
+}
+
+// formatTokens abbreviates a token count: 850, 12.3K, 456K, 1.2M, 3.4B
+func formatTokens(n int64) string {
+	units := []struct {
+		size   float64
+		suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "K"}}
+	for _, u := range units {
+		if v := float64(n) / u.size; v >= 1 {
+			if v >= 100 {
+				return fmt.Sprintf("%.0f%s", v, u.suffix)
+			}
+			return fmt.Sprintf("%.1f%s", v, u.suffix)
+		}
+	}
+	return fmt.Sprint(n)
+}
+
+// divergenceArrows renders commits ahead and behind, e.g. " ↑2 ↓1"
+func divergenceArrows(ahead, behind int) string {
+	arrows := ""
+	if ahead > 0 {
+		arrows += fmt.Sprintf(" ↑%d", ahead)
+	}
+	if behind > 0 {
+		arrows += fmt.Sprintf(" ↓%d", behind)
+	}
+	return arrows
+}
+
+// sparkBlocks are the sparkline levels, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values as block heights relative to the largest, e.g.
+// "▁▂▅▇▃▁▂". Empty when all values are zero.
+func sparkline(values []float64) string {
+	highest := 0.0
+	for _, v := range values {
+		highest = max(highest, v)
+	}
+	if highest <= 0 {
+		return ""
+	}
+	blocks := make([]rune, len(values))
+	for i, v := range values {
+		blocks[i] = sparkBlocks[int(math.Round(v/highest*float64(len(sparkBlocks)-1)))]
+	}
+	return string(blocks)
+}
+
+// gitIndicators renders the working tree state: counts like "!3 +2 ?5"
+// (modified, staged, untracked), or with style "flags" just the symbols
+// ("?+!") without counts. A status that timed out shows as "…".
+func gitIndicators(git types.GitInfo, style string) string {
+	if git.StatusUnknown {
+		return "…"
+	}
+	if style == "flags" {
+		indicators := ""
+		if git.Untracked > 0 {
+			indicators += "?"
+		}
+		if git.Staged > 0 {
+			indicators += "+"
+		}
+		if git.Modified > 0 {
+			indicators += "!"
+		}
+		return indicators
+	}
+
+	var parts []string
+	if git.Modified > 0 {
+		parts = append(parts, fmt.Sprintf("!%d", git.Modified))
+	}
+	if git.Staged > 0 {
+		parts = append(parts, fmt.Sprintf("+%d", git.Staged))
+	}
+	if git.Untracked > 0 {
+		parts = append(parts, fmt.Sprintf("?%d", git.Untracked))
+	}
+	return strings.Join(parts, " ")
+}
+
 // formatContextBar renders a visual context window usage bar
 func formatContextBar(percent float64, cfg *config.Config) string {
 	const barWidth = 10
@@ -456,7 +1265,49 @@ func formatContextBar(percent float64, cfg *config.Config) string {
 	return colorize(text, fgColor, bgColor, cfg)
 }
 
+// usageBar draws a usage percentage as a gauge of --usage-bar-width cells:
+// blocks (▰▰▰▱▱) or braille (⣿⣿⡇⣀⣀, two steps per cell). It is empty
+// without --usage-bar.
+func usageBar(percent float64, cfg *config.Config) string {
+	width := cfg.UsageBarWidth
+	if width <= 0 {
+		width = defaultUsageBarWidth
+	}
+	steps := 1
+	if cfg.UsageBar == "braille" {
+		steps = 2
+	}
+	filled := min(max(int(math.Round(percent/100*float64(width*steps))), 0), width*steps)
+
+	switch cfg.UsageBar {
+	case "blocks":
+		return strings.Repeat("▰", filled) + strings.Repeat("▱", width-filled)
+	case "braille":
+		bar := strings.Repeat("⣿", filled/2)
+		if filled%2 == 1 {
+			bar += "⡇"
+		}
+		return bar + strings.Repeat("⣀", width-(filled+1)/2)
+	}
+	return ""
+}
+
 // formatToolsActivity renders running and completed tools
+// inlineTool returns the most recently started running tool, shown after
+// the model name instead of the tools segment with --tools-style model
+func inlineTool(data *types.TranscriptData, cfg *config.Config) *types.ToolEntry {
+	if cfg.ToolsStyle != "model" || !cfg.SegmentEnabled("tools") {
+		return nil
+	}
+	var latest *types.ToolEntry
+	for _, tool := range transcript.GetRunningTools(data) {
+		if latest == nil || tool.StartTime.After(latest.StartTime) {
+			latest = &tool
+		}
+	}
+	return latest
+}
+
 func formatToolsActivity(data *types.TranscriptData, cfg *config.Config) string {
 	if data == nil {
 		return ""
@@ -470,47 +1321,26 @@ func formatToolsActivity(data *types.TranscriptData, cfg *config.Config) string
 		if i >= 2 {
 			break
 		}
-		toolStr := colorize("◐", colorYellow, bgYellow, cfg) + " " + colorize(tool.Name, colorCyan, bgCyan, cfg)
+		toolStr := colorize(runningMarker(cfg), colorYellow, bgYellow, cfg) + " " + colorize(tool.Name, colorCyan, bgCyan, cfg)
 		if tool.Target != "" {
 			toolStr += " " + colorize(tool.Target, colorGray, bgBlue, cfg)
 		}
 		parts = append(parts, toolStr)
 	}
 
-	// Show completed tool counts
-	counts := transcript.GetCompletedToolCounts(data)
-	if len(counts) > 0 {
-		// Sort by count descending
-		type toolCount struct {
-			name  string
-			count int
-		}
-		var sorted []toolCount
-		for name, count := range counts {
-			sorted = append(sorted, toolCount{name, count})
-		}
-		sort.Slice(sorted, func(i, j int) bool {
-			return sorted[i].count > sorted[j].count
-		})
-
-		// Show top 4
-		var completedParts []string
-		for i, tc := range sorted {
-			if i >= 4 {
-				break
-			}
-			if tc.count > 1 {
-				completedParts = append(completedParts, fmt.Sprintf("%s×%d", tc.name, tc.count))
-			} else {
-				completedParts = append(completedParts, tc.name)
-			}
-		}
-
-		if len(completedParts) > 0 {
-			completedStr := colorize("✓", colorGreen, bgGreen, cfg) + " " + strings.Join(completedParts, ", ")
-			parts = append(parts, completedStr)
+	// Show completed tool counts (top 4)
+	var completedParts []string
+	for _, tc := range topCompletedTools(data, 4) {
+		if tc.count > 1 {
+			completedParts = append(completedParts, fmt.Sprintf("%s×%d", tc.name, tc.count))
+		} else {
+			completedParts = append(completedParts, tc.name)
 		}
 	}
+	if len(completedParts) > 0 {
+		completedStr := colorize("✓", colorGreen, bgGreen, cfg) + " " + strings.Join(completedParts, ", ")
+		parts = append(parts, completedStr)
+	}
 
 	if len(parts) == 0 {
 		return ""
@@ -519,6 +1349,85 @@ func formatToolsActivity(data *types.TranscriptData, cfg *config.Config) string
 	return strings.Join(parts, " | ")
 }
 
+// spinnerFrames are the frames of the --spinner animation
+var spinnerFrames = []string{"◐", "◓", "◑", "◒"}
+
+// spinnerFrameTime is how long each frame shows. Claude Code renders the
+// statusline at most every 300ms, so successive renders step through the
+// frames.
+const spinnerFrameTime = 250 * time.Millisecond
+
+// runningMarker returns the marker in front of running tools and agents:
+// with --spinner the frame for the current time, else a still ◐
+func runningMarker(cfg *config.Config) string {
+	if !cfg.Spinner {
+		return spinnerFrames[0]
+	}
+	return spinnerFrames[now().UnixMilli()/spinnerFrameTime.Milliseconds()%int64(len(spinnerFrames))]
+}
+
+// toolCount is how often a tool completed
+type toolCount struct {
+	name  string
+	count int
+}
+
+// topCompletedTools returns up to n completed tools, most used first
+func topCompletedTools(data *types.TranscriptData, n int) []toolCount {
+	var sorted []toolCount
+	for name, count := range transcript.GetCompletedToolCounts(data) {
+		sorted = append(sorted, toolCount{name, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// summaryCount is how often the tools of a --summary-tools entry completed
+type summaryCount struct {
+	label string // e.g. "E"
+	tool  string // the entry's first tool, e.g. "Edit"
+	count int
+}
+
+// toolSummary counts the completed calls of each --summary-tools entry over
+// the whole session, in the order listed. Entries without calls are left out, and nothing is
+// returned below --summary-min calls in total.
+func toolSummary(data *types.TranscriptData, cfg *config.Config) []summaryCount {
+	counts := data.ToolCounts
+	var summary []summaryCount
+	total := 0
+	for _, entry := range strings.Split(cfg.SummaryTools, ",") {
+		tools, label, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if tools == "" {
+			continue
+		}
+		if label == "" {
+			label = tools[:1]
+		}
+		n := 0
+		for _, tool := range strings.Split(tools, "+") {
+			n += counts[strings.TrimSpace(tool)]
+		}
+		if n > 0 {
+			first, _, _ := strings.Cut(tools, "+")
+			summary = append(summary, summaryCount{label, strings.TrimSpace(first), n})
+			total += n
+		}
+	}
+	if total < cfg.SummaryMin {
+		return nil
+	}
+	return summary
+}
+
 // formatAgentsActivity renders running agents
 func formatAgentsActivity(data *types.TranscriptData, cfg *config.Config) string {
 	if data == nil {
@@ -535,12 +1444,12 @@ func formatAgentsActivity(data *types.TranscriptData, cfg *config.Config) string
 		if i >= 2 {
 			break
 		}
-		agentStr := colorize("◐", colorYellow, bgYellow, cfg) + " " + colorize(agent.Type, colorMagenta, bgMagenta, cfg)
+		agentStr := colorize(runningMarker(cfg), colorYellow, bgYellow, cfg) + " " + colorize(agent.Type, colorMagenta, bgMagenta, cfg)
 		if agent.Description != "" {
 			agentStr += ": " + colorize(agent.Description, colorGray, bgBlue, cfg)
 		}
 		// Show elapsed time
-		elapsed := time.Since(agent.StartTime)
+		elapsed := now().Sub(agent.StartTime)
 		if elapsed > 0 {
 			agentStr += " " + colorize("("+formatShortDuration(elapsed)+")", colorGray, bgBlue, cfg)
 		}
@@ -582,20 +1491,11 @@ func formatTodoProgress(data *types.TranscriptData, cfg *config.Config) string {
 	return colorize("▸", colorYellow, bgYellow, cfg) + " " + colorize(progress, colorGray, bgBlue, cfg)
 }
 
-// formatShortDuration formats duration for display (compact)
+// formatShortDuration formats how long something has been running, down
+// to seconds
 func formatShortDuration(d time.Duration) string {
 	if d < time.Second {
 		return "<1s"
 	}
-	if d < time.Minute {
-		return fmt.Sprintf("%ds", int(d.Seconds()))
-	}
-	mins := int(d.Minutes())
-	secs := int(d.Seconds()) % 60
-	if mins < 60 {
-		return fmt.Sprintf("%dm%ds", mins, secs)
-	}
-	hours := mins / 60
-	mins = mins % 60
-	return fmt.Sprintf("%dh%dm", hours, mins)
+	return formatSpan(d, false, true)
 }
@@ -1,11 +1,16 @@
 package output
 
 import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/expr"
 	"github.com/erwint/claude-code-statusline/internal/types"
 )
 
@@ -37,9 +42,9 @@ func TestFullStatusLine(t *testing.T) {
 		gitInfo := types.GitInfo{
 			IsRepo:       true,
 			Branch:       "feature/test-branch",
-			HasModified:  true,
-			HasStaged:    true,
-			HasUntracked: true,
+			Modified:     2,
+			Staged:       1,
+			Untracked:    4,
 			Ahead:        3,
 			Behind:       1,
 		}
@@ -106,9 +111,9 @@ func TestGitStates(t *testing.T) {
 			gitInfo: types.GitInfo{
 				IsRepo:       true,
 				Branch:       "develop",
-				HasModified:  true,
-				HasStaged:    true,
-				HasUntracked: true,
+				Modified:     2,
+				Staged:       1,
+				Untracked:    4,
 			},
 			contains: []string{"develop", "!", "+", "?"},
 		},
@@ -132,6 +137,39 @@ func TestGitStates(t *testing.T) {
 			contains: []string{"↑10"},
 			notContains: []string{"↓"},
 		},
+		{
+			name: "monorepo subproject",
+			gitInfo: types.GitInfo{
+				IsRepo:   true,
+				Branch:   "main",
+				Scope:    "mono:packages/api",
+				Modified: 1,
+			},
+			contains: []string{"mono:packages/api main !1"},
+		},
+		{
+			name: "fork and upstream remotes",
+			gitInfo: types.GitInfo{
+				IsRepo: true,
+				Branch: "topic",
+				Ahead:  2,
+				Upstreams: []types.Upstream{
+					{Remote: "origin", Ahead: 2},
+					{Remote: "upstream", Ahead: 3, Behind: 14},
+				},
+			},
+			contains: []string{"topic origin ↑2 upstream ↑3 ↓14"},
+		},
+		{
+			name: "in sync with one of several remotes",
+			gitInfo: types.GitInfo{
+				IsRepo:    true,
+				Branch:    "topic",
+				Upstreams: []types.Upstream{{Remote: "origin"}, {Remote: "upstream", Behind: 4}},
+			},
+			contains:    []string{"topic upstream ↓4"},
+			notContains: []string{"origin"},
+		},
 		{
 			name: "not a git repo",
 			gitInfo: types.GitInfo{
@@ -168,6 +206,30 @@ func TestGitStates(t *testing.T) {
 	}
 }
 
+func TestGitIndicators(t *testing.T) {
+	tests := []struct {
+		name  string
+		git   types.GitInfo
+		style string
+		want  string
+	}{
+		{"clean", types.GitInfo{}, "counts", ""},
+		{"counts", types.GitInfo{Modified: 3, Staged: 2, Untracked: 5}, "counts", "!3 +2 ?5"},
+		{"default style is counts", types.GitInfo{Staged: 40}, "", "+40"},
+		{"flags", types.GitInfo{Modified: 3, Staged: 2, Untracked: 5}, "flags", "?+!"},
+		{"flags partial", types.GitInfo{Modified: 12}, "flags", "!"},
+		{"status timed out", types.GitInfo{StatusUnknown: true}, "counts", "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gitIndicators(tt.git, tt.style); got != tt.want {
+				t.Errorf("gitIndicators(%+v, %q) = %q, want %q", tt.git, tt.style, got, tt.want)
+			}
+		})
+	}
+}
+
 // TestUsageStates tests various API usage scenarios
 func TestUsageStates(t *testing.T) {
 	tests := []struct {
@@ -308,6 +370,9 @@ func TestUsageStates(t *testing.T) {
 
 // TestCostScenarios tests various cost data scenarios
 func TestCostScenarios(t *testing.T) {
+	budgetOut := time.Now().Add(48 * time.Hour)
+	budgetGone := time.Now().Add(-time.Hour)
+
 	tests := []struct {
 		name     string
 		stats    *types.TokenStats
@@ -346,6 +411,23 @@ func TestCostScenarios(t *testing.T) {
 			},
 			contains: []string{"$1234.56/m"},
 		},
+		{
+			name: "budget runs out this month",
+			stats: &types.TokenStats{
+				MonthlyCost: 420,
+				BudgetOut:   &budgetOut,
+			},
+			contains: []string{"$420.00/m", "budget out ~" + budgetOut.Format("Jan 2")},
+		},
+		{
+			name: "budget already exceeded",
+			stats: &types.TokenStats{
+				MonthlyCost: 520,
+				BudgetOut:   &budgetGone,
+			},
+			contains:    []string{"$0.00/d over budget"},
+			notContains: []string{"budget out"},
+		},
 	}
 
 	cfg := &config.Config{
@@ -375,6 +457,229 @@ func TestCostScenarios(t *testing.T) {
 	}
 }
 
+func TestCostBreakdown(t *testing.T) {
+	stats := &types.TokenStats{
+		DailyCost:      12.30,
+		WeeklyCost:     40,
+		MonthlyCost:    90,
+		DailyByModel:   map[string]float64{"opus": 9.10, "sonnet": 3.20},
+		WeeklyByModel:  map[string]float64{"opus": 40},
+		MonthlyByModel: map[string]float64{"opus": 80, "haiku": 6, "other": 4},
+	}
+
+	withConfig(t, &config.Config{NoColor: true, CostBreakdown: true}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, nil, stats, "", "", false, nil)
+		want := "$90.00 (op $80.00, ha $6.00, other $4.00)/m $40.00 (op $40.00)/w $12.30 (op $9.10, so $3.20)/d"
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %q, got %q", want, result)
+		}
+	})
+
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, nil, stats, "", "", false, nil)
+		if strings.Contains(result, "op $") {
+			t.Errorf("Expected no breakdown by default, got %q", result)
+		}
+	})
+}
+
+func TestCostBudgets(t *testing.T) {
+	stats := &types.TokenStats{DailyCost: 8.20, WeeklyCost: 40, MonthlyCost: 90}
+
+	tests := []struct {
+		name  string
+		cfg   *config.Config
+		color string
+		want  string
+	}{
+		{"no budget", &config.Config{}, colorCyan, "$90.00/m $40.00/w $8.20/d"},
+		{"within budget", &config.Config{BudgetDaily: 20, BudgetWeekly: 100}, colorGreen, "$90.00/m $40.00/w $8.20/d"},
+		{"daily nearly spent", &config.Config{BudgetDaily: 10, BudgetWeekly: 100, BudgetPercent: true}, colorYellow, "$90.00/m $40.00/w (40%) $8.20/d (82%)"},
+		{"weekly exceeded", &config.Config{BudgetDaily: 10, BudgetWeekly: 35}, colorRed, "$90.00/m $40.00/w $8.20/d"},
+		{"monthly percent", &config.Config{BudgetMonthly: 300, BudgetPercent: true}, colorGreen, "$90.00/m (30%) $40.00/w $8.20/d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Segments = "cost"
+			withConfig(t, tt.cfg, func() {
+				result := FormatStatusLine(nil, types.GitInfo{}, nil, stats, "", "", false, nil)
+				if want := tt.color + tt.want + colorReset; result != want {
+					t.Errorf("Expected %q, got %q", want, result)
+				}
+			})
+		})
+	}
+}
+
+func TestAccessible(t *testing.T) {
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return at })
+	defer SetClock(time.Now)
+
+	data := &types.StatusData{
+		Cwd:     "/srv/acme",
+		Session: &types.SessionInput{Model: &types.SessionModel{DisplayName: "Opus 4.5"}},
+		Git:     types.GitInfo{IsRepo: true, Branch: "main", Modified: 2, Ahead: 3, Behind: 1},
+		Usage: &types.UsageCache{
+			UsagePercent: 45, ResetTime: at.Add(2 * time.Hour),
+			Projection: &types.Projection{Status: types.ProjectionOnTrack},
+		},
+		Stats:        &types.TokenStats{DailyCost: 8.2, WeeklyCost: 40, MonthlyCost: 90},
+		Subscription: "max",
+		Tier:         "default_claude_max_20x",
+		Transcript: &types.TranscriptData{
+			SessionStart: at.Add(-95 * time.Minute),
+			Tools: []types.ToolEntry{
+				{Name: "Bash", Target: "go test", Status: "running"},
+				{Name: "Read", Status: "completed"},
+				{Name: "Read", Status: "completed"},
+				{Name: "Edit", Status: "completed"},
+			},
+			Todos: []types.TodoItem{{Subject: "write docs", Status: "in_progress"}, {Subject: "fix", Status: "completed"}},
+		},
+	}
+
+	cfg := &config.Config{DisplayMode: "accessible", InfoMode: "icons", BudgetDaily: 10, ShowTools: true, ShowTodos: true, ShowDuration: true}
+	withConfig(t, cfg, func() {
+		want := "directory acme; Git branch main, 2 modified, 3 commits ahead, 1 commit behind; model Opus 4.5; plan max 20x; " +
+			"cost 90.00 dollars this month, 40.00 dollars this week, 8.20 dollars today, 82 percent of budget; " +
+			"usage 45 percent, resets in 2 hours\n" +
+			"running Bash on go test; completed Read 2 times, Edit; 1 of 2 todos done, current: write docs; session 1 hour 35 minutes"
+		if got := Format(data); got != want {
+			t.Errorf("Format() =\n%q\nwant\n%q", got, want)
+		}
+	})
+}
+
+func TestSpokenDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "less than a second"},
+		{45 * time.Second, "45 seconds"},
+		{75 * time.Second, "1 minute 15 seconds"},
+		{2 * time.Hour, "2 hours"},
+		{90 * time.Minute, "1 hour 30 minutes"},
+		{80 * time.Hour, "3 days 8 hours"},
+		{24*time.Hour + 30*time.Minute, "1 day"},
+	}
+
+	for _, tt := range tests {
+		if got := spokenDuration(tt.d); got != tt.want {
+			t.Errorf("spokenDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestCostProjection(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   *config.Config
+		stats *types.TokenStats
+		want  string
+	}{
+		{"projected", &config.Config{CostProjection: true}, &types.TokenStats{MonthlyCost: 350, DailyCost: 20, MonthProjected: 610.4}, "$350.00 → ~$610/m $0.00/w $20.00/d"},
+		{"with budget percent", &config.Config{CostProjection: true, BudgetMonthly: 500, BudgetPercent: true}, &types.TokenStats{MonthlyCost: 350, MonthProjected: 610.4}, "$350.00 → ~$610/m (70%)"},
+		{"nothing left to add", &config.Config{CostProjection: true}, &types.TokenStats{MonthlyCost: 350, MonthProjected: 350.5}, "$350.00/m"},
+		{"disabled", &config.Config{}, &types.TokenStats{MonthlyCost: 350, MonthProjected: 610.4}, "$350.00/m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.NoColor = true
+			tt.cfg.Segments = "cost"
+			withConfig(t, tt.cfg, func() {
+				result := FormatStatusLine(nil, types.GitInfo{}, nil, tt.stats, "", "", false, nil)
+				if !strings.HasPrefix(result, tt.want) {
+					t.Errorf("Expected %q, got %q", tt.want, result)
+				}
+			})
+		})
+	}
+}
+
+func TestCostUnit(t *testing.T) {
+	stats := &types.TokenStats{
+		DailyCost: 12.4, WeeklyCost: 80.1, MonthlyCost: 250.75,
+		DailyTokens: 1_234_567, WeeklyTokens: 8_500_000, MonthlyTokens: 31_000_000,
+		MonthProjected: 610,
+	}
+
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{"", "$250.75 → ~$610/m $80.10/w $12.40/d"},
+		{"dollars", "$250.75 → ~$610/m $80.10/w $12.40/d"},
+		{"tokens", "31.0M tok/m 8.5M tok/w 1.2M tok/d"},
+		{"both", "$250.75 → ~$610 31.0M tok/m $80.10 8.5M tok/w $12.40 1.2M tok/d"},
+	}
+
+	for _, tt := range tests {
+		withConfig(t, &config.Config{NoColor: true, Segments: "cost", CostUnit: tt.unit, CostProjection: true}, func() {
+			if got := FormatStatusLine(nil, types.GitInfo{}, nil, stats, "", "", false, nil); got != tt.want {
+				t.Errorf("unit %q: expected %q, got %q", tt.unit, tt.want, got)
+			}
+		})
+	}
+
+	withConfig(t, &config.Config{DisplayMode: "accessible", Segments: "cost", CostUnit: "tokens"}, func() {
+		want := "cost 31.0 million tokens this month, 8.5 million tokens this week, 1.2 million tokens today"
+		if got := Format(&types.StatusData{Stats: stats}); got != want {
+			t.Errorf("accessible: expected %q, got %q", want, got)
+		}
+	})
+}
+
+func TestFormatTokens(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0"},
+		{850, "850"},
+		{12_345, "12.3K"},
+		{456_789, "457K"},
+		{1_234_567, "1.2M"},
+		{3_400_000_000, "3.4B"},
+	}
+
+	for _, tt := range tests {
+		if got := formatTokens(tt.n); got != tt.want {
+			t.Errorf("formatTokens(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNoteSegment(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		note *types.Note
+		want string
+	}{
+		{"shown", &config.Config{ShowNote: true}, &types.Note{Text: "tried approach X"}, "tried approach X"},
+		{"text prefix", &config.Config{ShowNote: true, InfoMode: "text"}, &types.Note{Text: "tried approach X"}, "Note: tried approach X"},
+		{"truncated", &config.Config{ShowNote: true}, &types.Note{Text: strings.Repeat("é", 50)}, strings.Repeat("é", 37) + "..."},
+		{"off by default", &config.Config{}, &types.Note{Text: "tried approach X"}, ""},
+		{"no note", &config.Config{ShowNote: true}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.NoColor = true
+			tt.cfg.Segments = "note"
+			withConfig(t, tt.cfg, func() {
+				if got := Format(&types.StatusData{Note: tt.note}); got != tt.want {
+					t.Errorf("Expected %q, got %q", tt.want, got)
+				}
+			})
+		})
+	}
+}
+
 // TestModelVariations tests different model input scenarios
 func TestModelVariations(t *testing.T) {
 	tests := []struct {
@@ -526,6 +831,12 @@ func TestDisplayModes(t *testing.T) {
 			noColor:     true,
 			checkANSI:   false,
 		},
+		{
+			name:        "accessible mode",
+			displayMode: "accessible",
+			noColor:     false,
+			checkANSI:   false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -591,6 +902,11 @@ func TestInfoModes(t *testing.T) {
 			infoMode: "text",
 			contains: []string{"Dir:", "Git:"},
 		},
+		{
+			name:     "icons mode",
+			infoMode: "icons",
+			contains: []string{"\uf07c ", "\ue0a0 main"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -684,6 +1000,37 @@ func TestFormatDuration(t *testing.T) {
 	}
 }
 
+func TestDurationFormats(t *testing.T) {
+	tests := []struct {
+		style  string
+		format func(time.Duration) string
+		d      time.Duration
+		want   string
+	}{
+		{"compact", formatDuration, 2*time.Hour + 29*time.Minute, "2h29m"},
+		{"verbose", formatDuration, 2*time.Hour + 29*time.Minute, "2 hr 29 min"},
+		{"clock", formatDuration, 2*time.Hour + 29*time.Minute, "2:29"},
+		{"verbose", formatDuration, 45 * time.Minute, "45 min"},
+		{"clock", formatDuration, 5 * time.Minute, "0:05"},
+		{"verbose", formatDurationDays, 24*time.Hour + 5*time.Hour, "1 day 5 hr"},
+		{"verbose", formatDurationDays, 3*24*time.Hour + 22*time.Hour, "3 days 22 hr"},
+		{"clock", formatDurationDays, 3*24*time.Hour + 22*time.Hour + 15*time.Minute, "3d 22:15"},
+		{"verbose", formatShortDuration, 90 * time.Second, "1 min 30 sec"},
+		{"clock", formatShortDuration, 90 * time.Second, "1:30"},
+		{"clock", formatShortDuration, time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+		{"verbose", formatSessionDuration, 30 * time.Second, "<1m"},
+		{"clock", formatSessionDuration, 75 * time.Minute, "1:15"},
+		{"unknown", formatDuration, 2*time.Hour + 29*time.Minute, "2h29m"},
+	}
+	for _, tt := range tests {
+		withConfig(t, &config.Config{DurationFormat: tt.style}, func() {
+			if got := tt.format(tt.d); got != tt.want {
+				t.Errorf("%s style: format(%v) = %q, want %q", tt.style, tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFormatDurationDays(t *testing.T) {
 	tests := []struct {
 		duration time.Duration
@@ -1347,3 +1694,1438 @@ func TestFeatureFlags(t *testing.T) {
 		})
 	}
 }
+
+// TestSegmentsList tests that only listed segments are rendered
+func TestSegmentsList(t *testing.T) {
+	gitInfo := types.GitInfo{IsRepo: true, Branch: "main"}
+	stats := &types.TokenStats{DailyCost: 1.5, WeeklyCost: 5, MonthlyCost: 20}
+	usage := &types.UsageCache{UsagePercent: 42}
+
+	cfg := &config.Config{
+		NoColor:  true,
+		InfoMode: "emoji",
+		Segments: "git,usage",
+	}
+
+	withConfig(t, cfg, func() {
+		result := FormatStatusLine(nil, gitInfo, usage, stats, "pro", "", false, nil)
+
+		for _, want := range []string{"🔀 main", "42%"} {
+			if !strings.Contains(result, want) {
+				t.Errorf("Expected %q in output, got %q", want, result)
+			}
+		}
+		for _, notWant := range []string{"📁", "$1.50/d", "pro"} {
+			if strings.Contains(result, notWant) {
+				t.Errorf("Expected NOT to contain %q, got %q", notWant, result)
+			}
+		}
+	})
+}
+
+func TestRenderTemplate(t *testing.T) {
+	segs := map[string]string{
+		"dir":   "~/src",
+		"git":   "main",
+		"usage": "42%",
+		"tools": "✓ Read",
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{"reordered", "{usage} {dir} {git}", "42% | ~/src | main"},
+		{"empty segments dropped", "{dir} {cost} {git}", "~/src | main"},
+		{"surrounding text kept", "{dir} 5h:{usage}", "~/src | 5h:42%"},
+		{"literal token", "{dir} :: {git}", "~/src | :: | main"},
+		{"escaped newline", `{dir}\n{tools}`, "~/src\n✓ Read"},
+		{"empty line omitted", "{dir}\n{agents}", "~/src"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := renderTemplate(tt.format, segs, " | ")
+			if result != tt.expected {
+				t.Errorf("renderTemplate(%q) = %q, want %q", tt.format, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	segs := map[string]string{"dir": "proj", "git": "main", "model": "Opus", "usage": "42%", "cost": "$3/d", "todos": "2/5"}
+	tests := []struct {
+		cfg  *config.Config
+		want string
+	}{
+		{&config.Config{}, "proj | main | Opus | $3/d | 42%\n2/5"},
+		{&config.Config{Lines: 1}, "proj | main | Opus | $3/d | 42% | 2/5"},
+		{&config.Config{Lines: 2}, "proj | main | Opus\n42% | $3/d | 2/5"},
+		{&config.Config{Lines: 3}, "proj | main | Opus\n42% | $3/d\n2/5"},
+		{&config.Config{Lines: 7}, "proj | main | Opus | $3/d | 42%\n2/5"},
+		{&config.Config{Lines: 2, Format: "{usage} {dir}"}, "42% | proj"},
+	}
+	for _, tt := range tests {
+		withConfig(t, tt.cfg, func() {
+			if got, _ := layout(segs, nil, 0); got != tt.want {
+				t.Errorf("--lines %d = %q, want %q", tt.cfg.Lines, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxWidthOverflow(t *testing.T) {
+	segs := map[string]string{
+		"dir":     "~/src",
+		"git":     "main",
+		"model":   "Sonnet",
+		"cost":    "$1.20/d",
+		"history": "▁▂▅",
+		"usage":   "42%",
+		"tools":   "✓ Read",
+	}
+	format := "{dir} {git} {model} {cost} {history} {usage}\n{tools}"
+
+	tests := []struct {
+		name     string
+		maxWidth int
+		overflow string
+		want     string
+		dropped  []string
+	}{
+		{"no limit", 0, "line", "~/src | main | Sonnet | $1.20/d | ▁▂▅ | 42%\n✓ Read", nil},
+		{"fits", 50, "line", "~/src | main | Sonnet | $1.20/d | ▁▂▅ | 42%\n✓ Read", nil},
+		{"history first", 40, "line", "~/src | main | Sonnet | $1.20/d | 42%\n✓ Read\n▁▂▅", []string{"history"}},
+		{"then cost", 30, "line", "~/src | main | Sonnet | 42%\n✓ Read\n$1.20/d | ▁▂▅", []string{"cost", "history"}},
+		{"dropped", 30, "drop", "~/src | main | Sonnet | 42%\n✓ Read", []string{"cost", "history"}},
+		{"usage last", 3, "drop", "42%", []string{"dir", "git", "model", "cost", "history", "tools"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &config.Config{Format: format, MaxWidth: tt.maxWidth, Overflow: tt.overflow}, func() {
+				got, dropped := layout(segs, nil, tt.maxWidth)
+				if got != tt.want {
+					t.Errorf("layout() = %q, want %q", got, tt.want)
+				}
+				if !slices.Equal(dropped, tt.dropped) {
+					t.Errorf("dropped = %v, want %v", dropped, tt.dropped)
+				}
+			})
+		})
+	}
+}
+
+func TestRightAlign(t *testing.T) {
+	segs := map[string]string{"dir": "~/src", "git": "main", "usage": "42%", "cost": "\033[36m$1.20/d\033[0m", "tools": "📖 Read"}
+	tests := []struct {
+		name   string
+		format string
+		width  int
+		want   string
+	}{
+		{"padded", "{dir} {git} {>} {cost} {usage}", 30, "~/src | main     \033[36m$1.20/d\033[0m | 42%"},
+		{"no width", "{dir} {git} {>} {cost} {usage}", 0, "~/src | main | \033[36m$1.20/d\033[0m | 42%"},
+		{"only right", "{>} {usage}", 10, "       42%"},
+		{"wide glyphs", "{tools} {>} {usage}", 14, "📖 Read    42%"},
+		{"nothing right", "{dir} {>} {note}", 20, "~/src"},
+		{"blank line", "{dir}\n{>} {note}", 20, "~/src"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &config.Config{Format: tt.format}, func() {
+				if got, _ := layout(segs, nil, tt.width); got != tt.want {
+					t.Errorf("layout() = %q, want %q", got, tt.want)
+				}
+			})
+		})
+	}
+}
+
+func TestShortForms(t *testing.T) {
+	data := &types.StatusData{
+		Git:          types.GitInfo{IsRepo: true, Branch: "feature/login-redesign-v2"},
+		Stats:        &types.TokenStats{DailyCost: 1.2, WeeklyCost: 8, MonthlyCost: 30},
+		Subscription: "Max",
+		Tier:         "default_claude_max_20x",
+		Usage:        &types.UsageCache{UsagePercent: 42, Projection: &types.Projection{Status: types.ProjectionOnTrack}},
+		Cwd:          "/src/proj",
+	}
+	format := "{dir} {git} {subscription} {cost} {usage}"
+
+	tests := []struct {
+		width int
+		want  string
+	}{
+		{0, "proj | feature/login-redesign-v2 | Max/20x | $30.00/m $8.00/w $1.20/d | 42%"},
+		{60, "proj | feature/login-redesign-v2 | Max/20x | $1.20/d | 42%"},
+		{55, "proj | feature/login-redesign-v2 | Max | $1.20/d | 42%"},
+		{50, "proj | f/login-redesign-v2 | Max | $1.20/d | 42%"},
+		{40, "proj | f/login-redesign-v2 | Max | 42%\n$1.20/d"},
+		{32, "proj | f/login-redesign-v2 | 42%\nMax | $1.20/d"},
+	}
+	for _, tt := range tests {
+		withConfig(t, &config.Config{NoColor: true, Format: format}, func() {
+			got, _ := layout(renderSegments(data), shortSegments(data), tt.width)
+			if got != tt.want {
+				t.Errorf("width %d: layout() = %q, want %q", tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateBranch(t *testing.T) {
+	tests := []struct {
+		branch string
+		want   string
+	}{
+		{"main", "main"},
+		{"feature/login", "feature/login"},
+		{"feature/login-redesign-v2", "f/login-redesign-v2"},
+		{"users/erwin/fix/the-very-long-bug", "u/e/f/the-very-long…"},
+		{"a-branch-name-without-slashes", "a-branch-name-witho…"},
+	}
+	for _, tt := range tests {
+		if got := truncateBranch(tt.branch, maxBranchWidth); got != tt.want {
+			t.Errorf("truncateBranch(%q) = %q, want %q", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestLineWidth(t *testing.T) {
+	sess := &types.SessionInput{TerminalWidth: 100}
+	t.Setenv("COLUMNS", "80")
+	tests := []struct {
+		cfg  *config.Config
+		sess *types.SessionInput
+		want int
+	}{
+		{&config.Config{MaxWidth: 60, AutoWidth: true}, sess, 60},
+		{&config.Config{AutoWidth: true}, sess, 100},
+		{&config.Config{AutoWidth: true}, nil, 80},
+		{&config.Config{}, sess, 0},
+	}
+	for _, tt := range tests {
+		if got := lineWidth(tt.cfg, tt.sess); got != tt.want {
+			t.Errorf("lineWidth(%+v) = %d, want %d", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+// TestFormatOption tests that --format reorders and drops segments
+func TestFormatOption(t *testing.T) {
+	gitInfo := types.GitInfo{IsRepo: true, Branch: "main"}
+	stats := &types.TokenStats{DailyCost: 1.5, WeeklyCost: 5, MonthlyCost: 20}
+	usage := &types.UsageCache{UsagePercent: 42}
+
+	cfg := &config.Config{
+		NoColor: true,
+		Format:  "{usage} {git}",
+	}
+
+	withConfig(t, cfg, func() {
+		result := FormatStatusLine(nil, gitInfo, usage, stats, "", "", false, nil)
+		if result != "42% | main" {
+			t.Errorf("Expected usage first and no cost, got %q", result)
+		}
+	})
+}
+
+func TestFreshWindowMarker(t *testing.T) {
+	usage := &types.UsageCache{
+		UsagePercent: 2,
+		ResetTime:    time.Now().Add(4*time.Hour + 55*time.Minute),
+		WindowStart:  time.Now().Add(-5 * time.Minute),
+	}
+
+	withConfig(t, &config.Config{NoColor: true, FreshWindow: 10}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, usage, &types.TokenStats{}, "", "", false, nil)
+		if !strings.Contains(result, "fresh") {
+			t.Errorf("Expected fresh marker, got %q", result)
+		}
+	})
+
+	withConfig(t, &config.Config{NoColor: true, FreshWindow: 3}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, usage, &types.TokenStats{}, "", "", false, nil)
+		if strings.Contains(result, "fresh") {
+			t.Errorf("Expected no fresh marker after the fresh period, got %q", result)
+		}
+	})
+}
+
+func TestCalculateProjectionFromWindowStart(t *testing.T) {
+	// Window started lazily 1h ago and resets in 3h: 25% elapsed, while the
+	// nominal 5h assumption would say 40% elapsed
+	windowStart := time.Now().Add(-1 * time.Hour)
+	resetTime := time.Now().Add(3 * time.Hour)
+
+	if result := calculateProjectionFrom(25, windowStart, resetTime, colorGreen); result != "" {
+		t.Errorf("Expected on-track usage against the real window start, got %q", result)
+	}
+	if result := calculateProjection(25, resetTime, 5*time.Hour, colorGreen); result == "" {
+		t.Error("Expected the nominal window to flag 25% as under")
+	}
+	if result := calculateProjectionFrom(40, windowStart, resetTime, colorGreen); !strings.Contains(result, "⮝") {
+		t.Errorf("Expected way-over arrow against the real window start, got %q", result)
+	}
+}
+
+func TestProjectionArrowFromStructuredData(t *testing.T) {
+	tests := []struct {
+		status string
+		arrow  string
+	}{
+		{types.ProjectionWayOver, "⮝"},
+		{types.ProjectionOver, "△"},
+		{types.ProjectionUnder, "▽"},
+		{types.ProjectionWayUnder, "⮟"},
+		{types.ProjectionOnTrack, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			result := projectionArrow(&types.Projection{Status: tt.status}, colorGreen)
+			if tt.arrow == "" && result != "" {
+				t.Errorf("Expected no arrow, got %q", result)
+			}
+			if !strings.Contains(result, tt.arrow) {
+				t.Errorf("Expected %q, got %q", tt.arrow, result)
+			}
+		})
+	}
+
+	// A precomputed projection on the usage data wins over recomputing
+	usage := &types.UsageCache{
+		UsagePercent: 50,
+		ResetTime:    time.Now().Add(2*time.Hour + 30*time.Minute),
+		Projection:   &types.Projection{Status: types.ProjectionWayOver},
+	}
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, usage, &types.TokenStats{}, "", "", false, nil)
+		if !strings.Contains(result, "⮝") {
+			t.Errorf("Expected arrow from precomputed projection, got %q", result)
+		}
+	})
+}
+
+func TestLimitHint(t *testing.T) {
+	usage := &types.UsageCache{
+		UsagePercent: 100,
+		ResetTime:    time.Date(2025, 12, 3, 15, 30, 0, 0, time.Local),
+	}
+
+	withConfig(t, &config.Config{NoColor: true, LimitHint: "switch to haiku?"}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, usage, &types.TokenStats{}, "", "", false, nil)
+		if !strings.Contains(result, "100% until 15:30 switch to haiku?") {
+			t.Errorf("Expected reset time followed by hint, got %q", result)
+		}
+	})
+
+	usage.UsagePercent = 60
+	usage.ResetTime = time.Now().Add(time.Hour)
+	withConfig(t, &config.Config{NoColor: true, LimitHint: "switch to haiku?"}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, usage, &types.TokenStats{}, "", "", false, nil)
+		if strings.Contains(result, "haiku") {
+			t.Errorf("Expected no hint below the limit, got %q", result)
+		}
+	})
+}
+
+func TestModelHint(t *testing.T) {
+	largeModels := map[string]float64{"opus": 8, "sonnet": 1.5, "haiku": 0.5}
+	mixed := map[string]float64{"opus": 4, "haiku": 6}
+	tests := []struct {
+		name    string
+		percent float64
+		byModel map[string]float64
+		model   string
+		want    bool
+	}{
+		{"high usage on large models", 80, largeModels, "claude-opus-4-1", true},
+		{"usage below threshold", 60, largeModels, "claude-opus-4-1", false},
+		{"mostly haiku already", 80, mixed, "claude-opus-4-1", false},
+		{"session on haiku", 80, largeModels, "claude-haiku-4-5", false},
+		{"no costs today", 80, nil, "claude-opus-4-1", false},
+	}
+	for _, tt := range tests {
+		usage := &types.UsageCache{UsagePercent: tt.percent, ResetTime: time.Now().Add(time.Hour)}
+		data := &types.StatusData{
+			Session: &types.SessionInput{Model: &types.SessionModel{ID: tt.model}},
+			Usage:   usage,
+			Stats:   &types.TokenStats{DailyByModel: tt.byModel},
+		}
+		cfg := &config.Config{NoColor: true, ModelHint: "try haiku", ModelHintUsage: 75, ModelHintShare: 80}
+		withConfig(t, cfg, func() {
+			if got := strings.Contains(renderSegments(data)["usage"], "try haiku"); got != tt.want {
+				t.Errorf("%s: usage = %q, want hint %v", tt.name, renderSegments(data)["usage"], tt.want)
+			}
+		})
+		cfg.DisplayMode = "accessible"
+		withConfig(t, cfg, func() {
+			if got := strings.HasSuffix(renderSegments(data)["usage"], ", try haiku"); got != tt.want {
+				t.Errorf("%s: accessible usage = %q, want hint %v", tt.name, renderSegments(data)["usage"], tt.want)
+			}
+		})
+	}
+}
+
+func TestBurnRateField(t *testing.T) {
+	tests := []struct {
+		name     string
+		burnRate bool
+		rate     float64
+		want     string
+	}{
+		{"off", false, 8, "45%"},
+		{"rising", true, 8.2, "45% +8%/h"},
+		{"too slow", true, 0.3, "45%"},
+	}
+	for _, tt := range tests {
+		data := &types.StatusData{Usage: &types.UsageCache{UsagePercent: 45, BurnRate: tt.rate}}
+		withConfig(t, &config.Config{NoColor: true, BurnRate: tt.burnRate}, func() {
+			if got := renderSegments(data)["usage"]; got != tt.want {
+				t.Errorf("%s: usage = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitETA(t *testing.T) {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return at })
+	defer SetClock(time.Now)
+
+	usage := &types.UsageCache{UsagePercent: 82, BurnRate: 12, FetchedAt: at, ResetTime: at.Add(2*time.Hour + 40*time.Minute),
+		Projection: &types.Projection{Status: types.ProjectionOnTrack}}
+	data := &types.StatusData{Usage: usage}
+	withConfig(t, &config.Config{NoColor: true, BurnRate: true, LimitETA: true}, func() {
+		if got, want := renderSegments(data)["usage"], "82% +12%/h →100% in 1h30m 2h40m"; got != want {
+			t.Errorf("usage = %q, want %q", got, want)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", LimitETA: true}, func() {
+		if got := renderSegments(data)["usage"]; !strings.Contains(got, "limit reached in 1 hour 30 minutes at this rate") {
+			t.Errorf("accessible usage = %q, want the time to the limit", got)
+		}
+	})
+
+	// Resets before it fills up
+	usage.ResetTime = at.Add(time.Hour)
+	withConfig(t, &config.Config{NoColor: true, LimitETA: true}, func() {
+		if got := renderSegments(data)["usage"]; strings.Contains(got, "→100%") {
+			t.Errorf("usage = %q, want no estimate when the window resets first", got)
+		}
+	})
+}
+
+func TestUsageBar(t *testing.T) {
+	tests := []struct {
+		style   string
+		width   int
+		percent float64
+		want    string
+	}{
+		{"off", 5, 58, ""},
+		{"blocks", 5, 58, "▰▰▰▱▱"},
+		{"blocks", 5, 0, "▱▱▱▱▱"},
+		{"blocks", 0, 120, "▰▰▰▰▰"},
+		{"blocks", 10, 58, "▰▰▰▰▰▰▱▱▱▱"},
+		{"braille", 5, 58, "⣿⣿⣿⣀⣀"},
+		{"braille", 5, 50, "⣿⣿⡇⣀⣀"},
+		{"braille", 5, 100, "⣿⣿⣿⣿⣿"},
+		{"braille", 4, 10, "⡇⣀⣀⣀"},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{UsageBar: tt.style, UsageBarWidth: tt.width}
+		if got := usageBar(tt.percent, cfg); got != tt.want {
+			t.Errorf("usageBar(%v) %s/%d = %q, want %q", tt.percent, tt.style, tt.width, got, tt.want)
+		}
+	}
+
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return at })
+	defer SetClock(time.Now)
+	data := &types.StatusData{Usage: &types.UsageCache{UsagePercent: 58, ResetTime: at.Add(2 * time.Hour),
+		SevenDayPercent: 20, SevenDayResetTime: at.Add(72 * time.Hour),
+		Projection: &types.Projection{Status: types.ProjectionOnTrack}, SevenDayProjection: &types.Projection{Status: types.ProjectionOnTrack}}}
+	withConfig(t, &config.Config{NoColor: true, UsageBar: "blocks"}, func() {
+		segs := renderSegments(data)
+		if got, want := segs["usage"], "▰▰▰▱▱ 58% 2h0m"; got != want {
+			t.Errorf("usage = %q, want %q", got, want)
+		}
+		if got, want := segs["usage7d"], "▰▱▱▱▱ 20% 3d0h"; got != want {
+			t.Errorf("usage7d = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestToolsStyleModel(t *testing.T) {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return at })
+	defer SetClock(time.Now)
+
+	data := &types.StatusData{
+		Session: &types.SessionInput{Model: &types.SessionModel{DisplayName: "Sonnet 4.5"}},
+		Transcript: &types.TranscriptData{Tools: []types.ToolEntry{
+			{Name: "Read", Status: "completed", StartTime: at.Add(-time.Minute)},
+			{Name: "Grep", Status: "running", StartTime: at.Add(-50 * time.Second)},
+			{Name: "Bash", Status: "running", StartTime: at.Add(-32 * time.Second)},
+		}},
+	}
+	tests := []struct {
+		style, display string
+		model, tools   string
+	}{
+		{"full", "", "Sonnet 4.5", "◐ Grep | ◐ Bash | ✓ Read"},
+		{"model", "", "Sonnet 4.5 ▶ Bash 32s", ""},
+		{"model", "accessible", "model Sonnet 4.5, running Bash for 32 seconds", ""},
+	}
+	for _, tt := range tests {
+		withConfig(t, &config.Config{NoColor: true, ShowTools: true, ToolsStyle: tt.style, DisplayMode: tt.display}, func() {
+			segs := renderSegments(data)
+			if segs["model"] != tt.model || segs["tools"] != tt.tools {
+				t.Errorf("%s %s: model = %q, tools = %q, want %q, %q", tt.style, tt.display, segs["model"], segs["tools"], tt.model, tt.tools)
+			}
+		})
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	data := &types.StatusData{
+		Session: &types.SessionInput{
+			SessionID: "abc",
+			Model:     &types.SessionModel{ID: "claude-sonnet-4-5-20250929", DisplayName: "Sonnet 4.5"},
+		},
+		Git:   types.GitInfo{IsRepo: true, Branch: "main", Ahead: 2},
+		Usage: &types.UsageCache{UsagePercent: 42, Stale: true},
+		Stats: &types.TokenStats{DailyCost: 1.5},
+		Transcript: &types.TranscriptData{
+			Tools: []types.ToolEntry{
+				{Name: "Read", Status: "completed"},
+				{Name: "Bash", Status: "running"},
+			},
+			Todos: []types.TodoItem{{Subject: "Write tests", Status: "in_progress"}},
+		},
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(FormatJSON(data)), &doc); err != nil {
+		t.Fatalf("FormatJSON produced invalid JSON: %v", err)
+	}
+
+	if git := doc["git"].(map[string]any); git["branch"] != "main" || git["ahead"] != 2.0 {
+		t.Errorf("unexpected git section: %v", git)
+	}
+	if usage := doc["usage"].(map[string]any); usage["usage_percent"] != 42.0 || usage["stale"] != true {
+		t.Errorf("unexpected usage section: %v", usage)
+	}
+	if costs := doc["costs"].(map[string]any); costs["daily_cost"] != 1.5 {
+		t.Errorf("unexpected costs section: %v", costs)
+	}
+	if _, ok := doc["subscription"]; ok {
+		t.Error("expected subscription to be omitted when not collected")
+	}
+
+	tr := doc["transcript"].(map[string]any)
+	if tr["current_todo"] != "Write tests" || len(tr["running_tools"].([]any)) != 1 {
+		t.Errorf("unexpected transcript section: %v", tr)
+	}
+	if tr["completed_tools"].(map[string]any)["Read"] != 1.0 {
+		t.Errorf("expected completed tool counts, got %v", tr["completed_tools"])
+	}
+}
+
+func TestWindowFormats(t *testing.T) {
+	usage := &types.UsageCache{
+		UsagePercent:       40,
+		ResetTime:          time.Now().Add(2*time.Hour + 30*time.Second),
+		SevenDayPercent:    30,
+		SevenDayResetTime:  time.Now().Add(3*24*time.Hour + 30*time.Second),
+		Projection:         &types.Projection{Status: types.ProjectionOnTrack},
+		SevenDayProjection: &types.Projection{Status: types.ProjectionOnTrack},
+	}
+
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "defaults",
+			cfg:      config.Config{},
+			contains: []string{"40% 2h0m", "30% 3d"},
+		},
+		{
+			name:        "7d percentage only",
+			cfg:         config.Config{SevenDayFormat: "wk:{percent}"},
+			contains:    []string{"40% 2h0m", "wk:30%"},
+			notContains: []string{"3d"},
+		},
+		{
+			name:     "5h reordered",
+			cfg:      config.Config{UsageFormat: "{reset} left ({percent})"},
+			contains: []string{"2h0m left (40%)"},
+		},
+		{
+			name:        "7d hidden below threshold",
+			cfg:         config.Config{SevenDayMin: 50},
+			contains:    []string{"40%"},
+			notContains: []string{"30%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.NoColor = true
+			withConfig(t, &cfg, func() {
+				result := FormatStatusLine(nil, types.GitInfo{}, usage, &types.TokenStats{}, "", "", false, nil)
+				for _, want := range tt.contains {
+					if !strings.Contains(result, want) {
+						t.Errorf("Expected %q in %q", want, result)
+					}
+				}
+				for _, unwanted := range tt.notContains {
+					if strings.Contains(result, unwanted) {
+						t.Errorf("Did not expect %q in %q", unwanted, result)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestOpusWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		usage    *types.UsageCache
+		expected string
+		color    string
+	}{
+		{"not reported", &types.UsageCache{UsagePercent: 10}, "", ""},
+		{"low", &types.UsageCache{OpusPercent: 30}, "op 30%", colorGreen},
+		{"warn", &types.UsageCache{OpusPercent: 62}, "op 62%", colorYellow},
+		{"critical", &types.UsageCache{OpusPercent: 80}, "op 80%", colorRed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &config.Config{DisplayMode: "colors", Segments: "opus"}, func() {
+				result := FormatStatusLine(nil, types.GitInfo{}, tt.usage, &types.TokenStats{}, "", "", false, nil)
+				if tt.expected == "" {
+					if result != "" {
+						t.Errorf("Expected no opus segment, got %q", result)
+					}
+					return
+				}
+				if result != tt.color+tt.expected+colorReset {
+					t.Errorf("Expected %q in %q, got %q", tt.expected, tt.color, result)
+				}
+			})
+		})
+	}
+}
+
+func TestActivityInfoPrefixes(t *testing.T) {
+	data := &types.TranscriptData{
+		Tools:  []types.ToolEntry{{Name: "Bash", Target: "go test ./...", Status: "running", StartTime: time.Now()}},
+		Agents: []types.AgentEntry{{Type: "Explore", Status: "running", StartTime: time.Now()}},
+	}
+
+	withConfig(t, &config.Config{NoColor: true, InfoMode: "emoji", ShowTools: true, ShowAgents: true, Segments: "tools,agents"}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{}, nil, &types.TokenStats{}, "", "", false, data)
+		if !strings.Contains(result, "⚙ ◐ Bash go test ./...") {
+			t.Errorf("Expected running tool with prefix, got %q", result)
+		}
+		if !strings.Contains(result, "🤖 ◐ Explore") {
+			t.Errorf("Expected running agent with prefix, got %q", result)
+		}
+	})
+}
+
+func TestExplain(t *testing.T) {
+	data := &types.StatusData{
+		Session: &types.SessionInput{Model: &types.SessionModel{ID: "claude-opus-4"}},
+		Git:     types.GitInfo{IsRepo: true, Branch: "main"},
+		Usage:   &types.UsageCache{UsagePercent: 30, Source: "cache", FetchedAt: time.Now().Add(-2 * time.Minute)},
+		Stats:   &types.TokenStats{},
+		Sources: map[string]string{"git": "collected in 12ms", "usage": "collected in 3ms"},
+	}
+
+	withConfig(t, &config.Config{NoColor: true, Segments: "git,model,usage,usage7d,tools", ShowTools: false}, func() {
+		var buf bytes.Buffer
+		Explain(&buf, data)
+		out := buf.String()
+
+		lines := map[string]string{}
+		for _, line := range strings.Split(out, "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 {
+				lines[fields[0]] = line
+			}
+		}
+
+		checks := []struct {
+			segment string
+			want    []string
+		}{
+			{"git", []string{"shown", "collected in 12ms"}},
+			{"usage", []string{"shown", "cache fetched 2m", "collected in 3ms"}},
+			{"usage7d", []string{"missing", "no 7-day window"}},
+			{"cost", []string{"hidden", "not in --segments"}},
+			{"tools", []string{"hidden", "--show-tools=false"}},
+		}
+		for _, c := range checks {
+			for _, want := range c.want {
+				if !strings.Contains(lines[c.segment], want) {
+					t.Errorf("Expected %q in %s line %q", want, c.segment, lines[c.segment])
+				}
+			}
+		}
+	})
+}
+
+func TestSetBackground(t *testing.T) {
+	defer SetBackground("dark")
+	cfg := &config.Config{DisplayMode: "colors"}
+
+	SetBackground("light")
+	if got := colorize("main", colorYellow, bgYellow, cfg); got != "\033[38;5;136mmain"+colorReset {
+		t.Errorf("light yellow = %q, want the darker 256-color yellow", got)
+	}
+	if colorRed != "\033[31m" {
+		t.Errorf("colorRed = %q, red should stay readable on both backgrounds", colorRed)
+	}
+
+	SetBackground("dark")
+	if got := colorize("main", colorYellow, bgYellow, cfg); got != "\033[33mmain"+colorReset {
+		t.Errorf("dark yellow = %q, want the standard yellow", got)
+	}
+}
+
+func TestColorCode(t *testing.T) {
+	tests := []struct {
+		spec string
+		bg   bool
+		want string
+	}{
+		{"magenta", false, "\033[35m"},
+		{"Bright-Blue", true, "\033[104m"},
+		{"208", false, "\033[38;5;208m"},
+		{"236", true, "\033[48;5;236m"},
+		{"#268bd2", false, "\033[38;2;38;139;210m"},
+		{"#073642", true, "\033[48;2;7;54;66m"},
+		{"256", false, ""},
+		{"#12345", false, ""},
+		{"teal", false, ""},
+	}
+	for _, tt := range tests {
+		if got, _ := colorCode(tt.spec, tt.bg); got != tt.want {
+			t.Errorf("colorCode(%q, %v) = %q, want %q", tt.spec, tt.bg, got, tt.want)
+		}
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	defer func() { colorDepth = "truecolor" }()
+	tests := []struct {
+		depth string
+		seq   string
+		want  string
+	}{
+		{"truecolor", "\033[38;2;38;139;210m", "\033[38;2;38;139;210m"},
+		{"256", "\033[38;2;38;139;210m", "\033[38;5;32m"},
+		{"256", "\033[48;2;7;54;66m", "\033[48;5;235m"},
+		{"256", "\033[38;2;128;128;128m", "\033[38;5;244m"},
+		{"256", "\033[38;5;248m", "\033[38;5;248m"},
+		{"16", "\033[38;2;220;50;47m", "\033[31m"},
+		{"16", "\033[48;2;0;0;230m", "\033[44m"},
+		{"16", "\033[38;5;252m", "\033[37m"},
+		{"16", "\033[38;5;242m", "\033[90m"},
+		{"16", "\033[33m", "\033[33m"},
+	}
+	for _, tt := range tests {
+		colorDepth = tt.depth
+		if got := downgrade(tt.seq); got != tt.want {
+			t.Errorf("downgrade(%q) at %s = %q, want %q", tt.seq, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestThemes(t *testing.T) {
+	defer SetBackground("dark")
+	data := &types.StatusData{Cwd: "/home/user/project", Git: types.GitInfo{IsRepo: true, Branch: "main"}}
+
+	SetTheme("nord")
+	withConfig(t, &config.Config{DisplayMode: "colors", Segments: "dir,git"}, func() {
+		want := "\033[38;2;129;161;193mproject" + colorReset + " | \033[38;2;180;142;173mmain" + colorReset
+		if got := Format(data); got != want {
+			t.Errorf("nord theme = %q, want %q", got, want)
+		}
+	})
+
+	SetTheme("no-such-theme")
+	withConfig(t, &config.Config{DisplayMode: "background", Segments: "dir,git", Colors: "dir=white/#073642, git=bogus"}, func() {
+		want := "\033[48;2;7;54;66m project " + colorReset + " | \033[48;2;180;142;173m main " + colorReset
+		if got := Format(data); got != want {
+			t.Errorf("segment colors = %q, want %q", got, want)
+		}
+	})
+
+	SetBackground("dark")
+	if colorBlue != "\033[34m" || bgMagenta != "\033[45m" {
+		t.Errorf("SetBackground didn't restore the default palette: %q %q", colorBlue, bgMagenta)
+	}
+
+	// --theme accepts exactly the built-in themes
+	if !slices.Equal(config.Choices["theme"], ThemeNames()) {
+		t.Errorf("config.Choices[theme] = %v, want %v", config.Choices["theme"], ThemeNames())
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   string
+	}{
+		{[]float64{0, 0, 0}, ""},
+		{nil, ""},
+		{[]float64{1, 2, 5, 7, 3, 1, 2}, "▂▃▆█▄▂▃"},
+		{[]float64{0, 10}, "▁█"},
+		{[]float64{4, 4}, "██"},
+	}
+	for _, tt := range tests {
+		if got := sparkline(tt.values); got != tt.want {
+			t.Errorf("sparkline(%v) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestHistorySegment(t *testing.T) {
+	data := &types.StatusData{Stats: &types.TokenStats{DailyCost: 2, DayHistory: []float64{0, 0, 8, 0, 0, 0, 2}}}
+
+	withConfig(t, &config.Config{NoColor: true, ShowHistory: true}, func() {
+		if got := renderSegments(data)["history"]; got != "▁▁█▁▁▁▃" {
+			t.Errorf("history = %q, want the sparkline", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		if got := renderSegments(data)["history"]; got != "" {
+			t.Errorf("history = %q, want hidden without --show-history", got)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowHistory: true}, func() {
+		want := "daily cost over the last 7 days, oldest first: 0, 0, 8, 0, 0, 0, 2 dollars"
+		if got := renderSegments(data)["history"]; got != want {
+			t.Errorf("accessible history = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestEmojiPrefix(t *testing.T) {
+	tests := []struct {
+		style  string
+		widths string
+		prefix string
+		want   string
+	}{
+		{"auto", "", "📁 ", "📁 "},
+		{"auto", "", "⚙ ", "⚙ "},
+		{"emoji", "", "📁 ", "📁\uFE0F "},
+		{"emoji", "", "⚙ ", "⚙\uFE0F "},
+		{"text", "", "📁 ", "📁\uFE0E  "},
+		{"none", "", "📁 ", ""},
+		// The terminal draws the folder in one cell: pad it like ⚙
+		{"auto", "📁=1", "📁 ", "📁  "},
+		{"auto", "📁=1", "⚙ ", "⚙  "},
+		{"auto", "U+2699=2", "⚙ ", "⚙ "},
+		{"emoji", "⚙=1", "⚙ ", "⚙\uFE0F  "},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{EmojiStyle: tt.style, GlyphWidths: tt.widths}
+		if got := emojiPrefix(tt.prefix, cfg); got != tt.want {
+			t.Errorf("emojiPrefix(%q) with style %q, widths %q = %q, want %q", tt.prefix, tt.style, tt.widths, got, tt.want)
+		}
+	}
+
+	withConfig(t, &config.Config{NoColor: true, InfoMode: "emoji", EmojiStyle: "none"}, func() {
+		result := FormatStatusLine(nil, types.GitInfo{IsRepo: true, Branch: "main"}, nil, nil, "", "", false, nil)
+		if strings.Contains(result, "🔀") || !strings.Contains(result, "main") {
+			t.Errorf("expected the branch without emoji, got %q", result)
+		}
+	})
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		s         string
+		overrides map[rune]int
+		want      int
+	}{
+		{"main", nil, 4},
+		{"📁 ~/app", nil, 8},
+		{"⚙ Bash", nil, 6},
+		{"⚙\uFE0F Bash", nil, 7},
+		{"📁\uFE0E", nil, 1},
+		{"\033[36mmain\033[0m", nil, 4},
+		{"日本", nil, 4},
+		{"📁 ~/app", map[rune]int{'📁': 1}, 7},
+		{"📁\uFE0F", map[rune]int{'📁': 1}, 1},
+		{"⚡ fast", nil, 7},
+		{"🚀", nil, 2},
+		{"👩\u200D💻 dev", nil, 6},
+		{"👍🏽", nil, 2},
+		{"🇳🇱", nil, 2},
+		{"a\u200Bb", nil, 2},
+	}
+	for _, tt := range tests {
+		if got := displayWidth(tt.s, tt.overrides); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSessionSegment(t *testing.T) {
+	data := &types.StatusData{
+		Session: &types.SessionInput{SessionID: "s1"},
+		Stats:   &types.TokenStats{SessionCosts: map[string]float64{"s1": 1.844, "s2": 9}},
+	}
+
+	withConfig(t, &config.Config{NoColor: true, ShowSession: true}, func() {
+		if got := renderSegments(data)["session"]; got != "$1.84/s" {
+			t.Errorf("session = %q, want %q", got, "$1.84/s")
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowSession: true}, func() {
+		if got := renderSegments(data)["session"]; got != "1.84 dollars this session" {
+			t.Errorf("accessible session = %q", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true, ShowSession: true}, func() {
+		other := &types.StatusData{Session: &types.SessionInput{SessionID: "s3"}, Stats: data.Stats}
+		if got := renderSegments(other)["session"]; got != "" {
+			t.Errorf("session = %q, want nothing for a session without costs", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		if got := renderSegments(data)["session"]; got != "" {
+			t.Errorf("session = %q, want hidden without --show-session", got)
+		}
+	})
+}
+
+func TestChangesSegment(t *testing.T) {
+	data := &types.StatusData{Transcript: &types.TranscriptData{LinesAdded: 120, LinesRemoved: 45}}
+
+	withConfig(t, &config.Config{NoColor: true, ShowChanges: true}, func() {
+		if got := renderSegments(data)["changes"]; got != "+120/-45" {
+			t.Errorf("changes = %q, want %q", got, "+120/-45")
+		}
+		if got := renderSegments(&types.StatusData{Transcript: &types.TranscriptData{}})["changes"]; got != "" {
+			t.Errorf("changes = %q, want nothing without edits", got)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowChanges: true}, func() {
+		if got := renderSegments(data)["changes"]; got != "120 lines added, 45 removed" {
+			t.Errorf("accessible changes = %q", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		if got := renderSegments(data)["changes"]; got != "" {
+			t.Errorf("changes = %q, want hidden without --show-changes", got)
+		}
+	})
+}
+
+func TestSummarySegment(t *testing.T) {
+	data := &types.StatusData{Transcript: &types.TranscriptData{
+		Tools:      []types.ToolEntry{{Name: "Read", Status: "running"}},
+		ToolCounts: map[string]int{"Read": 12, "Edit": 3, "MultiEdit": 2, "Bash": 8, "Grep": 4},
+	}}
+
+	tests := []struct {
+		name  string
+		tools string
+		min   int
+		want  string
+	}{
+		{"default tools", config.DefaultSummaryTools, 10, "R12 E5 B8"},
+		{"labels", "Grep=G,Bash=$", 0, "G4 $8"},
+		{"unused tools left out", "Read,Write,Glob", 0, "R12"},
+		{"below the threshold", "Grep", 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &config.Config{NoColor: true, ShowSummary: true, SummaryTools: tt.tools, SummaryMin: tt.min}, func() {
+				if got := renderSegments(data)["summary"]; got != tt.want {
+					t.Errorf("summary = %q, want %q", got, tt.want)
+				}
+			})
+		})
+	}
+
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowSummary: true, SummaryTools: config.DefaultSummaryTools}, func() {
+		if got := renderSegments(data)["summary"]; got != "tool calls: Read 12, Edit 5, Bash 8" {
+			t.Errorf("accessible summary = %q", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true, SummaryTools: config.DefaultSummaryTools}, func() {
+		if got := renderSegments(data)["summary"]; got != "" {
+			t.Errorf("summary = %q, want hidden without --show-summary", got)
+		}
+	})
+}
+
+func TestSpinner(t *testing.T) {
+	start := time.Date(2025, 1, 24, 10, 0, 0, 0, time.UTC)
+	data := &types.StatusData{Transcript: &types.TranscriptData{
+		Agents: []types.AgentEntry{{Type: "Explore", Status: "running", StartTime: start}},
+	}}
+	t.Cleanup(func() { SetClock(time.Now) })
+
+	tests := []struct {
+		spinner bool
+		at      time.Duration
+		want    string
+	}{
+		{false, 2*time.Minute + 14*time.Second, "◐ Explore (2m14s)"},
+		{false, 2*time.Minute + 14*time.Second + 250*time.Millisecond, "◐ Explore (2m14s)"},
+		{true, 2*time.Minute + 14*time.Second, "◐ Explore (2m14s)"},
+		{true, 2*time.Minute + 14*time.Second + 250*time.Millisecond, "◓ Explore (2m14s)"},
+		{true, 2*time.Minute + 14*time.Second + 500*time.Millisecond, "◑ Explore (2m14s)"},
+	}
+	for _, tt := range tests {
+		SetClock(func() time.Time { return start.Add(tt.at) })
+		withConfig(t, &config.Config{NoColor: true, ShowAgents: true, Spinner: tt.spinner}, func() {
+			if got := renderSegments(data)["agents"]; got != tt.want {
+				t.Errorf("spinner=%v at %v: agents = %q, want %q", tt.spinner, tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorsSegment(t *testing.T) {
+	tests := []struct {
+		streak, min int
+		want        string
+	}{
+		{3, 3, "⚠ 3 errors"},
+		{2, 3, ""},
+		{1, 1, "⚠ 1 error"},
+		{0, 0, ""},
+	}
+	for _, tt := range tests {
+		data := &types.StatusData{Transcript: &types.TranscriptData{ErrorStreak: tt.streak}}
+		withConfig(t, &config.Config{NoColor: true, ShowErrors: true, ErrorStreak: tt.min}, func() {
+			if got := renderSegments(data)["errors"]; got != tt.want {
+				t.Errorf("streak %d, --error-streak %d: errors = %q, want %q", tt.streak, tt.min, got, tt.want)
+			}
+		})
+	}
+
+	data := &types.StatusData{Transcript: &types.TranscriptData{ErrorStreak: 4}}
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowErrors: true, ErrorStreak: 3}, func() {
+		if got := renderSegments(data)["errors"]; got != "warning: 4 tool errors in a row" {
+			t.Errorf("accessible errors = %q", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true, ErrorStreak: 3}, func() {
+		if got := renderSegments(data)["errors"]; got != "" {
+			t.Errorf("errors = %q, want hidden without --show-errors", got)
+		}
+	})
+}
+
+func TestSessionDetails(t *testing.T) {
+	var sess types.SessionInput
+	input := `{"cwd":"/work/app/internal","version":"1.0.80","output_style":{"name":"Explanatory"},
+		"workspace":{"current_dir":"/work/app/internal","project_dir":"/work/app"}}`
+	if err := json.Unmarshal([]byte(input), &sess); err != nil {
+		t.Fatal(err)
+	}
+	data := &types.StatusData{Cwd: sess.Cwd, Session: &sess}
+
+	withConfig(t, &config.Config{NoColor: true, ShowStyle: true, ShowVersion: true}, func() {
+		segs := renderSegments(data)
+		if segs["style"] != "Explanatory" || segs["version"] != "v1.0.80" || segs["dir"] != "internal" {
+			t.Errorf("style = %q, version = %q, dir = %q", segs["style"], segs["version"], segs["dir"])
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true, DirSource: "project"}, func() {
+		if got := renderSegments(data)["dir"]; got != "app" {
+			t.Errorf("dir = %q, want the project directory", got)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowStyle: true, ShowVersion: true}, func() {
+		segs := renderSegments(data)
+		if segs["style"] != "Explanatory output style" || segs["version"] != "Claude Code version 1.0.80" {
+			t.Errorf("accessible style = %q, version = %q", segs["style"], segs["version"])
+		}
+	})
+
+	sess.OutputStyle.Name = "default"
+	withConfig(t, &config.Config{NoColor: true, ShowStyle: true}, func() {
+		if got := renderSegments(data)["style"]; got != "" {
+			t.Errorf("style = %q, want nothing for the default style", got)
+		}
+	})
+}
+
+func TestCompactSegment(t *testing.T) {
+	session := func(pct float64, exceeds bool) *types.StatusData {
+		return &types.StatusData{Session: &types.SessionInput{
+			ContextWindow: &types.ContextWindow{Size: 200000, UsedPercentage: &pct},
+			Exceeds200k:   exceeds,
+		}}
+	}
+
+	tests := []struct {
+		name string
+		data *types.StatusData
+		warn int
+		want string
+	}{
+		{"below the threshold", session(60, false), 80, ""},
+		{"at the threshold", session(80, false), 80, "COMPACT SOON"},
+		{"over 200k tokens", session(40, true), 80, "COMPACT SOON"},
+		{"lower threshold", session(60, false), 50, "COMPACT SOON"},
+		{"no session input", &types.StatusData{}, 80, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &config.Config{NoColor: true, ShowCompact: true, CompactWarn: tt.warn}, func() {
+				if got := renderSegments(tt.data)["compact"]; got != tt.want {
+					t.Errorf("compact = %q, want %q", got, tt.want)
+				}
+			})
+		})
+	}
+
+	withConfig(t, &config.Config{ShowCompact: true, CompactWarn: 80}, func() {
+		if got := renderSegments(session(90, false))["compact"]; !strings.HasPrefix(got, blink) {
+			t.Errorf("compact = %q, want it flashing", got)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowCompact: true, CompactWarn: 80}, func() {
+		if got := renderSegments(session(90, false))["compact"]; got != "warning: context nearly full, compaction soon" {
+			t.Errorf("accessible compact = %q", got)
+		}
+	})
+}
+
+func TestCommitsSegment(t *testing.T) {
+	data := &types.StatusData{Git: types.GitInfo{IsRepo: true, Branch: "main", CommitsToday: 3}}
+
+	withConfig(t, &config.Config{NoColor: true, ShowCommits: true}, func() {
+		if got := renderSegments(data)["commits"]; got != "3 ⎌" {
+			t.Errorf("commits = %q, want %q", got, "3 ⎌")
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowCommits: true}, func() {
+		if got := renderSegments(data)["commits"]; got != "3 commits today" {
+			t.Errorf("accessible commits = %q", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		if got := renderSegments(data)["commits"]; got != "" {
+			t.Errorf("commits = %q, want hidden without --show-commits", got)
+		}
+	})
+}
+
+func TestBaseSegment(t *testing.T) {
+	data := &types.StatusData{Git: types.GitInfo{IsRepo: true, Branch: "topic", Base: "main", BaseAhead: 3, BaseBehind: 12}}
+
+	withConfig(t, &config.Config{NoColor: true, ShowBase: true}, func() {
+		if got := renderSegments(data)["base"]; got != "main↑3↓12" {
+			t.Errorf("base = %q, want %q", got, "main↑3↓12")
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", ShowBase: true}, func() {
+		if got := renderSegments(data)["base"]; got != "3 commits ahead of main, 12 commits behind main" {
+			t.Errorf("accessible base = %q", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		if got := renderSegments(data)["base"]; got != "" {
+			t.Errorf("base = %q, want hidden without --show-base", got)
+		}
+	})
+}
+
+func TestGitLastCommit(t *testing.T) {
+	at := time.Date(2025, 12, 3, 14, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return at })
+	defer SetClock(time.Now)
+
+	committed := at.Add(-2*time.Hour - 10*time.Minute)
+	data := &types.StatusData{Git: types.GitInfo{
+		IsRepo: true, Branch: "main", Ahead: 1,
+		LastCommit: &committed, LastSubject: "Fix the parser for nested templates in includes",
+	}}
+
+	withConfig(t, &config.Config{NoColor: true, GitLastCommit: true}, func() {
+		if got, want := renderSegments(data)["git"], "main ↑1 · 2h ago Fix the parser for nested tem…"; got != want {
+			t.Errorf("git = %q, want %q", got, want)
+		}
+		if got, want := shortSegments(data)["git"], "main ↑1 · 2h ago"; got != want {
+			t.Errorf("short git = %q, want %q", got, want)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", GitLastCommit: true}, func() {
+		want := "Git branch main, 1 commit ahead, last commit 2 hours 10 minutes ago: Fix the parser for nested templates in includes"
+		if got := renderSegments(data)["git"]; got != want {
+			t.Errorf("accessible git = %q, want %q", got, want)
+		}
+	})
+
+	for d, want := range map[time.Duration]string{
+		30 * time.Second: "just now",
+		59 * time.Minute: "59m ago",
+		49 * time.Hour:   "2d ago",
+	} {
+		if got := commitAge(d); got != want {
+			t.Errorf("commitAge(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestDisplayDir(t *testing.T) {
+	home := filepath.Join(string(filepath.Separator)+"home", "dev")
+	tests := []struct {
+		name, home, cwd, want string
+	}{
+		{"under home", home, filepath.Join(home, "src"), "~" + string(filepath.Separator) + "src"},
+		{"long path under home", home, filepath.Join(home, "src", "github.com", "someone", "project"), "~/project"},
+		{"outside home", home, filepath.Join(string(filepath.Separator)+"srv", "app"), "app"},
+		// Without a known home every path used to count as under it
+		{"no home", "", filepath.Join(string(filepath.Separator)+"srv", "app"), "app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", tt.home)
+			t.Setenv("USERPROFILE", tt.home)
+			if got := displayDir(tt.cwd); got != tt.want {
+				t.Errorf("displayDir(%q) = %q, want %q", tt.cwd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIBillingUsage(t *testing.T) {
+	month := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		usage            *types.UsageCache
+		want, accessible string
+	}{
+		{"no admin key", &types.UsageCache{}, "API", "API key billing"},
+		{"month spend", &types.UsageCache{MonthSpend: 123.4, MonthStart: month}, "API $123.40/m", "API key billing, organization spend this month 123.40 dollars"},
+		{"stale spend", &types.UsageCache{MonthSpend: 5, MonthStart: month, Stale: true}, "API ~$5.00/m", "API key billing, organization spend this month 5.00 dollars, not up to date"},
+	}
+	for _, tt := range tests {
+		data := &types.StatusData{Usage: tt.usage, IsApiBilling: true}
+		withConfig(t, &config.Config{NoColor: true}, func() {
+			if got := renderSegments(data)["usage"]; got != tt.want {
+				t.Errorf("%s: usage = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+		withConfig(t, &config.Config{DisplayMode: "accessible"}, func() {
+			if got := renderSegments(data)["usage"]; got != tt.accessible {
+				t.Errorf("%s: accessible usage = %q, want %q", tt.name, got, tt.accessible)
+			}
+		})
+	}
+}
+
+func TestProjectDirSegment(t *testing.T) {
+	data := &types.StatusData{Cwd: filepath.Join(string(filepath.Separator)+"srv", "monorepo", "services", "api"), Project: "api-server"}
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		if got := renderSegments(data)["dir"]; got != "api-server" {
+			t.Errorf("dir = %q, want the project name", got)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible"}, func() {
+		if got := renderSegments(data)["dir"]; got != "project api-server" {
+			t.Errorf("accessible dir = %q", got)
+		}
+	})
+
+	data.Project = ""
+	withConfig(t, &config.Config{NoColor: true}, func() {
+		if got := renderSegments(data)["dir"]; got != "api" {
+			t.Errorf("dir = %q, want the directory without a project", got)
+		}
+	})
+}
+
+func TestProfileSuffix(t *testing.T) {
+	tests := []struct {
+		subscription, profile, want, accessible string
+	}{
+		{"max", "work", "max @work", "plan max, profile work"},
+		{"", "work", "@work", "profile work"},
+		{"pro", "", "pro", "plan pro"},
+	}
+	for _, tt := range tests {
+		data := &types.StatusData{Subscription: tt.subscription, Profile: tt.profile}
+		withConfig(t, &config.Config{NoColor: true}, func() {
+			if got := renderSegments(data)["subscription"]; got != tt.want {
+				t.Errorf("subscription = %q, want %q", got, tt.want)
+			}
+		})
+		withConfig(t, &config.Config{DisplayMode: "accessible"}, func() {
+			if got := renderSegments(data)["subscription"]; got != tt.accessible {
+				t.Errorf("accessible subscription = %q, want %q", got, tt.accessible)
+			}
+		})
+	}
+}
+
+func TestCustomSegments(t *testing.T) {
+	segments := []config.CustomSegment{{Name: "k8s", Command: "kubectl config current-context"}, {Name: "aws", Command: "echo $AWS_PROFILE"}}
+	data := &types.StatusData{Custom: map[string]string{"k8s": "prod-cluster", "aws": ""}}
+
+	withConfig(t, &config.Config{NoColor: true, CustomSegments: segments}, func() {
+		segs := renderSegments(data)
+		if segs["k8s"] != "prod-cluster" {
+			t.Errorf("k8s = %q, want the command's output", segs["k8s"])
+		}
+		if _, ok := segs["aws"]; ok {
+			t.Errorf("aws = %q, want nothing for empty output", segs["aws"])
+		}
+	})
+	withConfig(t, &config.Config{CustomSegments: segments, Colors: "k8s=blue"}, func() {
+		if got := renderSegments(data)["k8s"]; !strings.HasPrefix(got, colorBlue) {
+			t.Errorf("k8s = %q, want it colored with --colors", got)
+		}
+	})
+	withConfig(t, &config.Config{NoColor: true, CustomSegments: segments, Segments: "dir"}, func() {
+		if got := renderSegments(data)["k8s"]; got != "" {
+			t.Errorf("k8s = %q, want it hidden when not in --segments", got)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", CustomSegments: segments}, func() {
+		if got := renderSegments(data)["k8s"]; got != "k8s: prod-cluster" {
+			t.Errorf("accessible k8s = %q", got)
+		}
+	})
+}
+
+func TestExprSegments(t *testing.T) {
+	parse := func(name, src string) config.CustomSegment {
+		e, err := expr.Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", src, err)
+		}
+		return config.CustomSegment{Name: name, Expr: e}
+	}
+	pct := 62.0
+	data := &types.StatusData{
+		Session:    &types.SessionInput{SessionID: "s1", Model: &types.SessionModel{DisplayName: "Opus"}, ContextWindow: &types.ContextWindow{Size: 200000, UsedPercentage: &pct}},
+		Git:        types.GitInfo{IsRepo: true, Branch: "main", Ahead: 2},
+		Stats:      &types.TokenStats{DailyCost: 7.5, SessionCosts: map[string]float64{"s1": 1.25}},
+		Transcript: &types.TranscriptData{Tools: []types.ToolEntry{{Name: "Bash", Status: "running"}}, ErrorStreak: 1},
+		Custom:     map[string]string{"k8s": "prod"},
+		Sources:    map[string]string{"cost": "collected"},
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"cost over a threshold", `cost.daily > 5 ? format("$%.2f", cost.daily) : nil`, "$7.50"},
+		{"hidden under a threshold", `cost.daily > 10 && format("$%.2f", cost.daily)`, ""},
+		{"git", `git.branch == "main" && git.clean ? "on main" : git.branch`, "on main"},
+		{"session and context", `model + " " + round(context.percent) + "% " + cost.session`, "Opus 62% 1.25"},
+		{"transcript", `tools.current + " x" + tools.running + (errors > 0 ? " !" : "")`, "Bash x1 !"},
+		{"custom output", `custom.k8s == "prod" ? upper(custom.k8s) : ""`, "PROD"},
+		{"not collected", `usage.percent > 50 ? "busy" : nil`, ""},
+		{"failing", `git.branch * 2`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &config.Config{NoColor: true, CustomSegments: []config.CustomSegment{parse("x", tt.src)}}, func() {
+				if got := renderSegments(data)["x"]; got != tt.want {
+					t.Errorf("x = %q, want %q", got, tt.want)
+				}
+			})
+		})
+	}
+
+	withConfig(t, &config.Config{CustomSegments: []config.CustomSegment{parse("x", `"k8s " + color("red", custom.k8s)`)}}, func() {
+		want := colorCyan + "k8s " + colorRed + "prod" + colorReset + colorCyan + colorReset
+		if got := renderSegments(data)["x"]; got != want {
+			t.Errorf("x = %q, want %q", got, want)
+		}
+	})
+	withConfig(t, &config.Config{DisplayMode: "accessible", CustomSegments: []config.CustomSegment{parse("x", `color("red", custom.k8s)`)}}, func() {
+		if got := renderSegments(data)["x"]; got != "x: prod" {
+			t.Errorf("accessible x = %q", got)
+		}
+	})
+}
+
+func TestRules(t *testing.T) {
+	rule := func(segment string, show bool, src string) config.Rule {
+		e, err := expr.Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error: %v", src, err)
+		}
+		return config.Rule{Segment: segment, Show: show, Cond: e}
+	}
+	data := func(daily float64, branch string, modified int) *types.StatusData {
+		return &types.StatusData{
+			Cwd:     "/tmp/project",
+			Git:     types.GitInfo{IsRepo: true, Branch: branch, Modified: modified},
+			Stats:   &types.TokenStats{DailyCost: daily},
+			Sources: map[string]string{"cost": "collected"},
+		}
+	}
+	rules := []config.Rule{
+		rule("cost", true, "cost.daily > 1"),
+		rule("git", false, "git.branch == 'main' && git.clean"),
+		rule("dir", false, "git.branch * 2"), // fails, so it hides nothing
+	}
+
+	tests := []struct {
+		name   string
+		data   *types.StatusData
+		shown  []string
+		hidden []string
+	}{
+		{"cheap day on clean main", data(0.5, "main", 0), []string{"dir"}, []string{"cost", "git"}},
+		{"expensive day with changes", data(2, "main", 3), []string{"dir", "cost", "git"}, nil},
+		{"feature branch", data(0.5, "feature", 0), []string{"dir", "git"}, []string{"cost"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mode := range []string{"colors", "accessible"} {
+				withConfig(t, &config.Config{NoColor: true, DisplayMode: mode, Rules: rules}, func() {
+					segs := renderSegments(tt.data)
+					for _, name := range tt.shown {
+						if segs[name] == "" {
+							t.Errorf("%s: %s hidden, want it shown", mode, name)
+						}
+					}
+					for _, name := range tt.hidden {
+						if segs[name] != "" {
+							t.Errorf("%s: %s = %q, want it hidden", mode, name, segs[name])
+						}
+					}
+				})
+			}
+		})
+	}
+
+	withConfig(t, &config.Config{NoColor: true, Rules: rules}, func() {
+		if got := missingReason("cost", data(0.5, "main", 0)); got != "--show-if condition doesn't hold: cost.daily > 1" {
+			t.Errorf("missingReason(cost) = %q", got)
+		}
+		if got := missingReason("git", data(0.5, "main", 0)); got != "--hide-if condition holds: git.branch == 'main' && git.clean" {
+			t.Errorf("missingReason(git) = %q", got)
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// Theme is a palette: the color each role is drawn in, as a color name,
+// a 256-color number or a #rrggbb truecolor value. Segments use roles, e.g.
+// blue for the directory and green, yellow and red for usage levels.
+type Theme struct {
+	Red, Green, Yellow, Blue, Magenta, Cyan, Gray string
+}
+
+// themes are the built-in palettes besides the default, which follows
+// --background
+var themes = map[string]Theme{
+	"solarized":     {Red: "#dc322f", Green: "#859900", Yellow: "#b58900", Blue: "#268bd2", Magenta: "#d33682", Cyan: "#2aa198", Gray: "#839496"},
+	"dracula":       {Red: "#ff5555", Green: "#50fa7b", Yellow: "#f1fa8c", Blue: "#bd93f9", Magenta: "#ff79c6", Cyan: "#8be9fd", Gray: "#6272a4"},
+	"nord":          {Red: "#bf616a", Green: "#a3be8c", Yellow: "#ebcb8b", Blue: "#81a1c1", Magenta: "#b48ead", Cyan: "#88c0d0", Gray: "#616e88"},
+	"gruvbox-light": {Red: "#9d0006", Green: "#79740e", Yellow: "#b57614", Blue: "#076678", Magenta: "#8f3f71", Cyan: "#427b58", Gray: "#7c6f64"},
+}
+
+// ThemeNames lists the built-in themes
+func ThemeNames() []string {
+	names := []string{"default"}
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// SetTheme switches to a built-in theme. The default theme (or an empty
+// name) keeps the colors SetBackground chose; unknown names are logged
+// and ignored.
+func SetTheme(name string) {
+	if name == "" || name == "default" {
+		return
+	}
+	theme, ok := themes[name]
+	if !ok {
+		config.WarnLog("Unknown theme %q, using the default", name)
+		return
+	}
+	for _, role := range []struct {
+		spec   string
+		fg, bg *string
+	}{
+		{theme.Red, &colorRed, &bgRed},
+		{theme.Green, &colorGreen, &bgGreen},
+		{theme.Yellow, &colorYellow, &bgYellow},
+		{theme.Blue, &colorBlue, &bgBlue},
+		{theme.Magenta, &colorMagenta, &bgMagenta},
+		{theme.Cyan, &colorCyan, &bgCyan},
+		{theme.Gray, &colorGray, nil},
+	} {
+		*role.fg, _ = colorCode(role.spec, false)
+		if role.bg != nil {
+			*role.bg, _ = colorCode(role.spec, true)
+		}
+	}
+}
+
+// colorNames are the 16 basic ANSI colors by their foreground code
+var colorNames = map[string]int{
+	"black": 30, "red": 31, "green": 32, "yellow": 33, "blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+	"gray": 90, "grey": 90, "bright-red": 91, "bright-green": 92, "bright-yellow": 93,
+	"bright-blue": 94, "bright-magenta": 95, "bright-cyan": 96, "bright-white": 97,
+}
+
+// colorCode returns the escape sequence for a color name, 256-color
+// number or #rrggbb value, as the background color if bg is set
+func colorCode(spec string, bg bool) (string, bool) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if code, ok := colorNames[spec]; ok {
+		if bg {
+			code += 10
+		}
+		return fmt.Sprintf("\033[%dm", code), true
+	}
+	layer := 38
+	if bg {
+		layer = 48
+	}
+	if n, err := strconv.Atoi(spec); err == nil && n >= 0 && n <= 255 {
+		return fmt.Sprintf("\033[%d;5;%dm", layer, n), true
+	}
+	if len(spec) == 7 && spec[0] == '#' {
+		if rgb, err := strconv.ParseUint(spec[1:], 16, 32); err == nil {
+			return fmt.Sprintf("\033[%d;2;%d;%d;%dm", layer, rgb>>16, rgb>>8&0xff, rgb&0xff), true
+		}
+	}
+	return "", false
+}
+
+// segmentColor returns the --colors override for a segment, e.g.
+// "dir=#268bd2/#073642,git=magenta", else the given colors. A missing
+// background keeps the given one.
+func segmentColor(segment, fg, bg string) (string, string) {
+	list := config.Get().Colors
+	if list == "" {
+		return fg, bg
+	}
+	for _, entry := range strings.Split(list, ",") {
+		name, spec, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) != segment {
+			continue
+		}
+		fgSpec, bgSpec, hasBg := strings.Cut(spec, "/")
+		if code, ok := colorCode(fgSpec, false); ok {
+			fg = downgrade(code)
+		} else if strings.TrimSpace(fgSpec) != "" {
+			config.WarnLog("Ignoring color %q for %s", fgSpec, segment)
+		}
+		if hasBg {
+			if code, ok := colorCode(bgSpec, true); ok {
+				bg = downgrade(code)
+			} else {
+				config.WarnLog("Ignoring background color %q for %s", bgSpec, segment)
+			}
+		}
+	}
+	return fg, bg
+}
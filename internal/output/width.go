@@ -0,0 +1,266 @@
+package output
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// Variation selectors asking for the emoji (usually two cells wide) or text
+// (one cell) presentation of the preceding glyph
+const (
+	emojiPresentation = '\uFE0F'
+	textPresentation  = '\uFE0E'
+)
+
+// prefixCells is the width emoji prefixes are padded to when --emoji-style
+// or --glyph-widths is set, so the text after them lines up
+const prefixCells = 2
+
+// emojiPrefix applies --emoji-style to an emoji info prefix like "📁 ":
+// "emoji" and "text" add the matching presentation selector, "none" drops
+// the prefix. Unless left at "auto" without width overrides, the glyph is
+// padded to prefixCells by its (possibly overridden) width.
+func emojiPrefix(prefix string, cfg *config.Config) string {
+	glyph := strings.TrimRight(strings.TrimSuffix(prefix, " "), string([]rune{emojiPresentation, textPresentation}))
+	switch cfg.EmojiStyle {
+	case "none":
+		return ""
+	case "emoji":
+		glyph += string(emojiPresentation)
+	case "text":
+		glyph += string(textPresentation)
+	default:
+		if cfg.GlyphWidths == "" {
+			return prefix
+		}
+	}
+	return glyph + strings.Repeat(" ", max(1, prefixCells-displayWidth(glyph, glyphWidths(cfg))+1))
+}
+
+// glyphWidths parses --glyph-widths, e.g. "📁=1,⚙=2" or "U+2699=2"
+func glyphWidths(cfg *config.Config) map[rune]int {
+	if cfg.GlyphWidths == "" {
+		return nil
+	}
+	widths := make(map[rune]int)
+	for _, entry := range strings.Split(cfg.GlyphWidths, ",") {
+		glyph, width, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		w, err := strconv.Atoi(strings.TrimSpace(width))
+		if !ok || err != nil || w < 0 {
+			config.WarnLog("Ignoring glyph width %q", entry)
+			continue
+		}
+		if hex, found := strings.CutPrefix(strings.ToUpper(glyph), "U+"); found {
+			if n, err := strconv.ParseUint(hex, 16, 32); err == nil {
+				widths[rune(n)] = w
+			}
+			continue
+		}
+		if r, size := utf8.DecodeRuneInString(glyph); size == len(glyph) && r != utf8.RuneError {
+			widths[r] = w
+		}
+	}
+	return widths
+}
+
+// displayWidth returns how many terminal cells s takes, skipping ANSI escape
+// sequences. Overrides take precedence over the built-in guess, which counts
+// wide East Asian characters and emoji as two cells and takes presentation
+// selectors, skin tone modifiers and zero-width-joined emoji sequences
+// (drawn as one glyph) into account.
+func displayWidth(s string, overrides map[rune]int) int {
+	width := 0
+	prev := 0 // width of the previous glyph, for presentation selectors
+	var prevRune rune
+	joined := false // the previous rune was a zero-width joiner
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			// CSI sequence: ESC [ parameters final-byte
+			j := i + 1
+			if j < len(s) && s[j] == '[' {
+				j++
+				for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+					j++
+				}
+				j++
+			}
+			i = j
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		switch {
+		case r == emojiPresentation || r == textPresentation:
+			if _, ok := overrides[prevRune]; !ok && prev > 0 {
+				w := 1
+				if r == emojiPresentation {
+					w = 2
+				}
+				width += w - prev
+				prev = w
+			}
+			continue
+		case r == zeroWidthJoiner:
+			joined = true
+			continue
+		case joined:
+			// Part of the glyph before the joiner, e.g. 👩‍💻
+			joined = false
+			continue
+		case r >= 0x1f3fb && r <= 0x1f3ff && prev == 2:
+			// Skin tone modifier of the emoji before it
+			continue
+		}
+		w, ok := overrides[r]
+		if !ok {
+			w = runeWidth(r)
+		}
+		width += w
+		prev, prevRune = w, r
+	}
+	return width
+}
+
+const zeroWidthJoiner = '\u200D'
+
+// wideSymbols are the symbols below the emoji blocks that terminals draw
+// as emoji, two cells wide, without a presentation selector
+var wideSymbols = []rune{
+	'⌚', '⌛', '⏩', '⏪', '⏫', '⏬', '⏰', '⏳', '◽', '◾', '☔', '☕', '♿', '⚓', '⚡',
+	'⚪', '⚫', '⚽', '⚾', '⛄', '⛅', '⛎', '⛔', '⛪', '⛲', '⛳', '⛵', '⛺', '⛽', '✅',
+	'✊', '✋', '✨', '❌', '❎', '❓', '❔', '❕', '❗', '➕', '➖', '➗', '➰', '➿', '⬛',
+	'⬜', '⭐', '⭕',
+}
+
+// runeWidth guesses the cells a rune takes without presentation selectors
+func runeWidth(r rune) int {
+	switch {
+	case r == zeroWidthJoiner || (r >= 0x0300 && r <= 0x036f) || (r >= 0x200b && r <= 0x200f):
+		// Joiners, zero-width spaces, direction marks and combining marks
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2648 && r <= 0x2653, // Zodiac signs
+		r >= 0x2e80 && r <= 0xa4cf, // CJK
+		r >= 0xac00 && r <= 0xd7a3, // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff, // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f, // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60, // Fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f, // Pictographs and emoticons
+		r >= 0x1f680 && r <= 0x1f6ff, // Transport and map symbols
+		r >= 0x1f900 && r <= 0x1faff, // Supplemental and extended pictographs
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	case r >= 0x231a && r <= 0x2b55 && slices.Contains(wideSymbols, r):
+		return 2
+	}
+	// Including regional indicators, which terminals draw as a two-cell
+	// flag per pair
+	return 1
+}
+
+// lineWidth returns the width lines are fitted into: --max-width, else
+// with --auto-width the terminal width Claude Code reports or $COLUMNS,
+// else 0 for no limit
+func lineWidth(cfg *config.Config, sess *types.SessionInput) int {
+	if cfg.MaxWidth > 0 {
+		return cfg.MaxWidth
+	}
+	if !cfg.AutoWidth {
+		return 0
+	}
+	if sess != nil && sess.TerminalWidth > 0 {
+		return sess.TerminalWidth
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 0
+}
+
+// overflowPriority orders the segments by which are dropped first when a
+// line is too wide: supplementary details and the cost before the
+// directory, model and 5h usage
+var overflowPriority = []string{
+	"version", "history", "commits", "base", "note", "style", "changes", "summary", "duration",
+	"session", "cost", "subscription", "opus", "usage7d", "todos", "agents", "tools",
+	"errors", "context", "git", "dir", "model", "compact", "usage",
+}
+
+// fitWidth fits each line that is wider than maxWidth cells: first it
+// switches segments to their short forms, then it drops segments, lowest
+// priority first each time, until the line fits or only literal text is
+// left. It returns the remaining lines and the dropped tokens, in template
+// order.
+func fitWidth(lines [][]templateToken, maxWidth int, sep string, overrides map[rune]int) ([][]templateToken, []templateToken) {
+	rank := make(map[string]int, len(overflowPriority))
+	for i, name := range overflowPriority {
+		rank[name] = i
+	}
+
+	kept := make([][]bool, len(lines))
+	for l, line := range lines {
+		kept[l] = make([]bool, len(line))
+		for i := range line {
+			kept[l][i] = true
+		}
+		for {
+			var visible []templateToken
+			for i, token := range line {
+				if kept[l][i] {
+					visible = append(visible, token)
+				}
+			}
+			if displayWidth(joinTokens(visible, sep), overrides) <= maxWidth {
+				break
+			}
+			shorten := -1
+			for i, token := range line {
+				if kept[l][i] && token.short != "" && (shorten < 0 || rank[token.segment] < rank[line[shorten].segment]) {
+					shorten = i
+				}
+			}
+			if shorten >= 0 {
+				line[shorten].text, line[shorten].short = line[shorten].short, ""
+				continue
+			}
+			drop := -1
+			for i, token := range line {
+				if kept[l][i] && token.segment != "" && (drop < 0 || rank[token.segment] < rank[line[drop].segment]) {
+					drop = i
+				}
+			}
+			if drop < 0 {
+				break
+			}
+			kept[l][drop] = false
+		}
+	}
+
+	var fitted [][]templateToken
+	var overflow []templateToken
+	for l, line := range lines {
+		var tokens []templateToken
+		for i, token := range line {
+			if kept[l][i] {
+				tokens = append(tokens, token)
+			} else {
+				overflow = append(overflow, token)
+			}
+		}
+		if !blankLine(tokens) {
+			fitted = append(fitted, tokens)
+		}
+	}
+	if len(overflow) > 0 {
+		config.DebugLog("%d segments don't fit in %d cells", len(overflow), maxWidth)
+	}
+	return fitted, overflow
+}
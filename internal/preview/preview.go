@@ -0,0 +1,94 @@
+package preview
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/output"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// fixtures are the scenarios as JSON, one file per scenario
+//
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// DisplayModes are the display modes Render shows by default
+var DisplayModes = []string{"colors", "minimal", "background", "accessible"}
+
+// Scenario is synthetic data for a statusline to render, as of At
+type Scenario struct {
+	Name        string            `json:"-"`
+	Description string            `json:"description"`
+	At          time.Time         `json:"at"`
+	Data        *types.StatusData `json:"data"`
+}
+
+// Names lists the scenarios, sorted
+func Names() []string {
+	entries, _ := fixtures.ReadDir("fixtures")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load reads the named scenario
+func Load(name string) (*Scenario, error) {
+	data, err := fixtures.ReadFile(path.Join("fixtures", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("unknown scenario %q, want one of %s", name, strings.Join(Names(), ", "))
+	}
+	s := &Scenario{Name: name}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("scenario %s: %v", name, err)
+	}
+	return s, nil
+}
+
+// Options choose the renders Render writes
+type Options struct {
+	Modes      []string // display modes
+	Themes     []string // themes, for the display modes that have colors
+	Background string   // "dark" or "light", for the default theme
+	ColorDepth string   // "truecolor", "256" or "16"
+}
+
+// Render writes the scenario as the statusline renders it with the current
+// configuration in each display mode and theme. The accessible mode has no
+// colors, so it is rendered once. The configuration and palette are left
+// as the last render set them.
+func Render(w io.Writer, s *Scenario, opts Options) {
+	output.SetClock(func() time.Time { return s.At })
+	defer output.SetClock(time.Now)
+
+	cfg := config.Get()
+	fmt.Fprintf(w, "Scenario %s: %s\n", s.Name, s.Description)
+	for _, mode := range opts.Modes {
+		cfg.DisplayMode = mode
+		themes := opts.Themes
+		colorless := mode == "accessible" || cfg.NoColor
+		if colorless {
+			themes = themes[:min(len(themes), 1)]
+		}
+		for _, theme := range themes {
+			output.SetBackground(opts.Background)
+			output.SetTheme(theme)
+			output.SetColorDepth(opts.ColorDepth)
+			label := mode + ", " + theme
+			if colorless {
+				label = mode
+			}
+			fmt.Fprintf(w, "\n%s:\n%s\n", label, output.Format(s.Data))
+		}
+	}
+}
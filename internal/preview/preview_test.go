@@ -0,0 +1,47 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+func TestScenarios(t *testing.T) {
+	orig := *config.Get()
+	defer func() { *config.Get() = orig }()
+	*config.Get() = config.Config{ShowTools: true, ShowTodos: true, ShowDuration: true, ShowContext: true}
+
+	names := Names()
+	for _, want := range []string{"clean", "heavy-usage", "rebase"} {
+		if !strings.Contains(strings.Join(names, ","), want) {
+			t.Errorf("Names() = %v, missing %s", names, want)
+		}
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			s, err := Load(name)
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			if s.Description == "" || s.At.IsZero() || s.Data == nil || !s.Data.Git.IsRepo {
+				t.Fatalf("Load() = %+v, want a description, a time and data", s)
+			}
+
+			var out strings.Builder
+			Render(&out, s, Options{Modes: DisplayModes, Themes: []string{"default", "nord"}, Background: "dark", ColorDepth: "truecolor"})
+			for _, label := range []string{"colors, default:", "colors, nord:", "background, nord:", "\naccessible:\ndirectory "} {
+				if !strings.Contains(out.String(), label) {
+					t.Errorf("Render() has no %q in\n%s", label, out.String())
+				}
+			}
+			if strings.Contains(out.String(), "accessible, nord") {
+				t.Error("Render() repeated the accessible mode per theme")
+			}
+		})
+	}
+
+	if _, err := Load("nope"); err == nil || !strings.Contains(err.Error(), "heavy-usage") {
+		t.Errorf("Load(nope) error = %v, want the known scenarios", err)
+	}
+}
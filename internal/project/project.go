@@ -0,0 +1,118 @@
+// Package project finds the name of the project a directory belongs to
+// from its package manifest.
+package project
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// manifests are the files naming a project, in order of preference when a
+// directory has several
+var manifests = []struct {
+	file  string
+	parse func(data []byte) string
+}{
+	{"go.mod", goModule},
+	{"package.json", packageJSON},
+	{"Cargo.toml", func(data []byte) string { return tomlName(data, "package") }},
+	{"pyproject.toml", func(data []byte) string {
+		if name := tomlName(data, "project"); name != "" {
+			return name
+		}
+		return tomlName(data, "tool.poetry")
+	}},
+}
+
+// Name returns the name in the nearest manifest at or above dir (empty =
+// the working directory), or "" if there is none. Manifests without a
+// name, like a Cargo workspace root, are skipped.
+func Name(dir string) string {
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		for _, m := range manifests {
+			data, err := os.ReadFile(filepath.Join(dir, m.file))
+			if err != nil {
+				continue
+			}
+			if name := m.parse(data); name != "" {
+				return name
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// goModule returns the last element of the module path, without a major
+// version suffix: github.com/org/tool/v2 is "tool"
+func goModule(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "module" {
+			continue
+		}
+		module := strings.Trim(fields[1], `"`)
+		name := path.Base(module)
+		if majorVersion.MatchString(name) && path.Dir(module) != "." {
+			name = path.Base(path.Dir(module))
+		}
+		return name
+	}
+	return ""
+}
+
+func packageJSON(data []byte) string {
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return ""
+	}
+	return pkg.Name
+}
+
+// tomlName returns the name key of a TOML table. Only the simple form
+// manifests use is understood: name = "value" on its own line.
+func tomlName(data []byte, table string) string {
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			current = strings.TrimSpace(strings.Trim(line, "[]"))
+			continue
+		}
+		if current != table {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "name" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return strings.Trim(value, `"'`)
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		file := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module github.com/acme/monorepo/v2\n\ngo 1.21\n")
+	write("services/api/go.mod", "// API server\nmodule github.com/acme/monorepo/services/api\n")
+	write("web/package.json", `{"name": "@acme/web", "private": true}`)
+	write("crates/Cargo.toml", "[workspace]\nmembers = [\"parser\"]\n")
+	write("crates/parser/Cargo.toml", "[package]\nname = \"acme-parser\" # the parser\nversion = \"0.1.0\"\n\n[dependencies]\nname = \"not this\"\n")
+	write("py/pyproject.toml", "[build-system]\nrequires = [\"setuptools\"]\n\n[project]\nname = \"acme-tools\"\n")
+	write("poetry/pyproject.toml", "[tool.poetry]\nname = 'acme-legacy'\n")
+	os.MkdirAll(filepath.Join(root, "services", "api", "internal", "handlers"), 0755)
+
+	tests := []struct {
+		dir, want string
+	}{
+		{"", "monorepo"},
+		{"services/api", "api"},
+		{"services/api/internal/handlers", "api"},
+		{"services", "monorepo"},
+		{"web", "@acme/web"},
+		{"crates/parser", "acme-parser"},
+		{"crates", "monorepo"}, // a workspace has no name of its own
+		{"py", "acme-tools"},
+		{"poetry", "acme-legacy"},
+	}
+	for _, tt := range tests {
+		if got := Name(filepath.Join(root, tt.dir)); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package rendercache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+const (
+	// waitForOther is how long we wait for a concurrent invocation to finish
+	// rendering before giving up and computing the output ourselves
+	waitForOther = 500 * time.Millisecond
+	pollInterval = 20 * time.Millisecond
+	// staleLockAge is the age after which a leftover lock is ignored
+	staleLockAge = 5 * time.Second
+	// pruneAge is the age after which other keys' results are removed, unless
+	// the ttl is longer
+	pruneAge = time.Minute
+)
+
+// Key derives a cache key from everything that influences the rendered output
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Get returns the rendered output for key. If another invocation rendered
+// the same key within ttl, its output is reused. Otherwise compute is called
+// by the first invocation to take the lock, while concurrent invocations wait
+// briefly for its result. A ttl <= 0 disables the cache.
+func Get(key string, ttl time.Duration, compute func() string) string {
+	if ttl <= 0 {
+		return compute()
+	}
+
+	resultFile := filepath.Join(config.CacheDir(), "render-"+key+".txt")
+	lockFile := resultFile + ".lock"
+
+	if out, ok := readFresh(resultFile, ttl); ok {
+		config.DebugLog("Using shared render result %s", key)
+		return out
+	}
+
+	lock, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, config.PrivateFileMode)
+	if err != nil {
+		if info, statErr := os.Stat(lockFile); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockFile)
+			config.DebugLog("Removed stale render lock %s", key)
+			return compute()
+		}
+
+		// Another invocation is rendering the same key, wait for it
+		deadline := time.Now().Add(waitForOther)
+		for time.Now().Before(deadline) {
+			time.Sleep(pollInterval)
+			if out, ok := readFresh(resultFile, ttl); ok {
+				config.DebugLog("Reused render result %s from concurrent invocation", key)
+				return out
+			}
+		}
+		config.WarnLog("Timed out waiting for render result %s", key)
+		return compute()
+	}
+	lock.Close()
+	defer os.Remove(lockFile)
+
+	out := compute()
+
+	// Write via rename so readers never see a partial result
+	tmpFile := resultFile + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(out), config.PrivateFileMode); err == nil {
+		if err := os.Rename(tmpFile, resultFile); err != nil {
+			os.Remove(tmpFile)
+		}
+	}
+	prune(max(ttl, pruneAge))
+
+	return out
+}
+
+// prune removes render results, and leftover locks and temporary files,
+// older than maxAge. Every distinct input gets a result file of its own, so
+// they would otherwise pile up.
+func prune(maxAge time.Duration) {
+	files, _ := filepath.Glob(filepath.Join(config.CacheDir(), "render-*"))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > maxAge {
+			os.Remove(file)
+		}
+	}
+}
+
+func readFresh(file string, ttl time.Duration) (string, bool) {
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return "", false
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,137 @@
+package rendercache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setupTestHome(t *testing.T) func() {
+	t.Helper()
+	dir := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	return func() { os.Setenv("HOME", origHome) }
+}
+
+func TestGet_ReusesFreshResult(t *testing.T) {
+	defer setupTestHome(t)()
+
+	calls := 0
+	compute := func() string {
+		calls++
+		return "statusline"
+	}
+
+	key := Key("stdin", "/repo")
+	if out := Get(key, time.Second, compute); out != "statusline" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if out := Get(key, time.Second, compute); out != "statusline" {
+		t.Fatalf("unexpected cached output %q", out)
+	}
+	if calls != 1 {
+		t.Errorf("expected compute to run once, ran %d times", calls)
+	}
+}
+
+func TestGet_ExpiresAfterTTL(t *testing.T) {
+	defer setupTestHome(t)()
+
+	calls := 0
+	compute := func() string {
+		calls++
+		return "statusline"
+	}
+
+	key := Key("stdin")
+	Get(key, 50*time.Millisecond, compute)
+	time.Sleep(80 * time.Millisecond)
+	Get(key, 50*time.Millisecond, compute)
+
+	if calls != 2 {
+		t.Errorf("expected compute to run twice after expiry, ran %d times", calls)
+	}
+}
+
+func TestGet_DisabledWithZeroTTL(t *testing.T) {
+	defer setupTestHome(t)()
+
+	calls := 0
+	compute := func() string {
+		calls++
+		return "x"
+	}
+	Get("k", 0, compute)
+	Get("k", 0, compute)
+
+	if calls != 2 {
+		t.Errorf("expected compute on every call with ttl=0, ran %d times", calls)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("HOME"), ".cache", "claude-code-statusline", "render-k.txt")); err == nil {
+		t.Error("expected no result file with ttl=0")
+	}
+}
+
+func TestGet_ConcurrentInvocationsShareResult(t *testing.T) {
+	defer setupTestHome(t)()
+
+	var calls int32
+	compute := func() string {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return "shared"
+	}
+
+	key := Key("same-input")
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out := Get(key, time.Second, compute); out != "shared" {
+				t.Errorf("unexpected output %q", out)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected a single computation, got %d", calls)
+	}
+}
+
+func TestGet_PrunesOldResults(t *testing.T) {
+	defer setupTestHome(t)()
+
+	dir := filepath.Join(os.Getenv("HOME"), ".cache", "claude-code-statusline")
+	os.MkdirAll(dir, 0700)
+	old := time.Now().Add(-2 * pruneAge)
+	for _, name := range []string{"render-old.txt", "render-old.txt.lock", "render-recent.txt", "usage.json"} {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte("x"), 0600)
+		if name != "render-recent.txt" {
+			os.Chtimes(file, old, old)
+		}
+	}
+
+	Get(Key("new"), time.Second, func() string { return "new" })
+
+	for name, want := range map[string]bool{"render-old.txt": false, "render-old.txt.lock": false, "render-recent.txt": true, "usage.json": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", name, err == nil, want)
+		}
+	}
+}
+
+func TestKey_DiffersByInput(t *testing.T) {
+	if Key("a", "b") == Key("ab") {
+		t.Error("expected part boundaries to affect the key")
+	}
+	if Key("a") != Key("a") {
+		t.Error("expected keys to be deterministic")
+	}
+}
@@ -0,0 +1,363 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/cost"
+	"github.com/erwint/claude-code-statusline/internal/transcript"
+)
+
+// CostSummary writes the daily/weekly/monthly totals and notes how much of
+// the spend was estimated with default pricing
+func CostSummary(w io.Writer, cache *cost.CostCache, now time.Time) {
+	cfg := config.Get()
+	stats := cost.AggregateStats(cache, now)
+
+	labels := [3]string{"Today", "This week", "This month"}
+	if cfg.AggregationMode == "sliding" {
+		labels = [3]string{"Last 24h", "Last 7 days", "Last 30 days"}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s:\t$%.2f\n", labels[0], stats.DailyCost)
+	fmt.Fprintf(tw, "%s:\t$%.2f\n", labels[1], stats.WeeklyCost)
+	fmt.Fprintf(tw, "%s:\t$%.2f\n", labels[2], stats.MonthlyCost)
+	tw.Flush()
+
+	forecast := cost.ForecastMonth(cache, now, cfg.BudgetMonthly)
+	fmt.Fprintf(w, "\nMonth-end forecast: $%.2f (recent average $%.2f/day)\n", forecast.Projected, forecast.DailyRate)
+	if cfg.BudgetMonthly > 0 {
+		switch {
+		case forecast.BudgetOut.IsZero():
+			fmt.Fprintf(w, "Monthly budget $%.2f: lasts the month\n", cfg.BudgetMonthly)
+		case forecast.MonthToDate >= cfg.BudgetMonthly:
+			fmt.Fprintf(w, "Monthly budget $%.2f: exceeded by $%.2f\n", cfg.BudgetMonthly, forecast.MonthToDate-cfg.BudgetMonthly)
+		default:
+			fmt.Fprintf(w, "Monthly budget $%.2f: runs out ~%s\n", cfg.BudgetMonthly, forecast.BudgetOut.Format("Jan 2"))
+		}
+	}
+
+	if len(cache.UnknownModels) > 0 {
+		var estimated float64
+		for _, m := range cache.UnknownModels {
+			estimated += m.EstimatedCost
+		}
+		fmt.Fprintf(w, "\n$%.2f from %d unknown model(s) was estimated at default rates (see --unknown-models)\n",
+			estimated, len(cache.UnknownModels))
+	}
+}
+
+// UnknownModels writes a table of models that had no pricing entry
+func UnknownModels(w io.Writer, cache *cost.CostCache) {
+	if len(cache.UnknownModels) == 0 {
+		fmt.Fprintln(w, "All models have pricing entries; no costs were estimated.")
+		return
+	}
+
+	names := make([]string, 0, len(cache.UnknownModels))
+	for name := range cache.UnknownModels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return cache.UnknownModels[names[i]].EstimatedCost > cache.UnknownModels[names[j]].EstimatedCost
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tMESSAGES\tINPUT\tOUTPUT\tCACHE WRITE\tCACHE READ\tEST. COST\tLAST SEEN")
+	var total float64
+	for _, name := range names {
+		m := cache.UnknownModels[name]
+		total += m.EstimatedCost
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t$%.2f\t%s\n",
+			name, m.Messages, m.InputTokens, m.OutputTokens, m.CacheCreationTokens, m.CacheReadTokens, m.EstimatedCost, m.LastSeen)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nTotal estimated at default rates: $%.2f\n", total)
+}
+
+// History writes a table of the last days (today included) from the cost
+// cache: cost, messages and tokens per day, with totals. asCSV writes CSV
+// without the totals row instead.
+func History(w io.Writer, cache *cost.CostCache, now time.Time, days int, asCSV bool) {
+	header := []string{"DATE", "COST", "MESSAGES", "INPUT", "OUTPUT", "CACHE WRITE", "CACHE READ"}
+
+	var rows [][]string
+	var totalCost float64
+	var total cost.DayStats
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i).Format("2006-01-02")
+		c := cache.DayCosts[day]
+		s := cache.DayStats[day]
+		if s == nil {
+			s = &cost.DayStats{}
+		}
+		totalCost += c
+		total.Messages += s.Messages
+		total.InputTokens += s.InputTokens
+		total.OutputTokens += s.OutputTokens
+		total.CacheCreationTokens += s.CacheCreationTokens
+		total.CacheReadTokens += s.CacheReadTokens
+		rows = append(rows, historyRow(day, c, s, !asCSV))
+	}
+
+	if asCSV {
+		cw := csv.NewWriter(w)
+		for i := range header {
+			header[i] = strings.ReplaceAll(strings.ToLower(header[i]), " ", "_")
+		}
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+	fmt.Fprintln(tw, strings.Join(historyRow("TOTAL", totalCost, &total, true), "\t")+"\t")
+	tw.Flush()
+
+	if retention := config.Get().RetentionDays; retention > 0 && days > retention {
+		fmt.Fprintf(w, "\nOnly the last %d days are kept (--retention-days)\n", retention)
+	}
+}
+
+// historyRow formats one row of the history table; dollars adds the
+// currency sign
+func historyRow(label string, c float64, s *cost.DayStats, dollars bool) []string {
+	costStr := strconv.FormatFloat(c, 'f', 2, 64)
+	if dollars {
+		costStr = "$" + costStr
+	}
+	return []string{
+		label,
+		costStr,
+		strconv.Itoa(s.Messages),
+		strconv.FormatInt(s.InputTokens, 10),
+		strconv.FormatInt(s.OutputTokens, 10),
+		strconv.FormatInt(s.CacheCreationTokens, 10),
+		strconv.FormatInt(s.CacheReadTokens, 10),
+	}
+}
+
+// TodoCosts writes the estimated cost of each todo of a session, most
+// expensive first, with the average per completed todo
+func TodoCosts(w io.Writer, stats *transcript.TodoStats) {
+	if len(stats.Todos) == 0 {
+		fmt.Fprintf(w, "No todos were worked on in this session ($%.2f total).\n", stats.Total)
+		return
+	}
+
+	todos := append([]transcript.TodoCost(nil), stats.Todos...)
+	sort.SliceStable(todos, func(i, j int) bool { return todos[i].Cost > todos[j].Cost })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TODO\tSTATUS\tMESSAGES\tCOST")
+	for _, todo := range todos {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t$%.2f\n", todo.Subject, todo.Status, todo.Messages, todo.Cost)
+	}
+	if stats.UnassignedMessages > 0 {
+		fmt.Fprintf(tw, "(no todo in progress)\t\t%d\t$%.2f\n", stats.UnassignedMessages, stats.Unassigned)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nSession total: $%.2f\n", stats.Total)
+	if completed := stats.Completed(); len(completed) > 0 {
+		var sum float64
+		for _, todo := range completed {
+			sum += todo.Cost
+		}
+		fmt.Fprintf(w, "Average per completed todo: $%.2f (%d completed)\n", sum/float64(len(completed)), len(completed))
+	}
+}
+
+// PricingDrift writes the differences between a pricing table and the
+// published rates
+func PricingDrift(w io.Writer, label string, drifts []cost.PricingDrift) {
+	if len(drifts) == 0 {
+		fmt.Fprintf(w, "%s: matches published pricing\n", label)
+		return
+	}
+
+	fmt.Fprintf(w, "%s: %d difference(s) from published pricing\n", label, len(drifts))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  MODEL\tFIELD\tOURS\tPUBLISHED")
+	for _, d := range drifts {
+		if d.Field == "missing" {
+			fmt.Fprintf(tw, "  %s\tmissing\t-\t$%g input\n", d.Model, d.Published)
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t$%g\t$%g\n", d.Model, d.Field, d.Ours, d.Published)
+	}
+	tw.Flush()
+}
+
+// Weekly writes a summary of an activity period for pasting into a weekly
+// update: totals, busiest days, top projects and models and peak hours.
+// markdown selects Markdown headings and tables over plain text.
+func Weekly(w io.Writer, a *cost.Activity, markdown bool) {
+	last := a.Until.Add(-time.Nanosecond)
+	title := fmt.Sprintf("Claude usage %s – %s", a.Since.Format("Jan 2"), last.Format("Jan 2, 2006"))
+	total := fmt.Sprintf("$%.2f across %d session(s), %d message(s)", a.Total, len(a.Sessions), a.Messages)
+	if markdown {
+		fmt.Fprintf(w, "## %s\n\n**Total:** %s\n", title, total)
+	} else {
+		fmt.Fprintf(w, "%s\n\nTotal: %s\n", title, total)
+	}
+	if a.Messages == 0 {
+		return
+	}
+
+	var days [][2]string
+	for _, day := range topKeys(a.Days, 3) {
+		t, _ := time.ParseInLocation("2006-01-02", day, time.Local)
+		days = append(days, [2]string{t.Format("Mon Jan 2"), fmt.Sprintf("$%.2f", a.Days[day])})
+	}
+	writeTable(w, markdown, "Busiest days", "Day", days)
+
+	var projects [][2]string
+	for _, name := range topKeys(a.Projects, 5) {
+		projects = append(projects, [2]string{name, share(a.Projects[name], a.Total)})
+	}
+	writeTable(w, markdown, "Top projects", "Project", projects)
+
+	var models [][2]string
+	for _, name := range topKeys(a.Models, 5) {
+		models = append(models, [2]string{name, share(a.Models[name], a.Total)})
+	}
+	writeTable(w, markdown, "Top models", "Model", models)
+
+	hourCosts := make(map[string]float64)
+	for hour, c := range a.Hours {
+		if c > 0 {
+			hourCosts[fmt.Sprintf("%02d:00–%02d:00", hour, (hour+1)%24)] = c
+		}
+	}
+	var hours [][2]string
+	for _, name := range topKeys(hourCosts, 3) {
+		hours = append(hours, [2]string{name, share(hourCosts[name], a.Total)})
+	}
+	writeTable(w, markdown, "Peak hours", "Hour", hours)
+}
+
+// writeTable writes a titled two-column table of names and costs; header
+// names the first column in Markdown
+func writeTable(w io.Writer, markdown bool, title, header string, rows [][2]string) {
+	if markdown {
+		fmt.Fprintf(w, "\n### %s\n\n| %s | Cost |\n|---|---:|\n", title, header)
+		for _, row := range rows {
+			fmt.Fprintf(w, "| %s | %s |\n", row[0], row[1])
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(tw, "  %s\t%s\n", row[0], row[1])
+	}
+	tw.Flush()
+}
+
+// topKeys returns up to n keys with the highest values, ties by name
+func topKeys(m map[string]float64, n int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// share formats a cost with its percentage of the total
+func share(c, total float64) string {
+	return fmt.Sprintf("$%.2f (%.0f%%)", c, c/total*100)
+}
+
+// exportRow is one row of Export's JSON output
+type exportRow struct {
+	Date                string  `json:"date"`
+	Project             string  `json:"project"`
+	Model               string  `json:"model"`
+	Cost                float64 `json:"cost"`
+	Messages            int     `json:"messages"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_write_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+}
+
+// Export writes the cost of each day, project and model in the activity
+// period as CSV or, with asJSON, a JSON document with the period and
+// total. Costs keep four decimals so the rows add up to the total.
+func Export(w io.Writer, a *cost.Activity, asJSON bool) error {
+	keys := make([]cost.ActivityKey, 0, len(a.Rows))
+	for key := range a.Rows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Day != keys[j].Day {
+			return keys[i].Day < keys[j].Day
+		}
+		if keys[i].Project != keys[j].Project {
+			return keys[i].Project < keys[j].Project
+		}
+		return keys[i].Model < keys[j].Model
+	})
+	rows := make([]exportRow, len(keys))
+	for i, key := range keys {
+		r := a.Rows[key]
+		rows[i] = exportRow{key.Day, key.Project, key.Model, math.Round(r.Cost*1e4) / 1e4, r.Messages,
+			r.InputTokens, r.OutputTokens, r.CacheCreationTokens, r.CacheReadTokens}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			From  string      `json:"from"`
+			To    string      `json:"to"`
+			Total float64     `json:"total"`
+			Rows  []exportRow `json:"rows"`
+		}{a.Since.Format("2006-01-02"), a.Until.AddDate(0, 0, -1).Format("2006-01-02"), math.Round(a.Total*1e4) / 1e4, rows})
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "project", "model", "cost", "messages", "input_tokens", "output_tokens", "cache_write_tokens", "cache_read_tokens"})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.Date,
+			r.Project,
+			r.Model,
+			strconv.FormatFloat(r.Cost, 'f', 4, 64),
+			strconv.Itoa(r.Messages),
+			strconv.FormatInt(r.InputTokens, 10),
+			strconv.FormatInt(r.OutputTokens, 10),
+			strconv.FormatInt(r.CacheCreationTokens, 10),
+			strconv.FormatInt(r.CacheReadTokens, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
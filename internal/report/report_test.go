@@ -0,0 +1,266 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/cost"
+	"github.com/erwint/claude-code-statusline/internal/transcript"
+)
+
+func TestCostSummary(t *testing.T) {
+	config.Get().AggregationMode = "fixed"
+	now := time.Date(2025, 11, 28, 12, 0, 0, 0, time.Local)
+
+	cache := &cost.CostCache{
+		DayCosts: map[string]float64{"2025-11-28": 4.5, "2025-11-27": 1.5},
+		UnknownModels: map[string]*cost.UnknownModelStats{
+			"claude-mystery-9": {Messages: 3, EstimatedCost: 1.25, LastSeen: "2025-11-28"},
+		},
+	}
+
+	var buf bytes.Buffer
+	CostSummary(&buf, cache, now)
+	out := buf.String()
+
+	for _, want := range []string{"Today:", "$4.50", "$6.00", "$1.25 from 1 unknown model(s)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in summary, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestCostSummaryForecast(t *testing.T) {
+	cfg := config.Get()
+	cfg.AggregationMode = "fixed"
+	defer func() { cfg.BudgetMonthly = 0 }()
+
+	now := time.Date(2025, 12, 11, 0, 0, 0, 0, time.Local)
+	cache := &cost.CostCache{DayCosts: map[string]float64{}}
+	for day := 1; day <= 10; day++ {
+		cache.DayCosts[time.Date(2025, 12, day, 0, 0, 0, 0, time.Local).Format("2006-01-02")] = 10
+	}
+
+	tests := []struct {
+		budget float64
+		want   string
+	}{
+		{0, "Month-end forecast: $310.00 (recent average $10.00/day)"},
+		{500, "Monthly budget $500.00: lasts the month"},
+		{205, "Monthly budget $205.00: runs out ~Dec 21"},
+		{80, "Monthly budget $80.00: exceeded by $20.00"},
+	}
+
+	for _, tt := range tests {
+		cfg.BudgetMonthly = tt.budget
+		var buf bytes.Buffer
+		CostSummary(&buf, cache, now)
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("budget %.0f: expected %q in summary, got:\n%s", tt.budget, tt.want, buf.String())
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Date(2025, 12, 3, 12, 0, 0, 0, time.Local)
+	cache := &cost.CostCache{
+		DayCosts: map[string]float64{"2025-12-03": 4.5, "2025-12-01": 1.5, "2025-11-20": 9},
+		DayStats: map[string]*cost.DayStats{
+			"2025-12-03": {Messages: 3, InputTokens: 300, OutputTokens: 30, CacheReadTokens: 3000},
+			"2025-12-01": {Messages: 1, InputTokens: 100, OutputTokens: 10},
+		},
+	}
+
+	var buf bytes.Buffer
+	History(&buf, cache, now, 3, false)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected header, 3 days and totals, got:\n%s", buf.String())
+	}
+	for i, want := range [][]string{
+		{"DATE", "COST", "MESSAGES", "INPUT", "OUTPUT", "CACHE", "WRITE", "CACHE", "READ"},
+		{"2025-12-01", "$1.50", "1", "100", "10", "0", "0"},
+		{"2025-12-02", "$0.00", "0", "0", "0", "0", "0"},
+		{"2025-12-03", "$4.50", "3", "300", "30", "0", "3000"},
+		{"TOTAL", "$6.00", "4", "400", "40", "0", "3000"},
+	} {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("line %d = %q, want %q", i, got, want)
+		}
+	}
+
+	buf.Reset()
+	History(&buf, cache, now, 2, true)
+	want := "date,cost,messages,input,output,cache_write,cache_read\n" +
+		"2025-12-02,0.00,0,0,0,0,0\n" +
+		"2025-12-03,4.50,3,300,30,0,3000\n"
+	if buf.String() != want {
+		t.Errorf("CSV = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTodoCosts(t *testing.T) {
+	stats := &transcript.TodoStats{
+		Todos: []transcript.TodoCost{
+			{Subject: "write parser", Status: "completed", Cost: 1.5, Messages: 4},
+			{Subject: "add tests", Status: "completed", Cost: 4.5, Messages: 9},
+			{Subject: "update docs", Status: "in_progress", Cost: 0.25, Messages: 1},
+		},
+		Total:              6.75,
+		Unassigned:         0.5,
+		UnassignedMessages: 2,
+	}
+
+	var buf bytes.Buffer
+	TodoCosts(&buf, stats)
+	out := buf.String()
+
+	if strings.Index(out, "add tests") > strings.Index(out, "write parser") {
+		t.Errorf("expected the most expensive todo first, got:\n%s", out)
+	}
+	for _, want := range []string{"(no todo in progress)", "Session total: $6.75", "Average per completed todo: $3.00 (2 completed)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	TodoCosts(&buf, &transcript.TodoStats{Total: 2})
+	if !strings.Contains(buf.String(), "No todos were worked on") {
+		t.Errorf("unexpected output without todos: %q", buf.String())
+	}
+}
+
+func TestUnknownModels(t *testing.T) {
+	cache := &cost.CostCache{
+		UnknownModels: map[string]*cost.UnknownModelStats{
+			"cheap-model":  {Messages: 1, InputTokens: 100, EstimatedCost: 0.10, LastSeen: "2025-11-20"},
+			"pricey-model": {Messages: 5, OutputTokens: 5000, EstimatedCost: 2.00, LastSeen: "2025-11-28"},
+		},
+	}
+
+	var buf bytes.Buffer
+	UnknownModels(&buf, cache)
+	out := buf.String()
+
+	if strings.Index(out, "pricey-model") > strings.Index(out, "cheap-model") {
+		t.Errorf("expected models sorted by estimated cost, got:\n%s", out)
+	}
+	if !strings.Contains(out, "$2.10") {
+		t.Errorf("expected total $2.10, got:\n%s", out)
+	}
+
+	buf.Reset()
+	UnknownModels(&buf, &cost.CostCache{})
+	if !strings.Contains(buf.String(), "no costs were estimated") {
+		t.Errorf("expected empty-state message, got: %q", buf.String())
+	}
+}
+
+func TestPricingDrift(t *testing.T) {
+	var buf bytes.Buffer
+	PricingDrift(&buf, "Embedded", nil)
+	if !strings.Contains(buf.String(), "matches published pricing") {
+		t.Errorf("expected match message, got %q", buf.String())
+	}
+
+	buf.Reset()
+	PricingDrift(&buf, "Embedded", []cost.PricingDrift{
+		{Model: "claude-opus-4-5", Field: "input", Ours: 15, Published: 5},
+		{Model: "claude-haiku-4-5", Field: "missing", Published: 1},
+	})
+	out := buf.String()
+	for _, want := range []string{"2 difference(s)", "claude-opus-4-5", "$15", "$5", "missing"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in drift report, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestWeekly(t *testing.T) {
+	since := time.Date(2025, 12, 1, 0, 0, 0, 0, time.Local)
+	a := &cost.Activity{
+		Since:    since,
+		Until:    since.AddDate(0, 0, 7),
+		Total:    100,
+		Messages: 42,
+		Days:     map[string]float64{"2025-12-01": 10, "2025-12-03": 60, "2025-12-04": 30},
+		Projects: map[string]float64{"api": 75, "web": 25},
+		Models:   map[string]float64{"claude-opus-4-5": 80, "claude-sonnet-4-5": 20},
+		Sessions: map[string]bool{"a": true, "b": true, "c": true},
+	}
+	a.Hours[14] = 70
+	a.Hours[9] = 30
+
+	var buf bytes.Buffer
+	Weekly(&buf, a, true)
+	md := buf.String()
+	for _, want := range []string{
+		"## Claude usage Dec 1 – Dec 7, 2025",
+		"**Total:** $100.00 across 3 session(s), 42 message(s)",
+		"| Day | Cost |\n|---|---:|\n| Wed Dec 3 | $60.00 |\n| Thu Dec 4 | $30.00 |",
+		"| api | $75.00 (75%) |",
+		"| claude-opus-4-5 | $80.00 (80%) |",
+		"| 14:00–15:00 | $70.00 (70%) |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in markdown, got:\n%s", want, md)
+		}
+	}
+
+	buf.Reset()
+	Weekly(&buf, a, false)
+	if text := buf.String(); strings.Contains(text, "|") || !strings.Contains(text, "Top projects:") {
+		t.Errorf("expected plain text summary, got:\n%s", text)
+	}
+
+	buf.Reset()
+	Weekly(&buf, &cost.Activity{Since: since, Until: since.AddDate(0, 0, 7)}, true)
+	if out := buf.String(); strings.Contains(out, "Busiest") {
+		t.Errorf("expected only the total for an empty week, got:\n%s", out)
+	}
+}
+
+func TestExport(t *testing.T) {
+	since := time.Date(2025, 11, 1, 0, 0, 0, 0, time.Local)
+	a := &cost.Activity{
+		Since: since,
+		Until: since.AddDate(0, 1, 0),
+		Total: 4.56789,
+		Rows: map[cost.ActivityKey]*cost.ActivityRow{
+			{Day: "2025-11-02", Project: "web", Model: "claude-sonnet-4-5"}: {Cost: 1.23456, DayStats: cost.DayStats{Messages: 2, InputTokens: 100}},
+			{Day: "2025-11-01", Project: "web", Model: "claude-opus-4-5"}:   {Cost: 3.33333, DayStats: cost.DayStats{Messages: 1, OutputTokens: 50}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, a, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "date,project,model,cost,messages,input_tokens,output_tokens,cache_write_tokens,cache_read_tokens\n" +
+		"2025-11-01,web,claude-opus-4-5,3.3333,1,0,50,0,0\n" +
+		"2025-11-02,web,claude-sonnet-4-5,1.2346,2,100,0,0,0\n"
+	if buf.String() != want {
+		t.Errorf("CSV = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := Export(&buf, a, true); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		From, To string
+		Total    float64
+		Rows     []map[string]any
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if doc.From != "2025-11-01" || doc.To != "2025-11-30" || doc.Total != 4.5679 || len(doc.Rows) != 2 || doc.Rows[1]["model"] != "claude-sonnet-4-5" {
+		t.Errorf("JSON = %s", buf.String())
+	}
+}
@@ -15,7 +15,7 @@ func ReadInput() *types.SessionInput {
 	// Check if stdin has data available (non-blocking)
 	stat, err := os.Stdin.Stat()
 	if err != nil {
-		config.DebugLog("stdin stat error: %v", err)
+		config.WarnLog("stdin stat error: %v", err)
 		return nil
 	}
 
@@ -32,7 +32,7 @@ func ReadInput() *types.SessionInput {
 	go func() {
 		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			config.DebugLog("stdin read error: %v", err)
+			config.WarnLog("stdin read error: %v", err)
 			resultCh <- nil
 			return
 		}
@@ -45,7 +45,7 @@ func ReadInput() *types.SessionInput {
 	case data = <-resultCh:
 		config.DebugLog("stdin data received: %d bytes", len(data))
 	case <-time.After(100 * time.Millisecond):
-		config.DebugLog("stdin timeout")
+		config.WarnLog("stdin timeout")
 		return nil
 	}
 
@@ -57,7 +57,7 @@ func ReadInput() *types.SessionInput {
 
 	var session types.SessionInput
 	if err := json.Unmarshal(data, &session); err != nil {
-		config.DebugLog("json unmarshal error: %v", err)
+		config.WarnLog("json unmarshal error: %v", err)
 		return nil
 	}
 
@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// sendInterval is how often a report is sent at most
+const sendInterval = 24 * time.Hour
+
+// Payload is everything a report contains: no costs, usage, paths or
+// identifiers, only which features are turned on
+type Payload struct {
+	Version  string   `json:"version"`
+	OS       string   `json:"os"`
+	Arch     string   `json:"arch"`
+	Features []string `json:"features"`
+}
+
+// State remembers when the last report was sent
+type State struct {
+	LastSent time.Time `json:"last_sent"`
+}
+
+// Collect builds the payload for the current configuration
+func Collect(version string) Payload {
+	cfg := config.Get()
+	p := Payload{Version: version, OS: runtime.GOOS, Arch: runtime.GOARCH}
+
+	for _, name := range config.SegmentNames {
+		if cfg.SegmentEnabled(name) {
+			p.Features = append(p.Features, "segment:"+name)
+		}
+	}
+
+	// Only the choice, never the value of free-form options
+	p.Features = append(p.Features,
+		"display:"+cfg.DisplayMode,
+		"background:"+cfg.Background,
+		"color-depth:"+cfg.ColorDepth,
+		"info:"+cfg.InfoMode,
+		"emoji-style:"+cfg.EmojiStyle,
+		"duration-format:"+cfg.DurationFormat,
+		"aggregation:"+cfg.AggregationMode,
+		"cost-unit:"+cfg.CostUnit,
+		"output:"+cfg.Output,
+		"tools-style:"+cfg.ToolsStyle,
+		"usage-bar:"+cfg.UsageBar,
+		"update-channel:"+cfg.UpdateChannel,
+	)
+	for feature, on := range map[string]bool{
+		"no-color":         cfg.NoColor,
+		"auto-update":      cfg.AutoUpdate,
+		"update-signed":    cfg.UpdatePublicKey != "",
+		"update-pin":       cfg.UpdatePin != "",
+		"custom-format":    cfg.Format != "",
+		"summary-tools":    cfg.SummaryTools != config.DefaultSummaryTools,
+		"spinner":          cfg.Spinner,
+		"custom-segments":  slices.ContainsFunc(cfg.CustomSegments, func(s config.CustomSegment) bool { return s.Expr == nil }),
+		"expr-segments":    slices.ContainsFunc(cfg.CustomSegments, func(s config.CustomSegment) bool { return s.Expr != nil }),
+		"rules":            len(cfg.Rules) > 0,
+		"transcript-tail":  cfg.TranscriptTail != config.DefaultTranscriptTail,
+		"lines":            cfg.Lines > 0,
+		"max-width":        cfg.MaxWidth > 0,
+		"auto-width":       cfg.AutoWidth,
+		"glyph-widths":     cfg.GlyphWidths != "",
+		"theme":            cfg.Theme != "" && cfg.Theme != "default",
+		"custom-colors":    cfg.Colors != "",
+		"git-upstreams":    cfg.GitUpstreams != "auto",
+		"git-scope":        cfg.GitScope != "",
+		"git-untracked-no": cfg.GitUntracked == "no",
+		"git-timeout":      cfg.GitTimeout > 0,
+		"git-last-commit":  cfg.GitLastCommit,
+		"project-name":     cfg.ProjectName,
+		"dir-source":       cfg.DirSource == "project",
+		"cost-sync":        !cfg.CostAsync,
+		"api-base":         cfg.APIBase != "",
+		"profiles":         cfg.ActiveProfile != "",
+		"custom-ttls":      cfg.PricingTTL != config.DefaultPricingTTL || cfg.UpdateTTL != config.DefaultUpdateTTL || cfg.GitTTL != config.DefaultGitTTL || cfg.NoGitCache,
+		"usage-format":     cfg.UsageFormat != "" || cfg.SevenDayFormat != "",
+		"burn-rate":        cfg.BurnRate,
+		"limit-eta":        cfg.LimitETA,
+		"limit-hint":       cfg.LimitHint != "",
+		"model-hint":       cfg.ModelHint != "",
+		"limit-notify":     cfg.LimitNotify,
+		"usage-notify":     cfg.UsageNotify != "",
+		"reset-notify":     cfg.ResetNotify,
+		"budget":           cfg.BudgetMonthly > 0 || cfg.BudgetWeekly > 0 || cfg.BudgetDaily > 0,
+		"budget-percent":   cfg.BudgetPercent,
+		"budget-notify":    cfg.BudgetNotify,
+		"webhook":          cfg.WebhookURL != "",
+		"otlp":             cfg.OTLPEndpoint != "",
+		"cost-breakdown":   cfg.CostBreakdown,
+		"cost-projection":  cfg.CostProjection,
+		"use-daemon":       cfg.UseDaemon,
+		"claude-discovery": cfg.ClaudeDiscovery,
+		"refresh-token":    cfg.RefreshToken,
+	} {
+		if on {
+			p.Features = append(p.Features, feature)
+		}
+	}
+	sort.Strings(p.Features)
+
+	return p
+}
+
+// Status reports whether reports are sent and why (or why not)
+func Status(endpoint string) (bool, string) {
+	switch {
+	case os.Getenv("CLAUDE_STATUS_NO_TELEMETRY") != "":
+		return false, "disabled by CLAUDE_STATUS_NO_TELEMETRY"
+	case os.Getenv("DO_NOT_TRACK") != "" && os.Getenv("DO_NOT_TRACK") != "0":
+		return false, "disabled by DO_NOT_TRACK"
+	case config.Get().Offline:
+		return false, "disabled while offline (--offline)"
+	case !config.Get().Telemetry:
+		return false, "off (opt in with --telemetry or CLAUDE_STATUS_TELEMETRY=true)"
+	case endpoint == "":
+		return false, "opted in, but this build has no telemetry endpoint"
+	}
+	return true, "opted in, sent at most once a day to " + endpoint
+}
+
+// SendDaily sends a report if the user opted in and none was sent in the
+// last day
+func SendDaily(version, endpoint string) {
+	if enabled, _ := Status(endpoint); !enabled {
+		return
+	}
+
+	file := getStateFile()
+	state := loadState(file)
+	if time.Since(state.LastSent) < sendInterval {
+		return
+	}
+
+	// Record first so concurrent invocations don't all send
+	state.LastSent = time.Now()
+	saveState(file, state)
+
+	if err := send(endpoint, Collect(version)); err != nil {
+		config.WarnLog("Telemetry failed: %v", err)
+	}
+}
+
+// send posts a payload to the endpoint (replaced in tests)
+var send = func(endpoint string, p Payload) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func getStateFile() string {
+	return filepath.Join(config.CacheDir(), "telemetry.json")
+}
+
+func loadState(file string) *State {
+	state := &State{}
+	if data, err := os.ReadFile(file); err == nil {
+		json.Unmarshal(data, state)
+	}
+	return state
+}
+
+func saveState(file string, state *State) {
+	data, _ := json.Marshal(state)
+	config.WriteFile(file, data)
+}
@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+// stubSend captures payloads instead of posting them
+func stubSend(t *testing.T) *[]Payload {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CLAUDE_STATUS_NO_TELEMETRY", "")
+	t.Setenv("DO_NOT_TRACK", "")
+
+	var sent []Payload
+	origSend := send
+	send = func(endpoint string, p Payload) error {
+		sent = append(sent, p)
+		return nil
+	}
+	t.Cleanup(func() { send = origSend })
+	return &sent
+}
+
+func withConfig(t *testing.T, c *config.Config) {
+	t.Helper()
+	orig := *config.Get()
+	*config.Get() = *c
+	t.Cleanup(func() { *config.Get() = orig })
+}
+
+func TestCollect_NoValues(t *testing.T) {
+	withConfig(t, &config.Config{
+		DisplayMode:   "colors",
+		InfoMode:      "emoji",
+		Segments:      "git,cost",
+		LimitHint:     "ask jane@example.com",
+		Format:        "{git} /home/jane/secret {cost}",
+		BudgetMonthly: 250,
+	})
+
+	p := Collect("v1.2.3")
+	data, _ := json.Marshal(p)
+	for _, leak := range []string{"jane", "secret", "250"} {
+		if strings.Contains(string(data), leak) {
+			t.Errorf("payload contains option value %q: %s", leak, data)
+		}
+	}
+
+	features := strings.Join(p.Features, " ")
+	for _, want := range []string{"segment:git", "segment:cost", "info:emoji", "limit-hint", "custom-format", "budget"} {
+		if !strings.Contains(features, want) {
+			t.Errorf("expected feature %q, got %v", want, p.Features)
+		}
+	}
+	if strings.Contains(features, "segment:usage") {
+		t.Errorf("expected disabled segments left out, got %v", p.Features)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		optIn    bool
+		env      map[string]string
+		endpoint string
+		want     bool
+	}{
+		{"default off", false, nil, "https://example.com", false},
+		{"opted in", true, nil, "https://example.com", true},
+		{"no endpoint", true, nil, "", false},
+		{"hard off switch", true, map[string]string{"CLAUDE_STATUS_NO_TELEMETRY": "1"}, "https://example.com", false},
+		{"do not track", true, map[string]string{"DO_NOT_TRACK": "1"}, "https://example.com", false},
+		{"do not track zero", true, map[string]string{"DO_NOT_TRACK": "0"}, "https://example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubSend(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			withConfig(t, &config.Config{Telemetry: tt.optIn})
+			if got, reason := Status(tt.endpoint); got != tt.want {
+				t.Errorf("Status() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendDaily(t *testing.T) {
+	sent := stubSend(t)
+
+	withConfig(t, &config.Config{})
+	SendDaily("v1", "https://example.com")
+	if len(*sent) != 0 {
+		t.Fatal("expected nothing sent without opting in")
+	}
+
+	withConfig(t, &config.Config{Telemetry: true})
+	SendDaily("v1", "https://example.com")
+	SendDaily("v1", "https://example.com")
+	if len(*sent) != 1 || (*sent)[0].Version != "v1" {
+		t.Fatalf("expected one report per day, got %v", *sent)
+	}
+
+	file := getStateFile()
+	saveState(file, &State{LastSent: time.Now().Add(-25 * time.Hour)})
+	SendDaily("v1", "https://example.com")
+	if len(*sent) != 2 {
+		t.Errorf("expected a new report after a day, got %d", len(*sent))
+	}
+}
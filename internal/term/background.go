@@ -0,0 +1,99 @@
+package term
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+const (
+	// queryTimeout bounds how long the terminal may take to report its
+	// background color
+	queryTimeout = 100 * time.Millisecond
+	// backgroundCacheTTL is how long a queried background is reused, so the
+	// terminal is asked at most once a day
+	backgroundCacheTTL = 24 * time.Hour
+)
+
+// oscBackground matches a terminal's reply to the OSC 11 background query,
+// e.g. "\033]11;rgb:ffff/ffff/ffff\a"
+var oscBackground = regexp.MustCompile(`\]11;rgb:([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})/([0-9a-fA-F]{1,4})`)
+
+// backgroundCache remembers the last queried background per terminal
+type backgroundCache struct {
+	Terminal   string    `json:"terminal"`
+	Background string    `json:"background"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Background resolves the --background setting to "light" or "dark". With
+// "auto" it uses COLORFGBG if the terminal sets it, otherwise asks the
+// terminal for its background color (OSC 11), falling back to dark.
+func Background(setting string) string {
+	if setting == "light" || setting == "dark" {
+		return setting
+	}
+	if bg := parseColorFGBG(os.Getenv("COLORFGBG")); bg != "" {
+		return bg
+	}
+
+	terminal := os.Getenv("TERM_PROGRAM") + "/" + os.Getenv("TERM")
+	file := filepath.Join(config.CacheDir(), "background.json")
+	var cache backgroundCache
+	if data, err := os.ReadFile(file); err == nil && json.Unmarshal(data, &cache) == nil &&
+		cache.Terminal == terminal && time.Since(cache.CheckedAt) < backgroundCacheTTL {
+		return cache.Background
+	}
+
+	bg := "dark"
+	if reply, err := queryBackground(queryTimeout); err != nil {
+		config.DebugLog("Background query failed: %v", err)
+	} else if parsed := parseOSC11(reply); parsed != "" {
+		bg = parsed
+	}
+
+	data, _ := json.Marshal(backgroundCache{Terminal: terminal, Background: bg, CheckedAt: time.Now()})
+	config.WriteFile(file, data)
+	return bg
+}
+
+// parseColorFGBG reads the background from COLORFGBG ("15;0" or
+// "15;default;0"): ANSI colors 7 and 9-15 are light
+func parseColorFGBG(value string) string {
+	if value == "" {
+		return ""
+	}
+	fields := strings.Split(value, ";")
+	n, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return ""
+	}
+	if n == 7 || (n >= 9 && n <= 15) {
+		return "light"
+	}
+	return "dark"
+}
+
+// parseOSC11 reads the background from an OSC 11 reply by its relative
+// luminance
+func parseOSC11(reply string) string {
+	m := oscBackground.FindStringSubmatch(reply)
+	if m == nil {
+		return ""
+	}
+	var rgb [3]float64
+	for i, hex := range m[1:] {
+		v, _ := strconv.ParseUint(hex, 16, 16)
+		rgb[i] = float64(v) / float64(uint64(1)<<(4*len(hex))-1)
+	}
+	if 0.2126*rgb[0]+0.7152*rgb[1]+0.0722*rgb[2] > 0.5 {
+		return "light"
+	}
+	return "dark"
+}
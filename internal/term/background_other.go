@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package term
+
+import (
+	"errors"
+	"time"
+)
+
+// queryBackground is not supported here; the background comes from
+// COLORFGBG or the --background setting
+func queryBackground(timeout time.Duration) (string, error) {
+	return "", errors.New("background query not supported on this platform")
+}
@@ -0,0 +1,74 @@
+//go:build linux || darwin
+
+package term
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// queryBackground asks the controlling terminal for its background color
+// with OSC 11 and returns the raw reply. The terminal is put in
+// non-canonical mode without echo while waiting, so the reply is neither
+// line-buffered nor printed.
+func queryBackground(timeout time.Duration) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
+
+	fd := tty.Fd()
+	var saved syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, &saved); err != nil {
+		return "", err
+	}
+	raw := saved
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 1 // reads return after 100ms without input
+	if err := ioctl(fd, ioctlSetTermios, &raw); err != nil {
+		return "", err
+	}
+	defer ioctl(fd, ioctlSetTermios, &saved)
+
+	if _, err := tty.WriteString("\033]11;?\033\\"); err != nil {
+		return "", err
+	}
+
+	// A tty opened through the runtime poller ignores VTIME, so bound the
+	// reads with a deadline too
+	deadline := time.Now().Add(timeout)
+	tty.SetReadDeadline(deadline)
+
+	var reply strings.Builder
+	buf := make([]byte, 64)
+	for time.Now().Before(deadline) {
+		n, err := tty.Read(buf)
+		if n > 0 {
+			reply.Write(buf[:n])
+			// The reply ends with BEL or ST (ESC \)
+			if s := reply.String(); strings.HasSuffix(s, "\a") || strings.HasSuffix(s, "\033\\") {
+				return s, nil
+			}
+		}
+		if err != nil || n == 0 {
+			break
+		}
+	}
+	if reply.Len() == 0 {
+		return "", errors.New("no reply from terminal")
+	}
+	return reply.String(), nil
+}
+
+func ioctl(fd uintptr, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package term
+
+import (
+	"os"
+	"strings"
+)
+
+// truecolorTerminals are TERM_PROGRAM values of terminals known to support
+// 24-bit color without advertising it in COLORTERM
+var truecolorTerminals = []string{"iTerm.app", "WezTerm", "vscode", "ghostty", "WarpTerminal", "Hyper", "Tabby"}
+
+// ColorDepth resolves the --color-depth setting to "truecolor", "256" or
+// "16". With "auto" it goes by COLORTERM, the terminal program and TERM,
+// assuming 256 colors when nothing says otherwise.
+func ColorDepth(setting string) string {
+	switch strings.ToLower(setting) {
+	case "truecolor", "24bit":
+		return "truecolor"
+	case "256", "16":
+		return setting
+	}
+
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return "truecolor"
+	}
+	if os.Getenv("WT_SESSION") != "" {
+		// Windows Terminal
+		return "truecolor"
+	}
+	program := os.Getenv("TERM_PROGRAM")
+	for _, t := range truecolorTerminals {
+		if program == t {
+			return "truecolor"
+		}
+	}
+	term := os.Getenv("TERM")
+	switch {
+	case strings.Contains(term, "truecolor") || strings.Contains(term, "direct"):
+		return "truecolor"
+	case strings.Contains(term, "256color"):
+		return "256"
+	case term == "linux" || term == "vt100" || term == "dumb" || term == "ansi":
+		return "16"
+	}
+	return "256"
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package term
+
+import "os"
+
+// EnableColors prepares f for ANSI escape sequences and reports whether
+// they will be interpreted. Unix terminals always interpret them.
+func EnableColors(f *os.File) bool {
+	return true
+}
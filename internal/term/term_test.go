@@ -0,0 +1,112 @@
+package term
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnableColors_NotAConsole(t *testing.T) {
+	// Output to Claude Code is a pipe, never a console: colors stay on
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if !EnableColors(f) {
+		t.Error("EnableColors() = false for a file, want true")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if !EnableColors(w) {
+		t.Error("EnableColors() = false for a pipe, want true")
+	}
+}
+
+func TestParseColorFGBG(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"15;0", "dark"},
+		{"0;15", "light"},
+		{"0;7", "light"},
+		{"15;default;0", "dark"},
+		{"0;default;11", "light"},
+		{"0;8", "dark"},
+		{"default;default", ""},
+	}
+	for _, tt := range tests {
+		if got := parseColorFGBG(tt.value); got != tt.want {
+			t.Errorf("parseColorFGBG(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseOSC11(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{"\033]11;rgb:ffff/ffff/ffff\a", "light"},
+		{"\033]11;rgb:fdf6/f6e3/e3e3\033\\", "light"},
+		{"\033]11;rgb:1e1e/1e1e/1e1e\a", "dark"},
+		{"\033]11;rgb:00/2b/36\a", "dark"},
+		{"\033]11;rgb:f/f/f\a", "light"},
+		{"garbage", ""},
+	}
+	for _, tt := range tests {
+		if got := parseOSC11(tt.reply); got != tt.want {
+			t.Errorf("parseOSC11(%q) = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestBackground(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if got := Background("light"); got != "light" {
+		t.Errorf("Background(light) = %q", got)
+	}
+	t.Setenv("COLORFGBG", "0;15")
+	if got := Background("dark"); got != "dark" {
+		t.Errorf("Background(dark) = %q, an explicit setting wins over COLORFGBG", got)
+	}
+	if got := Background("auto"); got != "light" {
+		t.Errorf("Background(auto) = %q with COLORFGBG=0;15, want light", got)
+	}
+}
+
+func TestColorDepth(t *testing.T) {
+	tests := []struct {
+		setting, colorterm, program, term string
+		want                              string
+	}{
+		{"16", "truecolor", "", "", "16"},
+		{"truecolor", "", "", "xterm", "truecolor"},
+		{"auto", "truecolor", "", "xterm-256color", "truecolor"},
+		{"auto", "24bit", "", "", "truecolor"},
+		{"auto", "", "iTerm.app", "xterm-256color", "truecolor"},
+		{"auto", "", "Apple_Terminal", "xterm-256color", "256"},
+		{"auto", "", "", "linux", "16"},
+		{"auto", "", "", "xterm-direct", "truecolor"},
+		{"auto", "", "", "", "256"},
+	}
+	for _, tt := range tests {
+		t.Setenv("COLORTERM", tt.colorterm)
+		t.Setenv("TERM_PROGRAM", tt.program)
+		t.Setenv("TERM", tt.term)
+		t.Setenv("WT_SESSION", "")
+		if got := ColorDepth(tt.setting); got != tt.want {
+			t.Errorf("ColorDepth(%q) with COLORTERM=%q TERM_PROGRAM=%q TERM=%q = %q, want %q",
+				tt.setting, tt.colorterm, tt.program, tt.term, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package term
+
+import (
+	"os"
+	"syscall"
+)
+
+// enableVirtualTerminalProcessing makes a Windows console interpret ANSI
+// escape sequences (Windows 10 1511 and later)
+const enableVirtualTerminalProcessing = 0x0004
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// EnableColors prepares f for ANSI escape sequences and reports whether
+// they will be interpreted. Consoles get virtual terminal processing turned
+// on; legacy consoles that don't support it can't show colors.
+func EnableColors(f *os.File) bool {
+	handle := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(handle, &mode); err != nil {
+		// Not a console (a pipe to Claude Code, a file): the escapes
+		// reach whatever reads them unchanged
+		return true
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	ok, _, _ := procSetConsoleMode.Call(uintptr(handle), uintptr(mode|enableVirtualTerminalProcessing))
+	return ok != 0
+}
@@ -0,0 +1,99 @@
+package transcript
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// lineDelta is the number of lines a file edit added and removed
+type lineDelta struct {
+	added, removed int
+}
+
+// editTools are the tools whose results change files
+var editTools = map[string]bool{"Edit": true, "MultiEdit": true, "Write": true, "NotebookEdit": true}
+
+// EditInput is one replacement of a MultiEdit
+type EditInput struct {
+	OldString string `json:"old_string"`
+	NewString string `json:"new_string"`
+}
+
+// toolUseResult holds the fields of an entry's toolUseResult that tell how
+// a file changed: the diff hunks of Edit and Write, the content of a newly
+// created file, or the new source of a notebook cell
+type toolUseResult struct {
+	Type            string `json:"type"` // Write: "create" or "update"
+	Content         string `json:"content"`
+	StructuredPatch []struct {
+		Lines []string `json:"lines"`
+	} `json:"structuredPatch"`
+	NewSource string `json:"new_source"`
+	EditMode  string `json:"edit_mode"`
+}
+
+// resultDelta counts the lines changed according to a tool's result, if it
+// describes the change
+func resultDelta(raw json.RawMessage) (lineDelta, bool) {
+	var result toolUseResult
+	if len(raw) == 0 || json.Unmarshal(raw, &result) != nil {
+		return lineDelta{}, false
+	}
+	var d lineDelta
+	switch {
+	case len(result.StructuredPatch) > 0:
+		for _, hunk := range result.StructuredPatch {
+			for _, line := range hunk.Lines {
+				switch {
+				case strings.HasPrefix(line, "+"):
+					d.added++
+				case strings.HasPrefix(line, "-"):
+					d.removed++
+				}
+			}
+		}
+	case result.Type == "create":
+		d.added = countLines(result.Content)
+	case result.EditMode != "":
+		if result.EditMode != "delete" {
+			d.added = countLines(result.NewSource)
+		}
+	default:
+		return lineDelta{}, false
+	}
+	return d, true
+}
+
+// inputDelta estimates the lines an edit tool changes from its input, for
+// results that don't include a diff. An overwritten file counts only the
+// lines written, since its old content isn't known.
+func inputDelta(tool string, input *ToolInput) lineDelta {
+	switch tool {
+	case "Edit":
+		return lineDelta{countLines(input.NewString), countLines(input.OldString)}
+	case "MultiEdit":
+		var d lineDelta
+		for _, edit := range input.Edits {
+			d.added += countLines(edit.NewString)
+			d.removed += countLines(edit.OldString)
+		}
+		return d
+	case "Write":
+		return lineDelta{added: countLines(input.Content)}
+	case "NotebookEdit":
+		if input.EditMode == "delete" {
+			return lineDelta{}
+		}
+		return lineDelta{added: countLines(input.NewSource)}
+	}
+	return lineDelta{}
+}
+
+// countLines counts the lines of s, including a last line without a
+// newline
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(s, "\n"), "\n") + 1
+}
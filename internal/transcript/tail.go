@@ -0,0 +1,94 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// searchChunk is how much of the transcript lastIndex reads at a time
+const searchChunk = 64 * 1024
+
+// todoWriteName is how a TodoWrite call names its tool in the transcript
+var todoWriteName = []byte(`"name":"TodoWrite"`)
+
+// parseTail reads a transcript longer than --transcript-tail KB from its
+// end, so rendering takes about as long however long the session is. The
+// running tools and agents, recent results and the error streak are in
+// the tail; when the todo list was last written before it, the transcript
+// is searched backwards for that write and read from there. The session
+// start comes from the first lines.
+//
+// It returns nil when the transcript should be read whole: it is short,
+// reading the tail is turned off, the tail holds no complete entry, or
+// the changes or summary segments add up the whole session.
+func parseTail(file *os.File) *types.TranscriptData {
+	cfg := config.Get()
+	window := int64(cfg.TranscriptTail) * 1024
+	info, err := file.Stat()
+	if window <= 0 || err != nil || info.Size() <= window || cfg.AnySegmentEnabled("changes", "summary") || cfg.ExprReads("changes") {
+		return nil
+	}
+	size := info.Size()
+
+	// Start on the byte before the window and drop the first line, which
+	// is then either empty or the end of a line begun before the window
+	start := size - window
+	data, entries, todos := scan(io.NewSectionReader(file, start-1, window+1), true)
+	if entries == 0 {
+		return nil
+	}
+	for !todos && (cfg.SegmentEnabled("todos") || cfg.ExprReads("todos")) {
+		at := lastIndex(file, start, todoWriteName)
+		if at < 0 {
+			break // the session has no todo list
+		}
+		start = lastIndex(file, at, []byte("\n")) + 1
+		data, _, todos = scan(io.NewSectionReader(file, start, size-start), false)
+	}
+
+	data.SessionStart = sessionStart(file, size)
+	config.DebugLog("Read the last %d of %d bytes of the transcript", size-start, size)
+	return data
+}
+
+// lastIndex returns the offset of the last needle in file that ends before
+// end, reading backwards a chunk at a time, or -1 if there is none
+func lastIndex(file *os.File, end int64, needle []byte) int64 {
+	buf := make([]byte, searchChunk)
+	for hi := end; hi > 0; {
+		lo := max(hi-searchChunk, 0)
+		n, err := file.ReadAt(buf[:hi-lo], lo)
+		if i := bytes.LastIndex(buf[:n], needle); i >= 0 {
+			return lo + int64(i)
+		}
+		if lo == 0 || (err != nil && err != io.EOF) {
+			break
+		}
+		// Overlap the chunks so a needle across their boundary is found
+		hi = lo + int64(len(needle)) - 1
+	}
+	return -1
+}
+
+// sessionStart returns the time of the first transcript entry that has one
+func sessionStart(file *os.File, size int64) time.Time {
+	scanner := bufio.NewScanner(io.NewSectionReader(file, 0, size))
+	scanner.Buffer(make([]byte, 0, 64*1024), 5*1024*1024)
+	for scanner.Scan() {
+		var entry TranscriptEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Timestamp == "" {
+			continue
+		}
+		if ts, err := time.Parse(time.RFC3339, entry.Timestamp); err == nil {
+			return ts
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,142 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// Pricer returns the cost of a message's tokens
+type Pricer func(model string, inputTokens, outputTokens, cacheCreation, cacheRead int) float64
+
+// TodoCost is the estimated cost of working on one todo
+type TodoCost struct {
+	Subject  string
+	Status   string // status in the last TodoWrite
+	Cost     float64
+	Messages int
+}
+
+// TodoStats splits a session's cost by the todo that was in progress when
+// each message was sent
+type TodoStats struct {
+	Todos []TodoCost // in the order work on them started
+	Total float64
+	// Unassigned is the cost of messages sent while no todo was in progress
+	Unassigned         float64
+	UnassignedMessages int
+}
+
+// Completed returns the completed todos
+func (s *TodoStats) Completed() []TodoCost {
+	var completed []TodoCost
+	for _, todo := range s.Todos {
+		if todo.Status == "completed" {
+			completed = append(completed, todo)
+		}
+	}
+	return completed
+}
+
+// TodoCosts reads a transcript and attributes the cost of each assistant
+// message to the todo in progress at the time. A message that marks a todo
+// completed still counts toward it.
+func TodoCosts(transcriptPath string, price Pricer) (*TodoStats, error) {
+	file, err := os.Open(transcriptPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stats := &TodoStats{}
+	index := make(map[string]int) // subject -> position in stats.Todos
+	seen := make(map[string]bool)
+	current := ""
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 5*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// Streamed responses repeat the message with the same usage
+		var usage types.LogEntry
+		if err := json.Unmarshal(line, &usage); err == nil && usage.Type == "assistant" {
+			key := usage.Message.ID + ":" + usage.RequestID
+			if key != ":" && !seen[key] {
+				seen[key] = true
+				u := usage.Message.Usage
+				cost := price(usage.Message.Model, u.InputTokens, u.OutputTokens, u.CacheCreationInputTokens, u.CacheReadInputTokens)
+				stats.Total += cost
+				if i, ok := index[current]; ok && current != "" {
+					stats.Todos[i].Cost += cost
+					stats.Todos[i].Messages++
+				} else {
+					stats.Unassigned += cost
+					stats.UnassignedMessages++
+				}
+			}
+		}
+
+		var entry TranscriptEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		for _, block := range entry.Message.Content {
+			if block.Type != "tool_use" || block.Name != "TodoWrite" {
+				continue
+			}
+			var input ToolInput
+			if err := json.Unmarshal(block.Input, &input); err != nil {
+				continue
+			}
+
+			current = ""
+			for _, todo := range input.Todos {
+				i, ok := index[todo.Subject]
+				if ok {
+					stats.Todos[i].Status = todo.Status
+				}
+				if todo.Status != "in_progress" || current != "" {
+					continue
+				}
+				current = todo.Subject
+				if !ok {
+					index[todo.Subject] = len(stats.Todos)
+					stats.Todos = append(stats.Todos, TodoCost{Subject: todo.Subject, Status: todo.Status})
+				}
+			}
+		}
+	}
+	return stats, scanner.Err()
+}
+
+// Locate returns the transcript of a session under ~/.claude/projects, or
+// with an empty ID the one written last, i.e. the active session's
+func Locate(sessionID string) string {
+	var found string
+	var latest time.Time
+	projectsDir := config.ProjectsDir()
+	filepath.Walk(projectsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".jsonl") {
+			return nil
+		}
+		if sessionID != "" {
+			if info.Name() == sessionID+".jsonl" {
+				found = path
+				return filepath.SkipAll
+			}
+			return nil
+		}
+		if info.ModTime().After(latest) {
+			found, latest = path, info.ModTime()
+		}
+		return nil
+	})
+	return found
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -25,6 +26,9 @@ type TranscriptEntry struct {
 	Message   struct {
 		Content []ContentBlock `json:"content"`
 	} `json:"message"`
+	// ToolUseResult details the result of the entry's tool call, e.g. the
+	// diff of an edit
+	ToolUseResult json.RawMessage `json:"toolUseResult"`
 }
 
 // ContentBlock represents a content block in a message
@@ -54,6 +58,14 @@ type ToolInput struct {
 
 	// For TodoWrite
 	Todos []TodoInput `json:"todos"`
+
+	// For Edit, MultiEdit, Write and NotebookEdit
+	OldString string      `json:"old_string"`
+	NewString string      `json:"new_string"`
+	Edits     []EditInput `json:"edits"`
+	Content   string      `json:"content"`
+	NewSource string      `json:"new_source"`
+	EditMode  string      `json:"edit_mode"`
 }
 
 // TodoInput represents a todo item from TodoWrite
@@ -63,7 +75,8 @@ type TodoInput struct {
 	Status  string `json:"status"`
 }
 
-// Parse reads the transcript file and extracts tools, agents, and todos
+// Parse reads the transcript file and extracts tools, agents, and todos.
+// Long transcripts are read from the end, see parseTail.
 func Parse(transcriptPath string) *types.TranscriptData {
 	if transcriptPath == "" {
 		return nil
@@ -71,37 +84,55 @@ func Parse(transcriptPath string) *types.TranscriptData {
 
 	file, err := os.Open(transcriptPath)
 	if err != nil {
-		config.DebugLog("transcript: failed to open %s: %v", transcriptPath, err)
+		config.WarnLog("Failed to open %s: %v", transcriptPath, err)
 		return nil
 	}
 	defer file.Close()
 
-	data := &types.TranscriptData{
-		Tools:  make([]types.ToolEntry, 0),
-		Agents: make([]types.AgentEntry, 0),
-		Todos:  make([]types.TodoItem, 0),
+	if data := parseTail(file); data != nil {
+		return data
+	}
+	data, _, _ := scan(file, false)
+	return data
+}
+
+// scan processes the transcript lines read from r. With skipFirst the first
+// line is left out, as r starts within it. It also returns how many entries
+// were read and whether one of them wrote the todo list.
+func scan(r io.Reader, skipFirst bool) (data *types.TranscriptData, entries int, todos bool) {
+	data = &types.TranscriptData{
+		Tools:      make([]types.ToolEntry, 0),
+		Agents:     make([]types.AgentEntry, 0),
+		Todos:      make([]types.TodoItem, 0),
+		ToolCounts: make(map[string]int),
 	}
 
 	// Maps for matching tool_use with tool_result
 	pendingTools := make(map[string]*types.ToolEntry)
 	pendingAgents := make(map[string]*types.AgentEntry)
+	pendingEdits := make(map[string]lineDelta)
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	// Increase buffer size for potentially large lines
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 5*1024*1024) // 5MB max line size
 
 	for scanner.Scan() {
 		line := scanner.Bytes()
+		if skipFirst {
+			skipFirst = false
+			continue
+		}
 		if len(line) == 0 {
 			continue
 		}
 
 		var entry TranscriptEntry
 		if err := json.Unmarshal(line, &entry); err != nil {
-			config.DebugLog("transcript: failed to parse line: %v", err)
+			config.DebugLog("Failed to parse line: %v", err)
 			continue
 		}
+		entries++
 
 		// Track session start from first entry
 		if data.SessionStart.IsZero() && entry.Timestamp != "" {
@@ -110,11 +141,16 @@ func Parse(transcriptPath string) *types.TranscriptData {
 			}
 		}
 
-		processEntry(&entry, data, pendingTools, pendingAgents)
+		processEntry(&entry, data, pendingTools, pendingAgents, pendingEdits)
+		for _, block := range entry.Message.Content {
+			if block.Type == "tool_use" && block.Name == "TodoWrite" {
+				todos = true
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		config.DebugLog("transcript: scanner error: %v", err)
+		config.WarnLog("Scanner error: %v", err)
 	}
 
 	// Add any remaining pending tools/agents as running
@@ -135,30 +171,35 @@ func Parse(transcriptPath string) *types.TranscriptData {
 		data.Agents = data.Agents[len(data.Agents)-MaxAgents:]
 	}
 
-	return data
+	return data, entries, todos
 }
 
 func processEntry(entry *TranscriptEntry, data *types.TranscriptData,
-	pendingTools map[string]*types.ToolEntry, pendingAgents map[string]*types.AgentEntry) {
+	pendingTools map[string]*types.ToolEntry, pendingAgents map[string]*types.AgentEntry, pendingEdits map[string]lineDelta) {
 
 	ts, _ := time.Parse(time.RFC3339, entry.Timestamp)
 
+	// toolUseResult belongs to the entry's only tool result
+	var result json.RawMessage
+	if len(entry.Message.Content) == 1 {
+		result = entry.ToolUseResult
+	}
 	for _, block := range entry.Message.Content {
 		switch block.Type {
 		case "tool_use":
-			processToolUse(&block, ts, data, pendingTools, pendingAgents)
+			processToolUse(&block, ts, data, pendingTools, pendingAgents, pendingEdits)
 		case "tool_result":
-			processToolResult(&block, ts, data, pendingTools, pendingAgents)
+			processToolResult(&block, ts, data, pendingTools, pendingAgents, pendingEdits, result)
 		}
 	}
 }
 
 func processToolUse(block *ContentBlock, ts time.Time, data *types.TranscriptData,
-	pendingTools map[string]*types.ToolEntry, pendingAgents map[string]*types.AgentEntry) {
+	pendingTools map[string]*types.ToolEntry, pendingAgents map[string]*types.AgentEntry, pendingEdits map[string]lineDelta) {
 
 	var input ToolInput
 	if err := json.Unmarshal(block.Input, &input); err != nil {
-		config.DebugLog("transcript: failed to parse tool input: %v", err)
+		config.DebugLog("Failed to parse tool input: %v", err)
 	}
 
 	// Handle Task tool (subagents)
@@ -199,10 +240,34 @@ func processToolUse(block *ContentBlock, ts time.Time, data *types.TranscriptDat
 		StartTime: ts,
 	}
 	pendingTools[block.ID] = tool
+	if editTools[block.Name] {
+		pendingEdits[block.ID] = inputDelta(block.Name, &input)
+	}
 }
 
 func processToolResult(block *ContentBlock, ts time.Time, data *types.TranscriptData,
-	pendingTools map[string]*types.ToolEntry, pendingAgents map[string]*types.AgentEntry) {
+	pendingTools map[string]*types.ToolEntry, pendingAgents map[string]*types.AgentEntry, pendingEdits map[string]lineDelta,
+	result json.RawMessage) {
+
+	if block.IsError {
+		data.ErrorStreak++
+	} else {
+		data.ErrorStreak = 0
+	}
+
+	// Count the lines changed by successful edits, from the diff in the
+	// result where there is one
+	if estimate, ok := pendingEdits[block.ToolUseID]; ok {
+		delete(pendingEdits, block.ToolUseID)
+		if !block.IsError {
+			d, ok := resultDelta(result)
+			if !ok {
+				d = estimate
+			}
+			data.LinesAdded += d.added
+			data.LinesRemoved += d.removed
+		}
+	}
 
 	// Check if it's an agent result
 	if agent, ok := pendingAgents[block.ToolUseID]; ok {
@@ -224,6 +289,7 @@ func processToolResult(block *ContentBlock, ts time.Time, data *types.Transcript
 		}
 		tool.EndTime = ts
 		data.Tools = append(data.Tools, *tool)
+		data.ToolCounts[tool.Name]++
 		delete(pendingTools, block.ToolUseID)
 		return
 	}
@@ -351,11 +417,16 @@ func GetCurrentTodo(data *types.TranscriptData) *types.TodoItem {
 
 // GetSessionDuration returns the session duration as a formatted string
 func GetSessionDuration(data *types.TranscriptData) string {
+	return GetSessionDurationAt(data, time.Now())
+}
+
+// GetSessionDurationAt returns the session duration as of now
+func GetSessionDurationAt(data *types.TranscriptData, now time.Time) string {
 	if data == nil || data.SessionStart.IsZero() {
 		return ""
 	}
 
-	duration := time.Since(data.SessionStart)
+	duration := now.Sub(data.SessionStart)
 	mins := int(duration.Minutes())
 
 	if mins < 1 {
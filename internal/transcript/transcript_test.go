@@ -1,11 +1,13 @@
 package transcript
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/erwint/claude-code-statusline/internal/config"
 	"github.com/erwint/claude-code-statusline/internal/types"
 )
 
@@ -64,6 +66,26 @@ func TestParse_ToolTracking(t *testing.T) {
 	}
 }
 
+func TestParse_ToolCounts(t *testing.T) {
+	var content string
+	for i := 0; i < MaxTools+5; i++ {
+		content += fmt.Sprintf(`{"timestamp":"2025-01-24T10:00:00Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"tool_%d","name":"Read","input":{"file_path":"/a.go"}}]}}`+"\n", i)
+		content += fmt.Sprintf(`{"timestamp":"2025-01-24T10:00:01Z","type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"tool_%d","content":"ok"}]}}`+"\n", i)
+	}
+	tmpFile := filepath.Join(t.TempDir(), "transcript.jsonl")
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Parse(tmpFile)
+	if len(result.Tools) != MaxTools {
+		t.Errorf("expected %d tools kept, got %d", MaxTools, len(result.Tools))
+	}
+	if got := result.ToolCounts["Read"]; got != MaxTools+5 {
+		t.Errorf("expected %d Read calls counted, got %d", MaxTools+5, got)
+	}
+}
+
 func TestParse_AgentTracking(t *testing.T) {
 	content := `{"timestamp":"2025-01-24T10:00:00Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"agent_1","name":"Task","input":{"subagent_type":"Explore","description":"searching files","model":"haiku"}}]}}
 {"timestamp":"2025-01-24T10:00:05Z","type":"result","message":{"content":[{"type":"tool_result","tool_use_id":"agent_1","content":"found results"}]}}
@@ -181,6 +203,161 @@ func TestParse_ToolError(t *testing.T) {
 	}
 }
 
+func TestParse_LinesChanged(t *testing.T) {
+	content := `{"timestamp":"2025-01-24T10:00:00Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"edit_1","name":"Edit","input":{"file_path":"/a.go","old_string":"x","new_string":"y"}}]}}
+{"timestamp":"2025-01-24T10:00:01Z","type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"edit_1","content":"ok"}]},"toolUseResult":{"structuredPatch":[{"lines":[" a","-b","-c","+d","+e","+f"," g"]}]}}
+{"timestamp":"2025-01-24T10:00:02Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"write_1","name":"Write","input":{"file_path":"/b.go","content":"1\n2\n3\n4\n"}}]}}
+{"timestamp":"2025-01-24T10:00:03Z","type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"write_1","content":"ok"}]},"toolUseResult":{"type":"create","content":"1\n2\n3\n4\n","structuredPatch":[]}}
+{"timestamp":"2025-01-24T10:00:04Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"multi_1","name":"MultiEdit","input":{"file_path":"/c.go","edits":[{"old_string":"a\nb","new_string":"c"},{"old_string":"d","new_string":"e\nf"}]}}]}}
+{"timestamp":"2025-01-24T10:00:05Z","type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"multi_1","content":"ok"}]}}
+{"timestamp":"2025-01-24T10:00:06Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"edit_2","name":"Edit","input":{"file_path":"/d.go","old_string":"q","new_string":"r\ns"}}]}}
+{"timestamp":"2025-01-24T10:00:07Z","type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"edit_2","content":"String not found","is_error":true}]}}
+`
+	tmpFile := filepath.Join(t.TempDir(), "transcript.jsonl")
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := Parse(tmpFile)
+	if result == nil {
+		t.Fatal("expected non-nil result")
+	}
+	// Edit diff +3/-2, created file +4, MultiEdit input +3/-3, failed edit nothing
+	if result.LinesAdded != 10 || result.LinesRemoved != 5 {
+		t.Errorf("expected +10/-5, got +%d/-%d", result.LinesAdded, result.LinesRemoved)
+	}
+}
+
+func TestParse_ErrorStreak(t *testing.T) {
+	use := `{"timestamp":"2025-01-24T10:00:0%[1]dZ","type":"assistant","message":{"content":[{"type":"tool_use","id":"tool_%[1]d","name":"Bash","input":{"command":"make"}}]}}` + "\n"
+	result := `{"timestamp":"2025-01-24T10:00:0%[1]dZ","type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"tool_%[1]d","content":"out","is_error":%[2]v}]}}` + "\n"
+
+	tests := []struct {
+		name    string
+		results []bool // is_error of each result in turn
+		want    int
+	}{
+		{"no errors", []bool{false, false}, 0},
+		{"trailing errors", []bool{false, true, true, true}, 3},
+		{"success resets", []bool{true, true, false}, 0},
+		{"success between", []bool{true, false, true}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var content string
+			for i, isError := range tt.results {
+				content += fmt.Sprintf(use, i) + fmt.Sprintf(result, i, isError)
+			}
+			tmpFile := filepath.Join(t.TempDir(), "transcript.jsonl")
+			if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := Parse(tmpFile).ErrorStreak; got != tt.want {
+				t.Errorf("ErrorStreak = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Tail(t *testing.T) {
+	line := func(format string, args ...any) string { return fmt.Sprintf(format, args...) + "\n" }
+	todos := func(id, status string) string {
+		return line(`{"timestamp":"2025-01-24T10:01:00Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"%s","name":"TodoWrite","input":{"todos":[{"subject":"Ship it","status":"%s"}]}}]}}`, id, status)
+	}
+	reads := func(from, n int) string {
+		var s string
+		for i := from; i < from+n; i++ {
+			s += line(`{"timestamp":"2025-01-24T10:02:00Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"read_%d","name":"Read","input":{"file_path":"/src/file_%d.go"}}]}}`, i, i)
+			s += line(`{"timestamp":"2025-01-24T10:02:01Z","type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"read_%d","content":"ok"}]}}`, i)
+		}
+		return s
+	}
+	start := line(`{"type":"summary","summary":"Earlier work"}`) +
+		line(`{"timestamp":"2025-01-24T10:00:00Z","type":"user","message":{"content":[]}}`)
+	running := line(`{"timestamp":"2025-01-24T10:03:00Z","type":"assistant","message":{"content":[{"type":"tool_use","id":"bash_1","name":"Bash","input":{"command":"make test"}}]}}`)
+
+	tests := []struct {
+		name      string
+		content   string
+		cfg       config.Config
+		wantTodos string // status of the todo, "" for none
+		wantAll   bool   // all 50 Read calls were read
+	}{
+		{"todo list near the end", start + reads(0, 50) + todos("todo_1", "in_progress") + reads(50, 5) + running,
+			config.Config{TranscriptTail: 1, ShowTodos: true}, "in_progress", false},
+		{"todo list before the tail", start + todos("todo_1", "pending") + todos("todo_2", "in_progress") + reads(0, 50) + running,
+			config.Config{TranscriptTail: 1, ShowTodos: true}, "in_progress", true},
+		{"no todo list", start + reads(0, 50) + running,
+			config.Config{TranscriptTail: 1, ShowTodos: true}, "", false},
+		{"whole session for the summary", start + todos("todo_1", "completed") + reads(0, 50) + running,
+			config.Config{TranscriptTail: 1, ShowTodos: true, ShowSummary: true}, "completed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := *config.Get()
+			*config.Get() = tt.cfg
+			t.Cleanup(func() { *config.Get() = orig })
+
+			tmpFile := filepath.Join(t.TempDir(), "transcript.jsonl")
+			if err := os.WriteFile(tmpFile, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			result := Parse(tmpFile)
+			if result == nil {
+				t.Fatal("expected non-nil result")
+			}
+
+			if want := time.Date(2025, 1, 24, 10, 0, 0, 0, time.UTC); !result.SessionStart.Equal(want) {
+				t.Errorf("session start = %v, want %v", result.SessionStart, want)
+			}
+			running := GetRunningTools(result)
+			if len(running) != 1 || running[0].Name != "Bash" {
+				t.Errorf("running tools = %+v, want Bash", running)
+			}
+			var status string
+			if len(result.Todos) > 0 {
+				status = result.Todos[0].Status
+			}
+			if status != tt.wantTodos {
+				t.Errorf("todo status = %q, want %q", status, tt.wantTodos)
+			}
+			if all := result.ToolCounts["Read"] == 50; all != tt.wantAll {
+				t.Errorf("read %d of the Read calls, want all: %v", result.ToolCounts["Read"], tt.wantAll)
+			}
+		})
+	}
+}
+
+func TestLastIndex(t *testing.T) {
+	content := "xx" + string(make([]byte, 2*searchChunk)) + "needle" + string(make([]byte, searchChunk-3)) + "needle"
+	tmpFile := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	last := int64(len(content) - len("needle"))
+	first := int64(2 + 2*searchChunk)
+	tests := []struct {
+		end  int64
+		want int64
+	}{
+		{int64(len(content)), last},
+		{last + 5, first}, // the last one doesn't end before end
+		{first + 6, first},
+		{first + 5, -1},
+	}
+	for _, tt := range tests {
+		if got := lastIndex(file, tt.end, []byte("needle")); got != tt.want {
+			t.Errorf("lastIndex(%d) = %d, want %d", tt.end, got, tt.want)
+		}
+	}
+}
+
 func TestGetRunningTools(t *testing.T) {
 	data := &types.TranscriptData{
 		Tools: []types.ToolEntry{
@@ -515,3 +692,80 @@ func TestParse_TodoOverwrite(t *testing.T) {
 		t.Errorf("expected first todo subject 'Updated', got '%s'", result.Todos[0].Subject)
 	}
 }
+
+func TestTodoCosts(t *testing.T) {
+	msg := func(id string, tokens int, todos string) string {
+		content := "[]"
+		if todos != "" {
+			content = `[{"type":"tool_use","id":"t` + id + `","name":"TodoWrite","input":{"todos":` + todos + `}}]`
+		}
+		return `{"type":"assistant","requestId":"r` + id + `","message":{"id":"m` + id + `","model":"m","usage":{"output_tokens":` +
+			fmt.Sprint(tokens) + `},"content":` + content + `}}` + "\n"
+	}
+	content := msg("1", 1, "") +
+		msg("2", 2, `[{"subject":"write parser","status":"in_progress"},{"subject":"add tests","status":"pending"}]`) +
+		msg("3", 4, "") +
+		msg("3", 4, "") + // streamed duplicate
+		msg("4", 8, `[{"subject":"write parser","status":"completed"},{"subject":"add tests","status":"in_progress"}]`) +
+		msg("5", 16, "")
+
+	tmpFile := filepath.Join(t.TempDir(), "transcript.jsonl")
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dollar per output token
+	price := func(model string, in, out, cw, cr int) float64 { return float64(out) }
+	stats, err := TodoCosts(tmpFile, price)
+	if err != nil {
+		t.Fatalf("TodoCosts: %v", err)
+	}
+
+	// The message that starts a todo is attributed before it, the one that
+	// completes it to it
+	want := []TodoCost{
+		{Subject: "write parser", Status: "completed", Cost: 12, Messages: 2},
+		{Subject: "add tests", Status: "in_progress", Cost: 16, Messages: 1},
+	}
+	if len(stats.Todos) != len(want) {
+		t.Fatalf("Todos = %+v, want %+v", stats.Todos, want)
+	}
+	for i := range want {
+		if stats.Todos[i] != want[i] {
+			t.Errorf("Todos[%d] = %+v, want %+v", i, stats.Todos[i], want[i])
+		}
+	}
+	if stats.Total != 31 || stats.Unassigned != 3 || stats.UnassignedMessages != 2 {
+		t.Errorf("Total = %v, Unassigned = %v (%d messages), want 31, 3 (2 messages)", stats.Total, stats.Unassigned, stats.UnassignedMessages)
+	}
+	if completed := stats.Completed(); len(completed) != 1 || completed[0].Subject != "write parser" {
+		t.Errorf("Completed = %+v, want only write parser", completed)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if path := Locate(""); path != "" {
+		t.Errorf("Locate = %q, want none without transcripts", path)
+	}
+
+	dir := filepath.Join(home, ".claude", "projects", "-home-user-app")
+	os.MkdirAll(dir, 0755)
+	old := filepath.Join(dir, "old-session.jsonl")
+	recent := filepath.Join(dir, "recent-session.jsonl")
+	os.WriteFile(old, []byte("{}\n"), 0644)
+	os.WriteFile(recent, []byte("{}\n"), 0644)
+	os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+
+	if path := Locate(""); path != recent {
+		t.Errorf("Locate(\"\") = %q, want %q", path, recent)
+	}
+	if path := Locate("old-session"); path != old {
+		t.Errorf("Locate(old-session) = %q, want %q", path, old)
+	}
+	if path := Locate("missing"); path != "" {
+		t.Errorf("Locate(missing) = %q, want none", path)
+	}
+}
@@ -7,6 +7,9 @@ import (
 
 // UsageCache holds cached API usage data
 type UsageCache struct {
+	// Version of the cache format it was saved in
+	Version int `json:"version,omitempty"`
+
 	// 5-hour window
 	UsagePercent float64   `json:"usage_percent"`
 	ResetTime    time.Time `json:"reset_time"`
@@ -15,16 +18,94 @@ type UsageCache struct {
 	SevenDayPercent   float64   `json:"seven_day_percent"`
 	SevenDayResetTime time.Time `json:"seven_day_reset_time"`
 
+	// 7-day Opus window (Max plans; zero when the API doesn't report it)
+	OpusPercent   float64   `json:"opus_percent,omitempty"`
+	OpusResetTime time.Time `json:"opus_reset_time,omitempty"`
+
+	// Every window the API reported, by its name there (five_hour,
+	// seven_day, seven_day_opus, ...), including ones not shown yet
+	Windows map[string]WindowUsage `json:"windows,omitempty"`
+
+	// API key billing has no plan windows; with an Admin API key the
+	// organization's spend this month is shown instead (zero MonthStart =
+	// not fetched)
+	MonthSpend float64   `json:"month_spend,omitempty"` // dollars
+	MonthStart time.Time `json:"month_start,omitempty"`
+
+	// When the current windows were first observed after the previous one
+	// reset (zero if unknown, e.g. on the first run)
+	WindowStart         time.Time `json:"window_start,omitempty"`
+	SevenDayWindowStart time.Time `json:"seven_day_window_start,omitempty"`
+
+	// Recent 5h usage growth in percentage points per hour, from the
+	// usage samples (zero if unknown)
+	BurnRate float64 `json:"burn_rate,omitempty"`
+
+	// Trend of each window against a linear schedule (computed at render time)
+	Projection         *Projection `json:"projection,omitempty"`
+	SevenDayProjection *Projection `json:"seven_day_projection,omitempty"`
+
+	// When the data was fetched from the API (zero for older caches)
+	FetchedAt time.Time `json:"fetched_at,omitempty"`
+	// Source describes where this render's data came from, e.g. "cache" or "api"
+	Source string `json:"-"`
+
 	// Stale indicates the data may be outdated (e.g. in backoff after 429)
 	Stale bool `json:"-"`
 	// Unavailable indicates we can't reach the API and data has expired
 	Unavailable bool `json:"-"`
 }
 
+// WindowUsage is a usage window as last reported by the API
+type WindowUsage struct {
+	Percent   float64   `json:"percent"`
+	ResetTime time.Time `json:"reset_time"`
+}
+
+// Projection severity levels
+const (
+	ProjectionOnTrack  = "on_track"  // within ±5% of the linear schedule
+	ProjectionOver     = "over"      // 5-25% ahead of schedule
+	ProjectionWayOver  = "way_over"  // more than 25% ahead of schedule
+	ProjectionUnder    = "under"     // 5-25% behind schedule
+	ProjectionWayUnder = "way_under" // more than 25% behind schedule
+)
+
+// Projection compares window usage against a linear schedule
+type Projection struct {
+	Status          string  `json:"status"`
+	ExpectedPercent float64 `json:"expected_percent"`
+	// Deviation is the relative difference from the expected usage,
+	// e.g. 0.3 means 30% more used than expected at this point
+	Deviation float64 `json:"deviation"`
+}
+
+// ResetObservation records when a usage window reset time was seen
+type ResetObservation struct {
+	ResetTime time.Time `json:"reset_time"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// UsageSample is the utilization of the usage windows at one fetch
+type UsageSample struct {
+	Time          time.Time `json:"time"`
+	FiveHour      float64   `json:"five_hour"`
+	SevenDay      float64   `json:"seven_day"`
+	FiveHourReset time.Time `json:"five_hour_reset,omitempty"`
+}
+
+// ResetHistory holds observed reset times per usage window, oldest first
+type ResetHistory struct {
+	FiveHour []ResetObservation `json:"five_hour"`
+	SevenDay []ResetObservation `json:"seven_day"`
+}
+
 // UsageResponse is the API response from Anthropic
 type UsageResponse struct {
-	FiveHour *UsageWindow `json:"five_hour"`
-	SevenDay *UsageWindow `json:"seven_day"`
+	FiveHour     *UsageWindow `json:"five_hour"`
+	SevenDay     *UsageWindow `json:"seven_day"`
+	SevenDayOpus *UsageWindow `json:"seven_day_opus"`
 }
 
 // UsageWindow represents a usage time window
@@ -74,13 +155,34 @@ type LogEntry struct {
 		ID string `json:"id"`
 	} `json:"message"`
 	RequestID string `json:"requestId"`
+	SessionID string `json:"sessionId"`
+	Cwd       string `json:"cwd"`
 }
 
 // TokenStats holds calculated cost statistics
 type TokenStats struct {
-	DailyCost   float64
-	WeeklyCost  float64
-	MonthlyCost float64
+	DailyCost   float64 `json:"daily_cost"`
+	WeeklyCost  float64 `json:"weekly_cost"`
+	MonthlyCost float64 `json:"monthly_cost"`
+	// Per-period costs by model family (opus, sonnet, haiku, other)
+	DailyByModel   map[string]float64 `json:"daily_by_model,omitempty"`
+	WeeklyByModel  map[string]float64 `json:"weekly_by_model,omitempty"`
+	MonthlyByModel map[string]float64 `json:"monthly_by_model,omitempty"`
+	// Per-period input, output and cache write tokens
+	DailyTokens   int64 `json:"daily_tokens,omitempty"`
+	WeeklyTokens  int64 `json:"weekly_tokens,omitempty"`
+	MonthlyTokens int64 `json:"monthly_tokens,omitempty"`
+	// DayHistory is the cost of each of the last 7 days, oldest first and
+	// ending today
+	DayHistory []float64 `json:"day_history,omitempty"`
+	// MonthProjected is the forecast month-end cost (fixed aggregation only)
+	MonthProjected float64 `json:"month_projected,omitempty"`
+	// BudgetOut is when the month-end forecast runs out of the monthly
+	// budget, if that happens before the month ends
+	BudgetOut *time.Time `json:"budget_out,omitempty"`
+	// SessionCosts is the cost so far of each session active since
+	// yesterday, by session ID
+	SessionCosts map[string]float64 `json:"session_costs,omitempty"`
 }
 
 // SessionInput is the JSON input from Claude Code via stdin
@@ -90,6 +192,22 @@ type SessionInput struct {
 	Cwd            string         `json:"cwd"`
 	TranscriptPath string         `json:"transcript_path"`
 	ContextWindow  *ContextWindow `json:"context_window"`
+	TerminalWidth  int            `json:"terminal_width,omitempty"`
+	Version        string         `json:"version,omitempty"`             // Claude Code's version
+	Exceeds200k    bool           `json:"exceeds_200k_tokens,omitempty"` // the conversation holds more than 200k tokens
+	OutputStyle    *OutputStyle   `json:"output_style,omitempty"`
+	Workspace      *Workspace     `json:"workspace,omitempty"`
+}
+
+// OutputStyle is the output style Claude Code answers in
+type OutputStyle struct {
+	Name string `json:"name"` // "default", "Explanatory", "Learning" or a custom style
+}
+
+// Workspace holds the directories of the session
+type Workspace struct {
+	CurrentDir string `json:"current_dir"`
+	ProjectDir string `json:"project_dir"` // where Claude Code was started
 }
 
 // ContextWindow represents context usage from Claude Code
@@ -134,12 +252,26 @@ type TodoItem struct {
 	Status  string // "pending" | "in_progress" | "completed"
 }
 
+// Note is an annotation left on a session with the note command
+type Note struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
 // TranscriptData holds parsed transcript information
 type TranscriptData struct {
 	Tools        []ToolEntry
 	Agents       []AgentEntry
 	Todos        []TodoItem
 	SessionStart time.Time
+	// Lines added and removed by the session's file edits
+	LinesAdded   int
+	LinesRemoved int
+	// Tool results in a row that were errors, up to the latest one
+	ErrorStreak int
+	// Completed (or failed) calls per tool over the whole session; Tools
+	// only keeps the latest
+	ToolCounts map[string]int
 }
 
 // SessionModel contains model identification
@@ -150,11 +282,66 @@ type SessionModel struct {
 
 // GitInfo holds git repository status
 type GitInfo struct {
-	Branch       string
-	HasUntracked bool
-	HasStaged    bool
-	HasModified  bool
-	Ahead        int
-	Behind       int
-	IsRepo       bool
+	Branch    string `json:"branch"`
+	Untracked int    `json:"untracked"` // untracked entries (a new directory counts once)
+	Staged    int    `json:"staged"`    // files with staged changes
+	Modified  int    `json:"modified"`  // files with unstaged changes
+	Ahead     int    `json:"ahead"`
+	Behind    int    `json:"behind"`
+	IsRepo    bool   `json:"is_repo"`
+	// Upstreams is the divergence from each compared remote, the branch's
+	// own upstream first, when more than one remote is compared
+	Upstreams []Upstream `json:"upstreams,omitempty"`
+	// Scope is "repo:subdir" inside a nested repository or a monorepo
+	// subproject matched by --git-scope (whose status counts are then
+	// limited to the subproject)
+	Scope string `json:"scope,omitempty"`
+	// LastCommit is when HEAD was committed and LastSubject its subject,
+	// read for --git-last-commit
+	LastCommit  *time.Time `json:"last_commit,omitempty"`
+	LastSubject string     `json:"last_subject,omitempty"`
+	// StatusUnknown is set when git status ran past --git-status-timeout,
+	// leaving the modified, staged and untracked counts at zero
+	StatusUnknown bool `json:"status_unknown,omitempty"`
+	// CommitsToday counts the commits on HEAD made since midnight
+	CommitsToday int `json:"commits_today,omitempty"`
+	// Base is the repository's default branch, e.g. "main", and BaseAhead
+	// and BaseBehind how far HEAD has diverged from it. Empty on the
+	// default branch itself.
+	Base       string `json:"base,omitempty"`
+	BaseAhead  int    `json:"base_ahead,omitempty"`
+	BaseBehind int    `json:"base_behind,omitempty"`
+}
+
+// Upstream is how far HEAD has diverged from a remote's branch
+type Upstream struct {
+	Remote string `json:"remote"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
+}
+
+// StatusData is everything collected for a single statusline render
+type StatusData struct {
+	// Working directory shown in the dir segment (empty = process cwd)
+	Cwd string `json:"cwd,omitempty"`
+	// Project name from the nearest package manifest, shown in the dir
+	// segment instead of the directory (--project-name)
+	Project string `json:"project,omitempty"`
+
+	Session      *SessionInput   `json:"session,omitempty"`
+	Git          GitInfo         `json:"git"`
+	Usage        *UsageCache     `json:"usage,omitempty"`
+	Stats        *TokenStats     `json:"stats,omitempty"`
+	Subscription string          `json:"subscription,omitempty"`
+	Tier         string          `json:"tier,omitempty"`
+	IsApiBilling bool            `json:"is_api_billing,omitempty"`
+	Profile      string          `json:"profile,omitempty"` // active account profile
+	Transcript   *TranscriptData `json:"transcript,omitempty"`
+	Note         *Note           `json:"note,omitempty"`
+
+	// What the commands of the custom segments printed, by segment name
+	Custom map[string]string `json:"custom,omitempty"`
+
+	// How each component (git, usage, cost, transcript, custom) was collected
+	Sources map[string]string `json:"sources,omitempty"`
 }
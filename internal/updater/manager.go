@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Manager is a package manager that installed the binary, and so owns it:
+// updates go through it rather than replacing the files it tracks
+type Manager struct {
+	Name    string
+	Command string // updates the binary
+}
+
+// managers are the package managers known by name, for the marker file
+var managers = map[string]Manager{
+	"homebrew": {"Homebrew", "brew upgrade claude-code-statusline"},
+	"apt":      {"apt", "sudo apt update && sudo apt install --only-upgrade claude-code-statusline"},
+	"scoop":    {"Scoop", "scoop update claude-code-statusline"},
+}
+
+// dpkgInfoDir holds the file lists of Debian packages
+var dpkgInfoDir = "/var/lib/dpkg/info"
+
+// InstalledBy returns the package manager that installed the running binary,
+// nil if there is none (or it can't be told)
+func InstalledBy() *Manager {
+	execPath, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		execPath = resolved
+	}
+	return detectManager(execPath)
+}
+
+// detectManager finds the package manager of the binary at execPath. A
+// marker file next to it, claude-code-statusline.install-method, names the
+// manager (homebrew, apt or scoop) or holds the command that updates it, for
+// packages the path doesn't give away. Otherwise Homebrew and Scoop are
+// recognized by their directories, and apt by the package's file list.
+func detectManager(execPath string) *Manager {
+	marker := strings.TrimSuffix(execPath, ".exe") + ".install-method"
+	if data, err := os.ReadFile(marker); err == nil {
+		method, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+		if m, ok := managers[strings.ToLower(strings.TrimSpace(method))]; ok {
+			return &m
+		}
+		if method = strings.TrimSpace(method); method != "" {
+			return &Manager{Name: "a package manager", Command: method}
+		}
+	}
+
+	slashed := strings.ToLower(strings.ReplaceAll(execPath, "\\", "/"))
+	switch {
+	case strings.Contains(slashed, "/cellar/") || strings.Contains(slashed, "/homebrew/") || strings.Contains(slashed, "/.linuxbrew/"):
+		m := managers["homebrew"]
+		return &m
+	case strings.Contains(slashed, "/scoop/apps/"):
+		m := managers["scoop"]
+		return &m
+	}
+
+	if list, err := os.ReadFile(filepath.Join(dpkgInfoDir, "claude-code-statusline.list")); err == nil {
+		for _, line := range strings.Split(string(list), "\n") {
+			if strings.TrimSpace(line) == execPath {
+				m := managers["apt"]
+				return &m
+			}
+		}
+	}
+	return nil
+}
@@ -2,13 +2,17 @@ package updater
 
 import (
 	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -18,39 +22,64 @@ import (
 )
 
 const (
-	githubRepo     = "erwint/claude-code-statusline"
-	releasesURL    = "https://api.github.com/repos/" + githubRepo + "/releases/latest"
-	downloadURLFmt = "https://github.com/" + githubRepo + "/releases/download/%s/claude-code-statusline_%s_%s.tar.gz"
-	updateCheckTTL = 24 * time.Hour
+	githubRepo = "erwint/claude-code-statusline"
+	archiveFmt = "claude-code-statusline_%s_%s"
+
+	// checksumsFile lists the SHA-256 of each release archive, and
+	// signatureFile is its minisign signature
+	checksumsFile = "checksums.txt"
+	signatureFile = checksumsFile + ".minisig"
+
+	// Upper bound on the extracted binary, guards against decompression bombs
+	maxBinarySize = 200 << 20
+	// Upper bound on the checksums and their signature
+	maxChecksumsSize = 1 << 20
+)
+
+// errOffline is returned instead of making requests with --offline
+var errOffline = errors.New("offline, not checking for updates")
+
+// releasesURL lists the releases, and downloadURL is where release assets
+// are downloaded from, by tag
+var (
+	releasesURL = "https://api.github.com/repos/" + githubRepo + "/releases"
+	downloadURL = "https://github.com/" + githubRepo + "/releases/download"
 )
 
 type UpdateCache struct {
 	LastCheck   time.Time `json:"last_check"`
 	LatestVersion string  `json:"latest_version"`
+	// PreviousVersion is the version kept as the .backup binary, if known
+	PreviousVersion string `json:"previous_version,omitempty"`
+	// SkipVersion was rolled back from, so automatic updates leave it out
+	SkipVersion string `json:"skip_version,omitempty"`
 }
 
 type Release struct {
-	TagName string `json:"tag_name"`
-	Name    string `json:"name"`
-	Body    string `json:"body"`
+	TagName    string `json:"tag_name"`
+	Name       string `json:"name"`
+	Body       string `json:"body"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
 }
 
-// CheckForUpdate checks if a newer version is available
+// CheckForUpdate checks if a version other than the current one should be
+// installed: the pinned version with --update-pin, else the latest release
+// of the --update-channel
 func CheckForUpdate(currentVersion string) (*Release, bool, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(releasesURL)
-	if err != nil {
-		return nil, false, fmt.Errorf("failed to check for updates: %w", err)
+	cfg := config.Get()
+	var release *Release
+	var err error
+	switch {
+	case cfg.UpdatePin != "":
+		release, err = FindRelease(cfg.UpdatePin)
+	case cfg.UpdateChannel == "prerelease":
+		release, err = latestPrerelease()
+	default:
+		release, err = fetchRelease(releasesURL + "/latest")
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, false, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
-	}
-
-	var release Release
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return nil, false, fmt.Errorf("failed to parse release info: %w", err)
+	if err != nil {
+		return nil, false, err
 	}
 
 	// Compare versions (strip 'v' prefix if present)
@@ -58,34 +87,79 @@ func CheckForUpdate(currentVersion string) (*Release, bool, error) {
 	latestVer := strings.TrimPrefix(release.TagName, "v")
 
 	if latestVer == currentVer || latestVer == "" {
-		return &release, false, nil
+		return release, false, nil
 	}
 
-	return &release, true, nil
+	return release, true, nil
 }
 
-// Update downloads and installs the latest version
-func Update(currentVersion string, release *Release) error {
-	// Determine platform and architecture
-	goos := runtime.GOOS
-	goarch := runtime.GOARCH
+// FindRelease returns the release of a version, with or without its v
+func FindRelease(version string) (*Release, error) {
+	return fetchRelease(releasesURL + "/tags/v" + strings.TrimPrefix(version, "v"))
+}
 
-	// Construct download URL
-	// Format: claude-code-statusline_darwin_arm64.tar.gz
-	downloadURL := fmt.Sprintf(downloadURLFmt, release.TagName, goos, goarch)
+// latestPrerelease returns the newest release, prereleases included
+func latestPrerelease() (*Release, error) {
+	var releases []Release
+	if err := getJSON(releasesURL+"?per_page=20", &releases); err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if !releases[i].Draft {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no releases found")
+}
 
-	config.DebugLog("Downloading from: %s", downloadURL)
+// fetchRelease gets a release from the GitHub API
+func fetchRelease(url string) (*Release, error) {
+	var release Release
+	if err := getJSON(url, &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
 
-	// Download the tar.gz file
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Get(downloadURL)
+// getJSON decodes the GitHub API response at url into v
+func getJSON(url string, v any) error {
+	if config.Get().Offline {
+		return errOffline
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to download update: %w", err)
+		return fmt.Errorf("failed to check for updates: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("release not found")
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+		return fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse release info: %w", err)
+	}
+	return nil
+}
+
+// Update downloads and installs a release, keeping the binary it replaces
+// as <binary>.backup for Rollback. The archive must match
+// its checksum in the release's checksums.txt, which with
+// --update-public-key must be signed with that key; otherwise nothing is
+// installed.
+func Update(currentVersion string, release *Release) error {
+	if m := InstalledBy(); m != nil {
+		return fmt.Errorf("installed with %s, update with: %s", m.Name, m.Command)
+	}
+	client := &http.Client{Timeout: 60 * time.Second}
+	name := archiveName(runtime.GOOS, runtime.GOARCH)
+	archive, err := downloadVerified(client, release.TagName, name)
+	if err != nil {
+		return err
 	}
 
 	// Get current executable path
@@ -100,17 +174,27 @@ func Update(currentVersion string, release *Release) error {
 		return fmt.Errorf("failed to resolve executable path: %w", err)
 	}
 
+	// Binaries a previous update couldn't remove, see removeFile
+	removeOldFiles(execPath)
+
 	// Create temporary file for the new binary
 	tmpFile := execPath + ".tmp"
 
-	// Extract binary from tar.gz
-	if err := extractBinary(resp.Body, tmpFile); err != nil {
+	// Extract binary from the tar.gz or zip
+	if err := extractArchive(name, archive, tmpFile); err != nil {
+		os.Remove(tmpFile)
 		return fmt.Errorf("failed to extract binary: %w", err)
 	}
 
-	// Create backup
+	// The new binary gets the same permissions as the one it replaces
+	if info, err := os.Stat(execPath); err == nil {
+		os.Chmod(tmpFile, info.Mode().Perm())
+	}
+
+	// Create backup. Windows won't overwrite a running binary but does
+	// rename it, so it's moved to the backup and the new one takes its name.
 	backupFile := execPath + ".backup"
-	os.Remove(backupFile) // Remove old backup if exists
+	removeFile(backupFile) // Remove old backup if exists
 	if err := os.Rename(execPath, backupFile); err != nil {
 		os.Remove(tmpFile)
 		return fmt.Errorf("failed to backup current version: %w", err)
@@ -123,12 +207,186 @@ func Update(currentVersion string, release *Release) error {
 		return fmt.Errorf("failed to install update: %w", err)
 	}
 
-	// Remove backup on success
-	os.Remove(backupFile)
+	// Keep the backup for Rollback
+	cacheFile := getCacheFile()
+	cache := loadUpdateCache(cacheFile)
+	cache.PreviousVersion = currentVersion
+	cache.SkipVersion = ""
+	saveUpdateCache(cacheFile, cache)
 
 	return nil
 }
 
+// Rollback reinstalls the binary the last update replaced, and keeps the
+// current one as the backup in turn. Automatic updates skip the version
+// rolled back from until a newer one is released. It returns the version
+// restored, if known.
+func Rollback(currentVersion string) (string, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+	execPath, err = filepath.EvalSymlinks(execPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+	if err := swapBackup(execPath); err != nil {
+		return "", err
+	}
+
+	cacheFile := getCacheFile()
+	cache := loadUpdateCache(cacheFile)
+	previous := cache.PreviousVersion
+	cache.PreviousVersion = currentVersion
+	cache.SkipVersion = currentVersion
+	saveUpdateCache(cacheFile, cache)
+	return previous, nil
+}
+
+// swapBackup exchanges the binary at execPath with its .backup
+func swapBackup(execPath string) error {
+	backupFile := execPath + ".backup"
+	if _, err := os.Stat(backupFile); err != nil {
+		return fmt.Errorf("no previous version to roll back to (%s)", filepath.Base(backupFile))
+	}
+	tmpFile := execPath + ".rollback"
+	removeFile(tmpFile)
+	if err := os.Rename(execPath, tmpFile); err != nil {
+		return fmt.Errorf("failed to move current version aside: %w", err)
+	}
+	if err := os.Rename(backupFile, execPath); err != nil {
+		os.Rename(tmpFile, execPath)
+		return fmt.Errorf("failed to restore previous version: %w", err)
+	}
+	if err := os.Rename(tmpFile, backupFile); err != nil {
+		config.WarnLog("Keeping %s as the backup: %v", tmpFile, err)
+	}
+	return nil
+}
+
+// downloadVerified downloads the named asset of a release and checks it
+// against the release's checksums, and those against their signature if
+// --update-public-key is set
+func downloadVerified(client *http.Client, tag, name string) ([]byte, error) {
+	base := downloadURL + "/" + tag + "/"
+	checksums, err := download(client, base+checksumsFile, maxChecksumsSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download checksums, refusing to update: %w", err)
+	}
+	if key := config.Get().UpdatePublicKey; key != "" {
+		k, err := parseMinisignKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("--update-public-key: %w", err)
+		}
+		signature, err := download(client, base+signatureFile, maxChecksumsSize)
+		if err != nil {
+			return nil, fmt.Errorf("release is not signed, refusing to update: %w", err)
+		}
+		if err := verifyMinisign(k, checksums, signature); err != nil {
+			return nil, fmt.Errorf("%s: %w, refusing to update", signatureFile, err)
+		}
+		config.DebugLog("Verified the signature of %s%s", base, checksumsFile)
+	}
+
+	data, err := download(client, base+name, maxBinarySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download update: %w", err)
+	}
+	if err := verifyChecksum(checksums, data, name); err != nil {
+		return nil, fmt.Errorf("%w, refusing to update", err)
+	}
+	return data, nil
+}
+
+// download fetches url, failing if it's larger than limit
+func download(client *http.Client, url string, limit int64) ([]byte, error) {
+	if config.Get().Offline {
+		return nil, errOffline
+	}
+	config.DebugLog("Downloading from: %s", url)
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s exceeds %d bytes", path.Base(url), limit)
+	}
+	return data, nil
+}
+
+// archiveName is the release archive for a platform: a zip on Windows and a
+// tar.gz elsewhere, e.g. claude-code-statusline_darwin_arm64.tar.gz
+func archiveName(goos, goarch string) string {
+	ext := ".tar.gz"
+	if goos == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf(archiveFmt, goos, goarch) + ext
+}
+
+// extractArchive extracts the binary from the named release archive
+func extractArchive(name string, data []byte, destPath string) error {
+	if strings.HasSuffix(name, ".zip") {
+		return extractZip(data, destPath)
+	}
+	return extractBinary(bytes.NewReader(data), destPath)
+}
+
+// removeFile deletes path. Windows won't delete the binary of a process
+// that's still running, but does rename it, so such a file is moved to a
+// .old name instead, for removeOldFiles to delete once it has exited.
+func removeFile(path string) {
+	if err := os.Remove(path); err == nil || os.IsNotExist(err) {
+		return
+	}
+	old := fmt.Sprintf("%s.%d.old", path, time.Now().UnixNano())
+	if err := os.Rename(path, old); err != nil {
+		config.WarnLog("Failed to remove %s: %v", path, err)
+	}
+}
+
+// removeOldFiles deletes the binaries removeFile moved aside, those that
+// are no longer running
+func removeOldFiles(execPath string) {
+	old, _ := filepath.Glob(execPath + ".*.old")
+	for _, file := range old {
+		os.Remove(file)
+	}
+}
+
+// extractZip extracts the claude-code-statusline binary from a zip archive
+func extractZip(data []byte, destPath string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := validateArchivePath(f.Name); err != nil {
+			return err
+		}
+
+		// Look for the claude-code-statusline binary, skipping links and directories
+		if f.Mode().IsRegular() && isBinaryName(f.Name) {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			return writeBinary(rc, destPath)
+		}
+	}
+	return fmt.Errorf("binary not found in archive")
+}
+
 // extractBinary extracts the claude-code-statusline binary from a tar.gz archive
 func extractBinary(r io.Reader, destPath string) error {
 	// Create gzip reader
@@ -151,33 +409,77 @@ func extractBinary(r io.Reader, destPath string) error {
 			return err
 		}
 
-		// Look for the claude-code-statusline binary
-		if strings.Contains(header.Name, "claude-code-statusline") && !strings.Contains(header.Name, ".") {
-			// Found the binary, extract it
-			out, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
-			if err != nil {
-				return err
-			}
-			defer out.Close()
-
-			_, err = io.Copy(out, tr)
+		if err := validateArchivePath(header.Name); err != nil {
 			return err
 		}
+
+		// Look for the claude-code-statusline binary, skipping links and directories
+		if header.Typeflag == tar.TypeReg && isBinaryName(header.Name) {
+			return writeBinary(tr, destPath)
+		}
 	}
 
 	return fmt.Errorf("binary not found in archive")
 }
 
-// CheckForUpdateDaily checks for updates once per day and auto-updates if available
+// writeBinary writes the binary found in an archive to destPath,
+// owner-only until it's installed
+func writeBinary(r io.Reader, destPath string) error {
+	out, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0700)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, io.LimitReader(r, maxBinarySize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxBinarySize {
+		return fmt.Errorf("binary in archive exceeds %d bytes", maxBinarySize)
+	}
+	return nil
+}
+
+// validateArchivePath rejects archive entries that would escape the
+// extraction directory
+func validateArchivePath(name string) error {
+	if name == "" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "\\") || filepath.IsAbs(name) {
+		return fmt.Errorf("unsafe path in archive: %q", name)
+	}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return fmt.Errorf("unsafe path in archive: %q", name)
+		}
+	}
+	return nil
+}
+
+// isBinaryName reports whether an archive entry is the statusline binary
+func isBinaryName(name string) bool {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	return base == "claude-code-statusline" || base == "claude-code-statusline.exe"
+}
+
+// CheckForUpdateDaily checks for updates once per --update-ttl (a day by
+// default) and auto-updates if available
 func CheckForUpdateDaily(currentVersion string) {
+	// The package manager that installed the binary updates it
+	if m := InstalledBy(); m != nil {
+		config.DebugLog("Installed with %s, leaving updates to it", m.Name)
+		return
+	}
+
 	cacheFile := getCacheFile()
 	cache := loadUpdateCache(cacheFile)
 
-	// Add jitter (±2 hours) to avoid thundering herd
-	jitter := time.Duration(rand.Int63n(int64(4*time.Hour))) - 2*time.Hour
-	checkInterval := updateCheckTTL + jitter
+	// Add jitter (±1/12 of the interval, ±2 hours for a day) to avoid
+	// thundering herd
+	interval := config.Get().UpdateInterval()
+	jitter := time.Duration(rand.Int63n(int64(interval/6))) - interval/12
+	checkInterval := interval + jitter
 
-	// Check if we've checked recently (within 24h ± jitter)
+	// Check if we've checked recently (within the interval ± jitter)
 	if time.Since(cache.LastCheck) < checkInterval {
 		return
 	}
@@ -188,7 +490,7 @@ func CheckForUpdateDaily(currentVersion string) {
 	// Check for updates
 	release, hasUpdate, err := CheckForUpdate(currentVersion)
 	if err != nil {
-		config.DebugLog("Update check failed: %v", err)
+		config.WarnLog("Update check failed: %v", err)
 		saveUpdateCache(cacheFile, cache)
 		return
 	}
@@ -198,45 +500,39 @@ func CheckForUpdateDaily(currentVersion string) {
 		saveUpdateCache(cacheFile, cache)
 		return
 	}
+	if strings.TrimPrefix(release.TagName, "v") == strings.TrimPrefix(cache.SkipVersion, "v") {
+		config.DebugLog("Not updating to %s, which was rolled back", release.TagName)
+		cache.LatestVersion = release.TagName
+		saveUpdateCache(cacheFile, cache)
+		return
+	}
 
 	// New version available
 	cache.LatestVersion = release.TagName
 	saveUpdateCache(cacheFile, cache)
 
-	config.DebugLog("New version available: %s (current: %s)", release.TagName, currentVersion)
+	config.InfoLog("New version available: %s (current: %s)", release.TagName, currentVersion)
 
-	// Auto-update in background
-	go func() {
-		if err := Update(currentVersion, release); err != nil {
-			config.DebugLog("Auto-update failed: %v", err)
-		} else {
-			config.DebugLog("Auto-updated to %s", release.TagName)
-		}
-	}()
+	// Auto-update (callers already run this in the background)
+	if err := Update(currentVersion, release); err != nil {
+		config.ErrorLog("Auto-update failed: %v", err)
+	} else {
+		config.InfoLog("Auto-updated to %s", release.TagName)
+	}
 }
 
 func getCacheFile() string {
-	cacheDir := filepath.Join(os.Getenv("HOME"), ".cache", "claude-code-statusline")
-	os.MkdirAll(cacheDir, 0755)
-	return filepath.Join(cacheDir, "update_cache.json")
+	return filepath.Join(config.CacheDir(), "update_cache.json")
 }
 
 func loadUpdateCache(file string) *UpdateCache {
 	cache := &UpdateCache{}
-
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return cache
+	if config.ReadCache(file, cache) != nil {
+		return &UpdateCache{}
 	}
-
-	json.Unmarshal(data, cache)
 	return cache
 }
 
 func saveUpdateCache(file string, cache *UpdateCache) {
-	data, err := json.Marshal(cache)
-	if err != nil {
-		return
-	}
-	os.WriteFile(file, data, 0644)
+	config.WriteCache(file, cache)
 }
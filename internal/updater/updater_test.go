@@ -0,0 +1,517 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+)
+
+type archiveEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+func makeArchive(t *testing.T, entries []archiveEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0755, Size: int64(len(e.body)), Linkname: e.linkname}
+		if e.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tw.Close()
+	gzw.Close()
+	return &buf
+}
+
+func TestExtractBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "binary next to docs",
+			entries: []archiveEntry{
+				{name: "README.md", typeflag: tar.TypeReg, body: "docs"},
+				{name: "claude-code-statusline", typeflag: tar.TypeReg, body: "binary"},
+			},
+			want: "binary",
+		},
+		{
+			name: "binary in a directory",
+			entries: []archiveEntry{
+				{name: "dist/", typeflag: tar.TypeDir},
+				{name: "dist/claude-code-statusline", typeflag: tar.TypeReg, body: "binary"},
+			},
+			want: "binary",
+		},
+		{
+			name: "symlink is skipped",
+			entries: []archiveEntry{
+				{name: "claude-code-statusline", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "traversal is rejected",
+			entries: []archiveEntry{
+				{name: "../../claude-code-statusline", typeflag: tar.TypeReg, body: "evil"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "absolute path is rejected",
+			entries: []archiveEntry{
+				{name: "/usr/local/bin/claude-code-statusline", typeflag: tar.TypeReg, body: "evil"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing binary",
+			entries: []archiveEntry{{name: "README.md", typeflag: tar.TypeReg, body: "docs"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "claude-code-statusline.tmp")
+			err := extractBinary(makeArchive(t, tt.entries), dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractBinary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			data, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("extracted %q, want %q", data, tt.want)
+			}
+			if runtime.GOOS != "windows" {
+				info, _ := os.Stat(dest)
+				if perm := info.Mode().Perm(); perm != 0700 {
+					t.Errorf("extracted binary has mode %o, want 700", perm)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	makeZip := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, body := range files {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(body))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"exe next to docs", map[string]string{"README.md": "docs", "claude-code-statusline.exe": "binary"}, "binary", false},
+		{"exe in a directory", map[string]string{"dist/": "", "dist/claude-code-statusline.exe": "binary"}, "binary", false},
+		{"traversal is rejected", map[string]string{"..\\claude-code-statusline.exe": "evil"}, "", true},
+		{"missing binary", map[string]string{"claude-code-statusline.txt": "docs"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "claude-code-statusline.exe.tmp")
+			err := extractArchive("claude-code-statusline_windows_amd64.zip", makeZip(tt.files), dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if data, _ := os.ReadFile(dest); !tt.wantErr && string(data) != tt.want {
+				t.Errorf("extracted %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	if got := archiveName("windows", "amd64"); got != "claude-code-statusline_windows_amd64.zip" {
+		t.Errorf("archiveName(windows) = %s", got)
+	}
+	if got := archiveName("linux", "arm64"); got != "claude-code-statusline_linux_arm64.tar.gz" {
+		t.Errorf("archiveName(linux) = %s", got)
+	}
+}
+
+func TestRemoveOldFiles(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "claude-code-statusline.exe")
+	os.WriteFile(bin, []byte("current"), 0700)
+	os.WriteFile(bin+".backup", []byte("backup"), 0700)
+	os.WriteFile(bin+".123.old", []byte("old"), 0700)
+
+	removeFile(bin + ".backup")
+	removeFile(bin + ".missing")
+	removeOldFiles(bin)
+	entries, _ := os.ReadDir(filepath.Dir(bin))
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(bin) {
+		t.Errorf("left %v, want only the binary", entries)
+	}
+}
+
+func TestValidateArchivePath(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"claude-code-statusline", true},
+		{"dist/claude-code-statusline", true},
+		{"./claude-code-statusline", true},
+		{"../claude-code-statusline", false},
+		{"dist/../../claude-code-statusline", false},
+		{"..\\claude-code-statusline", false},
+		{"/claude-code-statusline", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateArchivePath(tt.name); (err == nil) != tt.ok {
+				t.Errorf("validateArchivePath(%q) = %v, want ok=%v", tt.name, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("archive")
+	sum := sha256.Sum256(data)
+	good := hex.EncodeToString(sum[:])
+	tests := []struct {
+		name      string
+		checksums string
+		wantErr   bool
+	}{
+		{"match", good + "  claude-code-statusline_linux_amd64.tar.gz\n", false},
+		{"binary mode marker", "0000  other.tar.gz\n" + good + " *claude-code-statusline_linux_amd64.tar.gz\n", false},
+		{"mismatch", strings.Repeat("0", 64) + "  claude-code-statusline_linux_amd64.tar.gz\n", true},
+		{"missing", good + "  claude-code-statusline_darwin_arm64.tar.gz\n", true},
+		{"malformed", "xyz  claude-code-statusline_linux_amd64.tar.gz\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyChecksum([]byte(tt.checksums), data, "claude-code-statusline_linux_amd64.tar.gz")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// minisign signs data as minisign does with the given algorithm (ED by
+// default, Ed with -l), returning the public key and the signature file
+func minisign(t *testing.T, algorithm string, data []byte, comment string) (string, []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algorithm == minisignPrehashed {
+		sum := blake2b512(data)
+		data = sum[:]
+	}
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	sig := append(append([]byte(algorithm), id...), ed25519.Sign(priv, data)...)
+	global := ed25519.Sign(priv, append(append([]byte{}, sig[10:]...), comment...))
+	file := fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sig), comment, base64.StdEncoding.EncodeToString(global))
+	key := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...))
+	return key, []byte(file)
+}
+
+func TestBlake2b512(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		// RFC 7693, appendix A
+		{"abc", "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{"", "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+	}
+	for _, tt := range tests {
+		if sum := blake2b512([]byte(tt.data)); hex.EncodeToString(sum[:]) != tt.want {
+			t.Errorf("blake2b512(%q) = %x, want %s", tt.data, sum, tt.want)
+		}
+	}
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	data := []byte("checksums")
+	key, signature := minisign(t, minisignLegacy, data, "timestamp:1700000000")
+	otherKey, _ := minisign(t, minisignLegacy, data, "")
+
+	pubFile := filepath.Join(t.TempDir(), "minisign.pub")
+	os.WriteFile(pubFile, []byte("untrusted comment: minisign public key\n"+key+"\n"), 0600)
+	for _, k := range []string{key, pubFile} {
+		parsed, err := parseMinisignKey(k)
+		if err != nil {
+			t.Fatalf("parseMinisignKey(%s) error: %v", k, err)
+		}
+		if err := verifyMinisign(parsed, data, signature); err != nil {
+			t.Errorf("verifyMinisign() error: %v", err)
+		}
+	}
+
+	// The default, prehashed format; checksums files are large enough to
+	// take several BLAKE2b blocks
+	long := bytes.Repeat([]byte("0123456789abcdef  app.tar.gz\n"), 20)
+	prehashedKey, prehashed := minisign(t, minisignPrehashed, long, "timestamp:1700000000")
+	if k, err := parseMinisignKey(prehashedKey); err != nil {
+		t.Errorf("parseMinisignKey(prehashed) error: %v", err)
+	} else if err := verifyMinisign(k, long, prehashed); err != nil {
+		t.Errorf("verifyMinisign(prehashed) error: %v", err)
+	} else if err := verifyMinisign(k, long[1:], prehashed); err == nil {
+		t.Error("verifyMinisign(prehashed) accepted tampered data")
+	}
+
+	k, _ := parseMinisignKey(key)
+	other, _ := parseMinisignKey(otherKey)
+	tests := []struct {
+		name      string
+		key       *minisignKey
+		data      []byte
+		signature []byte
+	}{
+		{"tampered data", k, []byte("checksums!"), signature},
+		{"tampered comment", k, data, bytes.Replace(signature, []byte("1700000000"), []byte("1800000000"), 1)},
+		{"algorithm swapped", k, data, bytes.Replace(signature, []byte("RWQ"), []byte("RUQ"), 1)},
+		{"other key", other, data, signature},
+		{"truncated", k, data, signature[:40]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyMinisign(tt.key, tt.data, tt.signature); err == nil {
+				t.Error("verifyMinisign() succeeded, want an error")
+			}
+		})
+	}
+	if _, err := parseMinisignKey("not a key"); err == nil {
+		t.Error("parseMinisignKey(not a key) succeeded")
+	}
+}
+
+func TestDownloadVerified(t *testing.T) {
+	defer func(url string) { downloadURL = url }(downloadURL)
+	defer func() { *config.Get() = config.Config{} }()
+
+	archive := []byte("archive")
+	sum := sha256.Sum256(archive)
+	checksums := []byte(hex.EncodeToString(sum[:]) + "  app.tar.gz\n")
+	key, signature := minisign(t, minisignPrehashed, checksums, "release")
+	assets := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := assets[strings.TrimPrefix(r.URL.Path, "/v1.0.0/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	downloadURL = srv.URL
+
+	tests := []struct {
+		name    string
+		assets  map[string][]byte
+		key     string
+		wantErr string
+	}{
+		{"checksum ok", map[string][]byte{"app.tar.gz": archive, checksumsFile: checksums}, "", ""},
+		{"no checksums", map[string][]byte{"app.tar.gz": archive}, "", "refusing"},
+		{"tampered archive", map[string][]byte{"app.tar.gz": []byte("evil"), checksumsFile: checksums}, "", "checksum mismatch"},
+		{"signed", map[string][]byte{"app.tar.gz": archive, checksumsFile: checksums, signatureFile: signature}, key, ""},
+		{"unsigned", map[string][]byte{"app.tar.gz": archive, checksumsFile: checksums}, key, "not signed"},
+		{"bad signature", map[string][]byte{"app.tar.gz": archive, checksumsFile: append(checksums, '\n'), signatureFile: signature}, key, "invalid signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assets = tt.assets
+			config.Get().UpdatePublicKey = tt.key
+			data, err := downloadVerified(srv.Client(), "v1.0.0", "app.tar.gz")
+			if tt.wantErr == "" {
+				if err != nil || !bytes.Equal(data, archive) {
+					t.Errorf("downloadVerified() = %q, %v", data, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("downloadVerified() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	defer func(url string) { releasesURL = url }(releasesURL)
+	defer func() { *config.Get() = config.Config{} }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			fmt.Fprint(w, `{"tag_name": "v1.5.0"}`)
+		case "/tags/v1.4.2":
+			fmt.Fprint(w, `{"tag_name": "v1.4.2"}`)
+		case "/":
+			fmt.Fprint(w, `[{"tag_name": "v1.7.0", "draft": true}, {"tag_name": "v1.6.0-rc1", "prerelease": true}, {"tag_name": "v1.5.0"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	releasesURL = srv.URL
+
+	tests := []struct {
+		name, channel, pin, current string
+		want                        string
+		wantUpdate, wantErr         bool
+	}{
+		{"stable", "stable", "", "1.4.0", "v1.5.0", true, false},
+		{"stable, current", "stable", "", "1.5.0", "v1.5.0", false, false},
+		{"prerelease", "prerelease", "", "1.5.0", "v1.6.0-rc1", true, false},
+		{"pinned", "stable", "1.4.2", "1.5.0", "v1.4.2", true, false},
+		{"pinned, current", "prerelease", "v1.4.2", "1.4.2", "v1.4.2", false, false},
+		{"pinned, unknown", "stable", "v9.9.9", "1.5.0", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*config.Get() = config.Config{UpdateChannel: tt.channel, UpdatePin: tt.pin}
+			release, hasUpdate, err := CheckForUpdate(tt.current)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckForUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if release.TagName != tt.want || hasUpdate != tt.wantUpdate {
+				t.Errorf("CheckForUpdate() = %s, %v, want %s, %v", release.TagName, hasUpdate, tt.want, tt.wantUpdate)
+			}
+		})
+	}
+}
+
+func TestSwapBackup(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "claude-code-statusline")
+	if err := swapBackup(bin); err == nil {
+		t.Error("swapBackup() without a backup succeeded")
+	}
+
+	os.WriteFile(bin, []byte("new"), 0700)
+	os.WriteFile(bin+".backup", []byte("old"), 0700)
+	if err := swapBackup(bin); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := os.ReadFile(bin)
+	backup, _ := os.ReadFile(bin + ".backup")
+	if string(current) != "old" || string(backup) != "new" {
+		t.Errorf("after swapBackup() binary = %q, backup = %q, want old and new", current, backup)
+	}
+	if _, err := os.Stat(bin + ".rollback"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestDetectManager(t *testing.T) {
+	defer func(dir string) { dpkgInfoDir = dir }(dpkgInfoDir)
+	dir := t.TempDir()
+	dpkgInfoDir = filepath.Join(dir, "dpkg")
+	os.MkdirAll(dpkgInfoDir, 0700)
+	os.WriteFile(filepath.Join(dpkgInfoDir, "claude-code-statusline.list"), []byte("/usr\n/usr/bin\n/usr/bin/claude-code-statusline\n"), 0600)
+
+	marked := filepath.Join(dir, "named", "claude-code-statusline")
+	os.MkdirAll(filepath.Dir(marked), 0700)
+	os.WriteFile(marked+".install-method", []byte("Homebrew\n"), 0600)
+	command := filepath.Join(dir, "command", "claude-code-statusline.exe")
+	os.MkdirAll(filepath.Dir(command), 0700)
+	os.WriteFile(filepath.Join(dir, "command", "claude-code-statusline.install-method"), []byte("nix profile upgrade statusline\n"), 0600)
+
+	tests := []struct {
+		name     string
+		execPath string
+		want     string // command, "" for none
+	}{
+		{"homebrew cellar", "/opt/homebrew/Cellar/claude-code-statusline/1.4.2/bin/claude-code-statusline", "brew upgrade claude-code-statusline"},
+		{"linuxbrew", "/home/linuxbrew/.linuxbrew/bin/claude-code-statusline", "brew upgrade claude-code-statusline"},
+		{"scoop", `C:\Users\me\scoop\apps\claude-code-statusline\current\claude-code-statusline.exe`, "scoop update claude-code-statusline"},
+		{"apt", "/usr/bin/claude-code-statusline", managers["apt"].Command},
+		{"marker with a name", marked, "brew upgrade claude-code-statusline"},
+		{"marker with a command", command, "nix profile upgrade statusline"},
+		{"installed by hand", "/usr/local/bin/claude-code-statusline", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if m := detectManager(tt.execPath); m != nil {
+				got = m.Command
+			}
+			if got != tt.want {
+				t.Errorf("detectManager(%s) = %q, want %q", tt.execPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffline(t *testing.T) {
+	defer func(releases, download string) { releasesURL, downloadURL = releases, download }(releasesURL, downloadURL)
+	defer func() { *config.Get() = config.Config{} }()
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"tag_name": "v1.5.0"}`)
+	}))
+	defer srv.Close()
+	releasesURL, downloadURL = srv.URL, srv.URL
+
+	*config.Get() = config.Config{Offline: true}
+	if _, _, err := CheckForUpdate("1.4.0"); err == nil {
+		t.Error("CheckForUpdate() succeeded offline")
+	}
+	if _, err := downloadVerified(srv.Client(), "v1.5.0", "app.tar.gz"); err == nil {
+		t.Error("downloadVerified() succeeded offline")
+	}
+	if requests != 0 {
+		t.Errorf("got %d requests, want none offline", requests)
+	}
+}
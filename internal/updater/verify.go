@@ -0,0 +1,127 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checksumFor finds the SHA-256 of the named file in a goreleaser
+// checksums.txt, lines of "<hex sha256>  <file name>"
+func checksumFor(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			if _, err := hex.DecodeString(fields[0]); err != nil || len(fields[0]) != sha256.Size*2 {
+				return "", fmt.Errorf("invalid checksum for %s: %q", name, fields[0])
+			}
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+// verifyChecksum checks data against the checksum of the named file
+func verifyChecksum(checksums, data []byte, name string) error {
+	want, err := checksumFor(checksums, name)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	return nil
+}
+
+// minisign algorithms: Ed signs the file itself, ED (the default since
+// minisign 0.9) a BLAKE2b hash of it
+const (
+	minisignLegacy    = "Ed"
+	minisignPrehashed = "ED"
+)
+
+// minisignKey is a minisign public key
+type minisignKey struct {
+	id  [8]byte
+	key ed25519.PublicKey
+}
+
+// parseMinisignKey reads a minisign public key: the base64 key itself (as
+// given to minisign -P) or the path of a .pub file holding it
+func parseMinisignKey(s string) (*minisignKey, error) {
+	s = strings.TrimSpace(s)
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		data, readErr := os.ReadFile(s)
+		if readErr != nil {
+			return nil, fmt.Errorf("public key is neither a minisign key nor a readable file: %v", readErr)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if raw, err = base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1])); err != nil {
+			return nil, fmt.Errorf("%s: not a minisign public key", s)
+		}
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != minisignLegacy {
+		return nil, fmt.Errorf("not a minisign public key")
+	}
+	k := &minisignKey{key: ed25519.PublicKey(raw[10:])}
+	copy(k.id[:], raw[2:10])
+	return k, nil
+}
+
+// verifyMinisign checks a minisign signature of data: the signature of the
+// data (or of its BLAKE2b-512 hash, for prehashed signatures), and the
+// global signature covering it and the trusted comment
+func verifyMinisign(k *minisignKey, data, signature []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) != 4 {
+		return fmt.Errorf("malformed signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("malformed signature")
+	}
+	signed := data
+	switch string(sig[:2]) {
+	case minisignLegacy:
+	case minisignPrehashed:
+		sum := blake2b512(data)
+		signed = sum[:]
+	default:
+		return fmt.Errorf("unknown signature algorithm %q", sig[:2])
+	}
+	if !bytes.Equal(sig[2:10], k.id[:]) {
+		return fmt.Errorf("signed with key %X, want %X", reverse(sig[2:10]), reverse(k.id[:]))
+	}
+	if !ed25519.Verify(k.key, signed, sig[10:]) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	comment, ok := strings.CutPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("malformed signature: no trusted comment")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(k.key, append(append([]byte{}, sig[10:]...), comment...), global) {
+		return fmt.Errorf("invalid signature of the trusted comment")
+	}
+	return nil
+}
+
+// reverse returns b backwards: minisign shows key IDs as little-endian
+// numbers
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
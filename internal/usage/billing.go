@@ -0,0 +1,123 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// costReportPath is the Admin API's organization cost report
+const costReportPath = "/v1/organizations/cost_report"
+
+// adminKey returns the Admin API key for reading the organization's spend
+func adminKey() string {
+	return os.Getenv("ANTHROPIC_ADMIN_KEY")
+}
+
+// apiBillingUsage is the usage for API key billing: the organization's
+// spend this month when an Admin API key is set, else just the marker that
+// there are no plan limits
+func apiBillingUsage(now time.Time) *types.UsageCache {
+	key := adminKey()
+	if key == "" {
+		return withSource(&types.UsageCache{}, "API key billing (set ANTHROPIC_ADMIN_KEY for the organization's spend)")
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	cacheFile := getCacheFile("api_spend.json")
+	if cache, valid := loadCache(cacheFile, config.Get().CacheTTL); valid && cache.MonthStart.Equal(monthStart) {
+		return withSource(cache, "cache")
+	}
+
+	if config.Get().Offline {
+		if cache, err := loadCacheIgnoreExpiry(cacheFile); err == nil && cache.MonthStart.Equal(monthStart) {
+			cache.Stale = true
+			return withSource(cache, "stale cache (offline)")
+		}
+		return withSource(&types.UsageCache{}, "API key billing (offline)")
+	}
+
+	spend, err := fetchMonthSpend(key, monthStart)
+	if err != nil {
+		config.WarnLog("Cost report error: %v", err)
+		if cache, err := loadCacheIgnoreExpiry(cacheFile); err == nil && cache.MonthStart.Equal(monthStart) {
+			cache.Stale = true
+			return withSource(cache, fmt.Sprintf("stale cache (Admin API error: %v)", err))
+		}
+		return withSource(&types.UsageCache{}, fmt.Sprintf("API key billing (Admin API error: %v)", err))
+	}
+
+	cache := &types.UsageCache{MonthSpend: spend, MonthStart: monthStart, FetchedAt: now}
+	saveCache(cacheFile, cache)
+	config.InfoLog("Fetched organization spend: $%.2f", spend)
+	return withSource(cache, "Admin API cost report")
+}
+
+// costReport is a page of the Admin API's cost report
+type costReport struct {
+	Data []struct {
+		Results []struct {
+			Amount   string `json:"amount"` // decimal string in cents
+			Currency string `json:"currency"`
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+// fetchMonthSpend sums the organization's costs since monthStart, in
+// dollars
+func fetchMonthSpend(key string, monthStart time.Time) (float64, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	query := url.Values{
+		"starting_at":  {monthStart.Format(time.RFC3339)},
+		"bucket_width": {"1d"},
+		"limit":        {"31"},
+	}
+
+	var cents float64
+	for {
+		req, err := http.NewRequest("GET", apiBase()+costReportPath+"?"+query.Encode(), nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("x-api-key", key)
+		req.Header.Set("anthropic-version", "2023-06-01")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		var report costReport
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return 0, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&report)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		for _, bucket := range report.Data {
+			for _, result := range bucket.Results {
+				if amount, err := strconv.ParseFloat(result.Amount, 64); err == nil {
+					cents += amount
+				}
+			}
+		}
+		if !report.HasMore || report.NextPage == "" {
+			return cents / 100, nil
+		}
+		query.Set("page", report.NextPage)
+	}
+}
@@ -0,0 +1,135 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// How long a subscription type discovered via the claude CLI is reused
+const discoveryTTL = 24 * time.Hour
+
+// discoveredAuth is the cached result of asking the claude CLI
+type discoveredAuth struct {
+	LoggedIn         bool      `json:"logged_in"`
+	SubscriptionType string    `json:"subscription_type,omitempty"`
+	CheckedAt        time.Time `json:"checked_at"`
+}
+
+// discoverCredentials is the last-resort credentials source enabled with
+// --claude-discovery. It looks where the claude CLI itself keeps its state:
+// the credentials file in its config directory (CLAUDE_CONFIG_DIR aware),
+// then the CLI's own auth status for the subscription type.
+func discoverCredentials() *types.Credentials {
+	for _, file := range claudeCredentialFiles() {
+		if creds := readCredentialsFile(file); creds != nil {
+			return creds
+		}
+	}
+
+	auth := cliAuthStatus()
+	if auth == nil || !auth.LoggedIn {
+		return nil
+	}
+	// No token, but the subscription type is still worth showing
+	config.InfoLog("Discovered subscription via claude CLI: %q", auth.SubscriptionType)
+	return &types.Credentials{ClaudeAiOauth: &types.OAuthCredentials{SubscriptionType: auth.SubscriptionType}}
+}
+
+// claudeCredentialFiles lists the files the claude CLI may store OAuth
+// credentials in
+func claudeCredentialFiles() []string {
+	dirs := []string{config.ClaudeDir()}
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" && dir != dirs[0] {
+		dirs = append(dirs, dir)
+	}
+	if home := filepath.Join(config.HomeDir(), ".claude"); home != dirs[0] {
+		dirs = append(dirs, home)
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		files = append(files, filepath.Join(dir, ".credentials.json"), filepath.Join(dir, "credentials.json"))
+	}
+	return files
+}
+
+// readCredentialsFile parses a credentials file, returning nil if it is
+// missing, unparseable or has no OAuth section
+func readCredentialsFile(file string) *types.Credentials {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var creds types.Credentials
+	if err := json.Unmarshal(data, &creds); err != nil || creds.ClaudeAiOauth == nil {
+		config.WarnLog("Failed to parse credentials file %s: %v", file, err)
+		return nil
+	}
+	config.DebugLog("Loaded credentials from file: %s", file)
+	return &creds
+}
+
+// cliAuthStatus asks the claude binary for its auth state. The answer is
+// cached for a day since starting the CLI is far slower than a render.
+func cliAuthStatus() *discoveredAuth {
+	cacheFile := getCacheFile("claude-auth.json")
+	if data, err := os.ReadFile(cacheFile); err == nil {
+		var cached discoveredAuth
+		if json.Unmarshal(data, &cached) == nil && time.Since(cached.CheckedAt) < discoveryTTL {
+			return &cached
+		}
+	}
+
+	path, err := exec.LookPath("claude")
+	if err != nil {
+		config.DebugLog("claude CLI not found: %v", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "auth", "status", "--json").Output()
+	if err != nil {
+		config.WarnLog("claude auth status failed: %v", err)
+		return nil
+	}
+
+	auth := parseAuthStatus(out)
+	if auth == nil {
+		config.DebugLog("Unrecognized claude auth status output")
+		return nil
+	}
+	auth.CheckedAt = time.Now()
+	if data, err := json.Marshal(auth); err == nil {
+		config.WriteFile(cacheFile, data)
+	}
+	return auth
+}
+
+// parseAuthStatus extracts the login state and subscription type from the
+// CLI's JSON status output, accepting camelCase and snake_case keys
+func parseAuthStatus(out []byte) *discoveredAuth {
+	var status map[string]any
+	if err := json.Unmarshal(out, &status); err != nil {
+		return nil
+	}
+
+	auth := &discoveredAuth{}
+	for key, value := range status {
+		switch strings.ToLower(strings.ReplaceAll(key, "_", "")) {
+		case "loggedin":
+			auth.LoggedIn, _ = value.(bool)
+		case "subscriptiontype", "subscription":
+			auth.SubscriptionType, _ = value.(string)
+		}
+	}
+	return auth
+}
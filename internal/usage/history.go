@@ -0,0 +1,108 @@
+package usage
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+const (
+	// maxResetHistory bounds the number of observations kept per window
+	maxResetHistory = 50
+	// resetTimeTolerance absorbs jitter in reported reset times; distinct
+	// windows are always further apart than this
+	resetTimeTolerance = 30 * time.Minute
+)
+
+// GetResetHistory returns the observed reset times for each usage window
+func GetResetHistory() *types.ResetHistory {
+	h := &types.ResetHistory{}
+	data, err := os.ReadFile(getCacheFile("reset_history.json"))
+	if err != nil {
+		return h
+	}
+	json.Unmarshal(data, h)
+	return h
+}
+
+func saveResetHistory(h *types.ResetHistory) {
+	data, _ := json.Marshal(h)
+	config.WriteFile(getCacheFile("reset_history.json"), data)
+}
+
+// recordResetTimes adds freshly fetched reset times to the history and fills
+// in the window start times on cache
+func recordResetTimes(cache *types.UsageCache, now time.Time) {
+	h := GetResetHistory()
+	cutoff := config.Get().RetentionCutoff(now)
+	h.FiveHour = pruneObservations(h.FiveHour, cutoff)
+	h.SevenDay = pruneObservations(h.SevenDay, cutoff)
+	if !cache.ResetTime.IsZero() {
+		h.FiveHour, cache.WindowStart = observeReset(h.FiveHour, cache.ResetTime, 5*time.Hour, now)
+	}
+	if !cache.SevenDayResetTime.IsZero() {
+		h.SevenDay, cache.SevenDayWindowStart = observeReset(h.SevenDay, cache.SevenDayResetTime, 7*24*time.Hour, now)
+	}
+	saveResetHistory(h)
+}
+
+// observeReset records resetTime in the observation list and returns the
+// updated list plus the start of the window it belongs to. The start is only
+// known when we watched the previous window end: then it's when the new reset
+// time first appeared, bounded by the nominal window length.
+func observeReset(list []types.ResetObservation, resetTime time.Time, window time.Duration, now time.Time) ([]types.ResetObservation, time.Time) {
+	if n := len(list); n > 0 && absDuration(list[n-1].ResetTime.Sub(resetTime)) <= resetTimeTolerance {
+		list[n-1].LastSeen = now
+	} else {
+		list = append(list, types.ResetObservation{ResetTime: resetTime, FirstSeen: now, LastSeen: now})
+		if len(list) > maxResetHistory {
+			list = list[len(list)-maxResetHistory:]
+		}
+	}
+
+	n := len(list)
+	if n < 2 {
+		return list, time.Time{}
+	}
+
+	start := list[n-1].FirstSeen
+	if nominal := resetTime.Add(-window); start.Before(nominal) {
+		start = nominal
+	}
+	return list, start
+}
+
+// PurgeHistory removes usage window observations last seen before the given
+// time and returns how many were removed
+func PurgeHistory(before time.Time) int {
+	h := GetResetHistory()
+	n := len(h.FiveHour) + len(h.SevenDay)
+	h.FiveHour = pruneObservations(h.FiveHour, before)
+	h.SevenDay = pruneObservations(h.SevenDay, before)
+	removed := n - len(h.FiveHour) - len(h.SevenDay)
+	if removed > 0 {
+		saveResetHistory(h)
+	}
+	return removed
+}
+
+// pruneObservations drops observations last seen before cutoff
+func pruneObservations(list []types.ResetObservation, cutoff time.Time) []types.ResetObservation {
+	kept := list[:0]
+	for _, o := range list {
+		if !o.LastSeen.Before(cutoff) {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
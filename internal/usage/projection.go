@@ -0,0 +1,68 @@
+package usage
+
+import (
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+// Project compares usagePercent against a linear schedule running from
+// windowStart to resetTime. Returns nil when no projection applies: at or
+// above 100%, before the window started or after it reset.
+func Project(usagePercent float64, windowStart, resetTime, now time.Time) *types.Projection {
+	if usagePercent >= 100 || !now.Before(resetTime) {
+		return nil
+	}
+
+	totalWindow := resetTime.Sub(windowStart)
+	elapsed := now.Sub(windowStart)
+	if elapsed <= 0 || totalWindow <= 0 {
+		return nil
+	}
+
+	// Expected usage at this point: elapsed / total * 100
+	expectedPercent := (float64(elapsed) / float64(totalWindow)) * 100
+
+	p := &types.Projection{
+		ExpectedPercent: expectedPercent,
+		Deviation:       usagePercent/expectedPercent - 1,
+	}
+
+	switch {
+	case usagePercent > expectedPercent*1.25:
+		p.Status = types.ProjectionWayOver
+	case usagePercent > expectedPercent*1.05:
+		p.Status = types.ProjectionOver
+	case usagePercent < expectedPercent*0.75:
+		p.Status = types.ProjectionWayUnder
+	case usagePercent < expectedPercent*0.95:
+		p.Status = types.ProjectionUnder
+	default:
+		p.Status = types.ProjectionOnTrack
+	}
+	return p
+}
+
+// WindowStart returns the observed window start, or the nominal start
+// (reset time minus window length) when it isn't known
+func WindowStart(observed, resetTime time.Time, window time.Duration) time.Time {
+	if observed.IsZero() || !observed.Before(resetTime) {
+		return resetTime.Add(-window)
+	}
+	return observed
+}
+
+// AnnotateProjections fills in the projection of each usage window
+func AnnotateProjections(cache *types.UsageCache, now time.Time) {
+	if cache == nil || cache.Unavailable {
+		return
+	}
+	if !cache.ResetTime.IsZero() {
+		start := WindowStart(cache.WindowStart, cache.ResetTime, 5*time.Hour)
+		cache.Projection = Project(cache.UsagePercent, start, cache.ResetTime, now)
+	}
+	if !cache.SevenDayResetTime.IsZero() {
+		start := WindowStart(cache.SevenDayWindowStart, cache.SevenDayResetTime, 7*24*time.Hour)
+		cache.SevenDayProjection = Project(cache.SevenDayPercent, start, cache.SevenDayResetTime, now)
+	}
+}
@@ -0,0 +1,206 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	defaultTokenURL = "https://console.anthropic.com/v1/oauth/token"
+
+	// oauthClientID is the claude CLI's OAuth client; its tokens can only
+	// be refreshed as that client
+	oauthClientID = "9d1c250a-e61b-44d9-88ed-5944d1962f5e"
+
+	// refreshMargin refreshes tokens a little before they expire, so the
+	// usage request doesn't race the expiry
+	refreshMargin = time.Minute
+)
+
+// credentialStore is where credentials were loaded from: a file, the
+// keyring, or neither when they were discovered through the claude CLI
+type credentialStore struct {
+	file           string
+	keyringService string
+	keyringUser    string
+}
+
+// load reads the credentials again, e.g. after another session may have
+// refreshed them
+func (s credentialStore) load() *types.Credentials {
+	switch {
+	case s.file != "":
+		return readCredentialsFile(s.file)
+	case s.keyringUser != "":
+		secret, err := keyring.Get(s.keyringService, s.keyringUser)
+		if err != nil {
+			return nil
+		}
+		var creds types.Credentials
+		if json.Unmarshal([]byte(secret), &creds) != nil || creds.ClaudeAiOauth == nil {
+			return nil
+		}
+		return &creds
+	}
+	return nil
+}
+
+// save writes refreshed tokens back, keeping everything else the claude
+// CLI stores alongside them
+func (s credentialStore) save(oauth *types.OAuthCredentials) error {
+	var raw []byte
+	switch {
+	case s.file != "":
+		raw, _ = os.ReadFile(s.file)
+	case s.keyringUser != "":
+		secret, _ := keyring.Get(s.keyringService, s.keyringUser)
+		raw = []byte(secret)
+	default:
+		return nil
+	}
+
+	merged, err := mergeTokens(raw, oauth)
+	if err != nil {
+		return err
+	}
+	if s.file != "" {
+		// Replaced by renaming, so Claude Code never reads it half-written
+		return config.WriteFile(s.file, merged)
+	}
+	return keyring.Set(s.keyringService, s.keyringUser, string(merged))
+}
+
+// mergeTokens sets the tokens and expiry in a stored credentials document
+func mergeTokens(raw []byte, oauth *types.OAuthCredentials) ([]byte, error) {
+	doc := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+	}
+	fields := make(map[string]any)
+	if section, ok := doc["claudeAiOauth"]; ok {
+		dec := json.NewDecoder(bytes.NewReader(section))
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil {
+			return nil, err
+		}
+	}
+	fields["accessToken"] = oauth.AccessToken
+	fields["refreshToken"] = oauth.RefreshToken
+	fields["expiresAt"] = oauth.ExpiresAt
+	if oauth.ExpiresAt == "" {
+		delete(fields, "expiresAt")
+	}
+
+	section, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	doc["claudeAiOauth"] = section
+	return json.Marshal(doc)
+}
+
+// tokenExpired reports whether the access token expires within
+// refreshMargin. Tokens without an expiry are assumed valid.
+func tokenExpired(oauth *types.OAuthCredentials, now time.Time) bool {
+	ms, err := oauth.ExpiresAt.Int64()
+	if err != nil || ms <= 0 {
+		return false
+	}
+	return now.Add(refreshMargin).After(time.UnixMilli(ms))
+}
+
+// tokenURL returns the OAuth token endpoint, on the --api-base gateway
+// when one is set
+func tokenURL() string {
+	if config.Get().APIBase != "" {
+		return apiBase() + "/v1/oauth/token"
+	}
+	return defaultTokenURL
+}
+
+// tokenResponse is the OAuth server's answer to a refresh
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds
+}
+
+// reloadCredentials reads the stored credentials again for an expired
+// token, since Claude Code refreshes it on its own, and returns them if
+// they've been refreshed. Otherwise creds are returned as they are.
+func reloadCredentials(creds *types.Credentials, store credentialStore) *types.Credentials {
+	if stored := store.load(); stored != nil && stored.ClaudeAiOauth != nil && !tokenExpired(stored.ClaudeAiOauth, time.Now()) {
+		config.DebugLog("Token refreshed by Claude Code")
+		return stored
+	}
+	config.DebugLog("Token expired, waiting for Claude Code to refresh it (or use --refresh-token)")
+	return creds
+}
+
+// refreshCredentials exchanges the refresh token for a new access token
+// and saves both. The stored credentials are read again first, in case
+// another session or the claude CLI already refreshed them.
+func refreshCredentials(creds *types.Credentials, store credentialStore) (*types.Credentials, error) {
+	if stored := store.load(); stored != nil {
+		creds = stored
+	}
+	oauth := *creds.ClaudeAiOauth
+	if !tokenExpired(&oauth, time.Now()) {
+		config.DebugLog("Token already refreshed elsewhere")
+		return creds, nil
+	}
+	if oauth.RefreshToken == "" {
+		return nil, fmt.Errorf("token expired and no refresh token available")
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": oauth.RefreshToken,
+		"client_id":     oauthClientID,
+	})
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(tokenURL(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("token refresh error %d: %s", resp.StatusCode, string(msg))
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token refresh returned no access token")
+	}
+	oauth.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		oauth.RefreshToken = token.RefreshToken
+	}
+	oauth.ExpiresAt = ""
+	if token.ExpiresIn > 0 {
+		expires := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		oauth.ExpiresAt = json.Number(fmt.Sprint(expires.UnixMilli()))
+	}
+
+	if err := store.save(&oauth); err != nil {
+		// The new token still works for this fetch
+		config.WarnLog("Failed to save refreshed credentials: %v", err)
+	}
+	config.InfoLog("Refreshed access token")
+	return &types.Credentials{ClaudeAiOauth: &oauth}, nil
+}
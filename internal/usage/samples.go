@@ -0,0 +1,117 @@
+package usage
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/types"
+)
+
+const (
+	// sampleRetention is how long usage samples are kept: a full 7-day
+	// window
+	sampleRetention = 7 * 24 * time.Hour
+	// burnRateWindow is how far back the burn rate looks
+	burnRateWindow = time.Hour
+	// minBurnRateSpan is the shortest stretch of samples a burn rate is
+	// computed from; shorter ones are too noisy
+	minBurnRateSpan = 10 * time.Minute
+)
+
+// GetUsageSamples returns the fetched usage samples, oldest first
+func GetUsageSamples() []types.UsageSample {
+	var samples []types.UsageSample
+	data, err := os.ReadFile(getCacheFile("usage_samples.json"))
+	if err != nil {
+		return nil
+	}
+	json.Unmarshal(data, &samples)
+	return samples
+}
+
+// recordSample adds a fetched reading to the samples and fills in the burn
+// rate on cache
+func recordSample(cache *types.UsageCache, now time.Time) {
+	cutoff := now.Add(-sampleRetention)
+	if retention := config.Get().RetentionCutoff(now); retention.After(cutoff) {
+		cutoff = retention
+	}
+
+	samples := GetUsageSamples()
+	kept := samples[:0]
+	for _, s := range samples {
+		if s.Time.After(cutoff) && s.Time.Before(now) {
+			kept = append(kept, s)
+		}
+	}
+	samples = append(kept, types.UsageSample{
+		Time:          now,
+		FiveHour:      cache.UsagePercent,
+		SevenDay:      cache.SevenDayPercent,
+		FiveHourReset: cache.ResetTime,
+	})
+	cache.BurnRate = BurnRate(samples, now)
+
+	data, _ := json.Marshal(samples)
+	config.WriteFile(getCacheFile("usage_samples.json"), data)
+}
+
+// PurgeSamples removes usage samples taken before the given time and returns
+// how many were removed
+func PurgeSamples(before time.Time) int {
+	samples := GetUsageSamples()
+	kept := samples[:0]
+	for _, s := range samples {
+		if !s.Time.Before(before) {
+			kept = append(kept, s)
+		}
+	}
+	removed := len(samples) - len(kept)
+	if removed > 0 {
+		data, _ := json.Marshal(kept)
+		config.WriteFile(getCacheFile("usage_samples.json"), data)
+	}
+	return removed
+}
+
+// BurnRate returns how fast 5h usage grew over the last burnRateWindow,
+// in percentage points per hour, from samples ending with the current one.
+// Only samples from the current window count; it's zero until they span
+// minBurnRateSpan.
+func BurnRate(samples []types.UsageSample, now time.Time) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	last := samples[len(samples)-1]
+	first := last
+	for i := len(samples) - 2; i >= 0; i-- {
+		s := samples[i]
+		if s.Time.Before(now.Add(-burnRateWindow)) || absDuration(s.FiveHourReset.Sub(last.FiveHourReset)) > resetTimeTolerance {
+			break
+		}
+		first = s
+	}
+
+	span := last.Time.Sub(first.Time)
+	if span < minBurnRateSpan || last.FiveHour < first.FiveHour {
+		return 0
+	}
+	return (last.FiveHour - first.FiveHour) / span.Hours()
+}
+
+// LimitAt estimates when the 5h window reaches 100% at the burn rate
+// measured at the last fetch. It's zero without a burn rate, or when the
+// window resets first.
+func LimitAt(cache *types.UsageCache) time.Time {
+	if cache.BurnRate <= 0 || cache.UsagePercent >= 100 || cache.FetchedAt.IsZero() {
+		return time.Time{}
+	}
+	hours := (100 - cache.UsagePercent) / cache.BurnRate
+	at := cache.FetchedAt.Add(time.Duration(hours * float64(time.Hour)))
+	if !cache.ResetTime.IsZero() && !at.Before(cache.ResetTime) {
+		return time.Time{}
+	}
+	return at
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/erwint/claude-code-statusline/internal/config"
@@ -17,6 +18,17 @@ import (
 	"github.com/zalando/go-keyring"
 )
 
+// defaultAPIBase is the root of Anthropic's API
+const defaultAPIBase = "https://api.anthropic.com"
+
+// cacheVersion is the usage cache format, bumped when it changes with a
+// migration in cacheMigrations if older caches need upgrading. Caches from
+// before versioning are version 0.
+const cacheVersion = 1
+
+// cacheMigrations upgrade older usage caches, see config.Migrations
+var cacheMigrations = config.Migrations{}
+
 // GetUsageAndSubscription retrieves usage data and subscription info
 // Returns: usage data, subscription type, tier, and whether on API billing
 func GetUsageAndSubscription() (*types.UsageCache, string, string, bool) {
@@ -31,12 +43,20 @@ func GetUsageAndSubscription() (*types.UsageCache, string, string, bool) {
 	}
 
 	// Get subscription from credentials
-	creds := getCredentials()
+	creds, store := loadCredentials()
 	if creds != nil && creds.ClaudeAiOauth != nil {
 		subscription = creds.ClaudeAiOauth.SubscriptionType
 		tier = creds.ClaudeAiOauth.RateLimitTier
 	}
 
+	// Without an OAuth login there are no plan limits to fetch; an Admin
+	// API key also implies API billing
+	if creds == nil || creds.ClaudeAiOauth == nil || creds.ClaudeAiOauth.AccessToken == "" {
+		if isApiBilling || adminKey() != "" {
+			return apiBillingUsage(time.Now()), subscription, tier, true
+		}
+	}
+
 	cfg := config.Get()
 
 	// Check cache
@@ -46,19 +66,25 @@ func GetUsageAndSubscription() (*types.UsageCache, string, string, bool) {
 			config.DebugLog("Cache reset time has passed, forcing refresh")
 		} else {
 			config.DebugLog("Using cached usage: %.1f%%", cache.UsagePercent)
-			return cache, subscription, tier, isApiBilling
+			return withSource(cache, "cache"), subscription, tier, isApiBilling
 		}
 	}
 
+	// Offline and CI mode make no requests
+	if cfg.Offline {
+		return withSource(staleCache(cacheFile), "stale cache (offline)"), subscription, tier, isApiBilling
+	}
+
 	// Check backoff before hitting the API
 	if b := loadBackoff(); b != nil && time.Now().Before(b.BackoffUntil) {
 		config.DebugLog("In backoff until %s (%.0fs interval)", b.BackoffUntil.Format("15:04:05"), b.BackoffSeconds)
-		return staleCache(cacheFile), subscription, tier, isApiBilling
+		source := fmt.Sprintf("stale cache (rate-limit backoff until %s)", b.BackoffUntil.Format("15:04:05"))
+		return withSource(staleCache(cacheFile), source), subscription, tier, isApiBilling
 	}
 
 	// Acquire fetch lock so multiple sessions don't race
 	lockFile := getCacheFile("usage.lock")
-	lock, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	lock, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, config.PrivateFileMode)
 	if err != nil {
 		// Another session is fetching — check if the lock is stale (>30s)
 		if info, statErr := os.Stat(lockFile); statErr == nil && time.Since(info.ModTime()) > 30*time.Second {
@@ -69,9 +95,9 @@ func GetUsageAndSubscription() (*types.UsageCache, string, string, bool) {
 		}
 		// Re-check cache (the other session may have just written it)
 		if cache, valid := loadCache(cacheFile, cfg.CacheTTL); valid {
-			return cache, subscription, tier, isApiBilling
+			return withSource(cache, "cache (refreshed by another session)"), subscription, tier, isApiBilling
 		}
-		return staleCache(cacheFile), subscription, tier, isApiBilling
+		return withSource(staleCache(cacheFile), "stale cache (another session is fetching)"), subscription, tier, isApiBilling
 	}
 	lock.Close()
 	defer os.Remove(lockFile)
@@ -80,66 +106,134 @@ func GetUsageAndSubscription() (*types.UsageCache, string, string, bool) {
 	if cache, valid := loadCache(cacheFile, cfg.CacheTTL); valid {
 		if cache.ResetTime.IsZero() || !time.Now().After(cache.ResetTime) {
 			config.DebugLog("Cache refreshed by another session: %.1f%%", cache.UsagePercent)
-			return cache, subscription, tier, isApiBilling
+			return withSource(cache, "cache (refreshed by another session)"), subscription, tier, isApiBilling
+		}
+	}
+
+	// An expired token is refreshed by Claude Code, so read it again. Only
+	// with --refresh-token is it refreshed here: refresh tokens are single
+	// use, and Claude Code's own copy stops working once it's rotated.
+	if creds != nil && creds.ClaudeAiOauth != nil && tokenExpired(creds.ClaudeAiOauth, time.Now()) {
+		if !cfg.RefreshToken {
+			creds = reloadCredentials(creds, store)
+		} else if refreshed, err := refreshCredentials(creds, store); err != nil {
+			config.WarnLog("Token refresh failed: %v", err)
+		} else {
+			creds = refreshed
 		}
 	}
 
 	// Fetch from API
 	usage, fetchErr := fetchUsage(creds)
 	if fetchErr != nil {
-		config.DebugLog("API error: %v", fetchErr)
-		return staleCache(cacheFile), subscription, tier, isApiBilling
+		config.WarnLog("API error: %v", fetchErr)
+		return withSource(staleCache(cacheFile), fmt.Sprintf("stale cache (API error: %v)", fetchErr)), subscription, tier, isApiBilling
 	}
 
-	// Success: decay backoff and save cache
+	// Success: decay backoff, note window changes and save cache
 	decayBackoff()
+	recordResetTimes(usage, time.Now())
+	recordSample(usage, time.Now())
 	saveCache(cacheFile, usage)
-	config.DebugLog("Fetched usage: %.1f%%", usage.UsagePercent)
-	return usage, subscription, tier, isApiBilling
+	config.InfoLog("Fetched usage: %.1f%%", usage.UsagePercent)
+	return withSource(usage, "api"), subscription, tier, isApiBilling
+}
+
+// withSource records where the usage data came from, for --explain
+func withSource(cache *types.UsageCache, source string) *types.UsageCache {
+	if cache != nil {
+		cache.Source = source
+	}
+	return cache
+}
+
+// Cached returns the last fetched usage without contacting the API, marked
+// stale once past the cache TTL. Used when a render can't wait for a fetch;
+// returns nil if nothing was ever fetched.
+func Cached() *types.UsageCache {
+	cacheFile := getCacheFile("usage.json")
+	cache, valid := loadCache(cacheFile, config.Get().CacheTTL)
+	if cache == nil {
+		return nil
+	}
+	if valid && (cache.ResetTime.IsZero() || time.Now().Before(cache.ResetTime)) {
+		return withSource(cache, "cache")
+	}
+	return withSource(staleCache(cacheFile), "stale cache")
 }
 
-func getCredentials() *types.Credentials {
+// loadCredentials finds the OAuth credentials and where they are stored,
+// so refreshed tokens can be written back
+func loadCredentials() (*types.Credentials, credentialStore) {
 	// First, try reading from credentials file (preferred)
-	credFile := filepath.Join(os.Getenv("HOME"), ".claude", "credentials.json")
-	if data, err := os.ReadFile(credFile); err == nil {
-		var creds types.Credentials
-		if err := json.Unmarshal(data, &creds); err == nil {
-			config.DebugLog("Loaded credentials from file: %s", credFile)
-			return &creds
+	credFile := filepath.Join(config.ClaudeDir(), "credentials.json")
+	if creds := readCredentialsFile(credFile); creds != nil {
+		return creds, credentialStore{file: credFile}
+	}
+	// The claude CLI on Windows keeps them in a dotfile rather than the
+	// Credential Manager
+	if runtime.GOOS == "windows" {
+		credFile := filepath.Join(config.ClaudeDir(), ".credentials.json")
+		if creds := readCredentialsFile(credFile); creds != nil {
+			return creds, credentialStore{file: credFile}
 		}
-		config.DebugLog("Failed to parse credentials file: %v", err)
 	}
 
 	// Fall back to system keyring (macOS moves credentials there automatically)
 	if runtime.GOOS == "darwin" || runtime.GOOS == "linux" || runtime.GOOS == "windows" {
-		username := os.Getenv("USER")
-		if username == "" {
-			if u, err := user.Current(); err == nil {
-				username = u.Username
-			}
-		}
-
-		secret, err := keyring.Get("Claude Code-credentials", username)
+		username, service := keyringUser(), keyringServiceName()
+		secret, err := keyring.Get(service, username)
 		if err == nil && secret != "" {
 			var creds types.Credentials
 			if err := json.Unmarshal([]byte(secret), &creds); err == nil {
 				config.DebugLog("Loaded credentials from system keyring")
-				return &creds
+				return &creds, credentialStore{keyringService: service, keyringUser: username}
 			}
-			config.DebugLog("Failed to parse keyring credentials: %v", err)
+			config.WarnLog("Failed to parse keyring credentials: %v", err)
 		} else if err != nil {
-			config.DebugLog("Keyring access failed: %v", err)
+			config.WarnLog("Keyring access failed: %v", err)
+		}
+	}
+
+	// Last resort: ask the claude CLI itself
+	if config.Get().ClaudeDiscovery {
+		if creds := discoverCredentials(); creds != nil {
+			return creds, credentialStore{}
 		}
 	}
 
 	config.DebugLog("No credentials found")
-	return nil
+	return nil, credentialStore{}
+}
+
+// keyringService is the keyring entry the claude CLI stores credentials in
+const keyringService = "Claude Code-credentials"
+
+// keyringServiceName returns the keyring entry to read: the active
+// profile's, else the claude CLI's
+func keyringServiceName() string {
+	if service := config.Get().KeyringService; service != "" {
+		return service
+	}
+	return keyringService
+}
+
+// keyringUser returns the account the claude CLI's keyring entry is under
+func keyringUser() string {
+	username := os.Getenv("USER")
+	if username == "" {
+		username = os.Getenv("USERNAME") // Windows
+	}
+	if username == "" {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+	return username
 }
 
 func getCacheFile(name string) string {
-	cacheDir := filepath.Join(os.Getenv("HOME"), ".cache", "claude-code-statusline")
-	os.MkdirAll(cacheDir, 0755)
-	return filepath.Join(cacheDir, name)
+	return filepath.Join(config.CacheDir(), name)
 }
 
 func loadCache(file string, cacheTTL int) (*types.UsageCache, bool) {
@@ -148,13 +242,8 @@ func loadCache(file string, cacheTTL int) (*types.UsageCache, bool) {
 		return nil, false
 	}
 
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return nil, false
-	}
-
 	var cache types.UsageCache
-	if err := json.Unmarshal(data, &cache); err != nil {
+	if err := config.ReadVersionedCache(file, &cache, cacheVersion, cacheMigrations); err != nil {
 		return nil, false
 	}
 
@@ -190,22 +279,16 @@ func staleCache(cacheFile string) *types.UsageCache {
 }
 
 func loadCacheIgnoreExpiry(file string) (*types.UsageCache, error) {
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return nil, err
-	}
-
 	var cache types.UsageCache
-	if err := json.Unmarshal(data, &cache); err != nil {
+	if err := config.ReadVersionedCache(file, &cache, cacheVersion, cacheMigrations); err != nil {
 		return nil, err
 	}
-
 	return &cache, nil
 }
 
 func saveCache(file string, cache *types.UsageCache) {
-	data, _ := json.Marshal(cache)
-	os.WriteFile(file, data, 0644)
+	cache.Version = cacheVersion
+	config.WriteCache(file, cache)
 }
 
 const (
@@ -233,7 +316,7 @@ func loadBackoff() *backoffState {
 
 func saveBackoff(b *backoffState) {
 	data, _ := json.Marshal(b)
-	os.WriteFile(getCacheFile("backoff.json"), data, 0644)
+	config.WriteFile(getCacheFile("backoff.json"), data)
 }
 
 func clearBackoff() {
@@ -287,12 +370,21 @@ func decayBackoff() {
 	})
 }
 
+// apiBase returns the API root to fetch usage from: --api-base, for
+// gateways and tests, or Anthropic's API
+func apiBase() string {
+	if base := strings.TrimRight(config.Get().APIBase, "/"); base != "" {
+		return base
+	}
+	return defaultAPIBase
+}
+
 func fetchUsage(creds *types.Credentials) (*types.UsageCache, error) {
 	if creds == nil || creds.ClaudeAiOauth == nil || creds.ClaudeAiOauth.AccessToken == "" {
 		return nil, fmt.Errorf("no access token available")
 	}
 
-	req, err := http.NewRequest("GET", "https://api.anthropic.com/api/oauth/usage", nil)
+	req, err := http.NewRequest("GET", apiBase()+"/api/oauth/usage", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -317,29 +409,50 @@ func fetchUsage(creds *types.Credentials) (*types.UsageCache, error) {
 		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
 	}
 
-	var usageResp types.UsageResponse
-	if err := json.NewDecoder(resp.Body).Decode(&usageResp); err != nil {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
 		return nil, err
 	}
-
-	// Extract both five_hour and seven_day windows
-	if usageResp.FiveHour == nil {
-		return nil, fmt.Errorf("no five_hour usage data")
+	windows, err := parseWindows(body)
+	if err != nil {
+		return nil, err
 	}
-
-	resetTime, _ := time.Parse(time.RFC3339, usageResp.FiveHour.ResetsAt)
-
-	cache := &types.UsageCache{
-		UsagePercent: usageResp.FiveHour.Utilization,
-		ResetTime:    resetTime,
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no usage windows in response")
 	}
 
-	// Add seven_day data if available
-	if usageResp.SevenDay != nil {
-		sevenDayResetTime, _ := time.Parse(time.RFC3339, usageResp.SevenDay.ResetsAt)
-		cache.SevenDayPercent = usageResp.SevenDay.Utilization
-		cache.SevenDayResetTime = sevenDayResetTime
-	}
+	cache := &types.UsageCache{Windows: windows, FetchedAt: time.Now()}
+	// A window the API leaves out (or sends as null) had no usage yet
+	cache.UsagePercent = windows["five_hour"].Percent
+	cache.ResetTime = windows["five_hour"].ResetTime
+	cache.SevenDayPercent = windows["seven_day"].Percent
+	cache.SevenDayResetTime = windows["seven_day"].ResetTime
+	// Opus has its own weekly cap on Max plans
+	cache.OpusPercent = windows["seven_day_opus"].Percent
+	cache.OpusResetTime = windows["seven_day_opus"].ResetTime
 
 	return cache, nil
 }
+
+// parseWindows returns every usage window in a usage response by its name
+// there, so windows the API adds later are kept too. Fields that aren't
+// windows (no utilization) are skipped.
+func parseWindows(body []byte) (map[string]types.WindowUsage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	windows := make(map[string]types.WindowUsage)
+	for name, raw := range fields {
+		var w struct {
+			Utilization *float64 `json:"utilization"`
+			ResetsAt    string   `json:"resets_at"`
+		}
+		if json.Unmarshal(raw, &w) != nil || w.Utilization == nil {
+			continue
+		}
+		reset, _ := time.Parse(time.RFC3339, w.ResetsAt)
+		windows[name] = types.WindowUsage{Percent: *w.Utilization, ResetTime: reset}
+	}
+	return windows, nil
+}
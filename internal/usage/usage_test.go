@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/erwint/claude-code-statusline/internal/config"
+	"github.com/erwint/claude-code-statusline/internal/fakeapi"
 	"github.com/erwint/claude-code-statusline/internal/types"
+	"github.com/zalando/go-keyring"
 )
 
 func setupTestCacheDir(t *testing.T) (string, func()) {
@@ -293,3 +299,682 @@ func TestLockFile_StaleCleanup(t *testing.T) {
 		t.Error("expected lock file to be removed")
 	}
 }
+
+func TestObserveReset_FirstObservationHasNoStart(t *testing.T) {
+	now := time.Now()
+	list, start := observeReset(nil, now.Add(3*time.Hour), 5*time.Hour, now)
+	if len(list) != 1 {
+		t.Fatalf("expected 1 observation, got %d", len(list))
+	}
+	if !start.IsZero() {
+		t.Errorf("expected unknown window start on first observation, got %v", start)
+	}
+}
+
+func TestObserveReset_DetectsNewWindow(t *testing.T) {
+	base := time.Date(2025, 11, 28, 9, 0, 0, 0, time.UTC)
+	oldReset := base.Add(1 * time.Hour) // 10:00
+	list, _ := observeReset(nil, oldReset, 5*time.Hour, base)
+
+	// Same window, slightly jittered reset time
+	list, _ = observeReset(list, oldReset.Add(time.Second), 5*time.Hour, base.Add(30*time.Minute))
+	if len(list) != 1 {
+		t.Fatalf("expected jittered reset to match existing window, got %d entries", len(list))
+	}
+	if !list[0].LastSeen.Equal(base.Add(30 * time.Minute)) {
+		t.Errorf("expected LastSeen to advance, got %v", list[0].LastSeen)
+	}
+
+	// Window started lazily at 12:40, two hours after the old one reset
+	firstSeen := base.Add(3*time.Hour + 40*time.Minute)
+	newReset := firstSeen.Add(5 * time.Hour)
+	list, start := observeReset(list, newReset, 5*time.Hour, firstSeen)
+	if len(list) != 2 {
+		t.Fatalf("expected new window to be recorded, got %d entries", len(list))
+	}
+	if !start.Equal(firstSeen) {
+		t.Errorf("expected window start %v, got %v", firstSeen, start)
+	}
+
+	// Later observations keep reporting the same start
+	_, start = observeReset(list, newReset, 5*time.Hour, firstSeen.Add(time.Hour))
+	if !start.Equal(firstSeen) {
+		t.Errorf("expected stable window start %v, got %v", firstSeen, start)
+	}
+}
+
+func TestObserveReset_StartBoundedByWindowLength(t *testing.T) {
+	base := time.Date(2025, 11, 28, 9, 0, 0, 0, time.UTC)
+	list, _ := observeReset(nil, base, 5*time.Hour, base.Add(-time.Hour))
+
+	// First seen long before the nominal start (clock skew / odd data)
+	newReset := base.Add(10 * time.Hour)
+	_, start := observeReset(list, newReset, 5*time.Hour, base.Add(time.Minute))
+	if !start.Equal(newReset.Add(-5 * time.Hour)) {
+		t.Errorf("expected start clamped to nominal window start, got %v", start)
+	}
+}
+
+func TestRecordResetTimes_Persists(t *testing.T) {
+	_, cleanup := setupTestCacheDir(t)
+	defer cleanup()
+
+	now := time.Now()
+	recordResetTimes(&types.UsageCache{ResetTime: now.Add(time.Hour), SevenDayResetTime: now.Add(48 * time.Hour)}, now)
+
+	h := GetResetHistory()
+	if len(h.FiveHour) != 1 || len(h.SevenDay) != 1 {
+		t.Fatalf("expected one observation per window, got %d/%d", len(h.FiveHour), len(h.SevenDay))
+	}
+
+	cache := &types.UsageCache{ResetTime: now.Add(6 * time.Hour)}
+	recordResetTimes(cache, now.Add(time.Hour))
+	if cache.WindowStart.IsZero() {
+		t.Error("expected window start after observing a reset")
+	}
+	if len(GetResetHistory().FiveHour) != 2 {
+		t.Error("expected new window to be persisted")
+	}
+}
+
+func TestResetHistoryRetentionAndPurge(t *testing.T) {
+	_, cleanup := setupTestCacheDir(t)
+	defer cleanup()
+	config.Get().RetentionDays = 10
+	defer func() { config.Get().RetentionDays = 0 }()
+
+	now := time.Now()
+	saveResetHistory(&types.ResetHistory{
+		FiveHour: []types.ResetObservation{
+			{ResetTime: now.AddDate(0, 0, -20), LastSeen: now.AddDate(0, 0, -20)},
+			{ResetTime: now.AddDate(0, 0, -5), LastSeen: now.AddDate(0, 0, -5)},
+			{ResetTime: now.AddDate(0, 0, -2), LastSeen: now.AddDate(0, 0, -2)},
+		},
+	})
+
+	// Recording drops observations older than the retention period
+	recordResetTimes(&types.UsageCache{ResetTime: now.Add(time.Hour)}, now)
+	if h := GetResetHistory(); len(h.FiveHour) != 3 {
+		t.Fatalf("expected the 20-day-old observation dropped, got %d observations", len(h.FiveHour))
+	}
+
+	if removed := PurgeHistory(now.AddDate(0, 0, -3)); removed != 1 {
+		t.Errorf("PurgeHistory removed %d, want 1", removed)
+	}
+	if h := GetResetHistory(); len(h.FiveHour) != 2 || h.FiveHour[0].LastSeen.Before(now.AddDate(0, 0, -3)) {
+		t.Errorf("unexpected history after purge: %+v", h.FiveHour)
+	}
+}
+
+func TestProject(t *testing.T) {
+	now := time.Date(2025, 11, 28, 12, 0, 0, 0, time.UTC)
+	start := now.Add(-2*time.Hour - 30*time.Minute)
+	reset := now.Add(2*time.Hour + 30*time.Minute) // 50% elapsed
+
+	tests := []struct {
+		usage  float64
+		status string
+	}{
+		{50, types.ProjectionOnTrack},
+		{58, types.ProjectionOver},
+		{70, types.ProjectionWayOver},
+		{42, types.ProjectionUnder},
+		{20, types.ProjectionWayUnder},
+	}
+
+	for _, tt := range tests {
+		p := Project(tt.usage, start, reset, now)
+		if p == nil {
+			t.Fatalf("expected projection for %.0f%%", tt.usage)
+		}
+		if p.Status != tt.status {
+			t.Errorf("usage %.0f%%: expected %s, got %s", tt.usage, tt.status, p.Status)
+		}
+		if p.ExpectedPercent != 50 {
+			t.Errorf("expected 50%% expected usage, got %.1f", p.ExpectedPercent)
+		}
+	}
+
+	if p := Project(70, start, reset, now); p.Deviation < 0.39 || p.Deviation > 0.41 {
+		t.Errorf("expected deviation 0.4, got %.3f", p.Deviation)
+	}
+	if Project(100, start, reset, now) != nil {
+		t.Error("expected no projection at 100%")
+	}
+	if Project(50, start, reset, reset.Add(time.Minute)) != nil {
+		t.Error("expected no projection after reset")
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	reset := time.Date(2025, 11, 28, 17, 0, 0, 0, time.UTC)
+	observed := reset.Add(-3 * time.Hour)
+
+	if got := WindowStart(observed, reset, 5*time.Hour); !got.Equal(observed) {
+		t.Errorf("expected observed start, got %v", got)
+	}
+	if got := WindowStart(time.Time{}, reset, 5*time.Hour); !got.Equal(reset.Add(-5 * time.Hour)) {
+		t.Errorf("expected nominal start for unknown observation, got %v", got)
+	}
+	if got := WindowStart(reset.Add(time.Hour), reset, 5*time.Hour); !got.Equal(reset.Add(-5 * time.Hour)) {
+		t.Errorf("expected nominal start for observation after reset, got %v", got)
+	}
+}
+
+func TestAnnotateProjections(t *testing.T) {
+	now := time.Now()
+	cache := &types.UsageCache{
+		UsagePercent:      80,
+		ResetTime:         now.Add(2*time.Hour + 30*time.Minute),
+		SevenDayPercent:   10,
+		SevenDayResetTime: now.Add(3*24*time.Hour + 12*time.Hour),
+	}
+	AnnotateProjections(cache, now)
+
+	if cache.Projection == nil || cache.Projection.Status != types.ProjectionWayOver {
+		t.Errorf("expected way_over 5h projection, got %+v", cache.Projection)
+	}
+	if cache.SevenDayProjection == nil || cache.SevenDayProjection.Status != types.ProjectionWayUnder {
+		t.Errorf("expected way_under 7d projection, got %+v", cache.SevenDayProjection)
+	}
+
+	unavailable := &types.UsageCache{Unavailable: true}
+	AnnotateProjections(unavailable, now)
+	if unavailable.Projection != nil {
+		t.Error("expected no projection for unavailable data")
+	}
+}
+
+func TestDiscoverCredentials_ClaudeConfigDir(t *testing.T) {
+	_, cleanup := setupTestCacheDir(t)
+	defer cleanup()
+
+	configDir := t.TempDir()
+	t.Setenv("CLAUDE_CONFIG_DIR", configDir)
+	writeJSON(t, filepath.Join(configDir, ".credentials.json"), types.Credentials{
+		ClaudeAiOauth: &types.OAuthCredentials{AccessToken: "tok", SubscriptionType: "max"},
+	})
+
+	creds := discoverCredentials()
+	if creds == nil || creds.ClaudeAiOauth.AccessToken != "tok" || creds.ClaudeAiOauth.SubscriptionType != "max" {
+		t.Fatalf("expected credentials from CLAUDE_CONFIG_DIR, got %+v", creds)
+	}
+}
+
+func TestParseAuthStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		out          string
+		loggedIn     bool
+		subscription string
+		ok           bool
+	}{
+		{"camelCase", `{"loggedIn":true,"subscriptionType":"pro"}`, true, "pro", true},
+		{"snake_case", `{"logged_in":true,"subscription_type":"max"}`, true, "max", true},
+		{"logged out", `{"loggedIn":false}`, false, "", true},
+		{"not json", `Logged in as someone`, false, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := parseAuthStatus([]byte(tt.out))
+			if (auth != nil) != tt.ok {
+				t.Fatalf("parseAuthStatus(%q) = %+v, want ok=%v", tt.out, auth, tt.ok)
+			}
+			if auth != nil && (auth.LoggedIn != tt.loggedIn || auth.SubscriptionType != tt.subscription) {
+				t.Errorf("parseAuthStatus(%q) = %+v", tt.out, auth)
+			}
+		})
+	}
+}
+
+func TestCacheFiles_PrivatePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions")
+	}
+	_, cleanup := setupTestCacheDir(t)
+	defer cleanup()
+
+	cacheFile := getCacheFile("usage.json")
+	saveCache(cacheFile, &types.UsageCache{UsagePercent: 10})
+	saveBackoff(&backoffState{BackoffSeconds: 30})
+
+	for _, file := range []string{cacheFile, getCacheFile("backoff.json")} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s has mode %o, want 600", file, perm)
+		}
+	}
+
+	info, err := os.Stat(filepath.Dir(cacheFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("cache dir has mode %o, want 700", perm)
+	}
+}
+
+func TestCached(t *testing.T) {
+	_, cleanup := setupTestCacheDir(t)
+	defer cleanup()
+
+	cfg := config.Get()
+	origTTL := cfg.CacheTTL
+	cfg.CacheTTL = 300
+	defer func() { cfg.CacheTTL = origTTL }()
+
+	if Cached() != nil {
+		t.Fatal("expected nil without a cache file")
+	}
+
+	cacheFile := getCacheFile("usage.json")
+	writeJSON(t, cacheFile, types.UsageCache{UsagePercent: 20, ResetTime: time.Now().Add(time.Hour)})
+	if c := Cached(); c == nil || c.Stale || c.UsagePercent != 20 {
+		t.Errorf("expected fresh cached usage, got %+v", c)
+	}
+
+	// Past the TTL the data is still shown, but marked stale
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(cacheFile, old, old)
+	if c := Cached(); c == nil || !c.Stale || c.UsagePercent != 20 {
+		t.Errorf("expected stale cached usage, got %+v", c)
+	}
+}
+
+// setupFakeAPI points usage fetches at a fake API server and writes
+// credentials for it
+func setupFakeAPI(t *testing.T, responses ...fakeapi.Response) *fakeapi.Server {
+	t.Helper()
+	home, cleanup := setupTestCacheDir(t)
+	t.Cleanup(cleanup)
+	os.MkdirAll(filepath.Join(home, ".claude"), 0755)
+	writeJSON(t, filepath.Join(home, ".claude", "credentials.json"), types.Credentials{
+		ClaudeAiOauth: &types.OAuthCredentials{AccessToken: "test-token", SubscriptionType: "max"},
+	})
+
+	server := fakeapi.NewServer(responses...)
+	t.Cleanup(server.Close)
+
+	cfg := config.Get()
+	orig := *cfg
+	cfg.APIBase, cfg.CacheTTL, cfg.DataDir = server.URL+"/", 300, filepath.Join(home, ".claude")
+	t.Cleanup(func() { *cfg = orig })
+	return server
+}
+
+func TestGetUsage_FetchesAndCaches(t *testing.T) {
+	reset := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	server := setupFakeAPI(t, fakeapi.Usage(42, 10, reset, reset.Add(72*time.Hour)))
+
+	usage, subscription, _, _ := GetUsageAndSubscription()
+	if usage == nil || usage.UsagePercent != 42 || usage.SevenDayPercent != 10 || !usage.ResetTime.Equal(reset) || usage.Source != "api" {
+		t.Fatalf("first fetch = %+v, want 42%% from the api", usage)
+	}
+	if subscription != "max" {
+		t.Errorf("subscription = %q, want max", subscription)
+	}
+	reqs := server.Requests()
+	if len(reqs) != 1 || reqs[0].Path != fakeapi.UsagePath || reqs[0].Authorization != "Bearer test-token" || reqs[0].Beta == "" {
+		t.Errorf("requests = %+v, want one authorized usage request", reqs)
+	}
+
+	// Within the TTL the cache answers
+	if usage, _, _, _ := GetUsageAndSubscription(); usage == nil || usage.UsagePercent != 42 || usage.Source != "cache" {
+		t.Errorf("second call = %+v, want the cached 42%%", usage)
+	}
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("got %d requests, want the cache to avoid a second one", n)
+	}
+}
+
+func TestGetUsage_RateLimitBacksOff(t *testing.T) {
+	reset := time.Now().Add(2 * time.Hour)
+	server := setupFakeAPI(t, fakeapi.RateLimited(time.Minute), fakeapi.Usage(50, 0, reset, reset))
+
+	// No cache yet: nothing to show, and the 429 starts a backoff
+	if usage, _, _, _ := GetUsageAndSubscription(); usage == nil || !usage.Unavailable {
+		t.Errorf("usage = %+v after a 429 without a cache, want unavailable", usage)
+	}
+	b := loadBackoff()
+	if b == nil || time.Until(b.BackoffUntil) < 50*time.Second {
+		t.Fatalf("backoff = %+v, want about the minute from Retry-After", b)
+	}
+
+	// During the backoff the API isn't contacted
+	GetUsageAndSubscription()
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("got %d requests, want none during the backoff", n)
+	}
+
+	// Once it's over the next fetch succeeds
+	saveBackoff(&backoffState{BackoffSeconds: b.BackoffSeconds})
+	if usage, _, _, _ := GetUsageAndSubscription(); usage == nil || usage.UsagePercent != 50 {
+		t.Errorf("usage = %+v after the backoff, want 50%%", usage)
+	}
+}
+
+func TestGetUsage_ServerErrorServesStaleCache(t *testing.T) {
+	reset := time.Now().Add(2 * time.Hour)
+	server := setupFakeAPI(t, fakeapi.Usage(30, 0, reset, reset))
+	GetUsageAndSubscription()
+
+	// Expire the cache, then fail the refresh
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(getCacheFile("usage.json"), old, old)
+	server.Reply(fakeapi.Response{Status: 500, Body: "boom"})
+
+	usage, _, _, _ := GetUsageAndSubscription()
+	if usage == nil || usage.UsagePercent != 30 || !usage.Stale || !strings.Contains(usage.Source, "API error 500") {
+		t.Errorf("usage = %+v, want the stale 30%% with the API error", usage)
+	}
+}
+
+func TestGetUsage_PersistsAllWindows(t *testing.T) {
+	reset := time.Now().Add(72 * time.Hour).UTC().Truncate(time.Second)
+	setupFakeAPI(t, fakeapi.Response{Body: `{
+		"five_hour": null,
+		"seven_day": {"utilization": 41, "resets_at": "` + reset.Format(time.RFC3339) + `"},
+		"seven_day_sonnet": {"utilization": 12.5, "resets_at": null},
+		"extra_usage": {"is_enabled": false}
+	}`})
+
+	usage, _, _, _ := GetUsageAndSubscription()
+	if usage == nil || usage.Unavailable || usage.UsagePercent != 0 || usage.SevenDayPercent != 41 {
+		t.Fatalf("usage = %+v, want an idle 5h window and 41%% over 7 days", usage)
+	}
+
+	cached, err := loadCacheIgnoreExpiry(getCacheFile("usage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.SevenDayPercent != 41 || !cached.SevenDayResetTime.Equal(reset) {
+		t.Errorf("cached 7d = %v%% resetting %v, want 41%% resetting %v", cached.SevenDayPercent, cached.SevenDayResetTime, reset)
+	}
+	if w, ok := cached.Windows["seven_day_sonnet"]; !ok || w.Percent != 12.5 {
+		t.Errorf("cached windows = %+v, want seven_day_sonnet kept", cached.Windows)
+	}
+	if _, ok := cached.Windows["extra_usage"]; ok {
+		t.Errorf("cached windows = %+v, want extra_usage skipped", cached.Windows)
+	}
+}
+
+func TestBurnRate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	reset := now.Add(3 * time.Hour)
+	sample := func(ago time.Duration, pct float64, reset time.Time) types.UsageSample {
+		return types.UsageSample{Time: now.Add(-ago), FiveHour: pct, FiveHourReset: reset}
+	}
+	tests := []struct {
+		name    string
+		samples []types.UsageSample
+		want    float64
+	}{
+		{"no samples", nil, 0},
+		{"single sample", []types.UsageSample{sample(0, 40, reset)}, 0},
+		{"half an hour", []types.UsageSample{sample(30*time.Minute, 30, reset), sample(15*time.Minute, 33, reset), sample(0, 34, reset)}, 8},
+		{"older samples ignored", []types.UsageSample{sample(3*time.Hour, 0, reset), sample(time.Hour, 30, reset), sample(0, 38, reset)}, 8},
+		{"too short", []types.UsageSample{sample(5*time.Minute, 30, reset), sample(0, 34, reset)}, 0},
+		{"previous window ignored", []types.UsageSample{sample(40*time.Minute, 90, now.Add(-20*time.Minute)), sample(20*time.Minute, 2, reset), sample(0, 6, reset)}, 12},
+		{"idle", []types.UsageSample{sample(30*time.Minute, 30, reset), sample(0, 30, reset)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BurnRate(tt.samples, now); got != tt.want {
+				t.Errorf("BurnRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitAt(t *testing.T) {
+	fetched := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		cache types.UsageCache
+		want  time.Time
+	}{
+		{"before the reset", types.UsageCache{UsagePercent: 80, BurnRate: 10, ResetTime: fetched.Add(3 * time.Hour)}, fetched.Add(2 * time.Hour)},
+		{"reset comes first", types.UsageCache{UsagePercent: 80, BurnRate: 5, ResetTime: fetched.Add(3 * time.Hour)}, time.Time{}},
+		{"no burn rate", types.UsageCache{UsagePercent: 80, ResetTime: fetched.Add(3 * time.Hour)}, time.Time{}},
+		{"at the limit", types.UsageCache{UsagePercent: 100, BurnRate: 10, ResetTime: fetched.Add(3 * time.Hour)}, time.Time{}},
+	}
+	for _, tt := range tests {
+		tt.cache.FetchedAt = fetched
+		if got := LimitAt(&tt.cache); !got.Equal(tt.want) {
+			t.Errorf("%s: LimitAt() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetUsage_RecordsSamples(t *testing.T) {
+	reset := time.Now().Add(2 * time.Hour)
+	setupFakeAPI(t, fakeapi.Usage(30, 10, reset, reset))
+
+	// An earlier fetch of the same window, half an hour ago
+	earlier := []types.UsageSample{{Time: time.Now().Add(-30 * time.Minute), FiveHour: 26, SevenDay: 10, FiveHourReset: reset}}
+	writeJSON(t, getCacheFile("usage_samples.json"), earlier)
+
+	usage, _, _, _ := GetUsageAndSubscription()
+	if usage == nil || usage.BurnRate < 7.9 || usage.BurnRate > 8.1 {
+		t.Errorf("usage = %+v, want a burn rate of 8%%/h", usage)
+	}
+	samples := GetUsageSamples()
+	if len(samples) != 2 || samples[1].FiveHour != 30 || samples[1].SevenDay != 10 {
+		t.Errorf("samples = %+v, want the fetch appended", samples)
+	}
+}
+
+func TestPurgeSamples(t *testing.T) {
+	_, cleanup := setupTestCacheDir(t)
+	defer cleanup()
+
+	now := time.Now()
+	writeJSON(t, getCacheFile("usage_samples.json"), []types.UsageSample{
+		{Time: now.AddDate(0, 0, -5), FiveHour: 10},
+		{Time: now.AddDate(0, 0, -2), FiveHour: 20},
+		{Time: now.Add(-time.Hour), FiveHour: 30},
+	})
+
+	if removed := PurgeSamples(now.AddDate(0, 0, -3)); removed != 1 {
+		t.Errorf("PurgeSamples removed %d, want 1", removed)
+	}
+	if samples := GetUsageSamples(); len(samples) != 2 || samples[0].FiveHour != 20 {
+		t.Errorf("unexpected samples after purge: %+v", samples)
+	}
+	if removed := PurgeSamples(now.AddDate(0, 0, -3)); removed != 0 {
+		t.Errorf("second PurgeSamples removed %d, want 0", removed)
+	}
+}
+
+func TestGetUsage_OfflineServesCache(t *testing.T) {
+	reset := time.Now().Add(2 * time.Hour)
+	server := setupFakeAPI(t, fakeapi.Usage(30, 0, reset, reset))
+	GetUsageAndSubscription()
+
+	// CI mode: the expired cache is used as is, and nothing is written
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(getCacheFile("usage.json"), old, old)
+	config.Get().Offline = true
+	config.Get().ReadOnly = true
+
+	usage, _, _, _ := GetUsageAndSubscription()
+	if usage == nil || usage.UsagePercent != 30 || !usage.Stale || !strings.Contains(usage.Source, "offline") {
+		t.Errorf("usage = %+v, want the stale 30%% offline", usage)
+	}
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("got %d requests, want none offline", n)
+	}
+	if info, err := os.Stat(getCacheFile("usage.json")); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("usage cache was rewritten offline")
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(t time.Time) json.Number { return json.Number(strconv.FormatInt(t.UnixMilli(), 10)) }
+	tests := []struct {
+		name      string
+		expiresAt json.Number
+		want      bool
+	}{
+		{"no expiry", "", false},
+		{"valid for an hour", ms(now.Add(time.Hour)), false},
+		{"about to expire", ms(now.Add(30 * time.Second)), true},
+		{"expired", ms(now.Add(-time.Hour)), true},
+		{"unparseable", "soon", false},
+	}
+	for _, tt := range tests {
+		if got := tokenExpired(&types.OAuthCredentials{ExpiresAt: tt.expiresAt}, now); got != tt.want {
+			t.Errorf("%s: tokenExpired() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// expiredCredentials are credentials as the claude CLI stores them, with
+// an access token that expired an hour ago
+func expiredCredentials() string {
+	return `{"claudeAiOauth":{"accessToken":"old-token","refreshToken":"refresh-1","expiresAt":` +
+		strconv.FormatInt(time.Now().Add(-time.Hour).UnixMilli(), 10) +
+		`,"scopes":["user:inference"],"subscriptionType":"max"},"mcpOAuth":{"server":"kept"}}`
+}
+
+func TestGetUsage_ExpiredTokenWaitsForClaudeCode(t *testing.T) {
+	server := setupFakeAPI(t, fakeapi.Response{Status: 401, Body: "expired"})
+	credFile := filepath.Join(config.ClaudeDir(), "credentials.json")
+	expired := expiredCredentials()
+	os.WriteFile(credFile, []byte(expired), 0600)
+
+	// Without --refresh-token the refresh token is left to Claude Code
+	GetUsageAndSubscription()
+	if reqs := server.Requests(); len(reqs) != 1 || reqs[0].Path != fakeapi.UsagePath {
+		t.Errorf("requests = %+v, want only the usage fetch", reqs)
+	}
+	if data, _ := os.ReadFile(credFile); string(data) != expired {
+		t.Errorf("credentials = %s, want them left alone", data)
+	}
+
+	// Once Claude Code has refreshed it, the new token is read again
+	creds := readCredentialsFile(credFile)
+	os.WriteFile(credFile, []byte(`{"claudeAiOauth":{"accessToken":"new-token","expiresAt":`+
+		strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)+`}}`), 0600)
+	if got := reloadCredentials(creds, credentialStore{file: credFile}); got.ClaudeAiOauth.AccessToken != "new-token" {
+		t.Errorf("reloadCredentials() token = %q, want the refreshed one", got.ClaudeAiOauth.AccessToken)
+	}
+}
+
+func TestGetUsage_RefreshesExpiredToken(t *testing.T) {
+	reset := time.Now().Add(2 * time.Hour)
+	server := setupFakeAPI(t, fakeapi.Token("new-token", "refresh-2", 8*time.Hour), fakeapi.Usage(20, 0, reset, reset))
+	config.Get().RefreshToken = true
+	credFile := filepath.Join(config.ClaudeDir(), "credentials.json")
+	if err := os.WriteFile(credFile, []byte(expiredCredentials()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if usage, _, _, _ := GetUsageAndSubscription(); usage == nil || usage.UsagePercent != 20 {
+		t.Fatalf("usage = %+v, want 20%% after refreshing the token", usage)
+	}
+	reqs := server.Requests()
+	if len(reqs) != 2 || reqs[0].Path != fakeapi.TokenPath || reqs[1].Path != fakeapi.UsagePath {
+		t.Fatalf("requests = %+v, want a token refresh then the usage fetch", reqs)
+	}
+	if !strings.Contains(reqs[0].Body, `"refresh_token":"refresh-1"`) || !strings.Contains(reqs[0].Body, `"grant_type":"refresh_token"`) {
+		t.Errorf("refresh body = %s, want the refresh token grant", reqs[0].Body)
+	}
+	if reqs[1].Authorization != "Bearer new-token" {
+		t.Errorf("usage Authorization = %q, want the new token", reqs[1].Authorization)
+	}
+
+	// Written back with the new tokens and the rest untouched
+	data, _ := os.ReadFile(credFile)
+	saved := string(data)
+	for _, want := range []string{`"accessToken":"new-token"`, `"refreshToken":"refresh-2"`, `"scopes":["user:inference"]`, `"mcpOAuth":{"server":"kept"}`} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved credentials %s, missing %s", saved, want)
+		}
+	}
+	if creds := readCredentialsFile(credFile); creds == nil || tokenExpired(creds.ClaudeAiOauth, time.Now()) {
+		t.Errorf("saved credentials %s still expired", saved)
+	}
+}
+
+func TestGetUsage_RefreshesKeyringToken(t *testing.T) {
+	keyring.MockInit()
+	reset := time.Now().Add(2 * time.Hour)
+	server := setupFakeAPI(t, fakeapi.Token("new-token", "refresh-2", 8*time.Hour), fakeapi.Usage(20, 0, reset, reset))
+	config.Get().RefreshToken = true
+	os.Remove(filepath.Join(config.ClaudeDir(), "credentials.json"))
+	if err := keyring.Set(keyringService, keyringUser(), expiredCredentials()); err != nil {
+		t.Fatal(err)
+	}
+
+	if usage, _, _, _ := GetUsageAndSubscription(); usage == nil || usage.UsagePercent != 20 {
+		t.Fatalf("usage = %+v, want 20%% after refreshing the token", usage)
+	}
+	if n := len(server.Requests()); n != 2 {
+		t.Errorf("got %d requests, want a refresh and a fetch", n)
+	}
+	secret, _ := keyring.Get(keyringService, keyringUser())
+	if !strings.Contains(secret, `"accessToken":"new-token"`) || !strings.Contains(secret, `"mcpOAuth"`) {
+		t.Errorf("keyring credentials = %s, want the new token merged in", secret)
+	}
+}
+
+func TestGetUsage_RefreshFailureServesStaleCache(t *testing.T) {
+	reset := time.Now().Add(2 * time.Hour)
+	server := setupFakeAPI(t, fakeapi.Usage(30, 0, reset, reset))
+	GetUsageAndSubscription()
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(getCacheFile("usage.json"), old, old)
+	credFile := filepath.Join(config.ClaudeDir(), "credentials.json")
+	os.WriteFile(credFile, []byte(expiredCredentials()), 0600)
+	config.Get().RefreshToken = true
+	server.Reply(fakeapi.Response{Status: 400, Body: `{"error":"invalid_grant"}`}, fakeapi.Response{Status: 401, Body: "expired"})
+
+	if usage, _, _, _ := GetUsageAndSubscription(); usage == nil || usage.UsagePercent != 30 || !usage.Stale {
+		t.Errorf("usage = %+v, want the stale 30%% when the refresh fails", usage)
+	}
+	if data, _ := os.ReadFile(credFile); !strings.Contains(string(data), "old-token") {
+		t.Errorf("credentials = %s, want them left alone after a failed refresh", data)
+	}
+}
+
+func TestGetUsage_APIKeyBilling(t *testing.T) {
+	keyring.MockInit() // no credentials in the keyring either
+	server := setupFakeAPI(t, fakeapi.CostReport("1250.5", "749.5"))
+	os.Remove(filepath.Join(config.ClaudeDir(), "credentials.json"))
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-api-test")
+	t.Setenv("ANTHROPIC_ADMIN_KEY", "")
+
+	// Without an Admin API key there's only the marker
+	usage, _, _, isAPIBilling := GetUsageAndSubscription()
+	if !isAPIBilling || usage == nil || usage.Unavailable || !usage.MonthStart.IsZero() {
+		t.Errorf("usage = %+v, billing %v; want an API billing marker", usage, isAPIBilling)
+	}
+	if n := len(server.Requests()); n != 0 {
+		t.Errorf("got %d requests, want none without an Admin API key", n)
+	}
+
+	t.Setenv("ANTHROPIC_ADMIN_KEY", "sk-ant-admin-test")
+	usage, _, _, _ = GetUsageAndSubscription()
+	if usage == nil || usage.MonthSpend != 20 || usage.MonthStart.IsZero() {
+		t.Fatalf("usage = %+v, want $20 spent this month", usage)
+	}
+	reqs := server.Requests()
+	if len(reqs) != 1 || reqs[0].Path != fakeapi.CostReportPath || reqs[0].APIKey != "sk-ant-admin-test" {
+		t.Errorf("requests = %+v, want one cost report request with the admin key", reqs)
+	}
+
+	// Cached like plan usage
+	if usage, _, _, _ := GetUsageAndSubscription(); usage == nil || usage.MonthSpend != 20 || usage.Source != "cache" {
+		t.Errorf("second call = %+v, want the cached spend", usage)
+	}
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("got %d requests, want the cache to answer", n)
+	}
+}
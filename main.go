@@ -2,14 +2,36 @@ package main
 
 import (
 	_ "embed"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
+	"github.com/erwint/claude-code-statusline/internal/bundle"
 	"github.com/erwint/claude-code-statusline/internal/config"
 	"github.com/erwint/claude-code-statusline/internal/cost"
+	"github.com/erwint/claude-code-statusline/internal/custom"
+	"github.com/erwint/claude-code-statusline/internal/daemon"
 	"github.com/erwint/claude-code-statusline/internal/git"
+	"github.com/erwint/claude-code-statusline/internal/install"
+	"github.com/erwint/claude-code-statusline/internal/jobs"
+	"github.com/erwint/claude-code-statusline/internal/notes"
+	"github.com/erwint/claude-code-statusline/internal/notify"
+	"github.com/erwint/claude-code-statusline/internal/otlp"
 	"github.com/erwint/claude-code-statusline/internal/output"
+	"github.com/erwint/claude-code-statusline/internal/preview"
+	"github.com/erwint/claude-code-statusline/internal/project"
+	"github.com/erwint/claude-code-statusline/internal/rendercache"
+	"github.com/erwint/claude-code-statusline/internal/report"
 	"github.com/erwint/claude-code-statusline/internal/session"
+	"github.com/erwint/claude-code-statusline/internal/telemetry"
+	"github.com/erwint/claude-code-statusline/internal/term"
 	"github.com/erwint/claude-code-statusline/internal/transcript"
 	"github.com/erwint/claude-code-statusline/internal/types"
 	"github.com/erwint/claude-code-statusline/internal/updater"
@@ -21,27 +43,77 @@ var (
 	version = "dev"
 	commit  = "none"
 	date    = "unknown"
+
+	// telemetryEndpoint receives opt-in telemetry; builds without one never send
+	telemetryEndpoint = ""
 )
 
+// stragglerTimeout bounds how long collectors that missed the render
+// deadline, and the --cost-async rescan, may keep running after the output
+// is written. Claude Code waits for the process to exit, so it's kept short:
+// a rescan cut off resumes from its last checkpoint on the next render, and
+// an OTLP push is retried once its claim runs out.
+const stragglerTimeout = 500 * time.Millisecond
+
+// daemonQueryTimeout bounds how long a render waits for the daemon
+const daemonQueryTimeout = 50 * time.Millisecond
+
 //go:embed pricing.json
 var embeddedPricing []byte
 
-func handleUpdate() {
+// handleUpdate runs the "update" command
+func handleUpdate(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	to := fs.String("to", "", "Version to install, e.g. v1.4.2 (default: the latest)")
+	rollback := fs.Bool("rollback", false, "Reinstall the version the last update replaced")
+	config.ParseArgs(fs, args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline update [--to VERSION | --rollback]")
+		os.Exit(2)
+	}
+	if *rollback {
+		rollbackBinary()
+		return
+	}
+	updateBinary(*to)
+}
+
+// exitIfManaged tells how to update a binary a package manager installed,
+// and exits, rather than replace files the package manager tracks
+func exitIfManaged() {
+	if m := updater.InstalledBy(); m != nil {
+		fmt.Fprintf(os.Stderr, "claude-code-statusline was installed with %s, update it with:\n  %s\n", m.Name, m.Command)
+		os.Exit(1)
+	}
+}
+
+// updateBinary replaces the binary with the release of version, or the
+// one --update-pin and --update-channel choose if empty
+func updateBinary(to string) {
+	exitIfManaged()
 	fmt.Printf("Current version: %s\n", version)
 	fmt.Println("Checking for updates...")
 
-	release, hasUpdate, err := updater.CheckForUpdate(version)
+	var release *updater.Release
+	var hasUpdate bool
+	var err error
+	if to != "" {
+		release, err = updater.FindRelease(to)
+		hasUpdate = err == nil && strings.TrimPrefix(release.TagName, "v") != strings.TrimPrefix(version, "v")
+	} else {
+		release, hasUpdate, err = updater.CheckForUpdate(version)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error checking for updates: %v\n", err)
 		os.Exit(1)
 	}
 
 	if !hasUpdate {
-		fmt.Println("Already running the latest version!")
+		fmt.Printf("Already running %s!\n", release.TagName)
 		return
 	}
 
-	fmt.Printf("New version available: %s\n", release.TagName)
+	fmt.Printf("Installing version: %s\n", release.TagName)
 	fmt.Printf("Downloading and installing...\n")
 
 	if err := updater.Update(version, release); err != nil {
@@ -53,47 +125,835 @@ func handleUpdate() {
 	fmt.Println("Run the command again to use the new version.")
 }
 
-func main() {
-	// Handle --version and --update before parsing other flags
-	for _, arg := range os.Args[1:] {
-		if arg == "--version" || arg == "-version" || arg == "-v" {
-			fmt.Printf("claude-code-statusline %s (%s) built %s\n", version, commit, date)
-			os.Exit(0)
+// rollbackBinary reinstalls the version the last update replaced
+func rollbackBinary() {
+	exitIfManaged()
+	previous, err := updater.Rollback(version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Rollback failed: %v\n", err)
+		os.Exit(1)
+	}
+	if previous == "" {
+		previous = "the previous version"
+	}
+	fmt.Printf("✓ Rolled back from %s to %s\n", version, previous)
+	fmt.Printf("Automatic updates skip %s until a newer release; set --update-pin to stay on a version.\n", version)
+}
+
+// handleCost runs the "cost" subcommand
+func handleCost(args []string) {
+	if len(args) == 0 || args[0] != "report" {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline cost report [--unknown-models]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("cost report", flag.ExitOnError)
+	unknownModels := fs.Bool("unknown-models", false, "List models that were priced at default rates")
+	config.ParseArgs(fs, args[1:])
+	cost.SetEmbeddedPricing(embeddedPricing)
+
+	cache := cost.LoadCache()
+	if *unknownModels {
+		report.UnknownModels(os.Stdout, cache)
+		return
+	}
+	report.CostSummary(os.Stdout, cache, time.Now())
+}
+
+// handleReport runs the "report" subcommand
+func handleReport(args []string) {
+	if len(args) == 0 || args[0] != "weekly" {
+		handleHistory(args)
+		return
+	}
+
+	fs := flag.NewFlagSet("report weekly", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text|markdown")
+	config.ParseArgs(fs, args[1:])
+	cost.SetEmbeddedPricing(embeddedPricing)
+
+	// The last seven days, today included
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	activity := cost.ScanActivity(today.AddDate(0, 0, -6), now)
+	report.Weekly(os.Stdout, activity, *format == "markdown")
+}
+
+// handleHistory runs "report" without a report name: the per-day history
+// from the cost cache
+func handleHistory(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	days := fs.Int("days", 30, "Number of days to show, today included")
+	format := fs.String("format", "text", "Output format: text|csv")
+	config.ParseArgs(fs, args)
+	if fs.NArg() > 0 || *days < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline report [--days 30] [--format text|csv]\n       claude-code-statusline report weekly [--format text|markdown]")
+		os.Exit(2)
+	}
+	cost.SetEmbeddedPricing(embeddedPricing)
+
+	report.History(os.Stdout, cost.LoadCache(), time.Now(), *days, *format == "csv")
+}
+
+// handleExport runs the "export" subcommand
+func handleExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "csv", "Output format: csv|json")
+	fromFlag := fs.String("from", "", "First `date` to export, YYYY-MM-DD (default: the first of this month)")
+	toFlag := fs.String("to", "", "Last `date` to export, YYYY-MM-DD (default: today)")
+	config.ParseArgs(fs, args)
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var err error
+	if *fromFlag != "" {
+		from, err = time.ParseInLocation("2006-01-02", *fromFlag, time.Local)
+	}
+	if err == nil && *toFlag != "" {
+		to, err = time.ParseInLocation("2006-01-02", *toFlag, time.Local)
+	}
+	if err != nil || fs.NArg() > 0 || to.Before(from) || (*format != "csv" && *format != "json") {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline export [--format csv|json] [--from YYYY-MM-DD] [--to YYYY-MM-DD]")
+		os.Exit(2)
+	}
+	cost.SetEmbeddedPricing(embeddedPricing)
+
+	activity := cost.ScanActivity(from, to.AddDate(0, 0, 1))
+	if err := report.Export(os.Stdout, activity, *format == "json"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// handleTranscript runs the "transcript" subcommand
+func handleTranscript(args []string) {
+	if len(args) == 0 || args[0] != "stats" {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline transcript stats [--session ID | transcript.jsonl]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("transcript stats", flag.ExitOnError)
+	sessionID := fs.String("session", "", "Session to analyze (default: the most recently active one)")
+	config.ParseArgs(fs, args[1:])
+	cost.SetEmbeddedPricing(embeddedPricing)
+
+	path := fs.Arg(0)
+	if path == "" {
+		path = transcript.Locate(*sessionID)
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "Error: no Claude Code transcript found")
+		os.Exit(1)
+	}
+
+	stats, err := transcript.TodoCosts(path, cost.MessagePricer())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	report.TodoCosts(os.Stdout, stats)
+}
+
+// handleCache runs the "cache" command
+func handleCache(args []string) {
+	if len(args) == 0 || (args[0] != "dir" && args[0] != "purge") {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline cache dir\n       claude-code-statusline cache purge --before YYYY-MM-DD")
+		os.Exit(2)
+	}
+	if args[0] == "purge" {
+		handlePurge(args[1:])
+		return
+	}
+
+	fs := flag.NewFlagSet("cache dir", flag.ExitOnError)
+	config.ParseArgs(fs, args[1:])
+	fmt.Println(config.CacheDir())
+}
+
+// handlePurge runs "cache purge"
+func handlePurge(args []string) {
+	fs := flag.NewFlagSet("cache purge", flag.ExitOnError)
+	beforeFlag := fs.String("before", "", "Remove data from before this `date` (YYYY-MM-DD)")
+	config.ParseArgs(fs, args)
+
+	before, err := time.ParseInLocation("2006-01-02", *beforeFlag, time.Local)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline cache purge --before YYYY-MM-DD")
+		os.Exit(2)
+	}
+
+	days := cost.Purge(before)
+	windows := usage.PurgeHistory(before)
+	samples := usage.PurgeSamples(before)
+	notifications := notify.Purge(before)
+	sessionNotes := notes.Purge(before)
+	fmt.Printf("Removed data from before %s: %d day(s) of costs, %d usage window observation(s), %d usage sample(s), %d notification record(s), %d note(s)\n",
+		before.Format("2006-01-02"), days, windows, samples, notifications, sessionNotes)
+}
+
+// handleNote runs the "note" subcommand
+func handleNote(args []string) {
+	fs := flag.NewFlagSet("note", flag.ExitOnError)
+	sessionID := fs.String("session", "", "Session to annotate (default: the most recently active one)")
+	config.ParseArgs(fs, args)
+
+	if *sessionID == "" {
+		*sessionID = notes.LatestSession()
+	}
+	if *sessionID == "" {
+		fmt.Fprintln(os.Stderr, "Error: no Claude Code session found, pass --session")
+		os.Exit(1)
+	}
+
+	// Without text, list the session's notes
+	text := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if text == "" {
+		for _, note := range notes.List(*sessionID) {
+			fmt.Printf("%s  %s\n", note.Time.Local().Format("2006-01-02 15:04"), note.Text)
+		}
+		return
+	}
+
+	if err := notes.Add(*sessionID, text, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// handleTelemetry runs the "telemetry" subcommand
+func handleTelemetry(args []string) {
+	if len(args) == 0 || args[0] != "preview" {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline telemetry preview [statusline flags]")
+		os.Exit(2)
+	}
+
+	config.ParseArgs(flag.NewFlagSet("telemetry preview", flag.ExitOnError), args[1:])
+	_, status := telemetry.Status(telemetryEndpoint)
+	fmt.Printf("Telemetry: %s\n\nA report contains exactly:\n", status)
+
+	data, _ := json.MarshalIndent(telemetry.Collect(version), "", "  ")
+	fmt.Println(string(data))
+}
+
+// handleInit runs the "init" subcommand
+func handleInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	binary := fs.String("binary", "", "Statusline binary Claude Code should run (default: this one)")
+	dryRun := fs.Bool("dry-run", false, "Show what would change without writing the settings")
+	cfg := config.ParseArgs(fs, args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline init [--binary PATH] [--dry-run]")
+		os.Exit(2)
+	}
+
+	if *binary == "" {
+		exe, err := os.Executable()
+		if err == nil {
+			exe, err = filepath.EvalSymlinks(exe)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: can't find this binary, pass --binary: %v\n", err)
+			os.Exit(1)
+		}
+		*binary = exe
+	}
+	path, err := filepath.Abs(*binary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	ver, err := install.CheckBinary(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Binary: %s (%s)\n", path, ver)
+
+	// CI mode writes nothing
+	result, err := install.Install(install.SettingsFile(), install.Command(path), *dryRun || cfg.ReadOnly)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	switch {
+	case !result.Changed:
+		fmt.Printf("✓ %s already runs the statusline\n", result.Path)
+	case *dryRun || cfg.ReadOnly:
+		if result.Previous != "" {
+			fmt.Printf("Would replace the statusLine command %s in %s\n", result.Previous, result.Path)
+		} else {
+			fmt.Printf("Would add the statusLine to %s\n", result.Path)
+		}
+		if cfg.ReadOnly && !*dryRun {
+			fmt.Println("Nothing written in CI mode, run with --ci=false to write the settings")
+		}
+	default:
+		if result.Backup != "" {
+			fmt.Printf("Backed up the settings to %s\n", result.Backup)
+		}
+		if result.Previous != "" {
+			fmt.Printf("✓ Replaced the statusLine command %s in %s\n", result.Previous, result.Path)
+		} else {
+			fmt.Printf("✓ Added the statusLine to %s\n", result.Path)
+		}
+		fmt.Println("Restart Claude Code to see the statusline.")
+	}
+}
+
+// handlePreview runs the "preview" subcommand
+func handlePreview(args []string) {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	scenario := fs.String("scenario", "heavy-usage", "Synthetic session to render: "+strings.Join(preview.Names(), "|")+"|all")
+	modes := fs.String("modes", strings.Join(preview.DisplayModes, ","), "Display modes to render")
+	themes := fs.String("themes", strings.Join(output.ThemeNames(), ","), "Themes to render the modes with colors in")
+	cfg := config.ParseArgs(fs, args)
+	opts := preview.Options{
+		Modes:      strings.Split(*modes, ","),
+		Themes:     strings.Split(*themes, ","),
+		Background: term.Background(cfg.Background),
+		ColorDepth: term.ColorDepth(cfg.ColorDepth),
+	}
+	for _, mode := range opts.Modes {
+		if !slices.Contains(preview.DisplayModes, mode) {
+			fmt.Fprintf(os.Stderr, "Error: unknown display mode %q, want %s\n", mode, strings.Join(preview.DisplayModes, ", "))
+			os.Exit(2)
+		}
+	}
+	for _, theme := range opts.Themes {
+		if !slices.Contains(output.ThemeNames(), theme) {
+			fmt.Fprintf(os.Stderr, "Error: unknown theme %q, want %s\n", theme, strings.Join(output.ThemeNames(), ", "))
+			os.Exit(2)
+		}
+	}
+	if !cfg.NoColor && !term.EnableColors(os.Stdout) {
+		cfg.NoColor = true
+	}
+
+	names := []string{*scenario}
+	if *scenario == "all" {
+		names = preview.Names()
+	}
+	for i, name := range names {
+		s, err := preview.Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		preview.Render(os.Stdout, s, opts)
+	}
+}
+
+// handleConfig runs the "config check" and "config print" subcommands
+func handleConfig(args []string) {
+	if len(args) == 0 || (args[0] != "check" && args[0] != "print") {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline config check|print [statusline flags]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	cfg := config.ParseArgs(fs, args[1:])
+	file := config.ConfigFile()
+	if _, err := os.Stat(file); err != nil {
+		file += " (not found)"
+	}
+
+	if args[0] == "print" {
+		fmt.Printf("Config file: %s\n\n", file)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OPTION\tVALUE\tSOURCE")
+		fs.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, f.Value.String(), cfg.Source(f.Name))
+		})
+		w.Flush()
+		return
+	}
+
+	fmt.Printf("Config file: %s\n", file)
+	for _, p := range cfg.Problems {
+		fmt.Println(p)
+	}
+	if len(cfg.Problems) > 0 {
+		fmt.Printf("%d problem(s); the statusline uses the values shown after \"using\" and ignores the rest\n", len(cfg.Problems))
+		os.Exit(1)
+	}
+	fmt.Println("No problems found")
+}
+
+// handleDoctor runs the "doctor" command: a line per check of what the
+// statusline needs, exiting 1 if one fails
+func handleDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cfg := config.ParseArgs(fs, args)
+	config.ApplyProfile("")
+
+	failed := false
+	check := func(mark, format string, a ...any) {
+		failed = failed || mark == "✗"
+		fmt.Printf("%s %s\n", mark, fmt.Sprintf(format, a...))
+	}
+	check("✓", "claude-code-statusline %s (%s) built %s", version, commit, date)
+	if m := updater.InstalledBy(); m != nil {
+		check("✓", "Installed with %s, which updates it: %s", m.Name, m.Command)
+	}
+
+	if n := len(cfg.Problems); n > 0 {
+		check("✗", "%d configuration problem(s), see: claude-code-statusline config check", n)
+	} else {
+		check("✓", "Configuration: no problems")
+	}
+
+	self, err := os.Executable()
+	if err == nil {
+		self, err = filepath.EvalSymlinks(self)
+	}
+	if err == nil {
+		var result install.Result
+		result, err = install.Install(install.SettingsFile(), install.Command(self), true)
+		switch {
+		case err != nil:
+		case result.Previous == "":
+			check("✗", "No statusLine in %s, see: claude-code-statusline init", result.Path)
+		case result.Changed:
+			check("!", "Claude Code's statusLine runs %s, not %s", result.Previous, self)
+		default:
+			check("✓", "Claude Code's statusLine runs %s", self)
 		}
-		if arg == "--update" {
-			handleUpdate()
-			os.Exit(0)
+	}
+	if err != nil {
+		check("✗", "Can't read Claude Code's settings: %v", err)
+	}
+
+	if _, err := os.Stat(config.ProjectsDir()); err != nil {
+		check("✗", "No session logs in %s, costs can't be counted", config.ProjectsDir())
+	} else {
+		check("✓", "Session logs: %s", config.ProjectsDir())
+	}
+
+	if cfg.ReadOnly {
+		check("!", "CI mode: %s isn't written and nothing is fetched", config.CacheDir())
+	} else {
+		check("✓", "Cache: %s", config.CacheDir())
+		if cfg.Offline {
+			check("!", "Offline: usage comes from the cache, costs use the built-in pricing, no update checks")
 		}
 	}
 
-	cfg := config.Parse()
+	if _, err := daemon.Query(daemon.SocketPath(), daemonQueryTimeout); err == nil {
+		check("✓", "Daemon: running")
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// handlePricing runs the "pricing" subcommand
+func handlePricing(args []string) {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "Usage: claude-code-statusline pricing verify [--url URL]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("pricing verify", flag.ExitOnError)
+	url := fs.String("url", cost.PublishedPricingURL, "Pricing page to compare against")
+	config.ParseArgs(fs, args[1:])
 	cost.SetEmbeddedPricing(embeddedPricing)
 
+	published, err := cost.FetchPublishedPricing(*url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	embedded := cost.EmbeddedPricing()
+	drifts := cost.ComparePricing(embedded, published)
+	report.PricingDrift(os.Stdout, fmt.Sprintf("Embedded pricing (updated %s)", embedded.Updated), drifts)
+
+	// The cached remote copy is what's actually used when it's fresh
+	if active := cost.ActivePricing(); active.Updated != embedded.Updated {
+		activeDrifts := cost.ComparePricing(active, published)
+		report.PricingDrift(os.Stdout, fmt.Sprintf("Cached pricing (updated %s)", active.Updated), activeDrifts)
+		drifts = append(drifts, activeDrifts...)
+	}
+
+	if len(drifts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// runStatus runs the "status" command, the default: render the statusline
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("claude-code-statusline", flag.ExitOnError)
+	showVersion := fs.Bool("version", false, "Print the version and exit")
+	fs.BoolVar(showVersion, "v", false, "Print the version and exit")
+	update := fs.Bool("update", false, "Update to the latest release and exit (see: update)")
+	to := fs.String("to", "", "Version to install with --update, e.g. v1.4.2")
+	rollback := fs.Bool("rollback", false, "Reinstall the version the last update replaced and exit")
+	fs.Usage = statusUsage(fs)
+	cfg := config.ParseArgs(fs, args)
+	if *showVersion {
+		fmt.Printf("claude-code-statusline %s (%s) built %s\n", version, commit, date)
+		return
+	}
+	if *rollback {
+		rollbackBinary()
+		return
+	}
+	if *update || *to != "" {
+		updateBinary(*to)
+		return
+	}
+	cost.SetEmbeddedPricing(embeddedPricing)
+
+	// Legacy Windows consoles would print the escape codes literally
+	if !cfg.NoColor && !term.EnableColors(os.Stdout) {
+		cfg.NoColor = true
+	}
+
+	// Reproduce a recorded render without collecting anything
+	if cfg.Replay != "" {
+		b, err := bundle.Load(cfg.Replay)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(b.Replay())
+		return
+	}
+
 	// If installed via plugin, verify plugin is still installed
 	if !config.CheckRequiredPlugin() {
 		os.Exit(0) // Exit silently - plugin was uninstalled
 	}
 
+	// Pick the Claude account for the project Claude Code is working in,
+	// before the background jobs below use its cache directory. The daemon
+	// has no session input and serves the base account.
+	var sess *types.SessionInput
+	if !cfg.Daemon {
+		sess = session.ReadInput()
+		if sess != nil {
+			config.ApplyProfile(sess.Cwd)
+		} else {
+			config.ApplyProfile("")
+		}
+	}
+
 	// Check for updates once per day if auto-update is enabled (with jitter to avoid thundering herd)
-	if cfg.AutoUpdate {
-		go updater.CheckForUpdateDaily(version)
+	if cfg.AutoUpdate && cfg.UpdateChannel != "none" && !cfg.Offline {
+		go jobs.Run("update", func() { updater.CheckForUpdateDaily(version) })
+	}
+
+	// Anonymous feature-usage report, only when opted in
+	if enabled, _ := telemetry.Status(telemetryEndpoint); enabled {
+		go jobs.Run("telemetry", func() { telemetry.SendDaily(version, telemetryEndpoint) })
+	}
+
+	// Keep usage and cost data warm for other invocations
+	if cfg.Daemon {
+		if err := daemon.Run(daemon.SocketPath(), daemon.RefreshInterval, daemon.Collect); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Read session input from stdin (if available)
-	sess := session.ReadInput()
+	// Foreground colors readable on the terminal's background, unless a
+	// theme picks them
+	if !cfg.NoColor && (cfg.Theme == "" || cfg.Theme == "default") && (cfg.DisplayMode == "colors" || cfg.DisplayMode == "minimal") {
+		output.SetBackground(term.Background(cfg.Background))
+	}
+	output.SetTheme(cfg.Theme)
+	if !cfg.NoColor {
+		output.SetColorDepth(term.ColorDepth(cfg.ColorDepth))
+	}
 
-	// Parse transcript if path provided
-	var transcriptData *types.TranscriptData
-	if sess != nil && sess.TranscriptPath != "" {
-		transcriptData = transcript.Parse(sess.TranscriptPath)
+	// Record a bundle of this render for bug reports
+	if cfg.Record != "" {
+		data := collectData(sess)
+		fmt.Print(formatData(data))
+		b := bundle.New(bundle.RecordingArgs(args), data, time.Now())
+		if err := b.Save(cfg.Record); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Get all the status components
-	gitInfo := git.GetInfo()
-	usageData, subscription, tier, isApiBilling := usage.GetUsageAndSubscription()
-	tokenStats := cost.GetTokenStats()
+	// Explain mode always renders fresh and describes every segment
+	if cfg.Explain {
+		data := collectData(sess)
+		fmt.Println(output.Format(data))
+		fmt.Println()
+		output.Explain(os.Stdout, data)
+		return
+	}
 
-	// Format and output
-	out := output.FormatStatusLine(sess, gitInfo, usageData, tokenStats, subscription, tier, isApiBilling, transcriptData)
+	// Invocations with identical input (e.g. several tmux panes refreshing at
+	// once) share a single render
+	out := rendercache.Get(renderKey(sess), time.Duration(cfg.RenderCacheTTL)*time.Millisecond, func() string {
+		return render(sess)
+	})
 	fmt.Print(out)
+
+	// Close stdout so the output shows right away, then let collectors that
+	// missed the deadline finish their work
+	os.Stdout.Close()
+	waitPending(stragglerTimeout)
+}
+
+// render collects the status components needed by the enabled segments and
+// formats the statusline
+func render(sess *types.SessionInput) string {
+	data := collectData(sess)
+	if config.Get().OTLPEndpoint != "" {
+		collect(func() struct{} {
+			jobs.Run("otlp", func() { otlp.Push(version, data, time.Now()) })
+			return struct{}{}
+		})
+	}
+	return formatData(data)
+}
+
+// formatData renders collected data in the configured output format
+func formatData(data *types.StatusData) string {
+	if config.Get().Output == "json" {
+		return output.FormatJSON(data)
+	}
+	return output.Format(data)
+}
+
+// collectData gathers the components used by the enabled segments. They are
+// collected concurrently; any that miss the deadline are rendered from cached
+// data (or left out) and finish in the background, see waitPending.
+func collectData(sess *types.SessionInput) *types.StatusData {
+	cfg := config.Get()
+
+	var deadline time.Time
+	if cfg.Deadline > 0 {
+		deadline = time.Now().Add(time.Duration(cfg.Deadline) * time.Millisecond)
+	}
+
+	// Start every component that an enabled segment, or an expression
+	// segment, uses
+	var transcriptCh <-chan *types.TranscriptData
+	if sess != nil && sess.TranscriptPath != "" && (cfg.AnySegmentEnabled(config.TranscriptSegments...) || cfg.ExprReads(config.TranscriptSegments...)) {
+		transcriptCh = collect(func() *types.TranscriptData { return transcript.Parse(sess.TranscriptPath) })
+	}
+
+	// Claude Code reports the project it's working in, which needn't be
+	// where the statusline was started
+	var cwd string
+	if sess != nil {
+		cwd = sess.Cwd
+		if cwd == "" && sess.Workspace != nil {
+			cwd = sess.Workspace.CurrentDir
+		}
+	}
+
+	var gitCh <-chan types.GitInfo
+	if cfg.AnySegmentEnabled("git", "commits", "base") || cfg.ExprReads("git", "commits", "base") {
+		gitCh = collect(func() types.GitInfo { return git.GetInfoAt(cwd) })
+	}
+
+	// A running daemon keeps usage and cost data warm
+	wantUsage := cfg.AnySegmentEnabled("usage", "usage7d", "opus", "subscription") || cfg.ExprReads("usage", "subscription")
+	wantCost := cfg.AnySegmentEnabled("cost", "history", "session") || cfg.ExprReads("cost")
+	var snap *daemon.Snapshot
+	if cfg.UseDaemon && (wantUsage || wantCost) {
+		var err error
+		if snap, err = daemon.Query(daemon.SocketPath(), daemonQueryTimeout); err != nil {
+			config.DebugLog("No daemon: %v", err)
+			snap = nil
+		}
+	}
+
+	var usageCh <-chan usageResult
+	if wantUsage && snap != nil && snap.Usage != nil {
+		usageCh = ready(usageResult{snap.Usage, snap.Subscription, snap.Tier, snap.IsApiBilling})
+	} else if wantUsage {
+		usageCh = collect(func() usageResult {
+			var r usageResult
+			r.usage, r.subscription, r.tier, r.isApiBilling = usage.GetUsageAndSubscription()
+			return r
+		})
+	}
+
+	var customCh <-chan map[string]string
+	if len(cfg.CustomSegments) > 0 {
+		customCh = collect(func() map[string]string { return custom.Run(cwd) })
+	}
+
+	var statsCh <-chan *types.TokenStats
+	costRefreshing := false
+	if wantCost && snap != nil && snap.Stats != nil {
+		statsCh = ready(snap.Stats)
+	} else if wantCost && cfg.CostAsync {
+		// Stale-while-revalidate: render the costs as last scanned and bring
+		// them up to date for the next render, unless there's nothing yet
+		if stats, scanned := cost.SavedTokenStats(); scanned {
+			statsCh = ready(stats)
+			collect(func() struct{} { cost.Refresh(); return struct{}{} })
+			costRefreshing = true
+		} else {
+			statsCh = collect(cost.GetTokenStats)
+		}
+	} else if wantCost {
+		statsCh = collect(cost.GetTokenStats)
+	}
+
+	// Gather results, falling back for anything that misses the deadline
+	data := &types.StatusData{Cwd: cwd, Session: sess, Stats: &types.TokenStats{}, Profile: cfg.ActiveProfile, Sources: make(map[string]string)}
+	if sess != nil && sess.SessionID != "" && cfg.SegmentEnabled("note") {
+		// A small local file, not worth a collector
+		data.Note = notes.Latest(sess.SessionID)
+	}
+	if cfg.ProjectName && cfg.SegmentEnabled("dir") {
+		// A few small files up the tree, not worth a collector either
+		data.Project = project.Name(output.ShownDir(data))
+	}
+	started := time.Now()
+	if transcriptCh != nil {
+		data.Transcript = await(transcriptCh, deadline, started, data.Sources, "transcript", func() *types.TranscriptData { return nil })
+	}
+	if gitCh != nil {
+		data.Git = await(gitCh, deadline, started, data.Sources, "git", func() types.GitInfo { return types.GitInfo{} })
+	}
+	if usageCh != nil {
+		r := await(usageCh, deadline, started, data.Sources, "usage", func() usageResult { return usageResult{usage: usage.Cached()} })
+		data.Usage, data.Subscription, data.Tier, data.IsApiBilling = r.usage, r.subscription, r.tier, r.isApiBilling
+		usage.AnnotateProjections(data.Usage, time.Now())
+		if cfg.LimitNotify || cfg.UsageNotify != "" || cfg.ResetNotify || cfg.WebhookURL != "" {
+			// Webhooks can be slow, so alerts don't hold up the render
+			u := data.Usage
+			collect(func() struct{} { notify.CheckUsage(u, time.Now()); return struct{}{} })
+		}
+	}
+	if statsCh != nil {
+		data.Stats = await(statsCh, deadline, started, data.Sources, "cost", cost.CachedTokenStats)
+		if cfg.BudgetNotify || cfg.WebhookURL != "" {
+			stats := data.Stats
+			collect(func() struct{} { notify.CheckBudgets(stats, time.Now()); return struct{}{} })
+		}
+	}
+	if customCh != nil {
+		data.Custom = await(customCh, deadline, started, data.Sources, "custom", func() map[string]string { return custom.Cached(cwd) })
+	}
+	if snap != nil {
+		from := fmt.Sprintf("from daemon (refreshed %s ago)", time.Since(snap.UpdatedAt).Round(time.Second))
+		if snap.Usage != nil && usageCh != nil {
+			data.Sources["usage"] = from
+		}
+		if snap.Stats != nil && statsCh != nil {
+			data.Sources["cost"] = from
+		}
+	}
+	if costRefreshing {
+		data.Sources["cost"] = "as last scanned, rescanning in the background (--cost-async)"
+	}
+
+	return data
+}
+
+// usageResult bundles the values returned by usage.GetUsageAndSubscription
+type usageResult struct {
+	usage        *types.UsageCache
+	subscription string
+	tier         string
+	isApiBilling bool
+}
+
+// pending tracks component collectors that are still running
+var pending sync.WaitGroup
+
+// collect runs fn in the background and delivers its result on the channel
+func collect[T any](fn func() T) <-chan T {
+	ch := make(chan T, 1)
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		ch <- fn()
+	}()
+	return ch
+}
+
+// ready returns a channel already holding v, for results known up front
+func ready[T any](v T) <-chan T {
+	ch := make(chan T, 1)
+	ch <- v
+	return ch
+}
+
+// await returns the result from ch, or fallback() if it doesn't arrive
+// before deadline. A zero deadline waits indefinitely. How the result was
+// obtained is recorded in sources under name.
+func await[T any](ch <-chan T, deadline, started time.Time, sources map[string]string, name string, fallback func() T) T {
+	if deadline.IsZero() {
+		v := <-ch
+		sources[name] = fmt.Sprintf("collected in %s", time.Since(started).Round(time.Millisecond))
+		return v
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case v := <-ch:
+		sources[name] = fmt.Sprintf("collected in %s", time.Since(started).Round(time.Millisecond))
+		return v
+	case <-timer.C:
+		// Prefer a result that raced the timer
+		select {
+		case v := <-ch:
+			sources[name] = fmt.Sprintf("collected in %s", time.Since(started).Round(time.Millisecond))
+			return v
+		default:
+		}
+		config.WarnLog("%s missed the render deadline, using fallback", name)
+		sources[name] = fmt.Sprintf("missed the %s deadline, fell back to cached data", deadline.Sub(started).Round(time.Millisecond))
+		return fallback()
+	}
+}
+
+// waitPending gives collectors that missed the deadline up to timeout to
+// finish, so the caches they write are warm for the next render
+func waitPending(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		config.WarnLog("Collectors still running after %s, exiting", timeout)
+	}
+}
+
+// renderEnv are the environment variables besides CLAUDE_STATUS_* that
+// change the output
+var renderEnv = []string{"NO_COLOR", "TERM", "COLORTERM", "COLORFGBG", "TERM_PROGRAM", "WT_SESSION", "COLUMNS", "CI"}
+
+// renderKey identifies everything that makes one invocation's output differ
+// from another's: the session input, working directory, flags, environment,
+// options file and profile
+func renderKey(sess *types.SessionInput) string {
+	sessJSON, _ := json.Marshal(sess)
+	cwd, _ := os.Getwd()
+
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(key, "CLAUDE_STATUS_") || slices.Contains(renderEnv, key) {
+			env = append(env, kv)
+		}
+	}
+	slices.Sort(env)
+	options, _ := os.ReadFile(config.ConfigFile())
+
+	return rendercache.Key(string(sessJSON), cwd, strings.Join(os.Args[1:], " "),
+		strings.Join(env, "\n"), string(options), config.Get().ActiveProfile)
 }
@@ -11,6 +11,15 @@ if [ -z "$VERSION" ]; then
     exit 1
 fi
 
+# Check that the embedded pricing still matches the published rates
+if [ -z "$SKIP_PRICING_CHECK" ]; then
+    if ! go run . pricing verify; then
+        echo "pricing.json differs from the published pricing."
+        echo "Update pricing.json or rerun with SKIP_PRICING_CHECK=1 to release anyway."
+        exit 1
+    fi
+fi
+
 # Strip 'v' prefix for JSON files
 VERSION_NUM="${VERSION#v}"
 